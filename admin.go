@@ -0,0 +1,60 @@
+package gatego
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+	"github.com/hvuhsg/gatego/internal/drain"
+	"github.com/hvuhsg/gatego/internal/health"
+)
+
+// newAdminHandler create the admin api handler of the registries of the server
+//
+//	GET /health - health state of the health checked backend servers
+//	GET /circuit-breakers - state of the circuit breakers of the upstream servers
+//	GET /drain - draining state and in-flight requests of the backend servers
+//	POST /drain?backend=<backend>&url=<server url> - take a server out of the rotation, its in-flight requests complete
+//	DELETE /drain?backend=<backend>&url=<server url> - put a draining server back in the rotation
+func newAdminHandler(healthRegistry *health.Registry, breakers *circuitbreaker.Registry, drains *drain.Registry) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, healthRegistry.Statuses())
+	})
+
+	mux.HandleFunc("GET /circuit-breakers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, breakers.Statuses())
+	})
+
+	mux.HandleFunc("GET /drain", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, drains.Statuses())
+	})
+
+	mux.HandleFunc("POST /drain", setDraining(drains, true))
+	mux.HandleFunc("DELETE /drain", setDraining(drains, false))
+
+	return mux
+}
+
+// setDraining handle the draining of the server in the query
+func setDraining(drains *drain.Registry, draining bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend, url := r.URL.Query().Get("backend"), r.URL.Query().Get("url")
+
+		server := drains.Lookup(backend, url)
+		if server == nil {
+			http.Error(w, fmt.Sprintf("unknown server %s of backend <%s>", url, backend), http.StatusNotFound)
+			return
+		}
+
+		server.SetDraining(draining, "admin api")
+		writeJSON(w, server.Status())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
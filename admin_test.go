@@ -0,0 +1,122 @@
+package gatego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/drain"
+	"github.com/hvuhsg/gatego/internal/health"
+)
+
+func TestAdminHealth(t *testing.T) {
+	healthRegistry := health.NewRegistry()
+	healthRegistry.Register("admin.example.com/api", "http://10.0.0.1:8080", 1, 1).Report(errors.New("connection refused"))
+
+	rr := httptest.NewRecorder()
+	newAdminHandler(healthRegistry, circuitbreaker.NewRegistry(), drain.NewRegistry()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var statuses []health.Status
+	if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode the response: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.Backend == "admin.example.com/api" {
+			if status.Healthy || status.LastError != "connection refused" {
+				t.Errorf("Unexpected status %+v", status)
+			}
+			return
+		}
+	}
+
+	t.Errorf("Expected the server to be listed, got %+v", statuses)
+}
+
+func TestAdminCircuitBreakers(t *testing.T) {
+	failureRate := 0.5
+	breakers := circuitbreaker.NewRegistry()
+	breaker := breakers.Register("admin.example.com/orders", "http://10.0.0.1:8080", config.CircuitBreaker{FailureRate: &failureRate, Window: time.Minute, MinRequests: 1, OpenDuration: time.Minute, HalfOpenProbes: 1})
+	breaker.Allow(context.Background())
+	breaker.Report(context.Background(), true, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	newAdminHandler(health.NewRegistry(), breakers, drain.NewRegistry()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/circuit-breakers", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var statuses []circuitbreaker.Status
+	if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode the response: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.Backend == "admin.example.com/orders" {
+			if status.State != circuitbreaker.Open {
+				t.Errorf("Unexpected status %+v", status)
+			}
+			return
+		}
+	}
+
+	t.Errorf("Expected the circuit breaker to be listed, got %+v", statuses)
+}
+
+func TestAdminDrain(t *testing.T) {
+	drains := drain.NewRegistry()
+	server := drains.Register("admin.example.com/users", "http://10.0.0.1:8080", false, nil)
+	handler := newAdminHandler(health.NewRegistry(), circuitbreaker.NewRegistry(), drains)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		status   int
+		draining bool
+	}{
+		{"Drain", http.MethodPost, "/drain?backend=admin.example.com/users&url=http://10.0.0.1:8080", http.StatusOK, true},
+		{"Unknown server", http.MethodPost, "/drain?backend=admin.example.com/users&url=http://10.0.0.2:8080", http.StatusNotFound, true},
+		{"Back in the rotation", http.MethodDelete, "/drain?backend=admin.example.com/users&url=http://10.0.0.1:8080", http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.target, nil))
+
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d want %d", tt.name, rr.Code, tt.status)
+		}
+
+		if server.Draining() != tt.draining {
+			t.Errorf("%s: got draining %v want %v", tt.name, server.Draining(), tt.draining)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/drain", nil))
+
+	var statuses []drain.Status
+	if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode the response: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.Backend == "admin.example.com/users" {
+			return
+		}
+	}
+
+	t.Errorf("Expected the server to be listed, got %+v", statuses)
+}
@@ -1,29 +1,176 @@
 package gatego
 
 import (
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/handlers"
+	"github.com/hvuhsg/gatego/internal/health"
+	"github.com/hvuhsg/gatego/internal/streams"
 	"github.com/hvuhsg/gatego/pkg/monitor"
 )
 
-func createMonitorChecks(services []config.Service) []monitor.Check {
+// checksRunner run the checks and health checks of the services and streams, a reload that doesn't change
+// the checks keeps the running monitor (and its schedule)
+type checksRunner struct {
+	mu      sync.Mutex
+	monitor *monitor.Monitor // nil before the first run
+}
+
+// run start the monitor of the checks after delay and stop the previous monitor, the previous monitor is kept when the checks are unchanged
+func (cr *checksRunner) run(delay time.Duration, checks []monitor.Check) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.monitor != nil && sameChecks(cr.monitor.Checks, checks) {
+		return nil
+	}
+
+	checksMonitor := monitor.New(delay, checks...)
+	if err := checksMonitor.Start(); err != nil {
+		return err
+	}
+
+	if cr.monitor != nil {
+		cr.monitor.Stop()
+	}
+	cr.monitor = checksMonitor
+
+	return nil
+}
+
+// stop end the running checks
+func (cr *checksRunner) stop() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.monitor != nil {
+		cr.monitor.Stop()
+	}
+}
+
+// sameChecks compare the checks without their result callbacks (the health checks of a server report to the same state across reloads)
+func sameChecks(current []monitor.Check, next []monitor.Check) bool {
+	return slices.EqualFunc(current, next, func(a monitor.Check, b monitor.Check) bool {
+		a.OnResult, b.OnResult = nil, nil
+		return reflect.DeepEqual(a, b)
+	})
+}
+
+func createMonitorChecks(services []config.Service, streamsConfig []config.Stream, healthRegistry *health.Registry) []monitor.Check {
 	checks := make([]monitor.Check, 0)
 	for _, service := range services {
 		for _, path := range service.Paths {
 			for _, checkConfig := range path.Checks {
-				check := monitor.Check{
-					Name:      checkConfig.Name,
-					Cron:      checkConfig.Cron,
-					URL:       checkConfig.URL,
-					Method:    checkConfig.Method,
-					Timeout:   checkConfig.Timeout,
-					Headers:   checkConfig.Headers,
-					OnFailure: checkConfig.OnFailure,
+				checks = append(checks, newMonitorCheck(checkConfig))
+			}
+		}
+	}
+
+	for _, stream := range streamsConfig {
+		for _, checkConfig := range stream.Checks {
+			checks = append(checks, newMonitorCheck(checkConfig))
+		}
+	}
+
+	forEachBackend(services, streamsConfig, func(backendName string, backend config.Backend) {
+		checks = append(checks, newHealthChecks(healthRegistry, backendName, backend)...)
+	})
+
+	return checks
+}
+
+// forEachBackend call fn with the name and config of every backend of the services and streams
+func forEachBackend(services []config.Service, streamsConfig []config.Stream, fn func(backendName string, backend config.Backend)) {
+	for _, service := range services {
+		for _, path := range service.Paths {
+			if path.Backend != nil {
+				fn(handlers.BackendName(service, path, ""), *path.Backend)
+			}
+
+			if path.Split != nil {
+				for _, target := range path.Split.Targets {
+					if target.Backend != nil {
+						fn(handlers.BackendName(service, path, target.Name), *target.Backend)
+					}
 				}
+			}
+		}
+	}
 
-				checks = append(checks, check)
+	for _, stream := range streamsConfig {
+		if stream.Backend != nil {
+			fn(stream.Name, *stream.Backend)
+		}
+
+		for _, route := range stream.SNI {
+			fn(streams.SNIBackendName(stream, route), route.Backend)
+		}
+	}
+}
+
+// backendNames return the names of the backends and destinations of the services and streams
+func backendNames(services []config.Service, streamsConfig []config.Stream) []string {
+	names := make([]string, 0)
+	for _, service := range services {
+		for _, path := range service.Paths {
+			names = append(names, handlers.BackendName(service, path, ""))
+
+			if path.Split != nil {
+				for _, target := range path.Split.Targets {
+					names = append(names, handlers.BackendName(service, path, target.Name))
+				}
 			}
 		}
 	}
 
+	forEachBackend(nil, streamsConfig, func(backendName string, _ config.Backend) {
+		names = append(names, backendName)
+	})
+
+	return names
+}
+
+func newMonitorCheck(checkConfig config.Check) monitor.Check {
+	return monitor.Check{
+		Name:      checkConfig.Name,
+		Cron:      checkConfig.Cron,
+		URL:       checkConfig.URL,
+		Method:    checkConfig.Method,
+		Timeout:   checkConfig.Timeout,
+		Headers:   checkConfig.Headers,
+		OnFailure: checkConfig.OnFailure,
+	}
+}
+
+// newHealthChecks create a check per backend server that reports to the server health state in the registry
+func newHealthChecks(healthRegistry *health.Registry, backendName string, backend config.Backend) []monitor.Check {
+	if backend.HealthCheck == nil {
+		return nil
+	}
+
+	healthCheck := backend.HealthCheck
+	checks := make([]monitor.Check, 0, len(backend.Servers))
+	for _, server := range backend.Servers {
+		checkURL := server.URL
+		if !strings.HasPrefix(server.URL, "tcp://") {
+			checkURL = strings.TrimSuffix(server.URL, "/") + healthCheck.Path
+		}
+
+		checks = append(checks, monitor.Check{
+			Name:     backendName + " " + server.URL,
+			URL:      checkURL,
+			Method:   healthCheck.Method,
+			Timeout:  healthCheck.Timeout,
+			Headers:  healthCheck.Headers,
+			Interval: healthCheck.Interval,
+			OnResult: handlers.ServerHealth(healthRegistry, backendName, backend, server.URL).Report,
+		})
+	}
+
 	return checks
 }
@@ -0,0 +1,79 @@
+package gatego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/health"
+	"github.com/hvuhsg/gatego/pkg/monitor"
+)
+
+func TestCreateMonitorChecksHealthChecks(t *testing.T) {
+	backend := &config.Backend{
+		BalancePolicy: "round-robin",
+		Servers: []config.BackendServer{
+			{URL: "http://10.0.0.1:8080/", Weight: 1},
+			{URL: "http://10.0.0.2:8080", Weight: 1},
+		},
+		HealthCheck: &config.HealthCheck{Path: "/healthz", Method: "GET", HealthyThreshold: 1, UnhealthyThreshold: 1},
+	}
+
+	services := []config.Service{{Domain: "checks.example.com", Paths: []config.Path{{Path: "/api", Backend: backend}}}}
+
+	checks := createMonitorChecks(services, nil, health.NewRegistry())
+	if len(checks) != 2 {
+		t.Fatalf("Expected a health check per server, got %d checks", len(checks))
+	}
+
+	expectedURLs := []string{"http://10.0.0.1:8080/healthz", "http://10.0.0.2:8080/healthz"}
+	for i, check := range checks {
+		if check.URL != expectedURLs[i] {
+			t.Errorf("check %d url got %s want %s", i, check.URL, expectedURLs[i])
+		}
+
+		if check.OnResult == nil {
+			t.Errorf("check %d doesn't report its result", i)
+		}
+	}
+}
+
+func TestChecksRunnerKeepsUnchangedChecks(t *testing.T) {
+	runner := &checksRunner{}
+	defer runner.stop()
+
+	check := monitor.Check{Name: "api", URL: "http://10.0.0.1:8080/healthz", Method: "GET", Interval: time.Hour, OnResult: func(err error) {}}
+	if err := runner.run(time.Hour, []monitor.Check{check}); err != nil {
+		t.Fatalf("Failed to run the checks: %v", err)
+	}
+	running := runner.monitor
+
+	// Reloaded with the same checks (new result callbacks)
+	check.OnResult = func(err error) {}
+	if err := runner.run(time.Hour, []monitor.Check{check}); err != nil {
+		t.Fatalf("Failed to run the checks: %v", err)
+	}
+
+	if runner.monitor != running {
+		t.Error("Expected the running monitor to be kept when the checks are unchanged")
+	}
+
+	check.Interval = time.Minute
+	if err := runner.run(time.Hour, []monitor.Check{check}); err != nil {
+		t.Fatalf("Failed to run the checks: %v", err)
+	}
+
+	if runner.monitor == running {
+		t.Error("Expected a new monitor for the changed checks")
+	}
+
+	// An invalid check keeps the running monitor
+	changed := runner.monitor
+	if err := runner.run(time.Hour, []monitor.Check{{Name: "invalid", Cron: "invalid"}}); err == nil {
+		t.Error("Expected an error for an invalid cron expression")
+	}
+
+	if runner.monitor != changed {
+		t.Error("Expected the running monitor to be kept when the checks fail to start")
+	}
+}
@@ -0,0 +1,212 @@
+package gatego
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/discovery"
+	"github.com/hvuhsg/gatego/internal/docker"
+	"github.com/hvuhsg/gatego/internal/kubernetes"
+)
+
+// dynamicConfig assemble the config from the config providers. The local config is the base, the value of the consul config key
+// replaces it (keeping the provider blocks of the local config), and the services of the consul prefix keys, of the
+// kubernetes routes and of the docker containers are added to its services
+type dynamicConfig struct {
+	base    config.Config
+	version string
+
+	mu                 sync.Mutex
+	consulDocument     []byte            // Value of the consul config key, nil when unset
+	consulServices     map[string][]byte // Consul prefix key to service
+	kubernetesServices []config.Service
+	dockerServices     []config.Service
+}
+
+// hasProviders report if part of the config is loaded from a config provider
+func hasProviders(c config.Config) bool {
+	consul := c.Consul != nil && (c.Consul.ConfigKey != "" || c.Consul.ServicesPrefix != "")
+	kubernetes := c.Kubernetes != nil && (c.Kubernetes.Ingress || c.Kubernetes.HTTPRoutes)
+
+	return consul || kubernetes || c.Docker != nil
+}
+
+func (dc *dynamicConfig) setConsulDocument(document []byte) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.consulDocument = document
+}
+
+func (dc *dynamicConfig) setConsulServices(services map[string][]byte) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.consulServices = services
+}
+
+func (dc *dynamicConfig) setKubernetesServices(services []config.Service) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.kubernetesServices = services
+}
+
+func (dc *dynamicConfig) setDockerServices(services []config.Service) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.dockerServices = services
+}
+
+func (dc *dynamicConfig) build() (config.Config, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	c := dc.base
+	if dc.consulDocument != nil {
+		parsed, err := config.Parse(dc.consulDocument, dc.version)
+		if err != nil {
+			return config.Config{}, fmt.Errorf("consul key %s: %w", dc.base.Consul.ConfigKey, err)
+		}
+
+		parsed.Consul = dc.base.Consul
+		parsed.Kubernetes = dc.base.Kubernetes
+		parsed.Docker = dc.base.Docker
+		c = parsed
+	}
+
+	// Sorted for a stable order of the services
+	keys := make([]string, 0, len(dc.consulServices))
+	for key, value := range dc.consulServices {
+		// Empty keys are placeholders
+		if strings.TrimSpace(string(value)) != "" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	services := slices.Clone(c.Services)
+	for _, key := range keys {
+		service, err := config.ParseService(dc.consulServices[key])
+		if err != nil {
+			return config.Config{}, fmt.Errorf("consul key %s: %w", key, err)
+		}
+
+		services = append(services, service)
+	}
+
+	// The hosts of the config win over the hosts of the cluster, and the hosts of the cluster over the hosts of the containers
+	services = addDiscovered(services, dc.kubernetesServices, "Kubernetes routes")
+	services = addDiscovered(services, dc.dockerServices, "Docker containers")
+	c.Services = services
+
+	if err := c.Validate(dc.version); err != nil {
+		return config.Config{}, err
+	}
+
+	return c, nil
+}
+
+// addDiscovered add the discovered services whose host isn't served yet
+func addDiscovered(services []config.Service, discovered []config.Service, source string) []config.Service {
+	for _, service := range discovered {
+		if slices.ContainsFunc(services, func(s config.Service) bool { return strings.EqualFold(s.Domain, service.Domain) }) {
+			log.Default().Printf("%s of %s skipped: the host is already served\n", source, service.Domain)
+			continue
+		}
+
+		services = append(services, service)
+	}
+
+	return services
+}
+
+// loadDynamicConfig load the config from the config providers of the local config and keep watching them (until ctx is done),
+// the config is passed to reload on every change. An invalid config is logged and the running config is kept
+func loadDynamicConfig(ctx context.Context, base config.Config, version string, reload func(config.Config)) (config.Config, error) {
+	dc := &dynamicConfig{base: base, version: version}
+
+	// Reloads start after the first config is built, reloadMu keep the reloads in the order of the changes
+	var loaded atomic.Bool
+	var reloadMu sync.Mutex
+	changed := func() {
+		if !loaded.Load() {
+			return
+		}
+
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		newConfig, err := dc.build()
+		if err != nil {
+			log.Default().Printf("Config is invalid, keeping the running config: %s\n", err.Error())
+			return
+		}
+
+		reload(newConfig)
+	}
+
+	if base.Consul != nil {
+		if err := watchConsul(ctx, dc, *base.Consul, changed); err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	if base.Kubernetes != nil && (base.Kubernetes.Ingress || base.Kubernetes.HTTPRoutes) {
+		client, err := kubernetes.NewClient(*base.Kubernetes)
+		if err != nil {
+			return config.Config{}, err
+		}
+
+		err = kubernetes.WatchRoutes(ctx, client, *base.Kubernetes, func(services []config.Service) {
+			dc.setKubernetesServices(services)
+			changed()
+		})
+		if err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	if base.Docker != nil {
+		err := docker.NewClient(*base.Docker).Watch(ctx, func(services []config.Service) {
+			dc.setDockerServices(services)
+			changed()
+		})
+		if err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	loaded.Store(true)
+	return dc.build()
+}
+
+// watchConsul watch the config key and the services prefix of the consul kv store
+func watchConsul(ctx context.Context, dc *dynamicConfig, consul config.Consul, changed func()) error {
+	kv := discovery.NewConsulKV(consul)
+
+	if key := consul.ConfigKey; key != "" {
+		err := kv.Watch(ctx, key, false, func(values map[string][]byte) {
+			dc.setConsulDocument(values[key])
+			changed()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if prefix := consul.ServicesPrefix; prefix != "" {
+		err := kv.Watch(ctx, prefix, true, func(values map[string][]byte) {
+			dc.setConsulServices(values)
+			changed()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package gatego
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestDynamicConfigBuild(t *testing.T) {
+	base := config.Config{
+		Version: "0.0.1",
+		Host:    "0.0.0.0",
+		Port:    8080,
+		Consul:  &config.Consul{Address: "127.0.0.1:8500", ConfigKey: "gatego/config", ServicesPrefix: "gatego/services/"},
+		Services: []config.Service{
+			{Domain: "local.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Body: "local"}}}},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		document         []byte
+		services         map[string][]byte
+		kubernetes       []config.Service
+		docker           []config.Service
+		expectedDomains  []string
+		expectedPort     uint16
+		expectedErrorMsg string
+	}{
+		{
+			name:            "Local config only",
+			expectedDomains: []string{"local.example.com"},
+			expectedPort:    8080,
+		},
+		{
+			name: "Prefix services are added in key order",
+			services: map[string][]byte{
+				"gatego/services/web":   []byte("domain: www.example.com\npaths:\n  - path: /\n    respond:\n      body: web"),
+				"gatego/services/api":   []byte("domain: api.example.com\npaths:\n  - path: /\n    respond:\n      body: api"),
+				"gatego/services/empty": []byte(""),
+			},
+			expectedDomains: []string{"local.example.com", "api.example.com", "www.example.com"},
+			expectedPort:    8080,
+		},
+		{
+			name:            "Config key replaces the local config",
+			document:        []byte("version: 0.0.1\nhost: 0.0.0.0\nport: 9090\nservices:\n  - domain: remote.example.com\n    paths:\n      - path: /\n        respond:\n          body: remote"),
+			expectedDomains: []string{"remote.example.com"},
+			expectedPort:    9090,
+		},
+		{
+			name: "Kubernetes services are added after the config hosts",
+			kubernetes: []config.Service{
+				{Domain: "Local.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Body: "cluster"}}}},
+				{Domain: "shop.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Body: "shop"}}}},
+			},
+			expectedDomains: []string{"local.example.com", "shop.example.com"},
+			expectedPort:    8080,
+		},
+		{
+			name:       "Docker services are added after the cluster hosts",
+			kubernetes: []config.Service{{Domain: "shop.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Body: "shop"}}}}},
+			docker: []config.Service{
+				{Domain: "shop.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Body: "container"}}}},
+				{Domain: "dev.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Body: "dev"}}}},
+			},
+			expectedDomains: []string{"local.example.com", "shop.example.com", "dev.example.com"},
+			expectedPort:    8080,
+		},
+		{
+			name:             "Invalid prefix service",
+			services:         map[string][]byte{"gatego/services/bad": []byte("domain: not a domain")},
+			expectedErrorMsg: "invalid domain",
+		},
+		{
+			name:             "Invalid config key",
+			document:         []byte("version: 0.0.1\nport: 9090"),
+			expectedErrorMsg: "consul key gatego/config: host is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dc := &dynamicConfig{base: base, version: "0.0.1"}
+			dc.setConsulDocument(tt.document)
+			dc.setConsulServices(tt.services)
+			dc.setKubernetesServices(tt.kubernetes)
+			dc.setDockerServices(tt.docker)
+
+			c, err := dc.build()
+			if tt.expectedErrorMsg != "" {
+				if err == nil || err.Error() != tt.expectedErrorMsg {
+					t.Fatalf("Expected error %q, got %v", tt.expectedErrorMsg, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("build failed: %v", err)
+			}
+
+			if len(c.Services) != len(tt.expectedDomains) {
+				t.Fatalf("Expected %d services, got %d", len(tt.expectedDomains), len(c.Services))
+			}
+
+			for i, domain := range tt.expectedDomains {
+				if c.Services[i].Domain != domain {
+					t.Errorf("Expected service %d to be %s, got %s", i, domain, c.Services[i].Domain)
+				}
+			}
+
+			if c.Port != tt.expectedPort {
+				t.Errorf("Expected port %d, got %d", tt.expectedPort, c.Port)
+			}
+
+			if c.Consul != base.Consul {
+				t.Error("Expected the consul block of the local config to be kept")
+			}
+		})
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	cfg := config.Config{
+		Host: "127.0.0.1",
+		Port: 8080,
+		Services: []config.Service{
+			{Domain: "example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Status: http.StatusOK, Body: "before"}}}},
+		},
+	}
+
+	server, err := newServer(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	// Helper function to send a request to the routes of the server
+	get := func(host string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+		return rr
+	}
+
+	if rr := get("example.com"); rr.Body.String() != "before" {
+		t.Fatalf("Expected the body before the reload, got %q", rr.Body.String())
+	}
+
+	cfg.Services = []config.Service{
+		{Domain: "example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Status: http.StatusOK, Body: "after"}}}},
+		{Domain: "api.example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Status: http.StatusOK, Body: "api"}}}},
+	}
+
+	if err := server.reload(cfg); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	if rr := get("example.com"); rr.Body.String() != "after" {
+		t.Errorf("Expected the body after the reload, got %q", rr.Body.String())
+	}
+
+	if rr := get("api.example.com"); rr.Body.String() != "api" {
+		t.Errorf("Expected the added service to be served, got %q", rr.Body.String())
+	}
+}
+
+func TestServerReloadHealthChecks(t *testing.T) {
+	checked := make(chan string, 10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case checked <- r.URL.Path:
+		default:
+		}
+	}))
+	defer upstream.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.Config{
+		Host: "127.0.0.1",
+		Port: 8080,
+		Services: []config.Service{
+			{Domain: "example.com", Paths: []config.Path{{Path: "/", Respond: &config.Respond{Status: http.StatusOK, Body: "before"}}}},
+		},
+	}
+
+	server, err := newServer(ctx, cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	server.checksDelay = 0
+
+	healthCheck := &config.HealthCheck{Path: "/healthz", Method: http.MethodGet, Interval: 10 * time.Millisecond, Timeout: time.Second, HealthyThreshold: 1, UnhealthyThreshold: 1}
+	cfg.Services = []config.Service{
+		{Domain: "example.com", Paths: []config.Path{{Path: "/", Backend: &config.Backend{
+			BalancePolicy: "round-robin",
+			Servers:       []config.BackendServer{{URL: upstream.URL, Weight: 1}},
+			HealthCheck:   healthCheck,
+		}}}},
+	}
+
+	if err := server.reload(cfg); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	select {
+	case path := <-checked:
+		if path != "/healthz" {
+			t.Errorf("Expected the health check path, got %q", path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the health check of the reloaded backend to run")
+	}
+}
+
+func TestServerReloadPrunesRemovedBackends(t *testing.T) {
+	backend := &config.Backend{
+		BalancePolicy: "round-robin",
+		Servers:       []config.BackendServer{{URL: "http://10.0.0.1:8080", Weight: 1}},
+		HealthCheck:   &config.HealthCheck{Path: "/healthz", Method: http.MethodGet, Interval: time.Minute, Timeout: time.Second, HealthyThreshold: 1, UnhealthyThreshold: 1},
+	}
+	destination := "http://10.0.0.2:8080"
+	failureRate := 0.5
+	circuitBreaker := &config.CircuitBreaker{FailureRate: &failureRate, Window: time.Minute, MinRequests: 1, OpenDuration: time.Minute, HalfOpenProbes: 1}
+	cfg := config.Config{
+		Host: "127.0.0.1",
+		Port: 8080,
+		Services: []config.Service{
+			{Domain: "example.com", Paths: []config.Path{
+				{Path: "/api", Backend: backend},
+				{Path: "/users", Backend: backend},
+				{Path: "/orders", Destination: &destination, CircuitBreaker: circuitBreaker},
+				{Path: "/payments", Destination: &destination, CircuitBreaker: circuitBreaker},
+			}},
+		},
+	}
+
+	server, err := newServer(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	cfg.Services = []config.Service{
+		{Domain: "example.com", Paths: []config.Path{
+			{Path: "/api", Backend: backend},
+			{Path: "/orders", Destination: &destination, CircuitBreaker: circuitBreaker},
+		}},
+	}
+
+	if err := server.reload(cfg); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	healthStatuses := server.registries.Health.Statuses()
+	if len(healthStatuses) != 1 || healthStatuses[0].Backend != "example.com/api" {
+		t.Errorf("Expected only the health state of the kept backend, got %+v", healthStatuses)
+	}
+
+	breakerStatuses := server.registries.Breakers.Statuses()
+	if len(breakerStatuses) != 1 || breakerStatuses[0].Backend != "example.com/orders" {
+		t.Errorf("Expected only the circuit breaker of the kept destination, got %+v", breakerStatuses)
+	}
+
+	drainStatuses := server.registries.Drain.Statuses()
+	if len(drainStatuses) != 1 || drainStatuses[0].Backend != "example.com/api" {
+		t.Errorf("Expected only the draining state of the kept backend, got %+v", drainStatuses)
+	}
+}
+
+func TestRestartOnlyChanges(t *testing.T) {
+	current := config.Config{Host: "0.0.0.0", Port: 8080, Zone: "eu-west-1a"}
+
+	next := current
+	next.Zone = "eu-west-1b"
+	next.Services = []config.Service{{Domain: "example.com"}}
+	if changes := restartOnlyChanges(current, next); len(changes) != 0 {
+		t.Errorf("Expected the reloaded fields to be applied, got changes %v", changes)
+	}
+
+	next.Port = 9090
+	next.Admin = &config.Admin{Listen: "127.0.0.1:9000"}
+	if changes := restartOnlyChanges(current, next); !slices.Equal(changes, []string{"port", "admin"}) {
+		t.Errorf("Expected the port and admin changes, got %v", changes)
+	}
+}
@@ -0,0 +1,106 @@
+package gatego
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/errorpages"
+	"github.com/hvuhsg/gatego/pkg/multimux"
+)
+
+// newErrorRenderer merge the error pages of the config levels (global, service, endpoint),
+// later levels override earlier ones. Returns nil when none of the levels is configured.
+func newErrorRenderer(levels ...*config.ErrorPages) (*errorpages.Renderer, error) {
+	configured := false
+	problemJSON := false
+	pages := make(map[string]errorpages.Page)
+
+	for _, level := range levels {
+		if level == nil {
+			continue
+		}
+		configured = true
+
+		if level.ProblemJSON != nil {
+			problemJSON = *level.ProblemJSON
+		}
+
+		for key, pageConfig := range level.Pages {
+			page, err := newErrorPage(pageConfig)
+			if err != nil {
+				return nil, err
+			}
+			pages[key] = page
+		}
+	}
+
+	if !configured {
+		return nil, nil
+	}
+
+	return errorpages.New(pages, problemJSON), nil
+}
+
+func newErrorPage(pageConfig config.ErrorPage) (errorpages.Page, error) {
+	body := pageConfig.Body
+	if pageConfig.BodyFile != "" {
+		content, err := os.ReadFile(pageConfig.BodyFile)
+		if err != nil {
+			return errorpages.Page{}, err
+		}
+		body = string(content)
+	}
+
+	contentType := pageConfig.ContentType
+	if contentType == "" && pageConfig.BodyFile != "" {
+		contentType = mime.TypeByExtension(filepath.Ext(pageConfig.BodyFile))
+	}
+	if contentType == "" {
+		if json.Valid([]byte(body)) {
+			contentType = "application/json"
+		} else {
+			contentType = http.DetectContentType([]byte(body))
+		}
+	}
+
+	return errorpages.Page{ContentType: contentType, Body: body}, nil
+}
+
+// newMultiMuxErrorHandler render the multimux errors (unknown host / path) with the error pages
+// of the matched service, or the global error pages when no service matched.
+// Returns nil when no error pages are configured (multimux default errors).
+func newMultiMuxErrorHandler(services []config.Service, globalErrorPages *config.ErrorPages) (func(http.ResponseWriter, *http.Request, int), error) {
+	globalRenderer, err := newErrorRenderer(globalErrorPages)
+	if err != nil {
+		return nil, err
+	}
+
+	configured := globalRenderer != nil
+	renderers := map[string]*errorpages.Renderer{"": globalRenderer}
+	for _, service := range services {
+		renderer, err := newErrorRenderer(globalErrorPages, service.ErrorPages)
+		if err != nil {
+			return nil, err
+		}
+
+		configured = configured || renderer != nil
+		renderers[strings.ToLower(service.Domain)] = renderer
+		if service.Default {
+			renderers[multimux.DefaultPattern] = renderer
+		}
+	}
+
+	if !configured {
+		return nil, nil
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, status int) {
+		renderer := renderers[multimux.MatchedPattern(r.Context())]
+		renderer.Write(w, r, status, http.StatusText(status))
+	}, nil
+}
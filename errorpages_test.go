@@ -0,0 +1,50 @@
+package gatego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestNewErrorRenderer(t *testing.T) {
+	enabled, disabled := true, false
+
+	global := &config.ErrorPages{ProblemJSON: &enabled, Pages: map[string]config.ErrorPage{"404": {Body: "global 404"}, "502": {Body: "global 502"}}}
+	service := &config.ErrorPages{Pages: map[string]config.ErrorPage{"404": {Body: "<p>service 404</p>"}}}
+	endpoint := &config.ErrorPages{ProblemJSON: &disabled}
+
+	renderer, err := newErrorRenderer(nil, nil)
+	if err != nil || renderer != nil {
+		t.Fatalf("Expected no renderer without error pages, got %v %v", renderer, err)
+	}
+
+	renderer, err = newErrorRenderer(global, service, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status              int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{http.StatusNotFound, "text/html; charset=utf-8", "<p>service 404</p>"},
+		{http.StatusBadGateway, "text/plain; charset=utf-8", "global 502"},
+		{http.StatusGatewayTimeout, "text/plain; charset=utf-8", "Gateway Timeout\n"}, // problem json disabled by the endpoint
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		renderer.Write(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.status, http.StatusText(tt.status))
+
+		if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+			t.Errorf("status %d wrong content type: got %v want %v", tt.status, contentType, tt.expectedContentType)
+		}
+
+		if rr.Body.String() != tt.expectedBody {
+			t.Errorf("status %d wrong body: got %q want %q", tt.status, rr.Body.String(), tt.expectedBody)
+		}
+	}
+}
@@ -3,27 +3,46 @@ package gatego
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/hvuhsg/gatego/internal/config"
 	"github.com/hvuhsg/gatego/internal/contextvalues"
-	"github.com/hvuhsg/gatego/pkg/monitor"
 )
 
 const serviceName = "gatego"
 
 type GateGo struct {
 	config  config.Config
-	monitor *monitor.Monitor
 	ctx     context.Context
+	version string
 }
 
 func New(ctx context.Context, config config.Config, version string) *GateGo {
 	ctx = contextvalues.AddVersionToContext(ctx, version)
-	return &GateGo{config: config, ctx: ctx}
+	return &GateGo{config: config, ctx: ctx, version: version}
 }
 
 func (gg GateGo) Run() error {
+	// The newest config of the config providers, replaced when not yet applied
+	reloads := make(chan config.Config, 1)
+
+	if hasProviders(gg.config) {
+		dynamicConfig, err := loadDynamicConfig(gg.ctx, gg.config, gg.version, func(newConfig config.Config) {
+			select {
+			case <-reloads:
+			default:
+			}
+			reloads <- newConfig
+		})
+		if err != nil {
+			return err
+		}
+
+		gg.config = dynamicConfig
+		log.Default().Println("Config loaded from the config providers")
+	}
+
 	useOtel := gg.config.OTEL != nil
 	if useOtel {
 		otelConfig := otelConfig{
@@ -41,11 +60,6 @@ func (gg GateGo) Run() error {
 		defer shutdown(context.Background())
 	}
 
-	// Create checks start monitoring
-	healthChecks := createMonitorChecks(gg.config.Services)
-	gg.monitor = monitor.New(time.Second*5, healthChecks...)
-	gg.monitor.Start()
-
 	server, err := newServer(gg.ctx, gg.config, useOtel)
 	if err != nil {
 		return err
@@ -58,11 +72,19 @@ func (gg GateGo) Run() error {
 	}
 
 	// Wait for interruption.
-	select {
-	case err = <-serveErrChan:
-		return err
-	case <-gg.ctx.Done():
-		fmt.Println("\nShutting down...")
-		return server.Shutdown(context.Background())
+	for {
+		select {
+		case err = <-serveErrChan:
+			return err
+		case newConfig := <-reloads:
+			if err := server.reload(newConfig); err != nil {
+				log.Default().Printf("Failed to reload the config, keeping the running config: %s\n", err.Error())
+				continue
+			}
+			log.Default().Println("Config reloaded")
+		case <-gg.ctx.Done():
+			fmt.Println("\nShutting down...")
+			return server.Shutdown(context.Background())
+		}
 	}
 }
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"regexp"
 	"slices"
 
 	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/errorpages"
 	"github.com/hvuhsg/gatego/internal/handlers"
 	"github.com/hvuhsg/gatego/internal/middlewares"
 	"github.com/hvuhsg/gatego/internal/middlewares/security"
@@ -15,22 +17,69 @@ import (
 
 var ErrUnsupportedBaseHandler = errors.New("base handler unsupported")
 
-func GetBaseHandler(service config.Service, path config.Path) (http.Handler, error) {
+func GetBaseHandler(ctx context.Context, service config.Service, path config.Path, instance handlers.Instance) (http.Handler, error) {
 	if path.Destination != nil && *path.Destination != "" {
-		return handlers.NewProxy(service, path)
+		return handlers.NewProxy(service, path, instance)
 	} else if path.Directory != nil && *path.Directory != "" {
 		handler := handlers.NewFiles(*path.Directory, path.Path)
 		return handler, nil
 	} else if path.Backend != nil {
-		return handlers.NewBalancer(service, path)
+		return handlers.NewBalancer(ctx, service, path, instance)
+	} else if path.Redirect != nil {
+		return handlers.NewRedirect(*path.Redirect, path.Path), nil
+	} else if path.Respond != nil {
+		return handlers.NewRespond(*path.Respond)
+	} else if path.Split != nil {
+		return handlers.NewSplit(ctx, service, path, instance)
 	} else {
 		// Should not be reached (early validation should prevent it)
 		return nil, ErrUnsupportedBaseHandler
 	}
 }
 
-func NewHandler(ctx context.Context, useOtel bool, service config.Service, path config.Path) (http.Handler, error) {
-	handler, err := GetBaseHandler(service, path)
+func newRewriteConfig(path config.Path) middlewares.RewriteConfig {
+	rules := make([]middlewares.RewriteRule, 0, len(path.Rewrite))
+	for _, rewrite := range path.Rewrite {
+		rules = append(rules, middlewares.RewriteRule{
+			Regex:       regexp.MustCompile(rewrite.Regex), // Validated with the config
+			Replacement: rewrite.Replacement,
+		})
+	}
+
+	return middlewares.RewriteConfig{StripPrefix: path.StripPrefix, AddPrefix: path.AddPrefix, Rules: rules, PathVariables: middlewares.PathVariables(path.Path)}
+}
+
+func newMirrorConfig(mirror config.Mirror, maxBodySize uint64) middlewares.MirrorConfig {
+	percentage := 100.0
+	if mirror.Percentage != nil {
+		percentage = *mirror.Percentage
+	}
+
+	mirrorConfig := middlewares.MirrorConfig{
+		URL:            mirror.URL,
+		Percentage:     percentage,
+		MaxConcurrency: mirror.MaxConcurrency,
+		QueueSize:      mirror.QueueSize,
+		DropOldest:     mirror.DropPolicy == "drop-oldest",
+		Timeout:        mirror.Timeout,
+		MaxBodySize:    maxBodySize,
+	}
+
+	if mirror.Diff != nil {
+		mirrorConfig.Diff = &middlewares.MirrorDiffConfig{
+			Headers:      mirror.Diff.Headers,
+			IgnoreFields: mirror.Diff.IgnoreFields,
+			SamplesFile:  mirror.Diff.SamplesFile,
+			MaxSamples:   mirror.Diff.MaxSamples,
+		}
+	}
+
+	return mirrorConfig
+}
+
+// NewHandler create the endpoint handler with its middlewares, errorRenderer may be nil (plain text errors)
+func NewHandler(ctx context.Context, useOtel bool, service config.Service, path config.Path, instance handlers.Instance, errorRenderer *errorpages.Renderer) (http.Handler, error) {
+	handler, err := GetBaseHandler(ctx, service, path, instance)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +88,11 @@ func NewHandler(ctx context.Context, useOtel bool, service config.Service, path
 
 	handlerWithMiddlewares.Add(middlewares.NewLoggingMiddleware(os.Stdout))
 
+	// Custom error responses
+	if errorRenderer != nil {
+		handlerWithMiddlewares.Add(middlewares.NewErrorPagesMiddleware(errorRenderer))
+	}
+
 	// Open Telemetry
 	if useOtel {
 		otelMiddleware, err := middlewares.NewOpenTelemetryMiddleware(
@@ -88,7 +142,7 @@ func NewHandler(ctx context.Context, useOtel bool, service config.Service, path
 
 	// Add headers
 	if path.Headers != nil {
-		handlerWithMiddlewares.Add(middlewares.NewAddHeadersMiddleware(*path.Headers))
+		handlerWithMiddlewares.Add(middlewares.NewAddHeadersMiddleware(*path.Headers, path.Path))
 	}
 
 	// GZIP compression
@@ -127,5 +181,19 @@ func NewHandler(ctx context.Context, useOtel bool, service config.Service, path
 		handlerWithMiddlewares.Add(middlewares.NewCacheMiddleware())
 	}
 
+	// Rewrite path (last, so the middlewares before see the original path)
+	if path.StripPrefix != "" || path.AddPrefix != "" || len(path.Rewrite) > 0 {
+		handlerWithMiddlewares.Add(middlewares.NewRewriteMiddleware(newRewriteConfig(path)))
+	}
+
+	// Mirror (after the rewrite, the mirror gets the request sent upstream)
+	if path.Mirror != nil {
+		mirrorMiddleware, err := middlewares.NewMirrorMiddleware(ctx, newMirrorConfig(*path.Mirror, path.MaxSize))
+		if err != nil {
+			return nil, err
+		}
+		handlerWithMiddlewares.Add(mirrorMiddleware)
+	}
+
 	return handlerWithMiddlewares, nil
 }
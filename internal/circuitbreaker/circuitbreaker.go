@@ -0,0 +1,319 @@
+// This package implement the circuit breakers of the upstream servers, the handlers ask the breaker before
+// sending a request and report its result, the admin api exposes the state
+
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrOpen is the upstream error of requests rejected by an open circuit
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half-open"
+)
+
+// Breaker is the circuit breaker of an upstream server, a nil breaker always allows requests
+type Breaker struct {
+	backend string
+	url     string
+	config  config.CircuitBreaker
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	requests    int // In the window
+	failures    int // In the window
+	slowCalls   int // In the window
+	openedAt    time.Time
+	probes      int // Half-open requests in flight or succeeded
+	successes   int // Succeeded half-open probes
+}
+
+// Allow report if a request can be sent to the server, every allowed request must be followed by Report or Cancel
+func (b *Breaker) Allow(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if time.Since(b.openedAt) < b.config.OpenDuration {
+			return false
+		}
+
+		b.setState(ctx, HalfOpen, fmt.Sprintf("open for %s", b.config.OpenDuration))
+	}
+
+	if b.state == HalfOpen {
+		if b.probes >= b.config.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+	}
+
+	return true
+}
+
+// Available report if Allow may let a request through (without taking a half-open probe)
+func (b *Breaker) Available() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		return time.Since(b.openedAt) >= b.config.OpenDuration
+	case HalfOpen:
+		return b.probes < b.config.HalfOpenProbes
+	default:
+		return true
+	}
+}
+
+// Report the result of an allowed request (failed is true for errors and 5xx responses)
+func (b *Breaker) Report(ctx context.Context, failed bool, duration time.Duration) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slow := b.config.SlowCallDuration > 0 && duration >= b.config.SlowCallDuration
+
+	switch b.state {
+	case HalfOpen:
+		if failed || slow {
+			b.open(ctx, "half-open probe failed")
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.config.HalfOpenProbes {
+			b.setState(ctx, Closed, fmt.Sprintf("%d half-open probes succeeded", b.successes))
+		}
+
+	case Closed:
+		now := time.Now()
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.resetWindow(now)
+		}
+
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if slow {
+			b.slowCalls++
+		}
+
+		if reason := b.openReason(); reason != "" {
+			b.open(ctx, reason)
+		}
+	}
+
+	// Requests that started before the circuit opened say nothing about the server
+}
+
+// Cancel release an allowed request that ended without a result (the client went away)
+func (b *Breaker) Cancel() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen && b.probes > b.successes {
+		b.probes--
+	}
+}
+
+func (b *Breaker) openReason() string {
+	if b.requests < b.config.MinRequests {
+		return ""
+	}
+
+	if failureRate := float64(b.failures) / float64(b.requests); failureRate >= *b.config.FailureRate {
+		return fmt.Sprintf("failure rate %.2f of %d requests", failureRate, b.requests)
+	}
+
+	if b.config.SlowCallRate != nil {
+		if slowCallRate := float64(b.slowCalls) / float64(b.requests); slowCallRate >= *b.config.SlowCallRate {
+			return fmt.Sprintf("slow call rate %.2f of %d requests", slowCallRate, b.requests)
+		}
+	}
+
+	return ""
+}
+
+func (b *Breaker) open(ctx context.Context, reason string) {
+	b.openedAt = time.Now()
+	b.setState(ctx, Open, reason)
+}
+
+// setState move the breaker to the state, the transition is logged and added as an event to the request span
+func (b *Breaker) setState(ctx context.Context, state State, reason string) {
+	from := b.state
+	b.state = state
+	b.probes = 0
+	b.successes = 0
+	b.resetWindow(time.Now())
+
+	log.Default().Printf("Backend <%s> server %s circuit breaker %s -> %s: %s\n", b.backend, b.url, from, state, reason)
+
+	trace.SpanFromContext(ctx).AddEvent("Circuit breaker state changed", trace.WithAttributes(
+		attribute.String("gatego.circuit_breaker.backend", b.backend),
+		attribute.String("gatego.circuit_breaker.url", b.url),
+		attribute.String("gatego.circuit_breaker.from", string(from)),
+		attribute.String("gatego.circuit_breaker.to", string(state)),
+		attribute.String("gatego.circuit_breaker.reason", reason),
+	))
+}
+
+func (b *Breaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.slowCalls = 0
+}
+
+// Status is the state of a circuit breaker as exposed by the admin api
+type Status struct {
+	Backend      string    `json:"backend"`
+	URL          string    `json:"url"`
+	State        State     `json:"state"`
+	Requests     int       `json:"requests"`
+	FailureRate  float64   `json:"failure_rate"`
+	SlowCallRate float64   `json:"slow_call_rate"`
+	OpenedAt     time.Time `json:"opened_at"`
+}
+
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{Backend: b.backend, URL: b.url, State: b.state, Requests: b.requests, OpenedAt: b.openedAt}
+	if b.requests > 0 {
+		status.FailureRate = float64(b.failures) / float64(b.requests)
+		status.SlowCallRate = float64(b.slowCalls) / float64(b.requests)
+	}
+
+	return status
+}
+
+func newBreaker(backend string, url string, circuitBreaker config.CircuitBreaker) *Breaker {
+	return &Breaker{backend: backend, url: url, config: circuitBreaker, state: Closed, windowStart: time.Now()}
+}
+
+type breakerKey struct {
+	backend string
+	url     string
+}
+
+// Registry hold the circuit breakers by backend name and server url.
+// A nil registry keeps no state, every call creates a new circuit breaker
+type Registry struct {
+	mu       sync.RWMutex
+	breakers []*Breaker // In registration order
+	index    map[breakerKey]*Breaker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[breakerKey]*Breaker)}
+}
+
+// Register return the circuit breaker of the server, it is created (closed) on the first call.
+// A registered breaker keeps its state and takes the config of the call (changed by a reload)
+func (r *Registry) Register(backend string, url string, circuitBreaker config.CircuitBreaker) *Breaker {
+	if r == nil {
+		return newBreaker(backend, url, circuitBreaker)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := breakerKey{backend: backend, url: url}
+	if breaker, exists := r.index[key]; exists {
+		breaker.mu.Lock()
+		breaker.config = circuitBreaker
+		breaker.mu.Unlock()
+
+		return breaker
+	}
+
+	breaker := newBreaker(backend, url, circuitBreaker)
+	r.breakers = append(r.breakers, breaker)
+	r.index[key] = breaker
+
+	return breaker
+}
+
+// Unregister drop the state of a server removed from its backend
+func (r *Registry) Unregister(backend string, url string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := breakerKey{backend: backend, url: url}
+	if existing, exists := r.index[key]; exists {
+		delete(r.index, key)
+		r.breakers = slices.DeleteFunc(r.breakers, func(registered *Breaker) bool { return registered == existing })
+	}
+}
+
+// Prune drop the circuit breakers of the backends that are not in backends (removed by a reload)
+func (r *Registry) Prune(backends []string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.breakers = slices.DeleteFunc(r.breakers, func(breaker *Breaker) bool {
+		if slices.Contains(backends, breaker.backend) {
+			return false
+		}
+
+		delete(r.index, breakerKey{backend: breaker.backend, url: breaker.url})
+		return true
+	})
+}
+
+// Statuses return the state of all the registered circuit breakers
+func (r *Registry) Statuses() []Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(r.breakers))
+	for _, breaker := range r.breakers {
+		statuses = append(statuses, breaker.Status())
+	}
+
+	return statuses
+}
@@ -0,0 +1,171 @@
+package circuitbreaker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestBreakerStates(t *testing.T) {
+	breaker := NewRegistry().Register("example.com/api", "http://backend-1", newConfig())
+	ctx := context.Background()
+
+	// 2 failures of 4 requests reach the failure rate
+	for _, failed := range []bool{false, true, false, true} {
+		if !breaker.Allow(ctx) {
+			t.Fatal("Expected a closed circuit to allow requests")
+		}
+		breaker.Report(ctx, failed, time.Millisecond)
+	}
+
+	if breaker.Status().State != Open || breaker.Allow(ctx) || breaker.Available() {
+		t.Fatalf("Expected the circuit to open, got %+v", breaker.Status())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if !breaker.Available() {
+		t.Error("Expected the circuit to be available after the open duration")
+	}
+
+	// Only the probes are let through
+	if !breaker.Allow(ctx) || !breaker.Allow(ctx) || breaker.Allow(ctx) {
+		t.Fatal("Expected exactly 2 half-open probes")
+	}
+
+	if breaker.Status().State != HalfOpen {
+		t.Fatalf("Expected the circuit to be half-open, got %s", breaker.Status().State)
+	}
+
+	breaker.Report(ctx, false, time.Millisecond)
+	breaker.Report(ctx, false, time.Millisecond)
+
+	if breaker.Status().State != Closed {
+		t.Errorf("Expected the probes to close the circuit, got %s", breaker.Status().State)
+	}
+}
+
+func TestBreakerFailedProbe(t *testing.T) {
+	breaker := NewRegistry().Register("example.com/api", "http://backend-1", newConfig())
+	ctx := context.Background()
+
+	breaker.open(ctx, "test")
+	time.Sleep(60 * time.Millisecond)
+
+	breaker.Allow(ctx)
+	breaker.Report(ctx, true, time.Millisecond)
+
+	if breaker.Status().State != Open || breaker.Allow(ctx) {
+		t.Errorf("Expected a failed probe to open the circuit again, got %s", breaker.Status().State)
+	}
+}
+
+func TestBreakerCanceledProbe(t *testing.T) {
+	breaker := NewRegistry().Register("example.com/api", "http://backend-1", newConfig())
+	ctx := context.Background()
+
+	breaker.open(ctx, "test")
+	time.Sleep(60 * time.Millisecond)
+
+	breaker.Allow(ctx)
+	breaker.Allow(ctx)
+	breaker.Cancel()
+
+	if !breaker.Allow(ctx) {
+		t.Error("Expected a canceled probe to free its slot")
+	}
+}
+
+func TestBreakerSlowCalls(t *testing.T) {
+	circuitBreaker := newConfig()
+	slowCallRate := 0.5
+	circuitBreaker.SlowCallRate = &slowCallRate
+	circuitBreaker.SlowCallDuration = time.Second
+
+	breaker := NewRegistry().Register("example.com/api", "http://backend-1", circuitBreaker)
+	ctx := context.Background()
+
+	for _, duration := range []time.Duration{time.Millisecond, time.Second * 2, time.Millisecond, time.Second * 2} {
+		breaker.Allow(ctx)
+		breaker.Report(ctx, false, duration)
+	}
+
+	if breaker.Status().State != Open {
+		t.Errorf("Expected slow calls to open the circuit, got %s", breaker.Status().State)
+	}
+}
+
+func TestNilBreaker(t *testing.T) {
+	var breaker *Breaker
+
+	if !breaker.Allow(context.Background()) || !breaker.Available() {
+		t.Error("Expected a nil breaker to allow requests")
+	}
+
+	breaker.Report(context.Background(), true, time.Second)
+	breaker.Cancel()
+}
+
+func TestRegistryRegister(t *testing.T) {
+	registry := NewRegistry()
+
+	first := registry.Register("example.com/api", "http://backend-1", newConfig())
+	if registry.Register("example.com/api", "http://backend-1", newConfig()) != first {
+		t.Error("Expected the same breaker for the same backend and url")
+	}
+
+	registry.Register("example.com/other", "http://backend-1", newConfig())
+	if len(registry.Statuses()) != 2 {
+		t.Errorf("Expected 2 breakers, got %d", len(registry.Statuses()))
+	}
+}
+
+func TestRegistryPrune(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("example.com/api", "http://backend-1", newConfig())
+	registry.Register("example.com/removed", "http://backend-1", newConfig())
+
+	registry.Prune([]string{"example.com/api"})
+
+	statuses := registry.Statuses()
+	if len(statuses) != 1 || statuses[0].Backend != "example.com/api" {
+		t.Errorf("Expected only the breakers of the kept backend, got %+v", statuses)
+	}
+}
+
+func TestRegistryRegisterUpdatesConfig(t *testing.T) {
+	registry := NewRegistry()
+	ctx := context.Background()
+
+	breaker := registry.Register("example.com/api", "http://backend-1", newConfig())
+	for _, failed := range []bool{false, true, false, true} {
+		breaker.Allow(ctx)
+		breaker.Report(ctx, failed, time.Millisecond)
+	}
+
+	// Reloaded with a longer open duration and a single probe
+	reloaded := newConfig()
+	reloaded.OpenDuration = time.Hour
+	reloaded.HalfOpenProbes = 1
+	if registry.Register("example.com/api", "http://backend-1", reloaded) != breaker {
+		t.Fatal("Expected the same breaker after the reload")
+	}
+
+	if breaker.Status().State != Open {
+		t.Fatalf("Expected the breaker to keep its state, got %s", breaker.Status().State)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if breaker.Available() {
+		t.Error("Expected the reloaded open duration to keep the circuit open")
+	}
+}
+
+// Helper function to create a circuit breaker config that opens fast
+func newConfig() config.CircuitBreaker {
+	failureRate := 0.5
+	return config.CircuitBreaker{FailureRate: &failureRate, Window: time.Minute, MinRequests: 4, OpenDuration: 50 * time.Millisecond, HalfOpenProbes: 2}
+}
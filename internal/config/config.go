@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
@@ -22,14 +23,368 @@ import (
 
 const DefaultTimeout = time.Second * 30
 const DefaultMaxRequestSize = 1024 * 10 // 10 MB
-var SupportedBalancePolicies = []string{"round-robin", "random", "least-latency"}
+var SupportedBalancePolicies = []string{"round-robin", "random", "least-latency", "least-connections", "p2c", "peak-ewma", "hash"}
+
+// The load compared by the p2c policy
+var SupportedP2CMetrics = []string{"in-flight", "latency"}
+
+const DefaultHealthCheckInterval = time.Second * 10
+const DefaultHealthCheckTimeout = time.Second * 2
+const DefaultHealthyThreshold = 2
+const DefaultUnhealthyThreshold = 1
+
+// HealthCheck is checked against every server of the backend, failing servers are taken out of the rotation
+type HealthCheck struct {
+	Path               string            `yaml:"path"` // Appended to the server url (ignored for tcp servers)
+	Method             string            `yaml:"method"`
+	Headers            map[string]string `yaml:"headers"`
+	Interval           time.Duration     `yaml:"interval"`
+	Timeout            time.Duration     `yaml:"timeout"`
+	HealthyThreshold   int               `yaml:"healthy_threshold"`   // Consecutive successes to put a server back in the rotation
+	UnhealthyThreshold int               `yaml:"unhealthy_threshold"` // Consecutive failures to take a server out of the rotation
+}
+
+func (hc *HealthCheck) validate() error {
+	if hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+		return errors.New("health check path must start with '/'")
+	}
+
+	if hc.Interval < 0 || hc.Timeout < 0 || hc.HealthyThreshold < 0 || hc.UnhealthyThreshold < 0 {
+		return errors.New("health check interval, timeout and thresholds can't be negative")
+	}
+
+	if hc.Method == "" {
+		hc.Method = http.MethodGet
+	}
+
+	if hc.Interval == 0 {
+		hc.Interval = DefaultHealthCheckInterval
+	}
+
+	if hc.Timeout == 0 {
+		hc.Timeout = DefaultHealthCheckTimeout
+	}
+
+	if hc.HealthyThreshold == 0 {
+		hc.HealthyThreshold = DefaultHealthyThreshold
+	}
+
+	if hc.UnhealthyThreshold == 0 {
+		hc.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+
+	return nil
+}
+
+const DefaultOutlierConsecutive5xx = 5
+const DefaultOutlierConsecutiveConnectFailures = 3
+const DefaultOutlierErrorRate = 0.5
+const DefaultOutlierWindow = time.Second * 30
+const DefaultOutlierMinRequests = 10
+const DefaultOutlierBaseEjectionTime = time.Second * 30
+const DefaultOutlierMaxEjectionTime = time.Minute * 5
+const DefaultOutlierMaxEjectedPercent = 50
+
+// OutlierDetection eject servers by their live responses (passive health checking)
+type OutlierDetection struct {
+	Consecutive5xx             int           `yaml:"consecutive_5xx"`              // Consecutive 5xx responses to eject a server
+	ConsecutiveConnectFailures int           `yaml:"consecutive_connect_failures"` // Consecutive connection failures to eject a server
+	ErrorRate                  *float64      `yaml:"error_rate"`                   // Ratio of 5xx responses and failures in the window to eject a server
+	Window                     time.Duration `yaml:"window"`                       // Error rate window
+	MinRequests                int           `yaml:"min_requests"`                 // Requests in the window required to judge the error rate
+	BaseEjectionTime           time.Duration `yaml:"base_ejection_time"`           // Doubled on every repeated ejection
+	MaxEjectionTime            time.Duration `yaml:"max_ejection_time"`
+	MaxEjectedPercent          int           `yaml:"max_ejected_percent"` // Max percentage of the servers ejected at once
+}
+
+func (od *OutlierDetection) validate() error {
+	if od.Consecutive5xx < 0 || od.ConsecutiveConnectFailures < 0 || od.MinRequests < 0 {
+		return errors.New("outlier detection thresholds can't be negative")
+	}
+
+	if od.Window < 0 || od.BaseEjectionTime < 0 || od.MaxEjectionTime < 0 {
+		return errors.New("outlier detection durations can't be negative")
+	}
+
+	if od.MaxEjectedPercent < 0 || od.MaxEjectedPercent > 100 {
+		return errors.New("outlier detection max_ejected_percent must be between 0 and 100")
+	}
+
+	if od.Consecutive5xx == 0 {
+		od.Consecutive5xx = DefaultOutlierConsecutive5xx
+	}
+
+	if od.ConsecutiveConnectFailures == 0 {
+		od.ConsecutiveConnectFailures = DefaultOutlierConsecutiveConnectFailures
+	}
+
+	if od.ErrorRate == nil {
+		errorRate := DefaultOutlierErrorRate
+		od.ErrorRate = &errorRate
+	}
+
+	if *od.ErrorRate <= 0 || *od.ErrorRate > 1 {
+		return errors.New("outlier detection error_rate must be between 0 and 1")
+	}
+
+	if od.Window == 0 {
+		od.Window = DefaultOutlierWindow
+	}
+
+	if od.MinRequests == 0 {
+		od.MinRequests = DefaultOutlierMinRequests
+	}
+
+	if od.BaseEjectionTime == 0 {
+		od.BaseEjectionTime = DefaultOutlierBaseEjectionTime
+	}
+
+	if od.MaxEjectionTime == 0 {
+		od.MaxEjectionTime = max(DefaultOutlierMaxEjectionTime, od.BaseEjectionTime)
+	}
+
+	if od.MaxEjectionTime < od.BaseEjectionTime {
+		return errors.New("outlier detection max_ejection_time can't be shorter than base_ejection_time")
+	}
+
+	if od.MaxEjectedPercent == 0 {
+		od.MaxEjectedPercent = DefaultOutlierMaxEjectedPercent
+	}
+
+	return nil
+}
 
 type Backend struct {
-	BalancePolicy string `yaml:"balance_policy"`
-	Servers       []struct {
-		URL    string `yaml:"url"`
-		Weight uint   `yaml:"weight"`
+	BalancePolicy     string `yaml:"balance_policy"`
+	Servers           []BackendServer
+	SlowStart         time.Duration        `yaml:"slow_start"`         // Ramp up the share of servers joining the rotation over this window
+	FailoverThreshold *float64             `yaml:"failover_threshold"` // Healthy ratio of a priority group below which the next group joins the rotation
+	DNS               *DNSDiscovery        `yaml:"dns"`                // Resolve the servers from dns records instead of the servers list
+	File              *FileDiscovery       `yaml:"file"`               // Read the servers from a file instead of the servers list
+	HTTP              *HTTPDiscovery       `yaml:"http"`               // Poll the servers from an http endpoint instead of the servers list
+	Consul            *ConsulDiscovery     `yaml:"consul"`             // Take the servers from a consul catalog service instead of the servers list
+	Kubernetes        *KubernetesDiscovery `yaml:"kubernetes"`         // Take the servers from the endpoints of a kubernetes service instead of the servers list
+	Docker            *DockerDiscovery     `yaml:"docker"`             // Take the servers from the labeled containers of the docker engine instead of the servers list
+	P2CMetric         string               `yaml:"p2c_metric"`         // in-flight (default) or latency, p2c policy only
+	Hash              *Sticky              `yaml:"hash"`               // The request property hashed by the hash policy (defaults to the client ip)
+	StickyCookie      *StickyCookie        `yaml:"sticky_cookie"`      // Http backends only
+	HealthCheck       *HealthCheck         `yaml:"health_check"`
+	OutlierDetection  *OutlierDetection    `yaml:"outlier_detection"` // Http backends only
+}
+
+type BackendServer struct {
+	URL      string `yaml:"url"`
+	Weight   uint   `yaml:"weight"`
+	Draining bool   `yaml:"draining"` // Take no new requests, the in-flight requests complete
+	Priority uint   `yaml:"priority"` // Priority group, 0 is the first group in use
+	Backup   bool   `yaml:"backup"`   // In use after all the priority groups
+	Zone     string `yaml:"zone"`     // Servers in the zone of the gatego instance are preferred
+}
+
+// Validate check a server of the config or of a service discovery provider
+func (s BackendServer) Validate() error {
+	if !isValidURL(s.URL) {
+		return fmt.Errorf("invalid backend server url '%s'", s.URL)
+	}
+
+	if s.Backup && s.Priority > 0 {
+		return fmt.Errorf("backend server '%s' can't have both a priority and backup", s.URL)
+	}
+
+	return nil
+}
+
+const DefaultFailoverThreshold = 0.7
+
+// The schemes of the server urls built by the dns, consul and kubernetes service discovery
+var SupportedDiscoverySchemes = []string{"http", "https", "tcp", "udp"}
+
+var SupportedDNSRecordTypes = []string{"A", "AAAA", "SRV"}
+
+const DefaultDNSMinInterval = time.Second * 5
+const DefaultDNSMaxInterval = time.Minute * 5
+
+// DNSDiscovery resolve the servers of a backend from A / AAAA or SRV records, the records are resolved again when their ttl expires
+type DNSDiscovery struct {
+	Name        string        `yaml:"name"`
+	Type        string        `yaml:"type"`         // A (default), AAAA or SRV
+	Port        uint16        `yaml:"port"`         // A / AAAA records only, SRV records carry the port
+	Weight      uint          `yaml:"weight"`       // A / AAAA records only, SRV records carry the weight and priority
+	Scheme      string        `yaml:"scheme"`       // Of the server urls, defaults to http (the protocol for streams)
+	Resolver    string        `yaml:"resolver"`     // host:port of the dns server, defaults to the first nameserver of /etc/resolv.conf
+	MinInterval time.Duration `yaml:"min_interval"` // Resolve no more often than this (short ttls)
+	MaxInterval time.Duration `yaml:"max_interval"` // Resolve at least this often (long ttls)
+}
+
+func (d *DNSDiscovery) validate() error {
+	if !isValidDNSName(d.Name) {
+		return fmt.Errorf("dns invalid name '%s'", d.Name)
+	}
+
+	if d.Type == "" {
+		d.Type = SupportedDNSRecordTypes[0]
+	}
+
+	d.Type = strings.ToUpper(d.Type)
+	if !slices.Contains(SupportedDNSRecordTypes, d.Type) {
+		return fmt.Errorf("dns record type '%s' is not supported", d.Type)
+	}
+
+	if d.Type == "SRV" {
+		if d.Port != 0 || d.Weight != 0 {
+			return errors.New("dns port and weight are taken from the SRV records")
+		}
+	} else if d.Port == 0 {
+		return fmt.Errorf("dns %s records require a port", d.Type)
+	}
+
+	if d.Resolver != "" {
+		if _, _, err := net.SplitHostPort(d.Resolver); err != nil {
+			return fmt.Errorf("dns invalid resolver address: %s", err.Error())
+		}
+	}
+
+	if d.MinInterval == 0 {
+		d.MinInterval = DefaultDNSMinInterval
+	}
+
+	if d.MaxInterval == 0 {
+		d.MaxInterval = max(DefaultDNSMaxInterval, d.MinInterval)
+	}
+
+	if d.MinInterval < 0 || d.MaxInterval < d.MinInterval {
+		return errors.New("dns min_interval must be positive and at most max_interval")
+	}
+
+	return nil
+}
+
+const DefaultFileDiscoveryInterval = time.Second * 5
+
+// FileDiscovery read the servers of a backend from a json / yaml file (a list of servers), the file is read again when it changes
+type FileDiscovery struct {
+	Path     string        `yaml:"path"`
+	Interval time.Duration `yaml:"interval"` // How often the file is checked for changes
+}
+
+func (f *FileDiscovery) validate() error {
+	if f.Path == "" {
+		return errors.New("file discovery requires a path")
+	}
+
+	if f.Interval == 0 {
+		f.Interval = DefaultFileDiscoveryInterval
+	}
+
+	if f.Interval < 0 {
+		return errors.New("file discovery interval can't be negative")
+	}
+
+	return nil
+}
+
+const DefaultHTTPDiscoveryInterval = time.Second * 10
+const DefaultHTTPDiscoveryTimeout = time.Second * 5
+
+// HTTPDiscovery poll the servers of a backend from an http endpoint returning a json / yaml list of servers
+type HTTPDiscovery struct {
+	URL      string            `yaml:"url"`
+	Interval time.Duration     `yaml:"interval"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Headers  map[string]string `yaml:"headers"` // Sent with every poll (e.g. authorization)
+}
+
+func (h *HTTPDiscovery) validate() error {
+	if !isValidURL(h.URL) || !strings.HasPrefix(h.URL, "http") {
+		return fmt.Errorf("http discovery invalid url '%s'", h.URL)
+	}
+
+	if h.Interval == 0 {
+		h.Interval = DefaultHTTPDiscoveryInterval
+	}
+
+	if h.Timeout == 0 {
+		h.Timeout = DefaultHTTPDiscoveryTimeout
+	}
+
+	if h.Interval < 0 || h.Timeout < 0 {
+		return errors.New("http discovery interval and timeout can't be negative")
+	}
+
+	return nil
+}
+
+// ConsulDiscovery take the servers of a backend from the healthy instances of a consul catalog service (agent of the config consul block),
+// the instances are watched with blocking queries
+type ConsulDiscovery struct {
+	Service     string   `yaml:"service"`
+	Tags        []string `yaml:"tags"`         // The instances must have all the tags
+	Datacenter  string   `yaml:"datacenter"`   // Defaults to the datacenter of the agent
+	Scheme      string   `yaml:"scheme"`       // Of the server urls, defaults to http (the protocol for streams)
+	PassingOnly bool     `yaml:"passing_only"` // Skip the instances with warning checks too (critical instances are always skipped)
+}
+
+func (c *ConsulDiscovery) validate() error {
+	if c.Service == "" {
+		return errors.New("consul discovery requires a service")
+	}
+
+	return nil
+}
+
+const DefaultKubernetesNamespace = "default"
+
+// KubernetesDiscovery take the servers of a backend from the ready endpoints (EndpointSlices) of a kubernetes service (cluster of the
+// config kubernetes block), the endpoints are watched
+type KubernetesDiscovery struct {
+	Service   string `yaml:"service"`
+	Namespace string `yaml:"namespace"` // Defaults to default
+	Port      string `yaml:"port"`      // Name or number of the service port, optional for services with a single port
+	Scheme    string `yaml:"scheme"`    // Of the server urls, defaults to http (the protocol for streams)
+}
+
+func (k *KubernetesDiscovery) validate() error {
+	if k.Service == "" {
+		return errors.New("kubernetes discovery requires a service")
 	}
+
+	if k.Namespace == "" {
+		k.Namespace = DefaultKubernetesNamespace
+	}
+
+	return nil
+}
+
+// DockerDiscovery take the servers of a backend from the running containers of the docker engine (config docker block) with the
+// gatego.domain and gatego.path labels of the block, the containers are watched
+type DockerDiscovery struct {
+	Domain string `yaml:"domain"`
+	Path   string `yaml:"path"` // Defaults to /
+}
+
+func (d *DockerDiscovery) validate() error {
+	if d.Domain == "" {
+		return errors.New("docker discovery requires a domain")
+	}
+
+	// The domain labels are matched in lower case
+	d.Domain = strings.ToLower(d.Domain)
+
+	if d.Path == "" {
+		d.Path = "/"
+	}
+
+	return nil
+}
+
+const DefaultStickyCookieName = "gatego_affinity"
+
+// StickyCookie keep a user on the same server with an affinity cookie naming the server,
+// users without the cookie (or whose server is out of the rotation) are assigned by the balance policy
+type StickyCookie struct {
+	Name   string        `yaml:"name"`    // Defaults to gatego_affinity
+	MaxAge time.Duration `yaml:"max_age"` // 0 for a session cookie
+	Secure bool          `yaml:"secure"`
 }
 
 func (b Backend) validate() error {
@@ -37,19 +392,160 @@ func (b Backend) validate() error {
 		return fmt.Errorf("balance policy '%s' is not supported", b.BalancePolicy)
 	}
 
-	if len(b.Servers) == 0 {
+	if b.P2CMetric != "" {
+		if b.BalancePolicy != "p2c" {
+			return errors.New("p2c_metric requires the p2c balance policy")
+		}
+
+		if !slices.Contains(SupportedP2CMetrics, b.P2CMetric) {
+			return fmt.Errorf("p2c metric '%s' is not supported", b.P2CMetric)
+		}
+	}
+
+	if b.Hash != nil {
+		if b.BalancePolicy != "hash" {
+			return errors.New("hash requires the hash balance policy")
+		}
+
+		if b.Hash.By == "" {
+			b.Hash.By = SupportedStickyBy[0]
+		}
+
+		if !slices.Contains(SupportedStickyBy, b.Hash.By) {
+			return fmt.Errorf("hash by '%s' is not supported", b.Hash.By)
+		}
+
+		if b.Hash.By != "ip" && b.Hash.By != "path" && b.Hash.Name == "" {
+			return fmt.Errorf("hash by %s must have a name", b.Hash.By)
+		}
+	}
+
+	if b.StickyCookie != nil {
+		if b.StickyCookie.Name == "" {
+			b.StickyCookie.Name = DefaultStickyCookieName
+		}
+
+		if b.StickyCookie.MaxAge < 0 {
+			return errors.New("sticky cookie max_age can't be negative")
+		}
+	}
+
+	if b.SlowStart < 0 {
+		return errors.New("slow_start can't be negative")
+	}
+
+	// The keys of a server would move randomly during its slow start
+	if b.SlowStart > 0 && b.BalancePolicy == "hash" {
+		return errors.New("slow_start is not supported by the hash balance policy")
+	}
+
+	if b.FailoverThreshold != nil && (*b.FailoverThreshold <= 0 || *b.FailoverThreshold > 1) {
+		return errors.New("failover_threshold must be above 0 and at most 1")
+	}
+
+	discoveries := 0
+	for _, isSet := range []bool{b.DNS != nil, b.File != nil, b.HTTP != nil, b.Consul != nil, b.Kubernetes != nil, b.Docker != nil} {
+		if isSet {
+			discoveries++
+		}
+	}
+
+	switch {
+	case discoveries > 1:
+		return errors.New("backend can have only one of dns, file, http, consul, kubernetes or docker")
+	case discoveries == 1 && len(b.Servers) > 0:
+		return errors.New("backend can't have both servers and service discovery")
+	// The checks are created for the servers of the config
+	case discoveries == 1 && b.HealthCheck != nil:
+		return errors.New("health_check is not supported with service discovery, use outlier_detection")
+	case discoveries == 0 && len(b.Servers) == 0:
 		return errors.New("backend require at least one server")
 	}
 
+	if b.DNS != nil {
+		if err := b.DNS.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.Consul != nil {
+		if err := b.Consul.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.Kubernetes != nil {
+		if err := b.Kubernetes.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.Docker != nil {
+		if err := b.Docker.validate(); err != nil {
+			return err
+		}
+	}
+
+	if scheme := b.discoveryScheme(); scheme != nil && *scheme != "" && !slices.Contains(SupportedDiscoverySchemes, *scheme) {
+		return fmt.Errorf("service discovery scheme '%s' is not supported", *scheme)
+	}
+
+	if b.File != nil {
+		if err := b.File.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.HTTP != nil {
+		if err := b.HTTP.validate(); err != nil {
+			return err
+		}
+	}
+
 	for _, server := range b.Servers {
-		if !isValidURL(server.URL) {
-			return fmt.Errorf("invalid backend server url '%s'", server.URL)
+		if err := server.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.HealthCheck != nil {
+		if err := b.HealthCheck.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.OutlierDetection != nil {
+		if err := b.OutlierDetection.validate(); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// validateHTTP reject the stream only settings in http backends
+func (b Backend) validateHTTP() error {
+	if scheme := b.discoveryScheme(); scheme != nil && (*scheme == "tcp" || *scheme == "udp") {
+		return fmt.Errorf("service discovery scheme '%s' is only supported for streams", *scheme)
+	}
+
+	return nil
+}
+
+// discoveryScheme return the scheme of the urls built by the service discovery (dns, consul and kubernetes), nil for other backends
+func (b Backend) discoveryScheme() *string {
+	switch {
+	case b.DNS != nil:
+		return &b.DNS.Scheme
+	case b.Consul != nil:
+		return &b.Consul.Scheme
+	case b.Kubernetes != nil:
+		return &b.Kubernetes.Scheme
+	}
+
+	return nil
+}
+
 type Check struct {
 	Name      string            `yaml:"name"`
 	Cron      string            `yaml:"cron"`
@@ -69,37 +565,606 @@ func (c Check) validate() error {
 		return errors.New("invalid check cron expression")
 	}
 
-	if !isValidURL(c.URL) {
-		return errors.New("invalid check url")
+	if !isValidURL(c.URL) {
+		return errors.New("invalid check url")
+	}
+
+	// tcp:// checks only open a connection
+	if strings.HasPrefix(c.URL, "tcp://") {
+		return nil
+	}
+
+	if !isValidMethod(c.Method) {
+		return errors.New("invalid check method")
+	}
+
+	return nil
+}
+
+type MatchRule struct {
+	Name    string  `yaml:"name"`
+	Exact   *string `yaml:"exact"`
+	Regex   *string `yaml:"regex"`
+	Present *bool   `yaml:"present"` // false = must be absent
+}
+
+func (mr MatchRule) validate() error {
+	if mr.Name == "" {
+		return errors.New("match rule requires a name")
+	}
+
+	conditions := 0
+	for _, isSet := range []bool{mr.Exact != nil, mr.Regex != nil, mr.Present != nil} {
+		if isSet {
+			conditions++
+		}
+	}
+
+	if conditions != 1 {
+		return fmt.Errorf("match rule '%s' must have exactly one of exact, regex or present", mr.Name)
+	}
+
+	if mr.Regex != nil {
+		if _, err := regexp.Compile(*mr.Regex); err != nil {
+			return fmt.Errorf("match rule '%s' invalid regex: %s", mr.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Match select the endpoint by request properties other than host and path
+type Match struct {
+	Methods []string    `yaml:"methods"`
+	Headers []MatchRule `yaml:"headers"`
+	Query   []MatchRule `yaml:"query"`
+	Cookies []MatchRule `yaml:"cookies"`
+}
+
+func (m Match) validate() error {
+	for _, method := range m.Methods {
+		if !isValidMethod(method) {
+			return fmt.Errorf("invalid match method '%s'", method)
+		}
+	}
+
+	for _, rules := range [][]MatchRule{m.Headers, m.Query, m.Cookies} {
+		for _, rule := range rules {
+			if err := rule.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type Rewrite struct {
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"` // Supports regex groups ($1) and path variables ({id})
+}
+
+const DefaultRedirectStatus = http.StatusFound
+const DefaultRespondStatus = http.StatusOK
+
+var SupportedRedirectStatuses = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusSeeOther,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+type Redirect struct {
+	Status        int    `yaml:"status"`         // Defaults to 302
+	Target        string `yaml:"target"`         // Supports path variables ({id}) and {path}, {query}, {host}, {scheme}
+	PreserveQuery bool   `yaml:"preserve_query"` // Append the request query to the target
+}
+
+func (r *Redirect) validate() error {
+	if r.Status == 0 {
+		r.Status = DefaultRedirectStatus
+	}
+
+	if !slices.Contains(SupportedRedirectStatuses, r.Status) {
+		return fmt.Errorf("invalid redirect status %d", r.Status)
+	}
+
+	if r.Target == "" {
+		return errors.New("redirect must have a target")
+	}
+
+	return nil
+}
+
+type Respond struct {
+	Status   int               `yaml:"status"` // Defaults to 200
+	Headers  map[string]string `yaml:"headers"`
+	Body     string            `yaml:"body"`
+	BodyFile string            `yaml:"body_file"` // Read once on startup
+}
+
+func (r *Respond) validate() error {
+	if r.Status == 0 {
+		r.Status = DefaultRespondStatus
+	}
+
+	if r.Status < 100 || r.Status > 599 {
+		return fmt.Errorf("invalid respond status %d", r.Status)
+	}
+
+	if r.Body != "" && r.BodyFile != "" {
+		return errors.New("respond can't have body and body_file")
+	}
+
+	if r.BodyFile != "" && !isValidFile(r.BodyFile) {
+		return errors.New("invalid respond body_file path")
+	}
+
+	return nil
+}
+
+const DefaultMirrorMaxConcurrency = 10
+const DefaultMirrorTimeout = time.Second * 5
+
+var SupportedMirrorDropPolicies = []string{"drop-newest", "drop-oldest"}
+
+// Mirror send a copy of the endpoint requests to another server, the responses are discarded
+type Mirror struct {
+	URL            string        `yaml:"url"`             // Base url of the mirror server (the request path is appended)
+	Percentage     *float64      `yaml:"percentage"`      // Percentage of the requests to mirror (defaults to 100)
+	MaxConcurrency int           `yaml:"max_concurrency"` // Max concurrent mirror requests (defaults to 10)
+	QueueSize      int           `yaml:"queue_size"`      // Requests waiting for a free slot (defaults to 0)
+	DropPolicy     string        `yaml:"drop_policy"`     // What to drop when the queue is full: drop-newest (default) or drop-oldest
+	Timeout        time.Duration `yaml:"timeout"`         // Mirror request timeout (defaults to 5s)
+	Diff           *MirrorDiff   `yaml:"diff"`            // Compare the mirror responses with the primary responses
+}
+
+type MirrorDiff struct {
+	Headers      []string `yaml:"headers"`       // Response headers to compare
+	IgnoreFields []string `yaml:"ignore_fields"` // JSON body fields to ignore (dot separated, data.updated_at)
+	SamplesFile  string   `yaml:"samples_file"`  // JSONL file to append mismatch samples to
+	MaxSamples   int      `yaml:"max_samples"`   // Max samples to write (0 for no limit)
+}
+
+func (md MirrorDiff) validate() error {
+	if md.MaxSamples < 0 {
+		return errors.New("mirror diff max_samples can't be negative")
+	}
+
+	for _, field := range md.IgnoreFields {
+		if field == "" || slices.Contains(strings.Split(field, "."), "") {
+			return fmt.Errorf("invalid mirror diff ignore field '%s'", field)
+		}
+	}
+
+	if md.SamplesFile != "" && !isValidDir(filepath.Dir(md.SamplesFile)) {
+		return errors.New("mirror diff samples_file directory does not exist")
+	}
+
+	return nil
+}
+
+func (m *Mirror) validate() error {
+	if !isValidURL(m.URL) {
+		return errors.New("invalid mirror url")
+	}
+
+	if m.Percentage != nil && (*m.Percentage < 0 || *m.Percentage > 100) {
+		return errors.New("mirror percentage must be between 0 and 100")
+	}
+
+	if m.MaxConcurrency < 0 || m.QueueSize < 0 || m.Timeout < 0 {
+		return errors.New("mirror max_concurrency, queue_size and timeout can't be negative")
+	}
+
+	if m.MaxConcurrency == 0 {
+		m.MaxConcurrency = DefaultMirrorMaxConcurrency
+	}
+
+	if m.Timeout == 0 {
+		m.Timeout = DefaultMirrorTimeout
+	}
+
+	if m.DropPolicy == "" {
+		m.DropPolicy = SupportedMirrorDropPolicies[0]
+	}
+
+	if !slices.Contains(SupportedMirrorDropPolicies, m.DropPolicy) {
+		return fmt.Errorf("mirror drop policy '%s' is not supported", m.DropPolicy)
+	}
+
+	if m.Diff != nil {
+		if err := m.Diff.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var SupportedStickyBy = []string{"ip", "cookie", "header", "path", "query"}
+
+// Sticky select the request property hashed to assign a split target (or a server by the hash policy)
+type Sticky struct {
+	By   string `yaml:"by"`   // ip (default), cookie, header, path or query
+	Name string `yaml:"name"` // Cookie / header / query parameter name (requests without it are assigned by ip)
+}
+
+type SplitTarget struct {
+	Name        string   `yaml:"name"`
+	Weight      uint     `yaml:"weight"`
+	Destination *string  `yaml:"destination"`
+	Backend     *Backend `yaml:"backend"`
+}
+
+const DefaultProgressiveMinRequests = 20
+const DefaultProgressiveMaxErrorRate = 0.05
+
+// Progressive shift the split traffic from the stable target to the canary target over steps,
+// while the canary error rate and latency stay within the thresholds (otherwise it is rolled back)
+type Progressive struct {
+	Canary        string        `yaml:"canary"`          // Target that gets the steps weights, the other target is the stable one
+	Steps         []uint        `yaml:"steps"`           // Canary weight percentage of each step (5, 25, 50, 100)
+	Interval      time.Duration `yaml:"interval"`        // Time on each step
+	MinRequests   int           `yaml:"min_requests"`    // Canary requests required to judge a step (defaults to 20)
+	MaxErrorRate  *float64      `yaml:"max_error_rate"`  // Max ratio of canary 5xx responses (defaults to 0.05)
+	MaxP95Latency time.Duration `yaml:"max_p95_latency"` // Max canary p95 latency (0 for no limit)
+	OnFailure     string        `yaml:"on_failure"`      // Command to run on rollback (supports $endpoint, $canary, $weight, $error, $date)
+}
+
+func (p *Progressive) validate(targets []SplitTarget) error {
+	if len(targets) != 2 {
+		return errors.New("progressive split must have exactly two targets")
+	}
+
+	if !slices.ContainsFunc(targets, func(target SplitTarget) bool { return target.Name == p.Canary }) {
+		return fmt.Errorf("progressive canary '%s' is not a split target", p.Canary)
+	}
+
+	if len(p.Steps) == 0 {
+		return errors.New("progressive split must have steps")
+	}
+
+	var previous uint
+	for _, step := range p.Steps {
+		if step <= previous || step > 100 {
+			return errors.New("progressive steps must be increasing percentages (1 - 100)")
+		}
+		previous = step
+	}
+
+	if p.Interval <= 0 {
+		return errors.New("progressive interval must be positive")
+	}
+
+	if p.MinRequests < 0 || p.MaxP95Latency < 0 {
+		return errors.New("progressive min_requests and max_p95_latency can't be negative")
+	}
+
+	if p.MinRequests == 0 {
+		p.MinRequests = DefaultProgressiveMinRequests
+	}
+
+	if p.MaxErrorRate == nil {
+		maxErrorRate := DefaultProgressiveMaxErrorRate
+		p.MaxErrorRate = &maxErrorRate
+	}
+
+	if *p.MaxErrorRate < 0 || *p.MaxErrorRate > 1 {
+		return errors.New("progressive max_error_rate must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// Split divide the endpoint traffic between versions of a service by weight (canary releases)
+type Split struct {
+	Targets        []SplitTarget `yaml:"targets"`
+	Sticky         Sticky        `yaml:"sticky"`
+	OverrideHeader string        `yaml:"override_header"` // Request header with a target name to force (for QA)
+	Progressive    *Progressive  `yaml:"progressive"`     // Shift the weights automatically (the targets weights are ignored)
+}
+
+func (s *Split) validate() error {
+	if len(s.Targets) < 2 {
+		return errors.New("split must have at least two targets")
+	}
+
+	names := make(map[string]bool, len(s.Targets))
+	var totalWeight uint
+	for _, target := range s.Targets {
+		if target.Name == "" {
+			return errors.New("split target must have a name")
+		}
+
+		if names[target.Name] {
+			return fmt.Errorf("duplicate split target '%s'", target.Name)
+		}
+		names[target.Name] = true
+
+		if (target.Destination == nil) == (target.Backend == nil) {
+			return fmt.Errorf("split target '%s' must have exactly one of destination or backend", target.Name)
+		}
+
+		if target.Destination != nil && !isValidURL(*target.Destination) {
+			return fmt.Errorf("split target '%s' has invalid destination url", target.Name)
+		}
+
+		if target.Backend != nil {
+			if err := target.Backend.validate(); err != nil {
+				return err
+			}
+
+			if err := target.Backend.validateHTTP(); err != nil {
+				return err
+			}
+		}
+
+		totalWeight += target.Weight
+	}
+
+	if totalWeight == 0 && s.Progressive == nil {
+		return errors.New("split targets weights can't all be zero")
+	}
+
+	if s.Sticky.By == "" {
+		s.Sticky.By = SupportedStickyBy[0]
+	}
+
+	if !slices.Contains(SupportedStickyBy, s.Sticky.By) {
+		return fmt.Errorf("split sticky by '%s' is not supported", s.Sticky.By)
+	}
+
+	if s.Sticky.By != "ip" && s.Sticky.By != "path" && s.Sticky.Name == "" {
+		return fmt.Errorf("split sticky by %s must have a name", s.Sticky.By)
+	}
+
+	if s.Progressive != nil {
+		if err := s.Progressive.validate(s.Targets); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var errorPageKeyRegex = regexp.MustCompile(`^[45](\d\d|xx)$`)
+
+type ErrorPage struct {
+	ContentType string `yaml:"content_type"` // Detected from the body file extension or the body when empty
+	Body        string `yaml:"body"`         // Supports {status}, {status_text}, {detail}, {request_id}, {method}, {path}, {host}
+	BodyFile    string `yaml:"body_file"`    // Read once on startup
+}
+
+// ErrorPages customize the error responses generated by gatego (can be set globally, per service and per endpoint)
+type ErrorPages struct {
+	ProblemJSON *bool                `yaml:"problem_json"` // RFC 7807 problem details for errors without a page
+	Pages       map[string]ErrorPage `yaml:"pages"`        // Keyed by status code (404) or class (5xx)
+}
+
+func (ep ErrorPages) validate() error {
+	for key, page := range ep.Pages {
+		if !errorPageKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid error page status '%s' (use 4xx / 5xx codes or classes)", key)
+		}
+
+		if (page.Body == "") == (page.BodyFile == "") {
+			return fmt.Errorf("error page '%s' must have exactly one of body or body_file", key)
+		}
+
+		if page.BodyFile != "" && !isValidFile(page.BodyFile) {
+			return fmt.Errorf("invalid error page '%s' body_file path", key)
+		}
+	}
+
+	return nil
+}
+
+const DefaultRetryAttempts = 3
+const DefaultRetryBackoffBase = time.Millisecond * 25
+const DefaultRetryBackoffMax = time.Millisecond * 250
+const DefaultRetryBudgetPercent = 20.0
+const DefaultRetryBudgetMinRetries = 10
+
+// Retry conditions besides response status codes (502, 503, 429, ...)
+var SupportedRetryConditions = []string{"connect-error", "reset", "per-try-timeout"}
+var DefaultRetryOn = []string{"connect-error", "reset", "per-try-timeout", "502", "503", "504"}
+
+var retryStatusRegex = regexp.MustCompile(`^[45]\d\d$`)
+
+// Retry failed upstream requests (on another server of the backend)
+type Retry struct {
+	Attempts         int           `yaml:"attempts"`           // Tries including the first one
+	RetryOn          []string      `yaml:"retry_on"`           // Conditions and status codes to retry
+	PerTryTimeout    time.Duration `yaml:"per_try_timeout"`    // Timeout of each try (0 for the endpoint timeout)
+	BackoffBase      time.Duration `yaml:"backoff_base"`       // Jittered back-off, doubled on every retry
+	BackoffMax       time.Duration `yaml:"backoff_max"`        // Max back-off of a retry
+	NonIdempotent    bool          `yaml:"non_idempotent"`     // Retry POST, PATCH, etc. as well (connect errors are always retried)
+	BudgetPercent    *float64      `yaml:"budget_percent"`     // Max retries as a percentage of the requests (in a 10s window)
+	BudgetMinRetries int           `yaml:"budget_min_retries"` // Retries always allowed in the window (for low traffic)
+}
+
+func (r *Retry) validate() error {
+	if r.Attempts < 0 || r.PerTryTimeout < 0 || r.BackoffBase < 0 || r.BackoffMax < 0 || r.BudgetMinRetries < 0 {
+		return errors.New("retry attempts, timeouts, back-off and budget can't be negative")
+	}
+
+	for _, condition := range r.RetryOn {
+		if !slices.Contains(SupportedRetryConditions, condition) && !retryStatusRegex.MatchString(condition) {
+			return fmt.Errorf("retry condition '%s' is not supported", condition)
+		}
+	}
+
+	if r.Attempts == 0 {
+		r.Attempts = DefaultRetryAttempts
+	}
+
+	if len(r.RetryOn) == 0 {
+		r.RetryOn = DefaultRetryOn
+	}
+
+	if r.BackoffBase == 0 {
+		r.BackoffBase = DefaultRetryBackoffBase
+	}
+
+	if r.BackoffMax == 0 {
+		r.BackoffMax = max(DefaultRetryBackoffMax, r.BackoffBase)
+	}
+
+	if r.BackoffMax < r.BackoffBase {
+		return errors.New("retry backoff_max can't be shorter than backoff_base")
+	}
+
+	if r.BudgetPercent == nil {
+		budgetPercent := DefaultRetryBudgetPercent
+		r.BudgetPercent = &budgetPercent
+	}
+
+	if *r.BudgetPercent < 0 || *r.BudgetPercent > 100 {
+		return errors.New("retry budget_percent must be between 0 and 100")
+	}
+
+	if r.BudgetMinRetries == 0 {
+		r.BudgetMinRetries = DefaultRetryBudgetMinRetries
+	}
+
+	return nil
+}
+
+const DefaultCircuitBreakerFailureRate = 0.5
+const DefaultCircuitBreakerWindow = time.Second * 30
+const DefaultCircuitBreakerMinRequests = 20
+const DefaultCircuitBreakerOpenDuration = time.Second * 30
+const DefaultCircuitBreakerHalfOpenProbes = 3
+const DefaultCircuitBreakerStatus = http.StatusServiceUnavailable
+
+// CircuitBreaker stop sending requests to an overloaded server (per destination / backend server).
+// The circuit opens on a high failure rate or slow call rate in the window, after the open duration
+// a few probe requests are let through (half-open) and the circuit closes when they all succeed.
+type CircuitBreaker struct {
+	FailureRate      *float64      `yaml:"failure_rate"`       // Open at this rate of failed requests (errors and 5xx)
+	SlowCallRate     *float64      `yaml:"slow_call_rate"`     // Open at this rate of slow requests (disabled by default)
+	SlowCallDuration time.Duration `yaml:"slow_call_duration"` // Requests taking longer are slow
+	Window           time.Duration `yaml:"window"`             // The rates are counted over this window
+	MinRequests      int           `yaml:"min_requests"`       // Requests in the window before the rates are checked
+	OpenDuration     time.Duration `yaml:"open_duration"`      // Time to fail fast before probing the server
+	HalfOpenProbes   int           `yaml:"half_open_probes"`   // Probe requests that must succeed to close the circuit
+	Response         *Respond      `yaml:"response"`           // Fail fast response (defaults to a 503 error page)
+}
+
+func (cb *CircuitBreaker) validate() error {
+	if cb.SlowCallDuration < 0 || cb.Window < 0 || cb.MinRequests < 0 || cb.OpenDuration < 0 || cb.HalfOpenProbes < 0 {
+		return errors.New("circuit breaker durations and counts can't be negative")
+	}
+
+	if cb.FailureRate == nil {
+		failureRate := DefaultCircuitBreakerFailureRate
+		cb.FailureRate = &failureRate
+	}
+
+	if *cb.FailureRate <= 0 || *cb.FailureRate > 1 {
+		return errors.New("circuit breaker failure_rate must be between 0 and 1")
+	}
+
+	if (cb.SlowCallRate == nil) != (cb.SlowCallDuration == 0) {
+		return errors.New("circuit breaker slow_call_rate and slow_call_duration must be set together")
+	}
+
+	if cb.SlowCallRate != nil && (*cb.SlowCallRate <= 0 || *cb.SlowCallRate > 1) {
+		return errors.New("circuit breaker slow_call_rate must be between 0 and 1")
+	}
+
+	if cb.Window == 0 {
+		cb.Window = DefaultCircuitBreakerWindow
+	}
+
+	if cb.MinRequests == 0 {
+		cb.MinRequests = DefaultCircuitBreakerMinRequests
+	}
+
+	if cb.OpenDuration == 0 {
+		cb.OpenDuration = DefaultCircuitBreakerOpenDuration
+	}
+
+	if cb.HalfOpenProbes == 0 {
+		cb.HalfOpenProbes = DefaultCircuitBreakerHalfOpenProbes
+	}
+
+	if cb.Response != nil {
+		// The respond default (200) doesn't make sense for a failure
+		if cb.Response.Status == 0 {
+			cb.Response.Status = DefaultCircuitBreakerStatus
+		}
+
+		if err := cb.Response.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type Path struct {
+	Path           string             `yaml:"path"` // Path prefix or template (/users/{id})
+	Match          *Match             `yaml:"match"`
+	Destination    *string            `yaml:"destination"`  // The domain / url of the service server
+	Directory      *string            `yaml:"directory"`    // path to dir you want to serve
+	Backend        *Backend           `yaml:"backend"`      // List of servers to load balance between
+	Redirect       *Redirect          `yaml:"redirect"`     // Redirect the request
+	Respond        *Respond           `yaml:"respond"`      // Static response
+	Split          *Split             `yaml:"split"`        // Weighted split between versions of a service
+	StripPrefix    string             `yaml:"strip_prefix"` // Removed from the request path before proxying
+	AddPrefix      string             `yaml:"add_prefix"`   // Added to the request path before proxying
+	Rewrite        []Rewrite          `yaml:"rewrite"`      // Regex rewrite rules (the first matching rule is applied)
+	Headers        *map[string]string `yaml:"headers"`
+	OmitHeaders    []string           `yaml:"omit_headers"` // Omit specified headers
+	Minify         []string           `yaml:"minify"`
+	Gzip           *bool              `yaml:"gzip"`
+	Timeout        time.Duration      `yaml:"timeout"`
+	MaxSize        uint64             `yaml:"max_size"`
+	OpenAPI        *string            `yaml:"openapi"`
+	RateLimits     []string           `yaml:"ratelimits"`
+	Checks         []Check            `yaml:"checks"` // Automated checks
+	Cache          bool               `yaml:"cache"`  // Cache responses that has cache headers
+	ErrorPages     *ErrorPages        `yaml:"error_pages"`
+	Mirror         *Mirror            `yaml:"mirror"`          // Shadow traffic to another server
+	Retry          *Retry             `yaml:"retry"`           // Retry failed upstream requests
+	CircuitBreaker *CircuitBreaker    `yaml:"circuit_breaker"` // Fail fast when a server is overloaded
+}
+
+func (p Path) validate() error {
+	if len(p.Path) == 0 || p.Path[0] != '/' {
+		return errors.New("path must start with '/'")
+	}
+
+	if err := isValidPathPattern(p.Path); err != nil {
+		return err
+	}
+
+	if p.Match != nil {
+		if err := p.Match.validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.StripPrefix != "" && p.StripPrefix[0] != '/' {
+		return errors.New("strip_prefix must start with '/'")
 	}
 
-	if !isValidMethod(c.Method) {
-		return errors.New("invalid check method")
+	// The directory handler removes the endpoint path itself
+	if p.StripPrefix != "" && p.Directory != nil {
+		return errors.New("strip_prefix can't be used with directory")
 	}
 
-	return nil
-}
-
-type Path struct {
-	Path        string             `yaml:"path"`
-	Destination *string            `yaml:"destination"` // The domain / url of the service server
-	Directory   *string            `yaml:"directory"`   // path to dir you want to serve
-	Backend     *Backend           `yaml:"backend"`     // List of servers to load balance between
-	Headers     *map[string]string `yaml:"headers"`
-	OmitHeaders []string           `yaml:"omit_headers"` // Omit specified headers
-	Minify      []string           `yaml:"minify"`
-	Gzip        *bool              `yaml:"gzip"`
-	Timeout     time.Duration      `yaml:"timeout"`
-	MaxSize     uint64             `yaml:"max_size"`
-	OpenAPI     *string            `yaml:"openapi"`
-	RateLimits  []string           `yaml:"ratelimits"`
-	Checks      []Check            `yaml:"checks"` // Automated checks
-	Cache       bool               `yaml:"cache"`  // Cache responses that has cache headers
-}
+	if p.AddPrefix != "" && p.AddPrefix[0] != '/' {
+		return errors.New("add_prefix must start with '/'")
+	}
 
-func (p Path) validate() error {
-	if p.Path[0] != '/' {
-		return errors.New("path must start with '/'")
+	for _, rewrite := range p.Rewrite {
+		if _, err := regexp.Compile(rewrite.Regex); err != nil {
+			return fmt.Errorf("invalid rewrite regex '%s': %s", rewrite.Regex, err.Error())
+		}
 	}
 
 	if p.Destination != nil {
@@ -126,10 +1191,43 @@ func (p Path) validate() error {
 		if err := p.Backend.validate(); err != nil {
 			return err
 		}
+
+		if err := p.Backend.validateHTTP(); err != nil {
+			return err
+		}
+	}
+
+	if p.Redirect != nil {
+		if err := p.Redirect.validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Respond != nil {
+		if err := p.Respond.validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Split != nil {
+		if err := p.Split.validate(); err != nil {
+			return err
+		}
+	}
+
+	baseHandlers := 0
+	for _, isSet := range []bool{p.Destination != nil, p.Directory != nil, p.Backend != nil, p.Redirect != nil, p.Respond != nil, p.Split != nil} {
+		if isSet {
+			baseHandlers++
+		}
 	}
 
-	if p.Destination == nil && p.Directory == nil && p.Backend == nil {
-		return errors.New("path must have destination or directory or backend")
+	if baseHandlers == 0 {
+		return errors.New("path must have destination or directory or backend or redirect or respond or split")
+	}
+
+	if baseHandlers > 1 {
+		return errors.New("path must have only one of destination, directory, backend, redirect, respond or split")
 	}
 
 	if p.OpenAPI != nil {
@@ -155,6 +1253,42 @@ func (p Path) validate() error {
 		}
 	}
 
+	if p.ErrorPages != nil {
+		if err := p.ErrorPages.validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Mirror != nil {
+		if err := p.Mirror.validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Retry != nil {
+		if p.Destination == nil && p.Backend == nil && p.Split == nil {
+			return errors.New("retry requires destination, backend or split")
+		}
+
+		if err := p.Retry.validate(); err != nil {
+			return err
+		}
+
+		if p.Timeout > 0 && p.Retry.PerTryTimeout > p.Timeout {
+			return errors.New("retry per_try_timeout can't be longer than the endpoint timeout")
+		}
+	}
+
+	if p.CircuitBreaker != nil {
+		if p.Destination == nil && p.Backend == nil && p.Split == nil {
+			return errors.New("circuit_breaker requires destination, backend or split")
+		}
+
+		if err := p.CircuitBreaker.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -191,13 +1325,16 @@ func (a *AnomalyDetection) validate() error {
 }
 
 type Service struct {
-	Domain           string            `yaml:"domain"` // The domain / host the request was sent to
+	Domain           string            `yaml:"domain"`  // The domain / host the request was sent to (*.domain for all subdomains)
+	Default          bool              `yaml:"default"` // Serve requests to hosts that don't match any service
 	Paths            []Path            `yaml:"endpoints"`
 	AnomalyDetection *AnomalyDetection `yaml:"anomaly_detection"`
+	ErrorPages       *ErrorPages       `yaml:"error_pages"`
 }
 
-func (s Service) validate() error {
-	if !isValidHostname(s.Domain) {
+// Validate check a service of the config or of a config provider
+func (s Service) Validate() error {
+	if !isValidHostname(strings.TrimPrefix(s.Domain, "*.")) {
 		return errors.New("invalid domain")
 	}
 
@@ -213,6 +1350,12 @@ func (s Service) validate() error {
 		}
 	}
 
+	if s.ErrorPages != nil {
+		if err := s.ErrorPages.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -222,6 +1365,7 @@ type TLS struct {
 	Email    *string  `yaml:"email"`
 	KeyFile  *string  `yaml:"keyfile"`
 	CertFile *string  `yaml:"certfile"`
+	HTTP3    bool     `yaml:"http3"` // Serve HTTP/3 over QUIC on the same port (UDP)
 }
 
 func (tls TLS) validate() error {
@@ -254,6 +1398,134 @@ func (tls TLS) validate() error {
 		}
 	}
 
+	if tls.HTTP3 && (tls.CertFile == nil || tls.KeyFile == nil) {
+		return errors.New("http3 requires certfile and keyfile")
+	}
+
+	return nil
+}
+
+const DefaultStreamIdleTimeout = time.Minute * 5
+
+var SupportedStreamProtocols = []string{"tcp", "udp"}
+
+type SNIRoute struct {
+	ServerNames []string `yaml:"server_names"` // TLS server names (exact or *.domain wildcard)
+	Backend     Backend  `yaml:"backend"`
+}
+
+type Stream struct {
+	Name        string        `yaml:"name"`
+	Protocol    string        `yaml:"protocol"` // tcp (default) or udp
+	Listen      string        `yaml:"listen"`   // host:port to listen on
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	Backend     *Backend      `yaml:"backend"` // Servers urls are in the form of tcp://host:port or udp://host:port
+	SNI         []SNIRoute    `yaml:"sni"`     // Route TLS passthrough connections by server name
+	Checks      []Check       `yaml:"checks"`
+}
+
+func (s Stream) validate() error {
+	if s.Name == "" {
+		return errors.New("stream requires a name")
+	}
+
+	protocol := s.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	if !slices.Contains(SupportedStreamProtocols, protocol) {
+		return fmt.Errorf("stream '%s' protocol '%s' is not supported", s.Name, s.Protocol)
+	}
+
+	if _, _, err := net.SplitHostPort(s.Listen); err != nil {
+		return fmt.Errorf("stream '%s' invalid listen address: %s", s.Name, err.Error())
+	}
+
+	if s.IdleTimeout < 0 {
+		return fmt.Errorf("stream '%s' idle timeout can't be negative", s.Name)
+	}
+
+	if s.Backend == nil && len(s.SNI) == 0 {
+		return fmt.Errorf("stream '%s' must have backend or sni routes", s.Name)
+	}
+
+	if len(s.SNI) > 0 && protocol != "tcp" {
+		return fmt.Errorf("stream '%s' sni routing is only supported for tcp", s.Name)
+	}
+
+	backends := make([]Backend, 0, len(s.SNI)+1)
+	if s.Backend != nil {
+		backends = append(backends, *s.Backend)
+	}
+
+	for _, route := range s.SNI {
+		if len(route.ServerNames) == 0 {
+			return fmt.Errorf("stream '%s' sni route requires server names", s.Name)
+		}
+
+		for _, serverName := range route.ServerNames {
+			if !isValidHostname(strings.TrimPrefix(serverName, "*.")) {
+				return fmt.Errorf("stream '%s' invalid sni server name '%s'", s.Name, serverName)
+			}
+		}
+
+		backends = append(backends, route.Backend)
+	}
+
+	for _, backend := range backends {
+		if err := backend.validate(); err != nil {
+			return fmt.Errorf("stream '%s': %s", s.Name, err.Error())
+		}
+
+		if backend.HealthCheck != nil && protocol != "tcp" {
+			return fmt.Errorf("stream '%s' health checks are only supported for tcp", s.Name)
+		}
+
+		if backend.OutlierDetection != nil {
+			return fmt.Errorf("stream '%s' outlier detection is only supported for http backends", s.Name)
+		}
+
+		if backend.StickyCookie != nil {
+			return fmt.Errorf("stream '%s' sticky cookies are only supported for http backends", s.Name)
+		}
+
+		if backend.Docker != nil {
+			return fmt.Errorf("stream '%s' docker discovery is only supported for http backends", s.Name)
+		}
+
+		if backend.Hash != nil && backend.Hash.By != "ip" {
+			return fmt.Errorf("stream '%s' can only hash by ip", s.Name)
+		}
+
+		if scheme := backend.discoveryScheme(); scheme != nil {
+			if *scheme == "" {
+				*scheme = protocol
+			}
+
+			if *scheme != protocol {
+				return fmt.Errorf("stream '%s' service discovery must use the %s scheme", s.Name, protocol)
+			}
+		}
+
+		for _, server := range backend.Servers {
+			serverURL, _ := url.Parse(server.URL)
+			if serverURL.Scheme != protocol {
+				return fmt.Errorf("stream '%s' server '%s' must use the %s:// scheme", s.Name, server.URL, protocol)
+			}
+
+			if serverURL.Port() == "" {
+				return fmt.Errorf("stream '%s' server '%s' is missing a port", s.Name, server.URL)
+			}
+		}
+	}
+
+	for _, check := range s.Checks {
+		if err := check.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -284,6 +1556,108 @@ func (otel OTEL) validate() error {
 	return nil
 }
 
+type Admin struct {
+	Listen string `yaml:"listen"` // host:port to listen on (keep it private)
+}
+
+func (a Admin) validate() error {
+	if _, _, err := net.SplitHostPort(a.Listen); err != nil {
+		return fmt.Errorf("admin invalid listen address: %s", err.Error())
+	}
+
+	return nil
+}
+
+const DefaultConsulAddress = "127.0.0.1:8500"
+
+// Consul is the consul agent of the consul service discovery, it can also hold the config (or some of the services) in its kv store
+type Consul struct {
+	Address        string `yaml:"address"` // host:port of the agent, defaults to 127.0.0.1:8500
+	Scheme         string `yaml:"scheme"`  // http (default) or https
+	Token          string `yaml:"token"`   // ACL token
+	Datacenter     string `yaml:"datacenter"`
+	ConfigKey      string `yaml:"config_key"`      // Key of the whole config (yaml), replaces the local config
+	ServicesPrefix string `yaml:"services_prefix"` // Prefix of keys holding a service each (yaml), added to the services of the config
+}
+
+func (c *Consul) validate() error {
+	if c.Address == "" {
+		c.Address = DefaultConsulAddress
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("consul invalid address: %s", err.Error())
+	}
+
+	if c.Scheme == "" {
+		c.Scheme = "http"
+	}
+
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return fmt.Errorf("consul scheme '%s' is not supported", c.Scheme)
+	}
+
+	if strings.HasPrefix(c.ConfigKey, "/") || strings.HasPrefix(c.ServicesPrefix, "/") {
+		return errors.New("consul config_key and services_prefix can't start with /")
+	}
+
+	return nil
+}
+
+const DefaultIngressClass = "gatego"
+
+// Kubernetes is the cluster of the kubernetes service discovery, gatego can also serve the Ingresses and the Gateway API HTTPRoutes of the cluster
+type Kubernetes struct {
+	APIServer    string `yaml:"api_server"`    // Url of the api server, defaults to the in-cluster api server (with the service account)
+	TokenFile    string `yaml:"token_file"`    // Bearer token, read again on every request (rotated tokens)
+	CAFile       string `yaml:"ca_file"`       // CA of the api server certificate
+	Namespace    string `yaml:"namespace"`     // Namespace of the served Ingresses and HTTPRoutes, all namespaces when empty
+	Ingress      bool   `yaml:"ingress"`       // Serve the Ingresses of the ingress class
+	IngressClass string `yaml:"ingress_class"` // Defaults to gatego
+	HTTPRoutes   bool   `yaml:"http_routes"`   // Serve the HTTPRoutes attached to the gateway
+	Gateway      string `yaml:"gateway"`       // Name (or namespace/name) of the Gateway of the HTTPRoutes, all the gateways when empty
+
+	// Allow the gatego.io/openapi annotation, the spec (and its external refs) is loaded by gatego so the authors of the
+	// resources can read its files and reach its network
+	OpenAPIAnnotation bool `yaml:"openapi_annotation"`
+}
+
+func (k *Kubernetes) validate() error {
+	if k.APIServer != "" && (!isValidURL(k.APIServer) || !strings.HasPrefix(k.APIServer, "http")) {
+		return fmt.Errorf("kubernetes invalid api_server '%s'", k.APIServer)
+	}
+
+	if k.IngressClass == "" {
+		k.IngressClass = DefaultIngressClass
+	}
+
+	if strings.Count(k.Gateway, "/") > 1 {
+		return fmt.Errorf("kubernetes invalid gateway '%s', expected name or namespace/name", k.Gateway)
+	}
+
+	return nil
+}
+
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// Docker is the local docker engine, its running containers with gatego labels are served as services
+type Docker struct {
+	Socket  string `yaml:"socket"`  // Unix socket of the engine api, defaults to /var/run/docker.sock
+	Network string `yaml:"network"` // Network of the container addresses, defaults to the first network of a container
+}
+
+func (d *Docker) validate() error {
+	if d.Socket == "" {
+		d.Socket = DefaultDockerSocket
+	}
+
+	if !filepath.IsAbs(d.Socket) {
+		return errors.New("docker socket must be an absolute path")
+	}
+
+	return nil
+}
+
 type Config struct {
 	Version string `yaml:"version"`
 	Host    string `yaml:"host"` // listen host
@@ -295,6 +1669,20 @@ type Config struct {
 	TLS TLS `yaml:"ssl"`
 
 	Services []Service `yaml:"services"`
+
+	Streams []Stream `yaml:"streams"` // Layer 4 (tcp / udp) proxying
+
+	ErrorPages *ErrorPages `yaml:"error_pages"` // Default error pages of all services
+
+	Admin *Admin `yaml:"admin"` // Api exposing the internal state (backends health)
+
+	Zone string `yaml:"zone"` // Zone of this instance, the backends prefer servers of the zone
+
+	Consul *Consul `yaml:"consul"` // Agent of the consul service discovery and kv config
+
+	Kubernetes *Kubernetes `yaml:"kubernetes"` // Cluster of the kubernetes service discovery, Ingresses and HTTPRoutes
+
+	Docker *Docker `yaml:"docker"` // Docker engine of the labeled containers
 }
 
 func (c Config) Validate(currentVersion string) error {
@@ -335,7 +1723,55 @@ func (c Config) Validate(currentVersion string) error {
 	}
 
 	for _, service := range c.Services {
-		if err := service.validate(); err != nil {
+		if err := service.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateServicesDomains(c.Services); err != nil {
+		return err
+	}
+
+	for _, stream := range c.Streams {
+		if err := stream.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validateStreamsListeners(c.Streams); err != nil {
+		return err
+	}
+
+	if err := c.validateStreamsProxyListeners(); err != nil {
+		return err
+	}
+
+	if c.ErrorPages != nil {
+		if err := c.ErrorPages.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Admin != nil {
+		if err := c.Admin.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Consul != nil {
+		if err := c.Consul.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Kubernetes != nil {
+		if err := c.Kubernetes.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Docker != nil {
+		if err := c.Docker.validate(); err != nil {
 			return err
 		}
 	}
@@ -343,6 +1779,92 @@ func (c Config) Validate(currentVersion string) error {
 	return nil
 }
 
+// validateServicesDomains reject services that can't be matched unambiguously
+func validateServicesDomains(services []Service) error {
+	domains := make([]string, 0, len(services))
+	defaultDomain := ""
+
+	for _, service := range services {
+		if slices.ContainsFunc(domains, func(domain string) bool { return strings.EqualFold(domain, service.Domain) }) {
+			return fmt.Errorf("domain '%s' is used by more then one service", service.Domain)
+		}
+		domains = append(domains, service.Domain)
+
+		if service.Default {
+			if defaultDomain != "" {
+				return fmt.Errorf("only one default service is allowed (found '%s' and '%s')", defaultDomain, service.Domain)
+			}
+			defaultDomain = service.Domain
+		}
+	}
+
+	return nil
+}
+
+// validateStreamsListeners reject streams with the same name or listening on the same address
+func validateStreamsListeners(streams []Stream) error {
+	for i, stream := range streams {
+		for _, other := range streams[:i] {
+			if stream.Name == other.Name {
+				return fmt.Errorf("stream name '%s' is used by more then one stream", stream.Name)
+			}
+
+			if streamsShareListener(stream, other) {
+				return fmt.Errorf("streams '%s' and '%s' listen on the same address", other.Name, stream.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateStreamsProxyListeners reject streams listening on the address of the proxy (tcp, and udp with http3)
+func (c Config) validateStreamsProxyListeners() error {
+	proxyListen := net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port)))
+	proxyListeners := []Stream{{Protocol: "tcp", Listen: proxyListen}}
+	if c.TLS.HTTP3 {
+		proxyListeners = append(proxyListeners, Stream{Protocol: "udp", Listen: proxyListen})
+	}
+
+	for _, stream := range c.Streams {
+		for _, listener := range proxyListeners {
+			if streamsShareListener(stream, listener) {
+				return fmt.Errorf("stream '%s' listens on the address of the proxy (%s %s)", stream.Name, listener.Protocol, proxyListen)
+			}
+		}
+	}
+
+	return nil
+}
+
+// streamsShareListener report if the streams listen on the same protocol and port of overlapping hosts
+// (an empty or unspecified host listen on all the hosts)
+func streamsShareListener(a Stream, b Stream) bool {
+	protocol := func(s Stream) string {
+		if s.Protocol == "" {
+			return "tcp"
+		}
+		return s.Protocol
+	}
+
+	if protocol(a) != protocol(b) {
+		return false
+	}
+
+	hostA, portA, _ := net.SplitHostPort(a.Listen)
+	hostB, portB, _ := net.SplitHostPort(b.Listen)
+	if portA != portB {
+		return false
+	}
+
+	isAll := func(host string) bool {
+		ip := net.ParseIP(host)
+		return host == "" || (ip != nil && ip.IsUnspecified())
+	}
+
+	return isAll(hostA) || isAll(hostB) || strings.EqualFold(hostA, hostB)
+}
+
 func ParseConfig(filepath string, currentVersion string) (Config, error) {
 	// Read the YAML file
 	data, err := os.ReadFile(filepath)
@@ -350,11 +1872,16 @@ func ParseConfig(filepath string, currentVersion string) (Config, error) {
 		return Config{}, err
 	}
 
+	return Parse(data, currentVersion)
+}
+
+// Parse decode and validate a yaml config (the config file or the consul kv config)
+func Parse(data []byte, currentVersion string) (Config, error) {
 	// Defaults
 	c := Config{Port: 80}
 
 	// Unmarshal the YAML data into the struct
-	err = yaml.Unmarshal(data, &c)
+	err := yaml.Unmarshal(data, &c)
 	if err != nil {
 		return Config{}, err
 	}
@@ -366,6 +1893,16 @@ func ParseConfig(filepath string, currentVersion string) (Config, error) {
 	return c, nil
 }
 
+// ParseService decode a yaml service (a key of the consul kv services prefix), it is validated with the config it is added to
+func ParseService(data []byte) (Service, error) {
+	var service Service
+	if err := yaml.Unmarshal(data, &service); err != nil {
+		return Service{}, err
+	}
+
+	return service, nil
+}
+
 func isValidHostname(hostname string) bool {
 	// Remove leading/trailing whitespace
 	hostname = strings.TrimSpace(hostname)
@@ -397,6 +1934,35 @@ func isValidHostname(hostname string) bool {
 	return domainRegex.MatchString(hostname)
 }
 
+// isValidPathPattern check the path is a valid http.ServeMux pattern (/users/{id}, /files/{path...})
+func isValidPathPattern(pattern string) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("invalid path pattern: %v", recovered)
+		}
+	}()
+
+	http.NewServeMux().Handle(pattern, http.NotFoundHandler())
+	return nil
+}
+
+// isValidDNSName report if name can be looked up, unlike hostnames the labels may have underscores (SRV names)
+func isValidDNSName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	labelRegex := regexp.MustCompile(`^[a-zA-Z0-9_](?:[a-zA-Z0-9_-]{0,61}[a-zA-Z0-9])?$`)
+	for _, label := range strings.Split(name, ".") {
+		if !labelRegex.MatchString(label) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func isValidURL(str string) bool {
 	u, err := url.Parse(str)
 	return err == nil && u.Scheme != "" && u.Host != ""
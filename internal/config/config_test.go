@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestPathValidate(t *testing.T) {
@@ -18,6 +19,54 @@ func TestPathValidate(t *testing.T) {
 		{"Invalid destination URL", Path{Path: "/api", Destination: ptr("not-a-url")}, true},
 		{"Invalid with both destination and directory", Path{Path: "/both", Destination: ptr("http://example.com"), Directory: ptr("/var/www")}, true},
 		{"Invalid with neither destination nor directory", Path{Path: "/empty"}, true},
+		{"Valid path template", Path{Path: "/users/{id}", Destination: ptr("http://example.com")}, false},
+		{"Invalid path template", Path{Path: "/users/{id", Destination: ptr("http://example.com")}, true},
+		{"Valid match", Path{Path: "/api", Destination: ptr("http://example.com"), Match: &Match{Methods: []string{"GET"}, Headers: []MatchRule{{Name: "X-Api-Version", Exact: ptr("2")}}}}, false},
+		{"Invalid match method", Path{Path: "/api", Destination: ptr("http://example.com"), Match: &Match{Methods: []string{"FETCH"}}}, true},
+		{"Invalid match regex", Path{Path: "/api", Destination: ptr("http://example.com"), Match: &Match{Query: []MatchRule{{Name: "q", Regex: ptr("(")}}}}, true},
+		{"Match rule without condition", Path{Path: "/api", Destination: ptr("http://example.com"), Match: &Match{Cookies: []MatchRule{{Name: "session"}}}}, true},
+		{"Valid rewrite", Path{Path: "/billing", Destination: ptr("http://example.com"), StripPrefix: "/billing", AddPrefix: "/v1", Rewrite: []Rewrite{{Regex: "^/old/(.*)$", Replacement: "/new/$1"}}}, false},
+		{"Invalid strip prefix", Path{Path: "/billing", Destination: ptr("http://example.com"), StripPrefix: "billing"}, true},
+		{"Strip prefix of a directory", Path{Path: "/static", Directory: ptr("/var"), StripPrefix: "/static"}, true},
+		{"Invalid rewrite regex", Path{Path: "/billing", Destination: ptr("http://example.com"), Rewrite: []Rewrite{{Regex: "(", Replacement: "/"}}}, true},
+		{"Match rule with two conditions", Path{Path: "/api", Destination: ptr("http://example.com"), Match: &Match{Headers: []MatchRule{{Name: "X", Exact: ptr("1"), Regex: ptr("1")}}}}, true},
+		{"Valid redirect", Path{Path: "/old-docs", Redirect: &Redirect{Status: 301, Target: "https://docs.example.com{path}"}}, false},
+		{"Valid redirect with default status", Path{Path: "/old-docs", Redirect: &Redirect{Target: "/docs"}}, false},
+		{"Invalid redirect status", Path{Path: "/old-docs", Redirect: &Redirect{Status: 200, Target: "/docs"}}, true},
+		{"Redirect without target", Path{Path: "/old-docs", Redirect: &Redirect{Status: 301}}, true},
+		{"Valid respond", Path{Path: "/stub", Respond: &Respond{Status: 200, Body: `{"ok":true}`}}, false},
+		{"Invalid respond status", Path{Path: "/stub", Respond: &Respond{Status: 1000}}, true},
+		{"Respond with body and body file", Path{Path: "/stub", Respond: &Respond{Body: "a", BodyFile: "config.go"}}, true},
+		{"Respond with missing body file", Path{Path: "/stub", Respond: &Respond{BodyFile: "/missing/stub.json"}}, true},
+		{"Stream dns scheme on path", Path{Path: "/api", Backend: &Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080, Scheme: "tcp"}}}, true},
+		{"Invalid with destination and respond", Path{Path: "/both", Destination: ptr("http://example.com"), Respond: &Respond{}}, true},
+		{"Valid error pages", Path{Path: "/api", Destination: ptr("http://example.com"), ErrorPages: &ErrorPages{Pages: map[string]ErrorPage{"404": {Body: "missing"}, "5xx": {Body: "{}"}}}}, false},
+		{"Invalid error page status", Path{Path: "/api", Destination: ptr("http://example.com"), ErrorPages: &ErrorPages{Pages: map[string]ErrorPage{"200": {Body: "ok"}}}}, true},
+		{"Error page without body", Path{Path: "/api", Destination: ptr("http://example.com"), ErrorPages: &ErrorPages{Pages: map[string]ErrorPage{"404": {}}}}, true},
+		{"Error page with missing body file", Path{Path: "/api", Destination: ptr("http://example.com"), ErrorPages: &ErrorPages{Pages: map[string]ErrorPage{"404": {BodyFile: "/missing/404.html"}}}}, true},
+		{"Valid mirror", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "http://candidate:8080", DropPolicy: "drop-oldest"}}, false},
+		{"Invalid mirror url", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "candidate"}}, true},
+		{"Invalid mirror percentage", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "http://candidate", Percentage: floatPtr(150)}}, true},
+		{"Invalid mirror drop policy", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "http://candidate", DropPolicy: "block"}}, true},
+		{"Valid mirror diff", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "http://candidate", Diff: &MirrorDiff{Headers: []string{"Content-Type"}, IgnoreFields: []string{"data.updated_at"}, SamplesFile: "diff.jsonl"}}}, false},
+		{"Invalid mirror diff ignore field", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "http://candidate", Diff: &MirrorDiff{IgnoreFields: []string{"data..id"}}}}, true},
+		{"Invalid mirror diff samples dir", Path{Path: "/api", Destination: ptr("http://example.com"), Mirror: &Mirror{URL: "http://candidate", Diff: &MirrorDiff{SamplesFile: "/missing/diff.jsonl"}}}, true},
+		{"Valid split", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Weight: 90, Destination: ptr("http://v1")}, {Name: "v2", Weight: 10, Destination: ptr("http://v2")}}, Sticky: Sticky{By: "cookie", Name: "session"}}}, false},
+		{"Split with one target", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Weight: 100, Destination: ptr("http://v1")}}}}, true},
+		{"Split with duplicate targets", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Weight: 1, Destination: ptr("http://v1")}, {Name: "v1", Weight: 1, Destination: ptr("http://v2")}}}}, true},
+		{"Split target without destination", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Weight: 1, Destination: ptr("http://v1")}, {Name: "v2", Weight: 1}}}}, true},
+		{"Split with zero weights", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Destination: ptr("http://v1")}, {Name: "v2", Destination: ptr("http://v2")}}}}, true},
+		{"Split sticky header without name", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Weight: 1, Destination: ptr("http://v1")}, {Name: "v2", Weight: 1, Destination: ptr("http://v2")}}, Sticky: Sticky{By: "header"}}}, true},
+		{"Valid progressive split", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Destination: ptr("http://v1")}, {Name: "v2", Destination: ptr("http://v2")}}, Progressive: &Progressive{Canary: "v2", Steps: []uint{5, 25, 50, 100}, Interval: time.Minute}}}, false},
+		{"Progressive unknown canary", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Destination: ptr("http://v1")}, {Name: "v2", Destination: ptr("http://v2")}}, Progressive: &Progressive{Canary: "v3", Steps: []uint{50, 100}, Interval: time.Minute}}}, true},
+		{"Progressive decreasing steps", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Destination: ptr("http://v1")}, {Name: "v2", Destination: ptr("http://v2")}}, Progressive: &Progressive{Canary: "v2", Steps: []uint{50, 25}, Interval: time.Minute}}}, true},
+		{"Progressive without interval", Path{Path: "/api", Split: &Split{Targets: []SplitTarget{{Name: "v1", Destination: ptr("http://v1")}, {Name: "v2", Destination: ptr("http://v2")}}, Progressive: &Progressive{Canary: "v2", Steps: []uint{50, 100}}}}, true},
+		{"Split and destination", Path{Path: "/api", Destination: ptr("http://v1"), Split: &Split{Targets: []SplitTarget{{Name: "v1", Weight: 1, Destination: ptr("http://v1")}, {Name: "v2", Weight: 1, Destination: ptr("http://v2")}}}}, true},
+		{"Valid retry", Path{Path: "/api", Destination: ptr("http://example.com"), Timeout: time.Second * 5, Retry: &Retry{RetryOn: []string{"connect-error", "503"}, PerTryTimeout: time.Second}}, false},
+		{"Retry without destination", Path{Path: "/stub", Respond: &Respond{}, Retry: &Retry{}}, true},
+		{"Retry per try timeout longer than timeout", Path{Path: "/api", Destination: ptr("http://example.com"), Timeout: time.Second, Retry: &Retry{PerTryTimeout: time.Second * 2}}, true},
+		{"Valid circuit breaker", Path{Path: "/api", Destination: ptr("http://example.com"), CircuitBreaker: &CircuitBreaker{FailureRate: floatPtr(0.3), Response: &Respond{Body: "unavailable"}}}, false},
+		{"Circuit breaker without destination", Path{Path: "/stub", Respond: &Respond{}, CircuitBreaker: &CircuitBreaker{}}, true},
 	}
 
 	for _, tt := range tests {
@@ -39,13 +88,425 @@ func TestServiceValidate(t *testing.T) {
 		{"Valid service", Service{Domain: "example.com", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}, false},
 		{"Invalid domain", Service{Domain: "not a domain", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}, true},
 		{"Invalid path", Service{Domain: "example.com", Paths: []Path{{Path: "invalid", Destination: ptr("http://api.example.com")}}}, true},
+		{"Wildcard domain", Service{Domain: "*.example.com", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}, false},
+		{"Wildcard in the middle", Service{Domain: "api.*.example.com", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}, true},
+		{"Bare wildcard", Service{Domain: "*", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.service.validate()
+			err := tt.service.Validate()
 			if (err != nil) != tt.wantErr {
-				t.Errorf("Service.validate() service = %v, error = %v, wantErr %v", err, tt.service, tt.wantErr)
+				t.Errorf("Service.Validate() service = %v, error = %v, wantErr %v", err, tt.service, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamValidate(t *testing.T) {
+	backend := func(urls ...string) *Backend {
+		b := &Backend{BalancePolicy: "round-robin"}
+		for _, u := range urls {
+			b.Servers = append(b.Servers, BackendServer{URL: u, Weight: 1})
+		}
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		stream  Stream
+		wantErr bool
+	}{
+		{"Valid tcp stream", Stream{Name: "pg", Listen: ":5432", Backend: backend("tcp://10.0.0.1:5432")}, false},
+		{"Valid udp stream", Stream{Name: "syslog", Protocol: "udp", Listen: ":514", Backend: backend("udp://10.0.0.1:514")}, false},
+		{"Valid sni routes", Stream{Name: "tls", Listen: ":443", SNI: []SNIRoute{{ServerNames: []string{"*.example.com"}, Backend: *backend("tcp://10.0.0.1:443")}}}, false},
+		{"Missing name", Stream{Listen: ":5432", Backend: backend("tcp://10.0.0.1:5432")}, true},
+		{"Unsupported protocol", Stream{Name: "pg", Protocol: "sctp", Listen: ":5432", Backend: backend("tcp://10.0.0.1:5432")}, true},
+		{"Invalid listen address", Stream{Name: "pg", Listen: "5432", Backend: backend("tcp://10.0.0.1:5432")}, true},
+		{"Missing backend", Stream{Name: "pg", Listen: ":5432"}, true},
+		{"Scheme mismatch", Stream{Name: "pg", Listen: ":5432", Backend: backend("udp://10.0.0.1:5432")}, true},
+		{"Missing server port", Stream{Name: "pg", Listen: ":5432", Backend: backend("tcp://10.0.0.1")}, true},
+		{"SNI with udp", Stream{Name: "dns", Protocol: "udp", Listen: ":53", SNI: []SNIRoute{{ServerNames: []string{"example.com"}, Backend: *backend("udp://10.0.0.1:53")}}}, true},
+		{"Health check with udp", Stream{Name: "syslog", Protocol: "udp", Listen: ":514", Backend: withHealthCheck(backend("udp://10.0.0.1:514"), HealthCheck{})}, true},
+		{"Outlier detection on stream", Stream{Name: "pg", Listen: ":5432", Backend: withOutlierDetection(backend("tcp://10.0.0.1:5432"))}, true},
+		{"Valid tcp health check", Stream{Name: "pg", Listen: ":5432", Backend: withHealthCheck(backend("tcp://10.0.0.1:5432"), HealthCheck{})}, false},
+		{"Valid stream hash by ip", Stream{Name: "pg", Listen: ":5432", Backend: withHash(backend("tcp://10.0.0.1:5432"), Sticky{})}, false},
+		{"Stream hash by header", Stream{Name: "pg", Listen: ":5432", Backend: withHash(backend("tcp://10.0.0.1:5432"), Sticky{By: "header", Name: "X-User"})}, true},
+		{"Sticky cookie on stream", Stream{Name: "pg", Listen: ":5432", Backend: withStickyCookie(backend("tcp://10.0.0.1:5432"), StickyCookie{})}, true},
+		{"Valid stream dns", Stream{Name: "pg", Listen: ":5432", Backend: &Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "pg.service.consul", Port: 5432}}}, false},
+		{"Docker discovery on stream", Stream{Name: "pg", Listen: ":5432", Backend: &Backend{BalancePolicy: "round-robin", Docker: &DockerDiscovery{Domain: "pg.localhost"}}}, true},
+		{"Stream dns scheme mismatch", Stream{Name: "pg", Listen: ":5432", Backend: &Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "pg.service.consul", Port: 5432, Scheme: "http"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.stream.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stream.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackendValidate(t *testing.T) {
+	backend := func(balancePolicy string, p2cMetric string) *Backend {
+		return &Backend{BalancePolicy: balancePolicy, P2CMetric: p2cMetric, Servers: []BackendServer{{URL: "http://10.0.0.1:8080", Weight: 1}}}
+	}
+
+	tests := []struct {
+		name    string
+		backend *Backend
+		wantErr bool
+	}{
+		{"Valid least connections", backend("least-connections", ""), false},
+		{"Valid peak ewma", backend("peak-ewma", ""), false},
+		{"Valid p2c", backend("p2c", ""), false},
+		{"Valid p2c by latency", backend("p2c", "latency"), false},
+		{"Unsupported p2c metric", backend("p2c", "cpu"), true},
+		{"P2C metric without p2c", backend("round-robin", "latency"), true},
+		{"Unsupported policy", backend("fastest", ""), true},
+		{"Valid hash by header", withHash(backend("hash", ""), Sticky{By: "header", Name: "X-User"}), false},
+		{"Valid hash by path", withHash(backend("hash", ""), Sticky{By: "path"}), false},
+		{"Hash by query without name", withHash(backend("hash", ""), Sticky{By: "query"}), true},
+		{"Hash without the hash policy", &Backend{BalancePolicy: "round-robin", Hash: &Sticky{}, Servers: backend("round-robin", "").Servers}, true},
+		{"Unsupported hash by", withHash(backend("hash", ""), Sticky{By: "body"}), true},
+		{"Valid sticky cookie", withStickyCookie(backend("least-connections", ""), StickyCookie{MaxAge: time.Hour}), false},
+		{"Negative sticky cookie max age", withStickyCookie(backend("round-robin", ""), StickyCookie{MaxAge: -time.Hour}), true},
+		{"Valid slow start", withSlowStart(backend("least-connections", ""), time.Minute), false},
+		{"Negative slow start", withSlowStart(backend("round-robin", ""), -time.Minute), true},
+		{"Slow start with the hash policy", withSlowStart(backend("hash", ""), time.Minute), true},
+		{"Valid draining server", &Backend{BalancePolicy: "round-robin", Servers: []BackendServer{{URL: "http://10.0.0.1:8080", Weight: 1, Draining: true}}}, false},
+		{"Valid priority groups", &Backend{BalancePolicy: "round-robin", FailoverThreshold: floatPtr(0.5), Servers: []BackendServer{
+			{URL: "http://10.0.0.1:8080", Weight: 1, Zone: "eu-west-1a"},
+			{URL: "http://10.0.1.1:8080", Weight: 1, Priority: 1},
+			{URL: "http://10.0.2.1:8080", Weight: 1, Backup: true},
+		}}, false},
+		{"Backup server with a priority", &Backend{BalancePolicy: "round-robin", Servers: []BackendServer{{URL: "http://10.0.0.1:8080", Weight: 1, Priority: 1, Backup: true}}}, true},
+		{"Zero failover threshold", &Backend{BalancePolicy: "round-robin", FailoverThreshold: floatPtr(0), Servers: backend("round-robin", "").Servers}, true},
+		{"Failover threshold above 1", &Backend{BalancePolicy: "round-robin", FailoverThreshold: floatPtr(1.5), Servers: backend("round-robin", "").Servers}, true},
+		{"Valid dns", &Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080}}, false},
+		{"Valid dns srv", &Backend{BalancePolicy: "least-connections", DNS: &DNSDiscovery{Name: "_http._tcp.api.service.consul", Type: "srv", Scheme: "https"}}, false},
+		{"Dns and servers", &Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080}, Servers: backend("round-robin", "").Servers}, true},
+		{"Dns with health check", withHealthCheck(&Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080}}, HealthCheck{}), true},
+		{"Unsupported dns scheme", &Backend{BalancePolicy: "round-robin", DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080, Scheme: "ftp"}}, true},
+		{"No servers and no dns", &Backend{BalancePolicy: "round-robin"}, true},
+		{"Valid file discovery", &Backend{BalancePolicy: "round-robin", File: &FileDiscovery{Path: "/etc/gatego/api.json"}}, false},
+		{"File discovery without path", &Backend{BalancePolicy: "round-robin", File: &FileDiscovery{}}, true},
+		{"Valid http discovery", &Backend{BalancePolicy: "round-robin", HTTP: &HTTPDiscovery{URL: "http://deploy.internal/api/instances", Headers: map[string]string{"Authorization": "Bearer token"}}}, false},
+		{"Http discovery invalid url", &Backend{BalancePolicy: "round-robin", HTTP: &HTTPDiscovery{URL: "ftp://deploy.internal"}}, true},
+		{"Negative http discovery interval", &Backend{BalancePolicy: "round-robin", HTTP: &HTTPDiscovery{URL: "http://deploy.internal", Interval: -time.Second}}, true},
+		{"File and dns discovery", &Backend{BalancePolicy: "round-robin", File: &FileDiscovery{Path: "api.json"}, DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080}}, true},
+		{"File discovery and servers", &Backend{BalancePolicy: "round-robin", File: &FileDiscovery{Path: "api.json"}, Servers: backend("round-robin", "").Servers}, true},
+		{"Valid consul discovery", &Backend{BalancePolicy: "round-robin", Consul: &ConsulDiscovery{Service: "api", Tags: []string{"v2"}, PassingOnly: true}}, false},
+		{"Consul discovery without service", &Backend{BalancePolicy: "round-robin", Consul: &ConsulDiscovery{}}, true},
+		{"Unsupported consul scheme", &Backend{BalancePolicy: "round-robin", Consul: &ConsulDiscovery{Service: "api", Scheme: "ftp"}}, true},
+		{"Consul and dns discovery", &Backend{BalancePolicy: "round-robin", Consul: &ConsulDiscovery{Service: "api"}, DNS: &DNSDiscovery{Name: "api.service.consul", Port: 8080}}, true},
+		{"Valid kubernetes discovery", &Backend{BalancePolicy: "round-robin", Kubernetes: &KubernetesDiscovery{Service: "api", Port: "http"}}, false},
+		{"Kubernetes discovery without service", &Backend{BalancePolicy: "round-robin", Kubernetes: &KubernetesDiscovery{Namespace: "shop"}}, true},
+		{"Kubernetes and consul discovery", &Backend{BalancePolicy: "round-robin", Kubernetes: &KubernetesDiscovery{Service: "api"}, Consul: &ConsulDiscovery{Service: "api"}}, true},
+		{"Valid docker discovery", &Backend{BalancePolicy: "round-robin", Docker: &DockerDiscovery{Domain: "app.localhost"}}, false},
+		{"Docker discovery without domain", &Backend{BalancePolicy: "round-robin", Docker: &DockerDiscovery{Path: "/api/"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.backend.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Backend.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthCheckValidate(t *testing.T) {
+	healthCheck := HealthCheck{Path: "/healthz"}
+	if err := healthCheck.validate(); err != nil {
+		t.Fatalf("HealthCheck.validate() error = %v", err)
+	}
+
+	if healthCheck.Method != "GET" || healthCheck.Interval != DefaultHealthCheckInterval || healthCheck.Timeout != DefaultHealthCheckTimeout {
+		t.Errorf("Expected the defaults to be set, got %+v", healthCheck)
+	}
+
+	if healthCheck.HealthyThreshold != DefaultHealthyThreshold || healthCheck.UnhealthyThreshold != DefaultUnhealthyThreshold {
+		t.Errorf("Expected the default thresholds to be set, got %+v", healthCheck)
+	}
+
+	invalid := []HealthCheck{
+		{Path: "healthz"},
+		{Interval: -time.Second},
+		{HealthyThreshold: -1},
+	}
+	for _, healthCheck := range invalid {
+		if err := healthCheck.validate(); err == nil {
+			t.Errorf("Expected HealthCheck.validate() to fail for %+v", healthCheck)
+		}
+	}
+}
+
+func TestDNSDiscoveryValidate(t *testing.T) {
+	dns := DNSDiscovery{Name: "api.service.consul", Type: "aaaa", Port: 8080}
+	if err := dns.validate(); err != nil {
+		t.Fatalf("DNSDiscovery.validate() error = %v", err)
+	}
+
+	if dns.Type != "AAAA" || dns.MinInterval != DefaultDNSMinInterval || dns.MaxInterval != DefaultDNSMaxInterval {
+		t.Errorf("Expected the defaults to be set, got %+v", dns)
+	}
+
+	invalid := []DNSDiscovery{
+		{Name: "", Port: 8080},
+		{Name: "api..consul", Port: 8080},
+		{Name: "api.service.consul", Type: "MX", Port: 8080},
+		{Name: "api.service.consul"},
+		{Name: "_http._tcp.api.service.consul", Type: "SRV", Port: 8080},
+		{Name: "_http._tcp.api.service.consul", Type: "SRV", Weight: 2},
+		{Name: "api.service.consul", Port: 8080, Resolver: "10.0.0.1"},
+		{Name: "api.service.consul", Port: 8080, MinInterval: time.Minute, MaxInterval: time.Second},
+		{Name: "api.service.consul", Port: 8080, MinInterval: -time.Second},
+	}
+	for _, dns := range invalid {
+		if err := dns.validate(); err == nil {
+			t.Errorf("Expected DNSDiscovery.validate() to fail for %+v", dns)
+		}
+	}
+}
+
+func TestConsulValidate(t *testing.T) {
+	consul := Consul{}
+	if err := consul.validate(); err != nil {
+		t.Fatalf("Consul.validate() error = %v", err)
+	}
+
+	if consul.Address != DefaultConsulAddress || consul.Scheme != "http" {
+		t.Errorf("Expected the defaults to be set, got %+v", consul)
+	}
+
+	invalid := []Consul{
+		{Address: "consul.internal"},
+		{Scheme: "ftp"},
+		{ConfigKey: "/gatego/config"},
+		{ServicesPrefix: "/gatego/services/"},
+	}
+	for _, consul := range invalid {
+		if err := consul.validate(); err == nil {
+			t.Errorf("Expected Consul.validate() to fail for %+v", consul)
+		}
+	}
+}
+
+func TestKubernetesValidate(t *testing.T) {
+	kubernetes := Kubernetes{Ingress: true}
+	if err := kubernetes.validate(); err != nil {
+		t.Fatalf("Kubernetes.validate() error = %v", err)
+	}
+
+	if kubernetes.IngressClass != DefaultIngressClass {
+		t.Errorf("Expected the defaults to be set, got %+v", kubernetes)
+	}
+
+	discovery := KubernetesDiscovery{Service: "api"}
+	if err := discovery.validate(); err != nil || discovery.Namespace != DefaultKubernetesNamespace {
+		t.Errorf("Expected the default namespace, got %+v (error %v)", discovery, err)
+	}
+
+	invalid := []Kubernetes{
+		{APIServer: "kubernetes.default"},
+		{APIServer: "ftp://10.0.0.1"},
+		{Gateway: "infra/gateways/public"},
+	}
+	for _, kubernetes := range invalid {
+		if err := kubernetes.validate(); err == nil {
+			t.Errorf("Expected Kubernetes.validate() to fail for %+v", kubernetes)
+		}
+	}
+}
+
+func TestDockerValidate(t *testing.T) {
+	docker := Docker{}
+	if err := docker.validate(); err != nil {
+		t.Fatalf("Docker.validate() error = %v", err)
+	}
+
+	if docker.Socket != DefaultDockerSocket {
+		t.Errorf("Expected the default socket, got %+v", docker)
+	}
+
+	invalid := Docker{Socket: "docker.sock"}
+	if err := invalid.validate(); err == nil {
+		t.Error("Expected Docker.validate() to fail for a relative socket")
+	}
+}
+
+func TestOutlierDetectionValidate(t *testing.T) {
+	outlierDetection := OutlierDetection{}
+	if err := outlierDetection.validate(); err != nil {
+		t.Fatalf("OutlierDetection.validate() error = %v", err)
+	}
+
+	if outlierDetection.Consecutive5xx != DefaultOutlierConsecutive5xx || *outlierDetection.ErrorRate != DefaultOutlierErrorRate || outlierDetection.MaxEjectedPercent != DefaultOutlierMaxEjectedPercent {
+		t.Errorf("Expected the defaults to be set, got %+v", outlierDetection)
+	}
+
+	invalid := []OutlierDetection{
+		{Consecutive5xx: -1},
+		{ErrorRate: floatPtr(1.5)},
+		{MaxEjectedPercent: 101},
+		{BaseEjectionTime: time.Minute, MaxEjectionTime: time.Second},
+	}
+	for _, outlierDetection := range invalid {
+		if err := outlierDetection.validate(); err == nil {
+			t.Errorf("Expected OutlierDetection.validate() to fail for %+v", outlierDetection)
+		}
+	}
+}
+
+func TestRetryValidate(t *testing.T) {
+	retry := Retry{}
+	if err := retry.validate(); err != nil {
+		t.Fatalf("Retry.validate() error = %v", err)
+	}
+
+	if retry.Attempts != DefaultRetryAttempts || len(retry.RetryOn) != len(DefaultRetryOn) || *retry.BudgetPercent != DefaultRetryBudgetPercent {
+		t.Errorf("Expected the defaults to be set, got %+v", retry)
+	}
+
+	invalid := []Retry{
+		{Attempts: -1},
+		{RetryOn: []string{"timeout"}},
+		{RetryOn: []string{"200"}},
+		{BackoffBase: time.Second, BackoffMax: time.Millisecond},
+		{BudgetPercent: floatPtr(120)},
+	}
+	for _, retry := range invalid {
+		if err := retry.validate(); err == nil {
+			t.Errorf("Expected Retry.validate() to fail for %+v", retry)
+		}
+	}
+}
+
+func TestCircuitBreakerValidate(t *testing.T) {
+	circuitBreaker := CircuitBreaker{Response: &Respond{}}
+	if err := circuitBreaker.validate(); err != nil {
+		t.Fatalf("CircuitBreaker.validate() error = %v", err)
+	}
+
+	if *circuitBreaker.FailureRate != DefaultCircuitBreakerFailureRate || circuitBreaker.HalfOpenProbes != DefaultCircuitBreakerHalfOpenProbes || circuitBreaker.Response.Status != DefaultCircuitBreakerStatus {
+		t.Errorf("Expected the defaults to be set, got %+v", circuitBreaker)
+	}
+
+	invalid := []CircuitBreaker{
+		{FailureRate: floatPtr(0)},
+		{FailureRate: floatPtr(1.5)},
+		{SlowCallRate: floatPtr(0.5)},
+		{SlowCallDuration: time.Second},
+		{OpenDuration: -time.Second},
+		{Response: &Respond{Status: 1000}},
+	}
+	for _, circuitBreaker := range invalid {
+		if err := circuitBreaker.validate(); err == nil {
+			t.Errorf("Expected CircuitBreaker.validate() to fail for %+v", circuitBreaker)
+		}
+	}
+}
+
+// Helper function to balance a backend by the hash of the request property
+func withHash(backend *Backend, hash Sticky) *Backend {
+	backend.BalancePolicy = "hash"
+	backend.Hash = &hash
+	return backend
+}
+
+// Helper function to add a sticky cookie to a backend
+func withStickyCookie(backend *Backend, stickyCookie StickyCookie) *Backend {
+	backend.StickyCookie = &stickyCookie
+	return backend
+}
+
+// Helper function to set the slow start window of a backend
+func withSlowStart(backend *Backend, slowStart time.Duration) *Backend {
+	backend.SlowStart = slowStart
+	return backend
+}
+
+// Helper function to add outlier detection to a backend
+func withOutlierDetection(backend *Backend) *Backend {
+	backend.OutlierDetection = &OutlierDetection{}
+	return backend
+}
+
+// Helper function to add a health check to a backend
+func withHealthCheck(backend *Backend, healthCheck HealthCheck) *Backend {
+	backend.HealthCheck = &healthCheck
+	return backend
+}
+
+func TestValidateServicesDomains(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []Service
+		wantErr  bool
+	}{
+		{"Exact and wildcard", []Service{{Domain: "api.example.com"}, {Domain: "*.example.com"}}, false},
+		{"Nested wildcards", []Service{{Domain: "*.example.com"}, {Domain: "*.eu.example.com"}}, false},
+		{"Single default", []Service{{Domain: "example.com", Default: true}, {Domain: "*.example.com"}}, false},
+		{"Duplicate domain", []Service{{Domain: "example.com"}, {Domain: "EXAMPLE.COM"}}, true},
+		{"Duplicate wildcard", []Service{{Domain: "*.example.com"}, {Domain: "*.example.com"}}, true},
+		{"Duplicate wildcard case variant", []Service{{Domain: "*.Example.com"}, {Domain: "*.example.COM"}}, true},
+		{"Multiple defaults", []Service{{Domain: "a.com", Default: true}, {Domain: "b.com", Default: true}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateServicesDomains(tt.services)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateServicesDomains() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStreamsListeners(t *testing.T) {
+	tests := []struct {
+		name    string
+		streams []Stream
+		wantErr bool
+	}{
+		{"Different ports", []Stream{{Name: "pg", Listen: ":5432"}, {Name: "redis", Listen: ":6379"}}, false},
+		{"Same port different protocols", []Stream{{Name: "dns-tcp", Listen: ":53"}, {Name: "dns-udp", Protocol: "udp", Listen: ":53"}}, false},
+		{"Same port different hosts", []Stream{{Name: "a", Listen: "10.0.0.1:5432"}, {Name: "b", Listen: "10.0.0.2:5432"}}, false},
+		{"Duplicate name", []Stream{{Name: "pg", Listen: ":5432"}, {Name: "pg", Listen: ":5433"}}, true},
+		{"Duplicate listen address", []Stream{{Name: "a", Listen: "127.0.0.1:5432"}, {Name: "b", Protocol: "tcp", Listen: "127.0.0.1:5432"}}, true},
+		{"All hosts overlap", []Stream{{Name: "a", Listen: "0.0.0.0:5432"}, {Name: "b", Listen: "10.0.0.1:5432"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStreamsListeners(tt.streams)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateStreamsListeners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStreamsProxyListeners(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Other port", Config{Host: "0.0.0.0", Port: 8080, Streams: []Stream{{Name: "pg", Listen: ":5432"}}}, false},
+		{"Proxy port", Config{Host: "0.0.0.0", Port: 8080, Streams: []Stream{{Name: "pg", Listen: "127.0.0.1:8080"}}}, true},
+		{"Proxy port over udp", Config{Host: "0.0.0.0", Port: 8080, Streams: []Stream{{Name: "dns", Protocol: "udp", Listen: ":8080"}}}, false},
+		{"HTTP/3 port over udp", Config{Host: "0.0.0.0", Port: 443, TLS: TLS{HTTP3: true}, Streams: []Stream{{Name: "dns", Protocol: "udp", Listen: ":443"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateStreamsProxyListeners()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateStreamsProxyListeners() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
@@ -60,10 +521,15 @@ func TestConfigValidate(t *testing.T) {
 	}{
 		{"Valid config", Config{Version: "1.0.0", Host: "localhost", Port: 80, Services: []Service{{Domain: "example.com", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}}}, "1.0.0", false},
 		{"AutoTLS with port != 443", Config{Version: "1.0.0", Host: "localhost", Port: 80, TLS: TLS{Auto: true, Domains: []string{"example.com"}}, Services: []Service{{Domain: "example.com", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}}}, "1.0.0", true},
+		{"HTTP3 without certificates", Config{Version: "1.0.0", Host: "localhost", Port: 443, TLS: TLS{HTTP3: true}, Services: []Service{{Domain: "example.com", Paths: []Path{{Path: "/api", Destination: ptr("http://api.example.com")}}}}}, "1.0.0", true},
 		{"Missing version", Config{Host: "localhost"}, "1.0.0", true},
 		{"Invalid version", Config{Version: "invalid", Host: "localhost"}, "1.0.0", true},
 		{"Future version", Config{Version: "2.0.0", Host: "localhost"}, "1.0.0", true},
 		{"Missing host", Config{Version: "1.0.0"}, "1.0.0", true},
+		{"Valid admin", Config{Version: "1.0.0", Host: "localhost", Port: 80, Admin: &Admin{Listen: "127.0.0.1:9000"}}, "1.0.0", false},
+		{"Invalid admin listen", Config{Version: "1.0.0", Host: "localhost", Port: 80, Admin: &Admin{Listen: "9000"}}, "1.0.0", true},
+		{"Valid consul", Config{Version: "1.0.0", Host: "localhost", Port: 80, Consul: &Consul{ConfigKey: "gatego/config", ServicesPrefix: "gatego/services/"}}, "1.0.0", false},
+		{"Invalid consul scheme", Config{Version: "1.0.0", Host: "localhost", Port: 80, Consul: &Consul{Scheme: "grpc"}}, "1.0.0", true},
 	}
 
 	for _, tt := range tests {
@@ -133,6 +599,30 @@ host: "localhost"
 	}
 }
 
+func TestParseService(t *testing.T) {
+	service, err := ParseService([]byte(`
+domain: api.example.com
+endpoints:
+  - path: /
+    backend:
+      balance_policy: round-robin
+      kubernetes:
+        service: api
+        port: 8080
+`))
+	if err != nil {
+		t.Fatalf("ParseService() error = %v", err)
+	}
+
+	if len(service.Paths) != 1 || service.Paths[0].Backend.Kubernetes.Port != "8080" {
+		t.Errorf("Expected the port number as the kubernetes port, got %+v", service)
+	}
+
+	if _, err := ParseService([]byte("domain: [")); err == nil {
+		t.Error("Expected an error for invalid yaml")
+	}
+}
+
 func TestIsValidURL(t *testing.T) {
 	tests := []struct {
 		name string
@@ -186,3 +676,8 @@ func TestIsValidDir(t *testing.T) {
 func ptr(s string) *string {
 	return &s
 }
+
+// Helper function to create float pointers
+func floatPtr(f float64) *float64 {
+	return &f
+}
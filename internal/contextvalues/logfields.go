@@ -0,0 +1,63 @@
+package contextvalues
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Define a custom type for context keys to avoid collisions
+type logFieldsKeyType string
+
+var logFieldsKey = logFieldsKeyType("log-fields")
+
+// LogFields are extra key=value fields added to the request log line by the handlers and middlewares
+type LogFields struct {
+	mu     sync.Mutex
+	keys   []string
+	values map[string]string
+}
+
+// Set the field value (a nil LogFields ignores the field)
+func (lf *LogFields) Set(key string, value string) {
+	if lf == nil {
+		return
+	}
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if _, exists := lf.values[key]; !exists {
+		lf.keys = append(lf.keys, key)
+	}
+	lf.values[key] = value
+}
+
+// String return the fields as space separated key=value in the order they were first set
+func (lf *LogFields) String() string {
+	if lf == nil {
+		return ""
+	}
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	fields := make([]string, 0, len(lf.keys))
+	for _, key := range lf.keys {
+		fields = append(fields, key+"="+lf.values[key])
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// Add empty log fields to context
+func AddLogFieldsToContext(ctx context.Context) (context.Context, *LogFields) {
+	logFields := &LogFields{values: make(map[string]string)}
+	return context.WithValue(ctx, logFieldsKey, logFields), logFields
+}
+
+// Retrieve log fields from context (nil if missing)
+func LogFieldsFromContext(ctx context.Context) *LogFields {
+	logFields, _ := ctx.Value(logFieldsKey).(*LogFields)
+	return logFields
+}
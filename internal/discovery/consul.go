@@ -0,0 +1,340 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/wait"
+)
+
+// Max time a blocking query waits for a change
+const consulWait = time.Minute * 5
+
+// Wait after a failed query
+const consulRetry = time.Second * 5
+
+// Agent of the consul providers when the config has none
+var defaultConsulAgent = config.Consul{Address: config.DefaultConsulAddress, Scheme: "http"}
+
+// consulClient call the http api of a consul agent
+type consulClient struct {
+	agent  config.Consul
+	client *http.Client
+	wait   time.Duration
+	retry  time.Duration
+}
+
+func newConsulClient(agent config.Consul) *consulClient {
+	return &consulClient{agent: agent, client: &http.Client{}, wait: consulWait, retry: consulRetry}
+}
+
+type consulResponse struct {
+	body  []byte
+	index uint64 // X-Consul-Index
+	found bool   // false for 404 (missing kv key)
+}
+
+// get do a blocking query, it returns when the index of the result moves past index (at once for index 0) or after the wait
+func (c *consulClient) get(ctx context.Context, path string, query url.Values, index uint64) (consulResponse, error) {
+	if c.agent.Datacenter != "" && !query.Has("dc") {
+		query.Set("dc", c.agent.Datacenter)
+	}
+
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", c.wait.String())
+	}
+
+	// Consul adds up to wait/16 of jitter to the wait
+	ctx, cancel := context.WithTimeout(ctx, c.wait+c.wait/16+time.Second*10)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.agent.Scheme+"://"+c.agent.Address+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return consulResponse{}, err
+	}
+
+	if c.agent.Token != "" {
+		request.Header.Set("X-Consul-Token", c.agent.Token)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return consulResponse{}, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxHTTPBodySize))
+	if err != nil {
+		return consulResponse{}, err
+	}
+
+	responseIndex, _ := strconv.ParseUint(response.Header.Get("X-Consul-Index"), 10, 64)
+
+	if response.StatusCode == http.StatusNotFound {
+		return consulResponse{index: responseIndex}, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return consulResponse{}, fmt.Errorf("consul %s: status %d %s", path, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return consulResponse{body: body, index: responseIndex, found: true}, nil
+}
+
+// nextIndex return the index of the next blocking query. An index going backwards (consul restored from a snapshot)
+// restarts the watch, and the index is at least 1 so the queries keep blocking
+func nextIndex(previous uint64, current uint64) uint64 {
+	if current < previous {
+		return 0
+	}
+
+	return max(current, 1)
+}
+
+// Consul take the servers of a backend from the instances of a consul catalog service (health endpoint), the instances
+// with a critical check are skipped and the instances with a warning check take the warning weight of the service
+type Consul struct {
+	backend string
+	config  config.ConsulDiscovery
+	client  *consulClient
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Tags    []string
+		Meta    map[string]string
+		Weights struct {
+			Passing int
+			Warning int
+		}
+	}
+	Checks []struct {
+		Status string
+	}
+}
+
+// NewConsul return the provider of the service, the default agent is used when agent is nil
+func NewConsul(backend string, service config.ConsulDiscovery, agent *config.Consul) *Consul {
+	if agent == nil {
+		agent = &defaultConsulAgent
+	}
+
+	return &Consul{backend: backend, config: service, client: newConsulClient(*agent)}
+}
+
+// Start load the instances and pass them to update, then keep watching the service (until ctx is done) and pass
+// the instances again when they change. A failed query keeps the last servers
+func (c *Consul) Start(ctx context.Context, update func([]config.BackendServer)) {
+	servers, index, err := c.fetch(ctx, 0)
+	if err != nil {
+		log.Default().Printf("Backend <%s> consul service %s failed: %s\n", c.backend, c.config.Service, err.Error())
+	} else {
+		log.Default().Printf("Backend <%s> consul service %s loaded %d servers\n", c.backend, c.config.Service, len(servers))
+		update(servers)
+	}
+
+	go c.watch(ctx, update, servers, nextIndex(0, index))
+}
+
+func (c *Consul) watch(ctx context.Context, update func([]config.BackendServer), last []config.BackendServer, index uint64) {
+	for ctx.Err() == nil {
+		servers, newIndex, err := c.fetch(ctx, index)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Default().Printf("Backend <%s> consul service %s failed, keeping the last servers: %s\n", c.backend, c.config.Service, err.Error())
+			wait.Sleep(ctx, c.client.retry)
+			continue
+		}
+
+		index = nextIndex(index, newIndex)
+
+		if !slices.Equal(servers, last) {
+			log.Default().Printf("Backend <%s> consul service %s loaded %d servers\n", c.backend, c.config.Service, len(servers))
+			update(servers)
+			last = servers
+		}
+	}
+}
+
+func (c *Consul) fetch(ctx context.Context, index uint64) ([]config.BackendServer, uint64, error) {
+	query := url.Values{}
+	for _, tag := range c.config.Tags {
+		query.Add("tag", tag)
+	}
+
+	if c.config.Datacenter != "" {
+		query.Set("dc", c.config.Datacenter)
+	}
+
+	response, err := c.client.get(ctx, "/v1/health/service/"+url.PathEscape(c.config.Service), query, index)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []consulServiceEntry
+	if response.found {
+		if err := json.Unmarshal(response.body, &entries); err != nil {
+			return nil, 0, fmt.Errorf("invalid consul health response: %w", err)
+		}
+	}
+
+	scheme := c.config.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	servers := make([]config.BackendServer, 0, len(entries))
+	for _, entry := range entries {
+		weight, inRotation := c.weight(entry)
+
+		// The tags are filtered by the query too, older agents support a single tag
+		if !inRotation || slices.ContainsFunc(c.config.Tags, func(tag string) bool { return !slices.Contains(entry.Service.Tags, tag) }) {
+			continue
+		}
+
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+
+		servers = append(servers, config.BackendServer{
+			URL:    scheme + "://" + net.JoinHostPort(address, strconv.Itoa(entry.Service.Port)),
+			Weight: uint(weight),
+			Zone:   entry.Service.Meta["zone"],
+		})
+	}
+
+	return sortServers(servers), response.index, nil
+}
+
+// weight return the weight of the instance by the status of its checks, false when the instance is out of the rotation
+// (critical or maintenance checks, warning checks with passing_only)
+func (c *Consul) weight(entry consulServiceEntry) (int, bool) {
+	passing, warning := entry.Service.Weights.Passing, entry.Service.Weights.Warning
+	// Agents without weights
+	if passing == 0 {
+		passing, warning = 1, 1
+	}
+
+	status := "passing"
+	for _, check := range entry.Checks {
+		switch check.Status {
+		case "passing":
+		case "warning":
+			status = "warning"
+		default:
+			return 0, false
+		}
+	}
+
+	if status == "warning" {
+		return warning, !c.config.PassingOnly && warning > 0
+	}
+
+	return passing, true
+}
+
+// ConsulKV watch keys of the consul kv store with blocking queries
+type ConsulKV struct {
+	client *consulClient
+}
+
+type consulKVPair struct {
+	Key   string
+	Value []byte // Base64 in the json, null for folders
+}
+
+func NewConsulKV(agent config.Consul) *ConsulKV {
+	return &ConsulKV{client: newConsulClient(agent)}
+}
+
+// Watch pass the values of the key (or of the keys under it with recurse) to update before it returns, then keep watching
+// the keys (until ctx is done) and pass the values again when they change. A missing key has no values, a failed query
+// keeps the last values. Only the first query error is returned
+func (kv *ConsulKV) Watch(ctx context.Context, key string, recurse bool, update func(map[string][]byte)) error {
+	values, index, err := kv.fetch(ctx, key, recurse, 0)
+	if err != nil {
+		return err
+	}
+	update(values)
+
+	go func() {
+		index := nextIndex(0, index)
+
+		for ctx.Err() == nil {
+			next, newIndex, err := kv.fetch(ctx, key, recurse, index)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				log.Default().Printf("Consul kv %s failed, keeping the last values: %s\n", key, err.Error())
+				wait.Sleep(ctx, kv.client.retry)
+				continue
+			}
+
+			index = nextIndex(index, newIndex)
+
+			if !maps.EqualFunc(next, values, bytes.Equal) {
+				update(next)
+				values = next
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (kv *ConsulKV) fetch(ctx context.Context, key string, recurse bool, index uint64) (map[string][]byte, uint64, error) {
+	query := url.Values{}
+	if recurse {
+		query.Set("recurse", "true")
+	}
+
+	response, err := kv.client.get(ctx, "/v1/kv/"+key, query, index)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	values := map[string][]byte{}
+	if !response.found {
+		return values, response.index, nil
+	}
+
+	var pairs []consulKVPair
+	if err := json.Unmarshal(response.body, &pairs); err != nil {
+		return nil, 0, fmt.Errorf("invalid consul kv response: %w", err)
+	}
+
+	for _, pair := range pairs {
+		if pair.Value == nil && strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+
+		values[pair.Key] = pair.Value
+	}
+
+	return values, response.index, nil
+}
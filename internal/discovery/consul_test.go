@@ -0,0 +1,304 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestConsulProvider(t *testing.T) {
+	consul := startConsul(t, "secret")
+	consul.setService("api", []consulServiceEntry{
+		consulEntry("10.0.0.1", "", 8080, []string{"v2"}, "passing", 3, 1, "eu-west-1a"),
+		consulEntry("10.0.0.9", "10.0.0.2", 8080, []string{"v2"}, "warning", 3, 1, ""),
+		consulEntry("10.0.0.3", "", 8080, []string{"v2"}, "critical", 3, 1, ""),
+		consulEntry("10.0.0.4", "", 8080, []string{"v1"}, "passing", 3, 1, ""),
+	})
+
+	tests := []struct {
+		name     string
+		service  config.ConsulDiscovery
+		expected []config.BackendServer
+	}{
+		{
+			name:    "Healthy instances with the tags",
+			service: config.ConsulDiscovery{Service: "api", Tags: []string{"v2"}},
+			expected: []config.BackendServer{
+				{URL: "http://10.0.0.1:8080", Weight: 3, Zone: "eu-west-1a"},
+				{URL: "http://10.0.0.2:8080", Weight: 1},
+			},
+		},
+		{
+			name:     "Passing instances only",
+			service:  config.ConsulDiscovery{Service: "api", Tags: []string{"v2"}, PassingOnly: true, Scheme: "https"},
+			expected: []config.BackendServer{{URL: "https://10.0.0.1:8080", Weight: 3, Zone: "eu-west-1a"}},
+		},
+		{
+			name:     "Unknown service",
+			service:  config.ConsulDiscovery{Service: "billing"},
+			expected: []config.BackendServer{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, _, err := consul.provider(tt.service).fetch(testContext(t), 0)
+			if err != nil {
+				t.Fatalf("fetch failed: %v", err)
+			}
+
+			if !slices.Equal(servers, tt.expected) {
+				t.Errorf("got servers %v want %v", servers, tt.expected)
+			}
+		})
+	}
+
+	if !slices.Contains(consul.queries(), "tag=v2") {
+		t.Errorf("Expected the tags to be filtered by the query, got %v", consul.queries())
+	}
+}
+
+func TestConsulProviderBlockingQueries(t *testing.T) {
+	consul := startConsul(t, "")
+	consul.setService("api", []consulServiceEntry{consulEntry("10.0.0.1", "", 8080, nil, "passing", 1, 1, "")})
+
+	updates := make(chan []config.BackendServer, 10)
+	consul.provider(config.ConsulDiscovery{Service: "api"}).Start(testContext(t), func(servers []config.BackendServer) {
+		updates <- servers
+	})
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 1 {
+			t.Fatalf("Expected 1 server, got %v", servers)
+		}
+	default:
+		t.Fatal("Expected the servers before Start returns")
+	}
+
+	// The watch blocks until the service changes
+	time.Sleep(100 * time.Millisecond)
+	if requests := len(consul.queries()); requests > 3 {
+		t.Errorf("Expected the queries to block, got %d requests", requests)
+	}
+
+	consul.setService("api", []consulServiceEntry{
+		consulEntry("10.0.0.1", "", 8080, nil, "passing", 1, 1, ""),
+		consulEntry("10.0.0.2", "", 8080, nil, "passing", 1, 1, ""),
+	})
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 2 {
+			t.Errorf("Expected 2 servers, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the service changed")
+	}
+}
+
+func TestConsulKVWatch(t *testing.T) {
+	consul := startConsul(t, "")
+	consul.setKey("gatego/services/api", []byte("domain: api.example.com"))
+
+	kv := NewConsulKV(consul.agent)
+	kv.client.wait = time.Second
+
+	updates := make(chan map[string][]byte, 10)
+	err := kv.Watch(testContext(t), "gatego/services/", true, func(values map[string][]byte) { updates <- values })
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	if values := <-updates; string(values["gatego/services/api"]) != "domain: api.example.com" || len(values) != 1 {
+		t.Fatalf("Expected the keys of the prefix, got %v", values)
+	}
+
+	consul.setKey("gatego/services/web", []byte("domain: www.example.com"))
+
+	select {
+	case values := <-updates:
+		if len(values) != 2 {
+			t.Errorf("Expected 2 keys, got %v", values)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after a key was added")
+	}
+
+	// A missing key has no values
+	err = kv.Watch(testContext(t), "gatego/config", false, func(values map[string][]byte) { updates <- values })
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	if values := <-updates; len(values) != 0 {
+		t.Errorf("Expected no values for a missing key, got %v", values)
+	}
+}
+
+func TestConsulUnreachable(t *testing.T) {
+	kv := NewConsulKV(config.Consul{Address: "127.0.0.1:1", Scheme: "http"})
+	if err := kv.Watch(testContext(t), "gatego/config", false, func(map[string][]byte) {}); err == nil {
+		t.Error("Expected an error from an unreachable agent")
+	}
+}
+
+func TestNextIndex(t *testing.T) {
+	tests := []struct {
+		previous uint64
+		current  uint64
+		expected uint64
+	}{
+		{0, 12, 12},
+		{12, 15, 15},
+		{15, 15, 15},
+		{15, 3, 0}, // Restored from a snapshot
+		{0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		if index := nextIndex(tt.previous, tt.current); index != tt.expected {
+			t.Errorf("nextIndex(%d, %d) got %d want %d", tt.previous, tt.current, index, tt.expected)
+		}
+	}
+}
+
+// testConsul is a stand-in of the consul http api (health and kv endpoints) with blocking queries
+type testConsul struct {
+	agent config.Consul
+	token string
+
+	mu       sync.Mutex
+	index    uint64
+	changed  chan struct{} // Closed on every change
+	services map[string][]consulServiceEntry
+	kv       map[string][]byte
+	requests []string // Raw queries
+}
+
+// Helper function to start a consul stand-in, requests must carry the token when it is set
+func startConsul(t *testing.T, token string) *testConsul {
+	t.Helper()
+
+	consul := &testConsul{token: token, index: 1, changed: make(chan struct{}), services: map[string][]consulServiceEntry{}, kv: map[string][]byte{}}
+	server := httptest.NewServer(http.HandlerFunc(consul.serveHTTP))
+	t.Cleanup(server.Close)
+
+	consul.agent = config.Consul{Address: strings.TrimPrefix(server.URL, "http://"), Scheme: "http", Token: token}
+	return consul
+}
+
+// provider return a consul provider of the stand-in with a short wait
+func (c *testConsul) provider(service config.ConsulDiscovery) *Consul {
+	provider := NewConsul("test", service, nil)
+	provider.client = newConsulClient(c.agent)
+	provider.client.wait = time.Second
+
+	return provider
+}
+
+func (c *testConsul) setService(name string, entries []consulServiceEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.services[name] = entries
+	c.change()
+}
+
+func (c *testConsul) setKey(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kv[key] = value
+	c.change()
+}
+
+func (c *testConsul) change() {
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *testConsul) queries() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.requests)
+}
+
+func (c *testConsul) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.token != "" && r.Header.Get("X-Consul-Token") != c.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	c.mu.Lock()
+	c.requests = append(c.requests, r.URL.RawQuery)
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+
+	// Block until a change or the wait when the client has the current index
+	if queryIndex, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); queryIndex >= index {
+		wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+
+	if service, found := strings.CutPrefix(r.URL.Path, "/v1/health/service/"); found {
+		entries := c.services[service]
+		if entries == nil {
+			entries = []consulServiceEntry{}
+		}
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	pairs := make([]consulKVPair, 0)
+	for pairKey, value := range c.kv {
+		if pairKey == key || (r.URL.Query().Get("recurse") == "true" && strings.HasPrefix(pairKey, key)) {
+			pairs = append(pairs, consulKVPair{Key: pairKey, Value: value})
+		}
+	}
+
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(pairs)
+}
+
+// Helper function to create a health entry of an instance with a single check
+func consulEntry(nodeAddress string, serviceAddress string, port int, tags []string, status string, passing int, warning int, zone string) consulServiceEntry {
+	var entry consulServiceEntry
+	entry.Node.Address = nodeAddress
+	entry.Service.Address = serviceAddress
+	entry.Service.Port = port
+	entry.Service.Tags = tags
+	entry.Service.Weights.Passing = passing
+	entry.Service.Weights.Warning = warning
+	if zone != "" {
+		entry.Service.Meta = map[string]string{"zone": zone}
+	}
+	entry.Checks = append(entry.Checks, struct{ Status string }{Status: status})
+
+	return entry
+}
@@ -0,0 +1,317 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/wait"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const dnsTimeout = time.Second * 5
+
+// Advertised udp payload size (edns0), larger answers are truncated and queried again over tcp
+const ednsBufferSize = 1232
+
+// DNS resolve the servers of a backend from A / AAAA or SRV records, they are resolved again when the ttl of the records expires
+type DNS struct {
+	backend  string
+	config   config.DNSDiscovery
+	scheme   string
+	resolver string // host:port
+}
+
+func NewDNS(backend string, dns config.DNSDiscovery) *DNS {
+	scheme := dns.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	resolver := dns.Resolver
+	if resolver == "" {
+		resolver = systemResolver()
+	}
+
+	return &DNS{backend: backend, config: dns, scheme: scheme, resolver: resolver}
+}
+
+// Start resolve the servers and pass them to update, then keep resolving in the background (until ctx is done) and pass the servers
+// again when they change. A failed resolution keeps the last servers
+func (d *DNS) Start(ctx context.Context, update func([]config.BackendServer)) {
+	servers, ttl, err := d.Resolve(ctx)
+	if err != nil {
+		log.Default().Printf("Backend <%s> dns %s failed: %s\n", d.backend, d.config.Name, err.Error())
+	} else {
+		log.Default().Printf("Backend <%s> dns %s resolved %d servers\n", d.backend, d.config.Name, len(servers))
+		update(servers)
+	}
+
+	go d.watch(ctx, update, servers, d.interval(ttl))
+}
+
+func (d *DNS) watch(ctx context.Context, update func([]config.BackendServer), last []config.BackendServer, delay time.Duration) {
+	for wait.Sleep(ctx, delay) {
+		servers, ttl, err := d.Resolve(ctx)
+		delay = d.interval(ttl)
+
+		if err != nil {
+			log.Default().Printf("Backend <%s> dns %s failed, keeping the last servers: %s\n", d.backend, d.config.Name, err.Error())
+			continue
+		}
+
+		if !slices.Equal(servers, last) {
+			log.Default().Printf("Backend <%s> dns %s resolved %d servers\n", d.backend, d.config.Name, len(servers))
+			update(servers)
+			last = servers
+		}
+	}
+}
+
+// interval return the time until the next resolution, the ttl bounded by the min and max intervals
+func (d *DNS) interval(ttl time.Duration) time.Duration {
+	return min(max(ttl, d.config.MinInterval), d.config.MaxInterval)
+}
+
+// Resolve return the servers of the records (sorted by url) and the lowest ttl of the records.
+// A name that doesn't exist has no servers
+func (d *DNS) Resolve(ctx context.Context) ([]config.BackendServer, time.Duration, error) {
+	if d.config.Type == "SRV" {
+		return d.resolveSRV(ctx)
+	}
+
+	qtype := dnsmessage.TypeA
+	if d.config.Type == "AAAA" {
+		qtype = dnsmessage.TypeAAAA
+	}
+
+	response, err := d.query(ctx, d.config.Name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	servers := make([]config.BackendServer, 0, len(response.Answers))
+	for _, ip := range addresses(response.Answers, "") {
+		servers = append(servers, config.BackendServer{URL: d.serverURL(ip, d.config.Port), Weight: d.config.Weight})
+	}
+
+	return sortServers(servers), minTTL(response.Answers), nil
+}
+
+// resolveSRV map the SRV records to servers with their weight and priority, the targets are resolved by the additional
+// records of the answer or by their own A (and then AAAA) query
+func (d *DNS) resolveSRV(ctx context.Context) ([]config.BackendServer, time.Duration, error) {
+	response, err := d.query(ctx, d.config.Name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ttl := minTTL(response.Answers)
+	servers := make([]config.BackendServer, 0, len(response.Answers))
+
+	for _, answer := range response.Answers {
+		srv, ok := answer.Body.(*dnsmessage.SRVResource)
+		// A "." target means the service is not available
+		if !ok || srv.Target.String() == "." {
+			continue
+		}
+
+		ips := addresses(response.Additionals, srv.Target.String())
+		if len(ips) == 0 {
+			var targetTTL time.Duration
+			ips, targetTTL, err = d.resolveTarget(ctx, srv.Target.String())
+			if err != nil {
+				return nil, 0, err
+			}
+			ttl = min(ttl, targetTTL)
+		}
+
+		for _, ip := range ips {
+			servers = append(servers, config.BackendServer{
+				URL:      d.serverURL(ip, srv.Port),
+				Weight:   uint(srv.Weight),
+				Priority: uint(srv.Priority),
+			})
+		}
+	}
+
+	return sortServers(servers), ttl, nil
+}
+
+// resolveTarget return the A addresses of the SRV target, or the AAAA addresses when it has none
+func (d *DNS) resolveTarget(ctx context.Context, target string) ([]string, time.Duration, error) {
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		response, err := d.query(ctx, target, qtype)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if ips := addresses(response.Answers, ""); len(ips) > 0 {
+			return ips, minTTL(response.Answers), nil
+		}
+	}
+
+	return nil, 0, nil
+}
+
+func (d *DNS) serverURL(ip string, port uint16) string {
+	return d.scheme + "://" + net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// query send the question to the resolver over udp, truncated answers are queried again over tcp
+func (d *DNS) query(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsBufferSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+
+	id := uint16(rand.Uint32())
+	query := dnsmessage.Message{
+		Header:      dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions:   []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+		Additionals: []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}},
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := d.exchange(ctx, "udp", packed)
+	if err == nil && response.Truncated {
+		response, err = d.exchange(ctx, "tcp", packed)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("query %s %s: %w", name, qtype, err)
+	}
+
+	if response.ID != id {
+		return nil, fmt.Errorf("query %s %s: response id mismatch", name, qtype)
+	}
+
+	if response.RCode != dnsmessage.RCodeSuccess && response.RCode != dnsmessage.RCodeNameError {
+		return nil, fmt.Errorf("query %s %s: %s", name, qtype, response.RCode)
+	}
+
+	return response, nil
+}
+
+// exchange send the query to the resolver and read the response
+func (d *DNS) exchange(ctx context.Context, network string, query []byte) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.resolver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	var packet []byte
+	if network == "tcp" {
+		// Tcp messages are prefixed by their length
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+
+		packet = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, packet); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+
+		packet = make([]byte, 65535)
+		n, err := conn.Read(packet)
+		if err != nil {
+			return nil, err
+		}
+		packet = packet[:n]
+	}
+
+	var response dnsmessage.Message
+	if err := response.Unpack(packet); err != nil {
+		return nil, errors.Join(errors.New("invalid dns response"), err)
+	}
+
+	return &response, nil
+}
+
+// addresses return the ips of the A and AAAA records (of the name, any name when empty)
+func addresses(records []dnsmessage.Resource, name string) []string {
+	ips := make([]string, 0, len(records))
+	for _, record := range records {
+		if name != "" && !strings.EqualFold(record.Header.Name.String(), name) {
+			continue
+		}
+
+		switch body := record.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]).String())
+		}
+	}
+
+	return ips
+}
+
+func minTTL(records []dnsmessage.Resource) time.Duration {
+	if len(records) == 0 {
+		return 0
+	}
+
+	ttl := records[0].Header.TTL
+	for _, record := range records[1:] {
+		ttl = min(ttl, record.Header.TTL)
+	}
+
+	return time.Duration(ttl) * time.Second
+}
+
+// systemResolver return the first nameserver of /etc/resolv.conf
+func systemResolver() string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+
+	return "127.0.0.1:53"
+}
@@ -0,0 +1,330 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDNSResolveA(t *testing.T) {
+	server := startDNSServer(t)
+	server.set("api.service.local.", dnsmessage.TypeA, aRecord("api.service.local.", "10.0.0.2", 30), aRecord("api.service.local.", "10.0.0.1", 10))
+	server.set("v6.service.local.", dnsmessage.TypeAAAA, aaaaRecord("v6.service.local.", "fd00::1", 30))
+
+	tests := []struct {
+		name     string
+		dns      config.DNSDiscovery
+		expected []config.BackendServer
+		ttl      time.Duration
+	}{
+		{
+			name: "A records",
+			dns:  config.DNSDiscovery{Name: "api.service.local", Type: "A", Port: 8080, Weight: 2},
+			expected: []config.BackendServer{
+				{URL: "http://10.0.0.1:8080", Weight: 2},
+				{URL: "http://10.0.0.2:8080", Weight: 2},
+			},
+			ttl: 10 * time.Second,
+		},
+		{
+			name:     "AAAA records",
+			dns:      config.DNSDiscovery{Name: "v6.service.local", Type: "AAAA", Port: 443, Scheme: "https"},
+			expected: []config.BackendServer{{URL: "https://[fd00::1]:443"}},
+			ttl:      30 * time.Second,
+		},
+		{
+			name:     "Name not found",
+			dns:      config.DNSDiscovery{Name: "missing.service.local", Type: "A", Port: 8080},
+			expected: []config.BackendServer{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.dns.Resolver = server.addr
+			servers, ttl, err := NewDNS("test", tt.dns).Resolve(context.Background())
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+
+			if !slices.Equal(servers, tt.expected) {
+				t.Errorf("got servers %v want %v", servers, tt.expected)
+			}
+
+			if ttl != tt.ttl {
+				t.Errorf("got ttl %s want %s", ttl, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestDNSResolveSRV(t *testing.T) {
+	server := startDNSServer(t)
+	server.set("_http._tcp.api.local.", dnsmessage.TypeSRV,
+		srvRecord("_http._tcp.api.local.", 10, 5, 8080, "node-1.api.local.", 60),
+		srvRecord("_http._tcp.api.local.", 20, 1, 9090, "node-2.api.local.", 60),
+		srvRecord("_http._tcp.api.local.", 10, 1, 8080, ".", 60),
+	)
+	// node-1 comes in the additional records, node-2 is resolved by its own query
+	server.setAdditional("_http._tcp.api.local.", aRecord("node-1.api.local.", "10.0.0.1", 60))
+	server.set("node-2.api.local.", dnsmessage.TypeA, aRecord("node-2.api.local.", "10.0.0.2", 15))
+
+	servers, ttl, err := NewDNS("test", config.DNSDiscovery{Name: "_http._tcp.api.local", Type: "SRV", Resolver: server.addr}).Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	expected := []config.BackendServer{
+		{URL: "http://10.0.0.1:8080", Weight: 5, Priority: 10},
+		{URL: "http://10.0.0.2:9090", Weight: 1, Priority: 20},
+	}
+	if !slices.Equal(servers, expected) {
+		t.Errorf("got servers %v want %v", servers, expected)
+	}
+
+	if ttl != 15*time.Second {
+		t.Errorf("got ttl %s want 15s", ttl)
+	}
+}
+
+func TestDNSTruncatedAnswerUsesTCP(t *testing.T) {
+	server := startDNSServer(t)
+	server.mu.Lock()
+	server.truncateUDP = true
+	server.mu.Unlock()
+	server.set("api.service.local.", dnsmessage.TypeA, aRecord("api.service.local.", "10.0.0.1", 30))
+
+	servers, _, err := NewDNS("test", config.DNSDiscovery{Name: "api.service.local", Type: "A", Port: 80, Resolver: server.addr}).Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if len(servers) != 1 || servers[0].URL != "http://10.0.0.1:80" {
+		t.Errorf("Expected the tcp answer, got %v", servers)
+	}
+}
+
+func TestDNSStartUpdatesOnChange(t *testing.T) {
+	server := startDNSServer(t)
+	server.set("api.service.local.", dnsmessage.TypeA, aRecord("api.service.local.", "10.0.0.1", 0))
+
+	updates := make(chan []config.BackendServer, 10)
+	dns := NewDNS("test", config.DNSDiscovery{
+		Name:        "api.service.local",
+		Type:        "A",
+		Port:        80,
+		Resolver:    server.addr,
+		MinInterval: 10 * time.Millisecond,
+		MaxInterval: 50 * time.Millisecond,
+	})
+	dns.Start(testContext(t), func(servers []config.BackendServer) { updates <- servers })
+
+	// The first resolution is done before Start returns
+	select {
+	case servers := <-updates:
+		if len(servers) != 1 {
+			t.Fatalf("Expected 1 server, got %v", servers)
+		}
+	default:
+		t.Fatal("Expected the servers before Start returns")
+	}
+
+	server.set("api.service.local.", dnsmessage.TypeA, aRecord("api.service.local.", "10.0.0.1", 0), aRecord("api.service.local.", "10.0.0.2", 0))
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 2 {
+			t.Errorf("Expected 2 servers, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the records changed")
+	}
+
+	// Unchanged records don't update the pool
+	select {
+	case servers := <-updates:
+		t.Errorf("Unexpected update %v", servers)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDNSInterval(t *testing.T) {
+	dns := NewDNS("test", config.DNSDiscovery{Resolver: "127.0.0.1:53", MinInterval: 5 * time.Second, MaxInterval: time.Minute})
+
+	tests := []struct {
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		{0, 5 * time.Second},
+		{30 * time.Second, 30 * time.Second},
+		{time.Hour, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if interval := dns.interval(tt.ttl); interval != tt.expected {
+			t.Errorf("interval(%s) got %s want %s", tt.ttl, interval, tt.expected)
+		}
+	}
+}
+
+type testDNSServer struct {
+	addr string
+
+	mu          sync.Mutex
+	truncateUDP bool
+	records     map[string][]dnsmessage.Resource // name/type to answers
+	additionals map[string][]dnsmessage.Resource // name to additional records
+}
+
+// Helper function to start a dns server (udp and tcp on the same port) answering from its records
+func startDNSServer(t *testing.T) *testDNSServer {
+	t.Helper()
+
+	server := &testDNSServer{records: map[string][]dnsmessage.Resource{}, additionals: map[string][]dnsmessage.Resource{}}
+
+	var packetConn net.PacketConn
+	var listener net.Listener
+	for i := 0; i < 10 && listener == nil; i++ {
+		var err error
+		packetConn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+
+		listener, err = net.Listen("tcp", packetConn.LocalAddr().String())
+		if err != nil {
+			packetConn.Close()
+		}
+	}
+
+	if listener == nil {
+		t.Fatal("Failed to listen on tcp and udp")
+	}
+
+	server.addr = packetConn.LocalAddr().String()
+	t.Cleanup(func() {
+		packetConn.Close()
+		listener.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := packetConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			packetConn.WriteTo(server.answer(buf[:n], true), addr)
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+
+				response := server.answer(query, false)
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+			}()
+		}
+	}()
+
+	return server
+}
+
+func (s *testDNSServer) set(name string, qtype dnsmessage.Type, records ...dnsmessage.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name+"/"+qtype.String()] = records
+}
+
+func (s *testDNSServer) setAdditional(name string, records ...dnsmessage.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.additionals[name] = records
+}
+
+func (s *testDNSServer) answer(packet []byte, udp bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packet); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+
+	question := query.Questions[0]
+	response := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+
+	s.mu.Lock()
+	answers, found := s.records[question.Name.String()+"/"+question.Type.String()]
+	additionals := s.additionals[question.Name.String()]
+	truncate := udp && s.truncateUDP
+	s.mu.Unlock()
+
+	switch {
+	case truncate:
+		response.Truncated = true
+	case !found:
+		response.RCode = dnsmessage.RCodeNameError
+	default:
+		response.Answers = answers
+		response.Additionals = additionals
+	}
+
+	packed, err := response.Pack()
+	if err != nil {
+		return nil
+	}
+
+	return packed
+}
+
+// Helper function to create an A record
+func aRecord(name string, ip string, ttl uint32) dnsmessage.Resource {
+	var a dnsmessage.AResource
+	copy(a.A[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{Header: recordHeader(name, dnsmessage.TypeA, ttl), Body: &a}
+}
+
+// Helper function to create an AAAA record
+func aaaaRecord(name string, ip string, ttl uint32) dnsmessage.Resource {
+	var aaaa dnsmessage.AAAAResource
+	copy(aaaa.AAAA[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{Header: recordHeader(name, dnsmessage.TypeAAAA, ttl), Body: &aaaa}
+}
+
+// Helper function to create an SRV record
+func srvRecord(name string, priority uint16, weight uint16, port uint16, target string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: recordHeader(name, dnsmessage.TypeSRV, ttl),
+		Body:   &dnsmessage.SRVResource{Priority: priority, Weight: weight, Port: port, Target: dnsmessage.MustNewName(target)},
+	}
+}
+
+func recordHeader(name string, qtype dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET, TTL: ttl}
+}
@@ -0,0 +1,58 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/docker"
+	"github.com/hvuhsg/gatego/internal/wait"
+)
+
+// Wait after a failed first list of the containers
+const dockerRetry = time.Second * 5
+
+// Docker take the servers of a backend from the running containers of the docker engine with the domain and path labels,
+// the containers with a failing or starting health check are out of the rotation
+type Docker struct {
+	backend string
+	config  config.DockerDiscovery
+	engine  config.Docker
+	retry   time.Duration
+}
+
+// NewDocker return the provider of the containers, the default engine socket is used when engine is nil
+func NewDocker(backend string, containers config.DockerDiscovery, engine *config.Docker) *Docker {
+	if engine == nil {
+		engine = &config.Docker{Socket: config.DefaultDockerSocket}
+	}
+
+	return &Docker{backend: backend, config: containers, engine: *engine, retry: dockerRetry}
+}
+
+// Start load the containers and pass their servers to update, then keep watching the container events (until ctx is done)
+// and pass the servers again when they change. A failed watch keeps the last servers
+func (d *Docker) Start(ctx context.Context, update func([]config.BackendServer)) {
+	client := docker.NewClient(d.engine)
+
+	watch := func() error {
+		return client.WatchServers(ctx, d.config.Domain, d.config.Path, func(servers []config.BackendServer) {
+			log.Default().Printf("Backend <%s> docker containers of %s%s loaded %d servers\n", d.backend, d.config.Domain, d.config.Path, len(servers))
+			update(servers)
+		})
+	}
+
+	if err := watch(); err != nil {
+		log.Default().Printf("Backend <%s> docker containers of %s%s failed: %s\n", d.backend, d.config.Domain, d.config.Path, err.Error())
+
+		// The watch starts once the containers are listed
+		go func() {
+			for wait.Sleep(ctx, d.retry) {
+				if err := watch(); err == nil {
+					return
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,54 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// File read the servers of a backend from a json / yaml file, the file is checked every interval
+// and read again when its modification time or size changes
+type File struct {
+	backend string
+	config  config.FileDiscovery
+
+	modTime time.Time
+	size    int64
+	servers []config.BackendServer // Of the last read
+}
+
+func NewFile(backend string, file config.FileDiscovery) *File {
+	return &File{backend: backend, config: file}
+}
+
+// Start read the servers and pass them to update, then keep watching the file and pass the servers again when they change.
+// A missing or invalid file keeps the last servers
+func (f *File) Start(ctx context.Context, update func([]config.BackendServer)) {
+	poll(ctx, f.backend, "file "+f.config.Path, f.config.Interval, f.read, update)
+}
+
+func (f *File) read(context.Context) ([]config.BackendServer, error) {
+	info, err := os.Stat(f.config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.servers != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.servers, nil
+	}
+
+	data, err := os.ReadFile(f.config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := parseServers(data)
+	if err != nil {
+		return nil, err
+	}
+
+	f.modTime, f.size, f.servers = info.ModTime(), info.Size(), servers
+	return servers, nil
+}
@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	writeFile(t, path, `[{"url": "http://10.0.0.1:8080"}]`)
+
+	updates := make(chan []config.BackendServer, 10)
+	NewFile("test", config.FileDiscovery{Path: path, Interval: 10 * time.Millisecond}).Start(testContext(t), func(servers []config.BackendServer) {
+		updates <- servers
+	})
+
+	// The file is read before Start returns
+	select {
+	case servers := <-updates:
+		if len(servers) != 1 || servers[0].URL != "http://10.0.0.1:8080" {
+			t.Fatalf("Expected the servers of the file, got %v", servers)
+		}
+	default:
+		t.Fatal("Expected the servers before Start returns")
+	}
+
+	// A partial write keeps the last servers
+	writeFile(t, path, "")
+	writeFile(t, path, `[{"url": "http://10.0.0.1:8080"}, {"url": "http://10.0.0.2:8080"`)
+
+	select {
+	case servers := <-updates:
+		t.Fatalf("Unexpected update from an invalid file %v", servers)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writeFile(t, path, `[{"url": "http://10.0.0.1:8080"}, {"url": "http://10.0.0.2:8080"}]`)
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 2 {
+			t.Errorf("Expected 2 servers, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the file changed")
+	}
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	updates := make(chan []config.BackendServer, 10)
+	path := filepath.Join(t.TempDir(), "servers.yaml")
+
+	NewFile("test", config.FileDiscovery{Path: path, Interval: 10 * time.Millisecond}).Start(testContext(t), func(servers []config.BackendServer) {
+		updates <- servers
+	})
+
+	select {
+	case servers := <-updates:
+		t.Fatalf("Unexpected update without a file %v", servers)
+	default:
+	}
+
+	writeFile(t, path, "- url: http://10.0.0.1:8080\n")
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 1 {
+			t.Errorf("Expected 1 server, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the file was created")
+	}
+}
+
+// Helper function to write a file with a new modification time
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+
+	// Coarse file system clocks could keep the modification time of the last write
+	modTime := time.Now().Add(time.Duration(len(data)) * time.Millisecond)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to touch %s: %v", path, err)
+	}
+}
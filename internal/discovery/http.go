@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// Max size of a servers list response
+const maxHTTPBodySize = 10 << 20
+
+// HTTP poll the servers of a backend from an http endpoint returning a json / yaml list of servers,
+// the ETag of the last response is sent back so an unchanged list can be answered by 304 Not Modified
+type HTTP struct {
+	backend string
+	config  config.HTTPDiscovery
+	client  *http.Client
+
+	etag    string
+	servers []config.BackendServer // Of the last response
+}
+
+func NewHTTP(backend string, endpoint config.HTTPDiscovery) *HTTP {
+	return &HTTP{backend: backend, config: endpoint, client: &http.Client{Timeout: endpoint.Timeout}}
+}
+
+// Start fetch the servers and pass them to update, then keep polling the endpoint and pass the servers again when they change.
+// A failed poll (unreachable, non 2xx status or invalid list) keeps the last servers
+func (h *HTTP) Start(ctx context.Context, update func([]config.BackendServer)) {
+	poll(ctx, h.backend, "http "+h.config.URL, h.config.Interval, h.fetch, update)
+}
+
+func (h *HTTP) fetch(ctx context.Context) ([]config.BackendServer, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, h.config.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Accept", "application/json, application/yaml")
+	for name, value := range h.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	if h.etag != "" {
+		request.Header.Set("If-None-Match", h.etag)
+	}
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && h.servers != nil {
+		return h.servers, nil
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxHTTPBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := parseServers(data)
+	if err != nil {
+		return nil, err
+	}
+
+	h.etag, h.servers = response.Header.Get("ETag"), servers
+	return servers, nil
+}
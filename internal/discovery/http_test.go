@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	var mu sync.Mutex
+	body, etag, status := `[{"url": "http://10.0.0.1:8080"}]`, `"v1"`, http.StatusOK
+	notModified := 0
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer endpoint.Close()
+
+	set := func(newBody string, newETag string, newStatus int) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, etag, status = newBody, newETag, newStatus
+	}
+
+	updates := make(chan []config.BackendServer, 10)
+	NewHTTP("test", config.HTTPDiscovery{
+		URL:      endpoint.URL,
+		Interval: 10 * time.Millisecond,
+		Timeout:  time.Second,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+	}).Start(testContext(t), func(servers []config.BackendServer) { updates <- servers })
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 1 {
+			t.Fatalf("Expected 1 server, got %v", servers)
+		}
+	default:
+		t.Fatal("Expected the servers before Start returns")
+	}
+
+	// Unchanged lists are answered by 304 and don't update the pool
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if notModified == 0 {
+		t.Error("Expected the etag to be sent back")
+	}
+	mu.Unlock()
+
+	// A failing endpoint keeps the last servers
+	set("", `"v2"`, http.StatusInternalServerError)
+
+	select {
+	case servers := <-updates:
+		t.Fatalf("Unexpected update from a failing endpoint %v", servers)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	set(`[{"url": "http://10.0.0.1:8080"}, {"url": "http://10.0.0.2:8080"}]`, `"v3"`, http.StatusOK)
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 2 {
+			t.Errorf("Expected 2 servers, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the list changed")
+	}
+}
@@ -0,0 +1,215 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/kubernetes"
+	"github.com/hvuhsg/gatego/internal/wait"
+)
+
+// Wait after a failed first list of the EndpointSlices
+const kubernetesRetry = time.Second * 5
+
+// Kubernetes take the servers of a backend from the EndpointSlices of a kubernetes service, the ready endpoints are servers
+// and the terminating endpoints that are still serving are draining servers
+type Kubernetes struct {
+	backend string
+	config  config.KubernetesDiscovery
+	cluster config.Kubernetes
+	retry   time.Duration
+}
+
+type service struct {
+	Spec struct {
+		Ports []struct {
+			Name string
+			Port int
+		}
+	}
+}
+
+type endpointSlice struct {
+	Ports []struct {
+		Name *string
+		Port *int
+	}
+	Endpoints []struct {
+		Addresses  []string
+		Zone       *string
+		Conditions struct {
+			Ready       *bool // Unknown is ready
+			Serving     *bool
+			Terminating *bool
+		}
+	}
+}
+
+// NewKubernetes return the provider of the service, the in-cluster config is used when cluster is nil
+func NewKubernetes(backend string, service config.KubernetesDiscovery, cluster *config.Kubernetes) *Kubernetes {
+	if cluster == nil {
+		cluster = &config.Kubernetes{}
+	}
+
+	return &Kubernetes{backend: backend, config: service, cluster: *cluster, retry: kubernetesRetry}
+}
+
+// Start load the endpoints and pass them to update, then keep watching the EndpointSlices of the service (until ctx is done)
+// and pass the endpoints again when they change. A failed watch keeps the last servers
+func (k *Kubernetes) Start(ctx context.Context, update func([]config.BackendServer)) {
+	client, err := kubernetes.NewClient(k.cluster)
+	if err != nil {
+		log.Default().Printf("Backend <%s> kubernetes service %s/%s failed: %s\n", k.backend, k.config.Namespace, k.config.Service, err.Error())
+		return
+	}
+
+	path := "/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(k.config.Namespace) + "/endpointslices"
+	query := url.Values{"labelSelector": {"kubernetes.io/service-name=" + k.config.Service}}
+
+	// The port name is resolved on every list of the EndpointSlices (before their update), the events don't look up the service
+	portName := ""
+	listed := func(ctx context.Context) error {
+		name, err := k.portName(ctx, client)
+		if err == nil {
+			portName = name
+		}
+		return err
+	}
+
+	watch := func() error {
+		return client.WatchListed(ctx, path, query, listed, k.update(func() string { return portName }, update))
+	}
+
+	if err := watch(); err != nil {
+		log.Default().Printf("Backend <%s> kubernetes service %s/%s failed: %s\n", k.backend, k.config.Namespace, k.config.Service, err.Error())
+
+		// The watch starts once the endpoints are listed
+		go func() {
+			for wait.Sleep(ctx, k.retry) {
+				if err := watch(); err == nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// update return the update function of the EndpointSlices watch, the servers on the current port name are passed to update when they change
+func (k *Kubernetes) update(portName func() string, update func([]config.BackendServer)) func([]json.RawMessage) {
+	var mu sync.Mutex
+	var last []config.BackendServer
+
+	return func(objects []json.RawMessage) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		servers, err := k.servers(portName(), objects)
+		if err != nil {
+			log.Default().Printf("Backend <%s> kubernetes service %s/%s failed, keeping the last servers: %s\n", k.backend, k.config.Namespace, k.config.Service, err.Error())
+			return
+		}
+
+		if last != nil && slices.Equal(servers, last) {
+			return
+		}
+
+		log.Default().Printf("Backend <%s> kubernetes service %s/%s loaded %d servers\n", k.backend, k.config.Namespace, k.config.Service, len(servers))
+		update(servers)
+		last = servers
+	}
+}
+
+// servers return the servers of the endpoints of the slices on the port (name) of the backend
+func (k *Kubernetes) servers(portName string, objects []json.RawMessage) ([]config.BackendServer, error) {
+	scheme := k.config.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	servers := []config.BackendServer{}
+	for _, object := range objects {
+		var slice endpointSlice
+		if err := json.Unmarshal(object, &slice); err != nil {
+			return nil, fmt.Errorf("invalid endpointslice: %w", err)
+		}
+
+		port := 0
+		for _, slicePort := range slice.Ports {
+			name := ""
+			if slicePort.Name != nil {
+				name = *slicePort.Name
+			}
+
+			if slicePort.Port != nil && (name == portName || (portName == "" && len(slice.Ports) == 1)) {
+				port = *slicePort.Port
+			}
+		}
+
+		if port == 0 {
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			conditions := endpoint.Conditions
+			ready := conditions.Ready == nil || *conditions.Ready
+			draining := !ready && conditions.Serving != nil && *conditions.Serving && conditions.Terminating != nil && *conditions.Terminating
+
+			if !ready && !draining {
+				continue
+			}
+
+			zone := ""
+			if endpoint.Zone != nil {
+				zone = *endpoint.Zone
+			}
+
+			// The addresses of an endpoint are the same pod
+			if len(endpoint.Addresses) > 0 {
+				servers = append(servers, config.BackendServer{
+					URL:      scheme + "://" + net.JoinHostPort(endpoint.Addresses[0], strconv.Itoa(port)),
+					Weight:   1,
+					Zone:     zone,
+					Draining: draining,
+				})
+			}
+		}
+	}
+
+	return sortServers(servers), nil
+}
+
+// portName return the name of the service port of the backend (the port of the EndpointSlices is the target port),
+// the number of the port is looked up in the service
+func (k *Kubernetes) portName(ctx context.Context, client *kubernetes.Client) (string, error) {
+	number, err := strconv.Atoi(k.config.Port)
+	if err != nil {
+		return k.config.Port, nil
+	}
+
+	var s service
+	found, err := client.Get(ctx, "/api/v1/namespaces/"+url.PathEscape(k.config.Namespace)+"/services/"+url.PathEscape(k.config.Service), &s)
+	if err != nil {
+		return "", err
+	}
+
+	if !found {
+		return "", fmt.Errorf("service %s/%s not found", k.config.Namespace, k.config.Service)
+	}
+
+	for _, port := range s.Spec.Ports {
+		if port.Port == number {
+			return port.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("service %s/%s has no port %d", k.config.Namespace, k.config.Service, number)
+}
@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/kubernetes/kubernetestest"
+)
+
+const endpointSlices = "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices"
+
+func TestKubernetesProvider(t *testing.T) {
+	server := kubernetestest.NewServer(t, "")
+	server.Apply("/api/v1/namespaces/shop/services", map[string]any{
+		"metadata": map[string]any{"namespace": "shop", "name": "api"},
+		"spec":     map[string]any{"ports": []any{map[string]any{"name": "http", "port": 80}, map[string]any{"name": "metrics", "port": 9090}}},
+	})
+	server.Apply(endpointSlices, endpointSliceResource("api-abc", "api", []any{
+		endpoint("10.0.0.1", true, false, "eu-west-1a"),
+		endpoint("10.0.0.2", false, true, ""),  // Terminating and serving
+		endpoint("10.0.0.3", false, false, ""), // Not ready
+	}))
+	server.Apply(endpointSlices, endpointSliceResource("web-abc", "web", []any{endpoint("10.0.0.9", true, false, "")}))
+
+	tests := []struct {
+		name     string
+		port     string
+		expected []config.BackendServer
+	}{
+		{
+			name: "Port by number",
+			port: "80",
+			expected: []config.BackendServer{
+				{URL: "http://10.0.0.1:8080", Weight: 1, Zone: "eu-west-1a"},
+				{URL: "http://10.0.0.2:8080", Weight: 1, Draining: true},
+			},
+		},
+		{
+			name: "Port by name",
+			port: "metrics",
+			expected: []config.BackendServer{
+				{URL: "http://10.0.0.1:9100", Weight: 1, Zone: "eu-west-1a"},
+				{URL: "http://10.0.0.2:9100", Weight: 1, Draining: true},
+			},
+		},
+		{
+			name:     "Unknown port",
+			port:     "8443",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestKubernetes(server, config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: tt.port})
+
+			var servers []config.BackendServer
+			provider.Start(testContext(t), func(updated []config.BackendServer) { servers = updated })
+
+			if !slices.Equal(servers, tt.expected) {
+				t.Errorf("got servers %v want %v", servers, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKubernetesProviderWatch(t *testing.T) {
+	server := kubernetestest.NewServer(t, "")
+	server.Apply("/api/v1/namespaces/shop/services", map[string]any{
+		"metadata": map[string]any{"namespace": "shop", "name": "api"},
+		"spec":     map[string]any{"ports": []any{map[string]any{"name": "http", "port": 80}}},
+	})
+	server.Apply(endpointSlices, endpointSliceResource("api-abc", "api", []any{endpoint("10.0.0.1", true, false, "")}))
+
+	updates := make(chan []config.BackendServer, 10)
+	provider := newTestKubernetes(server, config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: "80"})
+	provider.Start(testContext(t), func(servers []config.BackendServer) { updates <- servers })
+
+	if servers := <-updates; len(servers) != 1 {
+		t.Fatalf("Expected 1 server, got %v", servers)
+	}
+
+	// The port name is resolved once, the events don't look up the service
+	server.Delete("/api/v1/namespaces/shop/services", "api")
+
+	// Scaled up
+	server.Apply(endpointSlices, endpointSliceResource("api-abc", "api", []any{
+		endpoint("10.0.0.1", true, false, ""),
+		endpoint("10.0.0.2", true, false, ""),
+	}))
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 2 {
+			t.Errorf("Expected 2 servers, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the endpoints changed")
+	}
+
+	// The port name is resolved again when the EndpointSlices are listed again
+	server.Apply("/api/v1/namespaces/shop/services", map[string]any{
+		"metadata": map[string]any{"namespace": "shop", "name": "api"},
+		"spec":     map[string]any{"ports": []any{map[string]any{"name": "metrics", "port": 80}}},
+	})
+	server.Expire()
+
+	select {
+	case servers := <-updates:
+		if len(servers) != 2 || servers[0].URL != "http://10.0.0.1:9100" {
+			t.Errorf("Expected 2 servers on the metrics port, got %v", servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the service port changed")
+	}
+}
+
+// Helper function to create a kubernetes provider of the fake api server
+func newTestKubernetes(server *kubernetestest.Server, service config.KubernetesDiscovery) *Kubernetes {
+	provider := NewKubernetes("test", service, nil)
+	provider.cluster = config.Kubernetes{APIServer: server.URL}
+
+	return provider
+}
+
+// Helper function to create an EndpointSlice of a service with the http (8080) and metrics (9100) target ports
+func endpointSliceResource(name string, service string, endpoints []any) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{
+			"namespace": "shop",
+			"name":      name,
+			"labels":    map[string]any{"kubernetes.io/service-name": service},
+		},
+		"addressType": "IPv4",
+		"ports":       []any{map[string]any{"name": "http", "port": 8080}, map[string]any{"name": "metrics", "port": 9100}},
+		"endpoints":   endpoints,
+	}
+}
+
+// Helper function to create an endpoint with its conditions
+func endpoint(address string, ready bool, terminating bool, zone string) map[string]any {
+	e := map[string]any{
+		"addresses":  []any{address},
+		"conditions": map[string]any{"ready": ready, "serving": ready || terminating, "terminating": terminating},
+	}
+	if zone != "" {
+		e["zone"] = zone
+	}
+
+	return e
+}
@@ -0,0 +1,112 @@
+// This package discover the servers of the backends at runtime (dns, a watched file, an http endpoint, consul, kubernetes or docker),
+// the providers pass the servers to an update function (the pool of the backend)
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/wait"
+	"gopkg.in/yaml.v3"
+)
+
+// Provider supply the servers of a backend at runtime
+type Provider interface {
+	// Start pass the current servers to update before it returns, then keep passing the servers when they change until ctx is done
+	Start(ctx context.Context, update func([]config.BackendServer))
+}
+
+// Agents are the discovery services of the instance used by the providers, nil is the default
+type Agents struct {
+	Consul     *config.Consul
+	Kubernetes *config.Kubernetes
+	Docker     *config.Docker
+}
+
+// New return the provider of the backend, nil when the backend has a static servers list
+func New(backendName string, backend config.Backend, agents Agents) Provider {
+	switch {
+	case backend.DNS != nil:
+		return NewDNS(backendName, *backend.DNS)
+	case backend.File != nil:
+		return NewFile(backendName, *backend.File)
+	case backend.HTTP != nil:
+		return NewHTTP(backendName, *backend.HTTP)
+	case backend.Consul != nil:
+		return NewConsul(backendName, *backend.Consul, agents.Consul)
+	case backend.Kubernetes != nil:
+		return NewKubernetes(backendName, *backend.Kubernetes, agents.Kubernetes)
+	case backend.Docker != nil:
+		return NewDocker(backendName, *backend.Docker, agents.Docker)
+	}
+
+	return nil
+}
+
+// poll fetch the servers before it returns, then every interval in the background (until ctx is done). The servers are passed
+// to update when they change, a failed fetch keeps the last servers
+func poll(ctx context.Context, backend string, source string, interval time.Duration, fetch func(context.Context) ([]config.BackendServer, error), update func([]config.BackendServer)) {
+	last, err := fetch(ctx)
+	if err != nil {
+		log.Default().Printf("Backend <%s> %s failed: %s\n", backend, source, err.Error())
+	} else {
+		log.Default().Printf("Backend <%s> %s loaded %d servers\n", backend, source, len(last))
+		update(last)
+	}
+
+	go func() {
+		for wait.Sleep(ctx, interval) {
+			servers, err := fetch(ctx)
+			if err != nil {
+				log.Default().Printf("Backend <%s> %s failed, keeping the last servers: %s\n", backend, source, err.Error())
+				continue
+			}
+
+			if !slices.Equal(servers, last) {
+				log.Default().Printf("Backend <%s> %s loaded %d servers\n", backend, source, len(servers))
+				update(servers)
+				last = servers
+			}
+		}
+	}()
+}
+
+// parseServers decode a json / yaml list of servers (the fields of the config servers), the list is rejected as a whole
+// when a server is invalid
+func parseServers(data []byte) ([]config.BackendServer, error) {
+	// An empty document is a file in the middle of a write, an empty list is "[]"
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, errors.New("empty servers list document")
+	}
+
+	var servers []config.BackendServer
+	if err := yaml.Unmarshal(data, &servers); err != nil {
+		return nil, fmt.Errorf("invalid servers list: %w", err)
+	}
+
+	for _, server := range servers {
+		if err := server.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return sortServers(servers), nil
+}
+
+// sortServers sort the servers by url and drop the duplicates (the first entry of a url is kept)
+func sortServers(servers []config.BackendServer) []config.BackendServer {
+	slices.SortFunc(servers, func(a, b config.BackendServer) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+
+	return slices.CompactFunc(servers, func(a, b config.BackendServer) bool {
+		return a.URL == b.URL
+	})
+}
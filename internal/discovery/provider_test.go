@@ -0,0 +1,109 @@
+package discovery
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestParseServers(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []config.BackendServer
+		wantErr  bool
+	}{
+		{
+			name: "JSON list",
+			data: `[{"url": "http://10.0.0.2:8080", "weight": 2}, {"url": "http://10.0.0.1:8080", "zone": "eu-west-1a"}]`,
+			expected: []config.BackendServer{
+				{URL: "http://10.0.0.1:8080", Zone: "eu-west-1a"},
+				{URL: "http://10.0.0.2:8080", Weight: 2},
+			},
+		},
+		{
+			name: "YAML list",
+			data: "- url: http://10.0.0.1:8080\n  priority: 1\n- url: http://10.0.0.2:8080\n  backup: true\n",
+			expected: []config.BackendServer{
+				{URL: "http://10.0.0.1:8080", Priority: 1},
+				{URL: "http://10.0.0.2:8080", Backup: true},
+			},
+		},
+		{
+			name:     "Duplicate servers",
+			data:     `[{"url": "http://10.0.0.1:8080", "weight": 2}, {"url": "http://10.0.0.1:8080"}]`,
+			expected: []config.BackendServer{{URL: "http://10.0.0.1:8080", Weight: 2}},
+		},
+		{name: "Empty list", data: "[]", expected: []config.BackendServer{}},
+		{name: "Empty document", data: "\n", wantErr: true},
+		{name: "Invalid document", data: `{"url": `, wantErr: true},
+		{name: "Invalid server url", data: `[{"url": "not-a-url"}]`, wantErr: true},
+		{name: "Backup server with a priority", data: `[{"url": "http://10.0.0.1:8080", "priority": 1, "backup": true}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, err := parseServers([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseServers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(servers, tt.expected) {
+				t.Errorf("got servers %v want %v", servers, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  config.Backend
+		expected Provider
+	}{
+		{"Static servers", config.Backend{Servers: []config.BackendServer{{URL: "http://10.0.0.1:8080"}}}, nil},
+		{"DNS", config.Backend{DNS: &config.DNSDiscovery{Name: "api.local", Resolver: "127.0.0.1:53"}}, &DNS{}},
+		{"File", config.Backend{File: &config.FileDiscovery{Path: "servers.json"}}, &File{}},
+		{"HTTP", config.Backend{HTTP: &config.HTTPDiscovery{URL: "http://deploy.local/servers"}}, &HTTP{}},
+		{"Docker", config.Backend{Docker: &config.DockerDiscovery{Domain: "app.localhost", Path: "/"}}, &Docker{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := New("test", tt.backend, Agents{})
+
+			switch tt.expected.(type) {
+			case nil:
+				if provider != nil {
+					t.Errorf("Expected no provider, got %T", provider)
+				}
+			case *DNS:
+				if _, ok := provider.(*DNS); !ok {
+					t.Errorf("Expected a dns provider, got %T", provider)
+				}
+			case *File:
+				if _, ok := provider.(*File); !ok {
+					t.Errorf("Expected a file provider, got %T", provider)
+				}
+			case *HTTP:
+				if _, ok := provider.(*HTTP); !ok {
+					t.Errorf("Expected an http provider, got %T", provider)
+				}
+			case *Docker:
+				if _, ok := provider.(*Docker); !ok {
+					t.Errorf("Expected a docker provider, got %T", provider)
+				}
+			}
+		})
+	}
+}
+
+// Helper function to create a context canceled when the test ends (stops the providers)
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return ctx
+}
@@ -0,0 +1,121 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// Shared run one provider per discovery source, the backends of the same source (e.g. the routes of a kubernetes service)
+// share its servers and watch. The provider of a source stops after its last backend stops, a nil Shared runs a provider per backend
+type Shared struct {
+	mu      sync.Mutex
+	sources map[string]*source
+}
+
+// source is a running provider and the update functions of its backends
+type source struct {
+	stop context.CancelFunc
+
+	mu      sync.Mutex // Serialize the updates
+	servers []config.BackendServer
+	loaded  bool
+	updates map[int]func([]config.BackendServer)
+	next    int
+}
+
+func NewShared() *Shared {
+	return &Shared{sources: map[string]*source{}}
+}
+
+// Source return the key of the discovery source of the backend, the backends of the same key discover the same servers
+func Source(backend config.Backend, agents Agents) string {
+	key, _ := json.Marshal(struct {
+		DNS        *config.DNSDiscovery
+		File       *config.FileDiscovery
+		HTTP       *config.HTTPDiscovery
+		Consul     *config.ConsulDiscovery
+		Kubernetes *config.KubernetesDiscovery
+		Docker     *config.DockerDiscovery
+		Agents     Agents
+	}{backend.DNS, backend.File, backend.HTTP, backend.Consul, backend.Kubernetes, backend.Docker, agents})
+
+	return string(key)
+}
+
+// Start is the Start of the provider shared by the backends of the source (the provider of the first backend runs), the servers
+// are passed to update until ctx is done. A backend joining a running source gets its current servers before Start returns
+func (s *Shared) Start(ctx context.Context, key string, provider Provider, update func([]config.BackendServer)) {
+	if s == nil {
+		provider.Start(ctx, update)
+		return
+	}
+
+	s.mu.Lock()
+	src, running := s.sources[key]
+	var sourceCtx context.Context
+	if !running {
+		src = &source{updates: map[int]func([]config.BackendServer){}}
+		sourceCtx, src.stop = context.WithCancel(context.WithoutCancel(ctx))
+		s.sources[key] = src
+	}
+	id := src.subscribe(update)
+	s.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if src.unsubscribe(id) == 0 {
+			if s.sources[key] == src {
+				delete(s.sources, key)
+			}
+			src.stop()
+		}
+	})
+
+	if !running {
+		provider.Start(sourceCtx, src.publish)
+	}
+}
+
+// subscribe add the update function of a backend, the current servers are passed to it
+func (src *source) subscribe(update func([]config.BackendServer)) int {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	id := src.next
+	src.next++
+	src.updates[id] = update
+
+	if src.loaded {
+		update(slices.Clone(src.servers))
+	}
+
+	return id
+}
+
+// unsubscribe remove the update function of a backend, it returns the number of backends left
+func (src *source) unsubscribe(id int) int {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	delete(src.updates, id)
+	return len(src.updates)
+}
+
+// publish pass the servers of the provider to the backends
+func (src *source) publish(servers []config.BackendServer) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	src.servers = servers
+	src.loaded = true
+
+	for _, update := range src.updates {
+		update(slices.Clone(servers))
+	}
+}
@@ -0,0 +1,97 @@
+package discovery
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// fakeProvider pass the servers given to set, it counts its starts
+type fakeProvider struct {
+	mu      sync.Mutex
+	starts  int
+	ctx     context.Context
+	update  func([]config.BackendServer)
+	servers []config.BackendServer
+}
+
+func (p *fakeProvider) Start(ctx context.Context, update func([]config.BackendServer)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.starts++
+	p.ctx, p.update = ctx, update
+	update(p.servers)
+}
+
+func (p *fakeProvider) set(servers []config.BackendServer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.servers = servers
+	p.update(servers)
+}
+
+func TestSharedStart(t *testing.T) {
+	shared := NewShared()
+	provider := &fakeProvider{servers: []config.BackendServer{{URL: "http://10.0.0.1:8080", Weight: 1}}}
+	key := Source(config.Backend{Kubernetes: &config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: "80"}}, Agents{})
+
+	firstCtx, firstStop := context.WithCancel(context.Background())
+	secondCtx, secondStop := context.WithCancel(context.Background())
+	defer secondStop()
+
+	var first, second []config.BackendServer
+	shared.Start(firstCtx, key, provider, func(servers []config.BackendServer) { first = servers })
+	shared.Start(secondCtx, key, &fakeProvider{}, func(servers []config.BackendServer) { second = servers })
+
+	if provider.starts != 1 {
+		t.Fatalf("Expected the provider of the source to start once, got %d", provider.starts)
+	}
+
+	if !slices.Equal(first, provider.servers) || !slices.Equal(second, provider.servers) {
+		t.Fatalf("Expected both backends to get the servers, got %v and %v", first, second)
+	}
+
+	// The provider keeps running while a backend of the source is in use
+	firstStop()
+	provider.set([]config.BackendServer{{URL: "http://10.0.0.2:8080", Weight: 1}})
+	if len(second) != 1 || second[0].URL != "http://10.0.0.2:8080" {
+		t.Errorf("Expected the second backend to get the new servers, got %v", second)
+	}
+
+	if provider.ctx.Err() != nil {
+		t.Error("Expected the provider to run while the second backend is in use")
+	}
+
+	secondStop()
+	<-provider.ctx.Done()
+
+	// The next backend of the source starts a new provider
+	next := &fakeProvider{}
+	shared.Start(context.Background(), key, next, func([]config.BackendServer) {})
+	if next.starts != 1 {
+		t.Errorf("Expected a new provider after the last backend stopped, got %d starts", next.starts)
+	}
+}
+
+func TestSource(t *testing.T) {
+	api := config.Backend{Kubernetes: &config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: "80"}}
+	apiOtherPolicy := config.Backend{BalancePolicy: "random", Kubernetes: &config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: "80"}}
+	apiOtherPort := config.Backend{Kubernetes: &config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: "9090"}}
+
+	if Source(api, Agents{}) != Source(apiOtherPolicy, Agents{}) {
+		t.Error("Expected the backends of the same service port to share the source")
+	}
+
+	if Source(api, Agents{}) == Source(apiOtherPort, Agents{}) {
+		t.Error("Expected the backends of other ports to have their own source")
+	}
+
+	if Source(api, Agents{}) == Source(api, Agents{Kubernetes: &config.Kubernetes{APIServer: "https://cluster-b"}}) {
+		t.Error("Expected the backends of other clusters to have their own source")
+	}
+}
@@ -0,0 +1,346 @@
+// This package watch the containers of the local docker engine (engine api on its unix socket), and translate the running
+// containers with gatego labels to gatego services
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/wait"
+)
+
+// Labels of the served containers
+const (
+	labelDomain = "gatego.domain" // Domain of the service
+	labelPath   = "gatego.path"   // Path of the endpoint, defaults to /
+	labelPort   = "gatego.port"   // Port of the container
+)
+
+// Wait after a failed list or events stream
+const watchRetry = time.Second * 5
+
+// Max size of the containers list
+const maxBodySize = 50 << 20
+
+// Actions of the container events that change the served containers
+var watchedActions = []string{"start", "restart", "unpause", "pause", "stop", "die", "kill", "destroy", "rename"}
+
+// Client watch the containers of a docker engine
+type Client struct {
+	client  *http.Client
+	network string
+	retry   time.Duration
+}
+
+type container struct {
+	ID              string `json:"Id"`
+	Names           []string
+	Labels          map[string]string
+	Status          string // Up 5 minutes (healthy)
+	NetworkSettings struct {
+		Networks map[string]endpointSettings
+	}
+}
+
+type endpointSettings struct {
+	IPAddress         string
+	GlobalIPv6Address string
+}
+
+type event struct {
+	Type   string
+	Action string
+}
+
+// NewClient create a client of the engine api on the socket of the config
+func NewClient(engine config.Docker) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", engine.Socket)
+		},
+	}
+
+	return &Client{client: &http.Client{Transport: transport}, network: engine.Network, retry: watchRetry}
+}
+
+// Watch pass the services of the labeled containers to update before it returns, then keep watching the container events
+// (until ctx is done) and pass the services again when they change. The backends of the paths take their servers from the
+// containers (docker service discovery), so only the domain and path labels change the services. A failed watch keeps the
+// last services, only the first error is returned
+func (c *Client) Watch(ctx context.Context, update func([]config.Service)) error {
+	var last []config.Service
+
+	return c.watch(ctx, func(containers []container) {
+		if services := buildServices(containers); last == nil || !reflect.DeepEqual(services, last) {
+			update(services)
+			last = services
+		}
+	})
+}
+
+// WatchServers pass the servers of the containers of the domain and path to update before it returns, then keep watching the
+// container events (until ctx is done) and pass the servers again when they change. A failed watch keeps the last servers,
+// only the first error is returned
+func (c *Client) WatchServers(ctx context.Context, domain string, path string, update func([]config.BackendServer)) error {
+	var last []config.BackendServer
+
+	return c.watch(ctx, func(containers []container) {
+		if servers := buildServers(containers, domain, path, c.network); last == nil || !slices.Equal(servers, last) {
+			update(servers)
+			last = servers
+		}
+	})
+}
+
+// watch pass the running labeled containers to update before it returns, then keep watching the container events (until ctx
+// is done) and pass the containers again after the events that change them. A failed watch keeps the last containers
+func (c *Client) watch(ctx context.Context, update func([]container)) error {
+	// The events are followed before the list so no change is missed between them
+	events, err := c.events(ctx)
+	if err != nil {
+		return err
+	}
+
+	containers, err := c.containers(ctx)
+	if err != nil {
+		events.Close()
+		return err
+	}
+	update(containers)
+
+	refresh := func() error {
+		containers, err := c.containers(ctx)
+		if err != nil {
+			return err
+		}
+
+		update(containers)
+		return nil
+	}
+
+	go func() {
+		for {
+			err := c.follow(events, refresh)
+			events.Close()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Default().Printf("Docker events failed, keeping the last containers: %s\n", err.Error())
+
+			// Listed again after the reconnect, the changes of the disconnection are missed otherwise
+			for {
+				if !wait.Sleep(ctx, c.retry) {
+					return
+				}
+
+				if events, err = c.events(ctx); err != nil {
+					continue
+				}
+
+				if err = refresh(); err != nil {
+					events.Close()
+					continue
+				}
+
+				break
+			}
+		}
+	}()
+
+	return nil
+}
+
+// follow call changed on the events of the stream that change the served containers, until the stream ends
+func (c *Client) follow(events io.Reader, changed func() error) error {
+	decoder := json.NewDecoder(events)
+	for {
+		var e event
+		if err := decoder.Decode(&e); err != nil {
+			return err
+		}
+
+		action, _, _ := strings.Cut(e.Action, ":")
+		if e.Type != "container" || (!slices.Contains(watchedActions, action) && action != "health_status") {
+			continue
+		}
+
+		if err := changed(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	// The host is ignored, requests are sent on the socket
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxBodySize))
+		return nil, fmt.Errorf("docker %s: status %d %s", path, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return response, nil
+}
+
+// events return the stream of the events of the labeled containers
+func (c *Client) events(ctx context.Context) (io.ReadCloser, error) {
+	filters, _ := json.Marshal(map[string][]string{"type": {"container"}, "label": {labelDomain}})
+
+	response, err := c.get(ctx, "/events", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// containers return the running labeled containers
+func (c *Client) containers(ctx context.Context) ([]container, error) {
+	filters, _ := json.Marshal(map[string][]string{"status": {"running"}, "label": {labelDomain}})
+
+	response, err := c.get(ctx, "/containers/json", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var containers []container
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxBodySize)).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("invalid docker containers list: %w", err)
+	}
+
+	return containers, nil
+}
+
+// buildServices translate the containers to services, one service per domain and one backend per path taking its servers from
+// the containers of the path
+func buildServices(containers []container) []config.Service {
+	// Sorted for stable services
+	slices.SortFunc(containers, func(a, b container) int { return strings.Compare(a.ID, b.ID) })
+
+	services := []config.Service{}
+	for _, c := range containers {
+		domain, path := containerRoute(c)
+
+		index := slices.IndexFunc(services, func(s config.Service) bool { return s.Domain == domain })
+		if index == -1 {
+			services = append(services, config.Service{Domain: domain})
+			index = len(services) - 1
+		}
+		service := &services[index]
+
+		if slices.ContainsFunc(service.Paths, func(p config.Path) bool { return p.Path == path }) {
+			continue
+		}
+
+		endpoint := config.Path{Path: path, Backend: &config.Backend{BalancePolicy: "round-robin", Docker: &config.DockerDiscovery{Domain: domain, Path: path}}}
+
+		// Checked alone so an invalid label doesn't take down the other containers of the domain
+		if err := (config.Service{Domain: domain, Paths: []config.Path{endpoint}}).Validate(); err != nil {
+			log.Default().Printf("Docker container %s skipped: %s\n", containerName(c), err.Error())
+			if len(service.Paths) == 0 {
+				services = services[:index]
+			}
+			continue
+		}
+
+		service.Paths = append(service.Paths, endpoint)
+	}
+
+	return services
+}
+
+// buildServers return the servers of the containers of the domain and path, sorted by url
+func buildServers(containers []container, domain string, path string, network string) []config.BackendServer {
+	servers := []config.BackendServer{}
+	for _, c := range containers {
+		if containerDomain, containerPath := containerRoute(c); containerDomain != domain || containerPath != path {
+			continue
+		}
+
+		// Containers with a failing or pending health check are out of the rotation, containers without a health check are served
+		if strings.Contains(c.Status, "(unhealthy)") || strings.Contains(c.Status, "(health: starting)") {
+			continue
+		}
+
+		port, err := strconv.ParseUint(c.Labels[labelPort], 10, 16)
+		if err != nil || port == 0 {
+			log.Default().Printf("Docker container %s skipped: invalid %s label '%s'\n", containerName(c), labelPort, c.Labels[labelPort])
+			continue
+		}
+
+		address := containerAddress(c, network)
+		if address == "" {
+			log.Default().Printf("Docker container %s skipped: no address on the network\n", containerName(c))
+			continue
+		}
+
+		servers = append(servers, config.BackendServer{URL: "http://" + net.JoinHostPort(address, strconv.FormatUint(port, 10)), Weight: 1})
+	}
+
+	slices.SortFunc(servers, func(a, b config.BackendServer) int { return strings.Compare(a.URL, b.URL) })
+	return servers
+}
+
+// containerRoute return the domain and path of the labels of the container
+func containerRoute(c container) (string, string) {
+	path := c.Labels[labelPath]
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.ToLower(c.Labels[labelDomain]), path
+}
+
+func containerName(c container) string {
+	return strings.TrimPrefix(strings.Join(c.Names, ","), "/")
+}
+
+// containerAddress return the address of the container on the network (the first network by name when empty)
+func containerAddress(c container, network string) string {
+	names := make([]string, 0, len(c.NetworkSettings.Networks))
+	for name := range c.NetworkSettings.Networks {
+		if network == "" || name == network {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		settings := c.NetworkSettings.Networks[name]
+		if settings.IPAddress != "" {
+			return settings.IPAddress
+		}
+
+		if settings.GlobalIPv6Address != "" {
+			return settings.GlobalIPv6Address
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,375 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// stubEngine is a stand-in for the docker engine api, it serves the containers list and streams the container events
+type stubEngine struct {
+	socket string
+
+	mu         sync.Mutex
+	containers []container
+	events     chan event
+	filters    []string
+	disconnect chan struct{}
+}
+
+func TestBuildServices(t *testing.T) {
+	containers := []container{
+		testContainer("c", map[string]string{labelDomain: "Shop.Example.com", labelPort: "8080"}, "Up 1 minute", "bridge", "172.17.0.4"),
+		testContainer("a", map[string]string{labelDomain: "shop.example.com", labelPort: "8080"}, "Up 1 minute (healthy)", "bridge", "172.17.0.2"),
+		testContainer("b", map[string]string{labelDomain: "shop.example.com", labelPath: "/api/", labelPort: "3000"}, "Up 1 minute", "bridge", "172.17.0.3"),
+		testContainer("g", map[string]string{labelDomain: "invalid.example.com", labelPath: "api", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.8"),
+	}
+
+	services := buildServices(containers)
+
+	if len(services) != 1 || services[0].Domain != "shop.example.com" {
+		t.Fatalf("Expected the service of the valid containers, got %+v", services)
+	}
+
+	paths := services[0].Paths
+	if len(paths) != 2 || paths[0].Path != "/" || paths[1].Path != "/api/" {
+		t.Fatalf("Expected a path per label, got %+v", paths)
+	}
+
+	discovery := paths[1].Backend.Docker
+	if discovery == nil || discovery.Domain != "shop.example.com" || discovery.Path != "/api/" || len(paths[1].Backend.Servers) != 0 {
+		t.Errorf("Expected the backend to discover the containers of the path, got %+v", paths[1].Backend)
+	}
+}
+
+func TestBuildServers(t *testing.T) {
+	containers := []container{
+		testContainer("c", map[string]string{labelDomain: "Shop.Example.com", labelPort: "8080"}, "Up 1 minute", "bridge", "172.17.0.4"),
+		testContainer("a", map[string]string{labelDomain: "shop.example.com", labelPort: "8080"}, "Up 1 minute (healthy)", "bridge", "172.17.0.2"),
+		testContainer("b", map[string]string{labelDomain: "shop.example.com", labelPath: "/api/", labelPort: "3000"}, "Up 1 minute", "bridge", "172.17.0.3"),
+		testContainer("d", map[string]string{labelDomain: "shop.example.com", labelPort: "8080"}, "Up 1 minute (unhealthy)", "bridge", "172.17.0.5"),
+		testContainer("e", map[string]string{labelDomain: "shop.example.com", labelPort: "8080"}, "Up 1 second (health: starting)", "bridge", "172.17.0.6"),
+		testContainer("f", map[string]string{labelDomain: "shop.example.com", labelPort: "http"}, "Up 1 minute", "bridge", "172.17.0.7"),
+		testContainer("h", map[string]string{labelDomain: "shop.example.com", labelPort: "80"}, "Up 1 minute", "", ""),
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected []config.BackendServer
+	}{
+		{
+			name:     "Healthy containers of the path",
+			path:     "/",
+			expected: []config.BackendServer{{URL: "http://172.17.0.2:8080", Weight: 1}, {URL: "http://172.17.0.4:8080", Weight: 1}},
+		},
+		{
+			name:     "Port of the label",
+			path:     "/api/",
+			expected: []config.BackendServer{{URL: "http://172.17.0.3:3000", Weight: 1}},
+		},
+		{
+			name:     "No containers",
+			path:     "/blog/",
+			expected: []config.BackendServer{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if servers := buildServers(containers, "shop.example.com", tt.path, ""); !slices.Equal(servers, tt.expected) {
+				t.Errorf("got servers %v want %v", servers, tt.expected)
+			}
+		})
+	}
+}
+
+func TestContainerAddress(t *testing.T) {
+	c := testContainer("a", nil, "", "frontend", "10.0.1.2")
+	c.NetworkSettings.Networks["backend"] = endpointSettings{IPAddress: "10.0.2.2"}
+	c.NetworkSettings.Networks["ipv6"] = endpointSettings{GlobalIPv6Address: "fd00::2"}
+
+	tests := []struct {
+		network  string
+		expected string
+	}{
+		{network: "", expected: "10.0.2.2"},
+		{network: "frontend", expected: "10.0.1.2"},
+		{network: "ipv6", expected: "fd00::2"},
+		{network: "missing", expected: ""},
+	}
+
+	for _, tt := range tests {
+		if address := containerAddress(c, tt.network); address != tt.expected {
+			t.Errorf("network %q: got address %q want %q", tt.network, address, tt.expected)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	engine := startEngine(t)
+	engine.setContainers(testContainer("a", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.2"))
+
+	updates := make(chan []config.Service, 10)
+	if err := engine.client().Watch(testContext(t), func(services []config.Service) { updates <- services }); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	select {
+	case services := <-updates:
+		if len(services) != 1 || services[0].Domain != "www.example.com" {
+			t.Fatalf("Expected the service of the container, got %+v", services)
+		}
+	default:
+		t.Fatal("Expected the services before Watch returns")
+	}
+
+	if filters := engine.requestFilters(); !slices.Equal(filters, []string{
+		`{"label":["gatego.domain"],"type":["container"]}`,
+		`{"label":["gatego.domain"],"status":["running"]}`,
+	}) {
+		t.Errorf("Expected the events stream before the list, got filters %v", filters)
+	}
+
+	// The containers of the domain change, the services don't
+	engine.setContainers(
+		testContainer("a", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.2"),
+		testContainer("b", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 second", "bridge", "172.17.0.3"),
+	)
+	engine.events <- event{Type: "container", Action: "start"}
+	expectNoUpdate(t, updates)
+
+	// A container of a new path
+	engine.setContainers(
+		testContainer("a", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.2"),
+		testContainer("c", map[string]string{labelDomain: "www.example.com", labelPath: "/api/", labelPort: "80"}, "Up 1 second", "bridge", "172.17.0.4"),
+	)
+	engine.events <- event{Type: "container", Action: "start"}
+	expectPaths(t, updates, "/", "/api/")
+
+	// Changes while the events stream is down are listed after the reconnect
+	engine.setContainers(testContainer("c", map[string]string{labelDomain: "www.example.com", labelPath: "/api/", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.4"))
+	engine.disconnectStreams()
+	expectPaths(t, updates, "/api/")
+
+	engine.setContainers()
+	engine.events <- event{Type: "container", Action: "die"}
+
+	select {
+	case services := <-updates:
+		if len(services) != 0 {
+			t.Errorf("Expected no services after the containers stopped, got %+v", services)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the container stopped")
+	}
+}
+
+func TestWatchServers(t *testing.T) {
+	engine := startEngine(t)
+	engine.setContainers(testContainer("a", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.2"))
+
+	updates := make(chan []config.BackendServer, 10)
+	if err := engine.client().WatchServers(testContext(t), "www.example.com", "/", func(servers []config.BackendServer) { updates <- servers }); err != nil {
+		t.Fatalf("WatchServers failed: %v", err)
+	}
+
+	expectServers(t, updates, "http://172.17.0.2:80")
+
+	// A second container of the path is started
+	engine.setContainers(
+		testContainer("a", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 minute", "bridge", "172.17.0.2"),
+		testContainer("b", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 second", "bridge", "172.17.0.3"),
+	)
+	engine.events <- event{Type: "container", Action: "start"}
+	expectServers(t, updates, "http://172.17.0.2:80", "http://172.17.0.3:80")
+
+	// Events that don't change the containers are ignored
+	engine.events <- event{Type: "container", Action: "exec_start: sh"}
+	engine.events <- event{Type: "container", Action: "health_status: healthy"}
+	expectNoUpdate(t, updates)
+
+	// A failing health check takes the container out of the rotation
+	engine.setContainers(
+		testContainer("a", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 minute (unhealthy)", "bridge", "172.17.0.2"),
+		testContainer("b", map[string]string{labelDomain: "www.example.com", labelPort: "80"}, "Up 1 second", "bridge", "172.17.0.3"),
+	)
+	engine.events <- event{Type: "container", Action: "health_status: unhealthy"}
+	expectServers(t, updates, "http://172.17.0.3:80")
+}
+
+func TestWatchUnreachable(t *testing.T) {
+	client := NewClient(config.Docker{Socket: filepath.Join(t.TempDir(), "missing.sock")})
+
+	if err := client.Watch(testContext(t), func([]config.Service) {}); err == nil {
+		t.Error("Expected an error for an unreachable engine")
+	}
+}
+
+// Helper function to start a stub engine on a unix socket, it is closed at the end of the test
+func startEngine(t *testing.T) *stubEngine {
+	t.Helper()
+
+	engine := &stubEngine{socket: filepath.Join(t.TempDir(), "docker.sock"), events: make(chan event), disconnect: make(chan struct{})}
+
+	listener, err := net.Listen("unix", engine.socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on the socket: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", engine.serveContainers)
+	mux.HandleFunc("GET /events", engine.serveEvents)
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return engine
+}
+
+func (e *stubEngine) client() *Client {
+	client := NewClient(config.Docker{Socket: e.socket})
+	client.retry = 10 * time.Millisecond
+
+	return client
+}
+
+func (e *stubEngine) setContainers(containers ...container) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.containers = containers
+}
+
+func (e *stubEngine) requestFilters() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return slices.Clone(e.filters)
+}
+
+// disconnectStreams end the open events streams
+func (e *stubEngine) disconnectStreams() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	close(e.disconnect)
+	e.disconnect = make(chan struct{})
+}
+
+func (e *stubEngine) serveContainers(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	e.filters = append(e.filters, r.URL.Query().Get("filters"))
+	containers := slices.Clone(e.containers)
+	e.mu.Unlock()
+
+	if containers == nil {
+		containers = []container{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(containers)
+}
+
+func (e *stubEngine) serveEvents(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	e.filters = append(e.filters, r.URL.Query().Get("filters"))
+	disconnect := e.disconnect
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case ev := <-e.events:
+			encoder.Encode(ev)
+			w.(http.Flusher).Flush()
+		case <-disconnect:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Helper function to create a running container on a network
+func testContainer(id string, labels map[string]string, status string, network string, address string) container {
+	c := container{ID: id, Names: []string{"/" + id}, Labels: labels, Status: status}
+	c.NetworkSettings.Networks = map[string]endpointSettings{}
+	if network != "" {
+		c.NetworkSettings.Networks[network] = endpointSettings{IPAddress: address}
+	}
+
+	return c
+}
+
+// Helper function to create a context canceled at the end of the test
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+// Helper function to wait for an update with the paths of the single service
+func expectPaths(t *testing.T, updates chan []config.Service, expected ...string) {
+	t.Helper()
+
+	select {
+	case services := <-updates:
+		paths := []string{}
+		if len(services) == 1 {
+			for _, path := range services[0].Paths {
+				paths = append(paths, path.Path)
+			}
+		}
+
+		if !slices.Equal(paths, expected) {
+			t.Fatalf("Expected the paths %v, got %+v", expected, services)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected an update with the paths %v", expected)
+	}
+}
+
+// Helper function to wait for an update with the servers
+func expectServers(t *testing.T, updates chan []config.BackendServer, expected ...string) {
+	t.Helper()
+
+	select {
+	case servers := <-updates:
+		urls := []string{}
+		for _, server := range servers {
+			urls = append(urls, server.URL)
+		}
+
+		if !slices.Equal(urls, expected) {
+			t.Fatalf("Expected the servers %v, got %v", expected, servers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected an update with the servers %v", expected)
+	}
+}
+
+// Helper function to check that no update is passed
+func expectNoUpdate[T any](t *testing.T, updates chan T) {
+	t.Helper()
+
+	select {
+	case update := <-updates:
+		t.Errorf("Expected no update, got %+v", update)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,195 @@
+// This package track the draining state of the backend servers, a draining server takes no new requests
+// while its in-flight requests complete. The state is set by the config and by the admin api
+
+package drain
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Server is the draining state of a backend server, a nil server is never draining
+type Server struct {
+	backend string
+	url     string
+
+	mu            sync.RWMutex
+	draining      bool
+	configured    bool // The draining state of the config when last registered
+	drainingSince time.Time
+	inFlight      func() int64
+}
+
+func (s *Server) Draining() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.draining
+}
+
+// SetDraining move the server in or out of the rotation, reason is logged
+func (s *Server) SetDraining(draining bool, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setDraining(draining, reason)
+}
+
+func (s *Server) setDraining(draining bool, reason string) {
+	if s.draining == draining {
+		return
+	}
+
+	s.draining = draining
+	if draining {
+		s.drainingSince = time.Now()
+		log.Default().Printf("Backend <%s> server %s is draining (%s)\n", s.backend, s.url, reason)
+	} else {
+		s.drainingSince = time.Time{}
+		log.Default().Printf("Backend <%s> server %s is back in the rotation (%s)\n", s.backend, s.url, reason)
+	}
+}
+
+// Status is the draining state of a server as exposed by the admin api
+type Status struct {
+	Backend       string    `json:"backend"`
+	URL           string    `json:"url"`
+	Draining      bool      `json:"draining"`
+	DrainingSince time.Time `json:"draining_since"`
+	InFlight      int64     `json:"in_flight"`
+	Drained       bool      `json:"drained"` // Draining without in-flight requests, the server can be removed
+}
+
+func (s *Server) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var inFlight int64
+	if s.inFlight != nil {
+		inFlight = s.inFlight()
+	}
+
+	return Status{
+		Backend:       s.backend,
+		URL:           s.url,
+		Draining:      s.draining,
+		DrainingSince: s.drainingSince,
+		InFlight:      inFlight,
+		Drained:       s.draining && inFlight == 0,
+	}
+}
+
+type serverKey struct {
+	backend string
+	url     string
+}
+
+// Registry hold the draining state of the servers by backend name and server url.
+// A nil registry keeps no state, every call creates a new server state
+type Registry struct {
+	mu      sync.RWMutex
+	servers []*Server // In registration order
+	index   map[serverKey]*Server
+}
+
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[serverKey]*Server)}
+}
+
+// Register return the server state, it is created on the first call. The draining state of the config is applied
+// when the server is created or the config changed it (so a reload doesn't undo the admin api), inFlight report the requests in flight
+func (r *Registry) Register(backend string, url string, draining bool, inFlight func() int64) *Server {
+	if r == nil {
+		server := &Server{backend: backend, url: url, configured: draining, inFlight: inFlight}
+		server.setDraining(draining, "config")
+		return server
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := serverKey{backend: backend, url: url}
+	server, exists := r.index[key]
+	if !exists {
+		server = &Server{backend: backend, url: url}
+		r.servers = append(r.servers, server)
+		r.index[key] = server
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if !exists || server.configured != draining {
+		server.configured = draining
+		server.setDraining(draining, "config")
+	}
+	server.inFlight = inFlight
+
+	return server
+}
+
+// Lookup return the registered server (nil when it is unknown)
+func (r *Registry) Lookup(backend string, url string) *Server {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.index[serverKey{backend: backend, url: url}]
+}
+
+// Unregister drop the state of a server removed from its backend
+func (r *Registry) Unregister(backend string, url string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := serverKey{backend: backend, url: url}
+	if existing, exists := r.index[key]; exists {
+		delete(r.index, key)
+		r.servers = slices.DeleteFunc(r.servers, func(registered *Server) bool { return registered == existing })
+	}
+}
+
+// Prune drop the state of the servers of the backends that are not in backends (removed by a reload)
+func (r *Registry) Prune(backends []string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.servers = slices.DeleteFunc(r.servers, func(server *Server) bool {
+		if slices.Contains(backends, server.backend) {
+			return false
+		}
+
+		delete(r.index, serverKey{backend: server.backend, url: server.url})
+		return true
+	})
+}
+
+// Statuses return the state of all the registered servers
+func (r *Registry) Statuses() []Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(r.servers))
+	for _, server := range r.servers {
+		statuses = append(statuses, server.Status())
+	}
+
+	return statuses
+}
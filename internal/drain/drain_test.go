@@ -0,0 +1,97 @@
+package drain
+
+import "testing"
+
+func TestRegisterConfig(t *testing.T) {
+	registry := NewRegistry()
+
+	steps := []struct {
+		name       string
+		configured bool  // The draining state of the config
+		admin      *bool // Set by the admin api after registering (nil for none)
+		draining   bool
+	}{
+		{"Not draining in the config", false, nil, false},
+		{"Drained by the admin api", false, ptr(true), true},
+		{"Reload with the same config keeps the admin state", false, nil, true},
+		{"Config drains the server", true, nil, true},
+		{"Returned by the admin api", true, ptr(false), false},
+		{"Config returns the server", false, nil, false},
+	}
+
+	for _, step := range steps {
+		server := registry.Register("example.com/api", "http://backend-1", step.configured, nil)
+		if step.admin != nil {
+			registry.Lookup("example.com/api", "http://backend-1").SetDraining(*step.admin, "admin api")
+		}
+
+		if server.Draining() != step.draining {
+			t.Errorf("%s: got draining %v want %v", step.name, server.Draining(), step.draining)
+		}
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+	registry := NewRegistry()
+
+	var inFlight int64 = 2
+	server := registry.Register("example.com/api", "http://backend-1", true, func() int64 { return inFlight })
+
+	status := server.Status()
+	if !status.Draining || status.InFlight != 2 || status.Drained || status.DrainingSince.IsZero() {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	inFlight = 0
+	if status := server.Status(); !status.Drained {
+		t.Errorf("Expected the server to be drained, got %+v", status)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	first := registry.Register("a", "http://backend-1", false, nil)
+	if registry.Register("a", "http://backend-1", false, nil) != first {
+		t.Error("Expected the same server to be returned for the same backend and url")
+	}
+
+	if registry.Lookup("a", "http://backend-2") != nil {
+		t.Error("Expected unknown servers to be nil")
+	}
+
+	if got := len(registry.Statuses()); got != 1 {
+		t.Errorf("Statuses got %d servers want 1", got)
+	}
+
+	var notRegistered *Server
+	if notRegistered.Draining() {
+		t.Error("Expected a server that is not registered to not be draining")
+	}
+}
+
+func TestRegistryPrune(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("a", "http://backend-1", false, nil)
+	registry.Register("b", "http://backend-1", false, nil).SetDraining(true, "admin api")
+
+	registry.Prune([]string{"a"})
+
+	if registry.Lookup("b", "http://backend-1") != nil {
+		t.Error("Expected the server of the removed backend to be dropped")
+	}
+
+	// A backend added back takes the draining state of its config
+	if registry.Register("b", "http://backend-1", false, nil).Draining() {
+		t.Error("Expected the server added back to be in the rotation")
+	}
+
+	if registry.Lookup("a", "http://backend-1") == nil {
+		t.Error("Expected the server of the kept backend to stay")
+	}
+}
+
+// Helper function to get a pointer to a value
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,187 @@
+// This package render the error responses generated by gatego itself
+// (unknown hosts, timeouts, rate limits, upstream failures, etc.)
+// with custom pages or RFC 7807 problem details
+
+package errorpages
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-Id"
+const ProblemContentType = "application/problem+json"
+
+var variableRegex = regexp.MustCompile(`\{(status|status_text|detail|request_id|method|path|host)\}`)
+
+// Define a custom type for context keys to avoid collisions
+type rendererKeyType string
+
+var rendererKey = rendererKeyType("error-renderer")
+
+// Page is an error page template, the body can use the variables
+// {status}, {status_text}, {detail}, {request_id}, {method}, {path} and {host}
+type Page struct {
+	ContentType string
+	Body        string
+}
+
+// Renderer write error responses, a nil renderer writes plain text errors (like http.Error)
+type Renderer struct {
+	pages       map[string]Page // Keyed by status code (404) or class (4xx)
+	problemJSON bool
+}
+
+func New(pages map[string]Page, problemJSON bool) *Renderer {
+	return &Renderer{pages: pages, problemJSON: problemJSON}
+}
+
+// Write the error response for status, detail is a human readable description of the error
+func (er *Renderer) Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if er == nil {
+		http.Error(w, detail, status)
+		return
+	}
+
+	requestID := RequestID(r)
+	if requestID == "" {
+		requestID = NewRequestID()
+	}
+	w.Header().Set(RequestIDHeader, requestID)
+
+	// Headers of the original response should not describe the error body
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if page, exists := er.page(status); exists {
+		w.Header().Set("Content-Type", page.ContentType)
+		w.WriteHeader(status)
+		w.Write([]byte(page.render(r, status, detail, requestID)))
+		return
+	}
+
+	if er.problemJSON {
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(newProblem(r, status, detail, requestID))
+		return
+	}
+
+	http.Error(w, detail, status)
+}
+
+func (er *Renderer) page(status int) (Page, bool) {
+	code := strconv.Itoa(status)
+
+	if page, exists := er.pages[code]; exists {
+		return page, true
+	}
+
+	page, exists := er.pages[code[:1]+"xx"]
+	return page, exists
+}
+
+func (p Page) render(r *http.Request, status int, detail string, requestID string) string {
+	escape := func(value string) string { return value }
+	if strings.Contains(p.ContentType, "json") {
+		escape = escapeJSON
+	} else if strings.Contains(p.ContentType, "html") || strings.Contains(p.ContentType, "xml") {
+		escape = html.EscapeString
+	}
+
+	return variableRegex.ReplaceAllStringFunc(p.Body, func(placeholder string) string {
+		var value string
+
+		switch placeholder[1 : len(placeholder)-1] {
+		case "status":
+			value = strconv.Itoa(status)
+		case "status_text":
+			value = http.StatusText(status)
+		case "detail":
+			value = detail
+		case "request_id":
+			value = requestID
+		case "method":
+			value = r.Method
+		case "path":
+			value = r.URL.Path
+		case "host":
+			value = r.Host
+		}
+
+		return escape(value)
+	})
+}
+
+// problem is the RFC 7807 problem details object
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"request_id"`
+}
+
+func newProblem(r *http.Request, status int, detail string, requestID string) problem {
+	return problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestID,
+	}
+}
+
+// escapeJSON escape value to be placed inside a json string
+func escapeJSON(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// RequestID return the request id header or the trace id of the request
+func RequestID(r *http.Request) string {
+	if requestID := r.Header.Get(RequestIDHeader); requestID != "" {
+		return requestID
+	}
+
+	spanContext := trace.SpanContextFromContext(r.Context())
+	if spanContext.HasTraceID() {
+		return spanContext.TraceID().String()
+	}
+
+	return ""
+}
+
+func NewRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Add renderer to context
+func AddToContext(ctx context.Context, renderer *Renderer) context.Context {
+	return context.WithValue(ctx, rendererKey, renderer)
+}
+
+// Retrieve renderer from context (nil if missing)
+func FromContext(ctx context.Context) *Renderer {
+	renderer, _ := ctx.Value(rendererKey).(*Renderer)
+	return renderer
+}
+
+// Error write the error response with the renderer of the request
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	FromContext(r.Context()).Write(w, r, status, detail)
+}
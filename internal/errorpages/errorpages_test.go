@@ -0,0 +1,135 @@
+package errorpages
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRendererWrite(t *testing.T) {
+	pages := map[string]Page{
+		"404": {ContentType: "text/html; charset=utf-8", Body: "<h1>{status} {status_text}</h1><p>{path}</p><p>{request_id}</p>"},
+		"5xx": {ContentType: "application/json", Body: `{"error":"{detail}","request_id":"{request_id}"}`},
+	}
+
+	tests := []struct {
+		name                string
+		renderer            *Renderer
+		status              int
+		detail              string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "exact status page",
+			renderer:            New(pages, false),
+			status:              http.StatusNotFound,
+			detail:              "Not Found",
+			expectedContentType: "text/html; charset=utf-8",
+			expectedBody:        "<h1>404 Not Found</h1><p>/a&lt;b&gt;</p><p>req-1</p>",
+		},
+		{
+			name:                "status class page",
+			renderer:            New(pages, false),
+			status:              http.StatusBadGateway,
+			detail:              `Upstream "down"`,
+			expectedContentType: "application/json",
+			expectedBody:        `{"error":"Upstream \"down\"","request_id":"req-1"}`,
+		},
+		{
+			name:                "no page falls back to plain text",
+			renderer:            New(pages, false),
+			status:              http.StatusTooManyRequests,
+			detail:              "Rate limit exceeded",
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "Rate limit exceeded\n",
+		},
+		{
+			name:                "nil renderer writes plain text",
+			renderer:            nil,
+			status:              http.StatusGatewayTimeout,
+			detail:              "Request timed out",
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "Request timed out\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/a%3Cb%3E", nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+			rr := httptest.NewRecorder()
+
+			tt.renderer.Write(rr, req, tt.status, tt.detail)
+
+			if rr.Code != tt.status {
+				t.Errorf("wrong status code: got %v want %v", rr.Code, tt.status)
+			}
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("wrong content type: got %v want %v", contentType, tt.expectedContentType)
+			}
+
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("wrong body: got %q want %q", rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRendererProblemJSON(t *testing.T) {
+	renderer := New(map[string]Page{"404": {ContentType: "text/plain", Body: "missing"}}, true)
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+	rr := httptest.NewRecorder()
+	renderer.Write(rr, req, http.StatusRequestEntityTooLarge, "Request body too large")
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Errorf("wrong content type: got %v want %v", contentType, ProblemContentType)
+	}
+
+	requestID := rr.Header().Get(RequestIDHeader)
+	if requestID == "" {
+		t.Error("Expected a generated request id header")
+	}
+
+	var body problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+
+	expected := problem{
+		Type:      "about:blank",
+		Title:     "Request Entity Too Large",
+		Status:    http.StatusRequestEntityTooLarge,
+		Detail:    "Request body too large",
+		Instance:  "/upload",
+		RequestID: requestID,
+	}
+	if body != expected {
+		t.Errorf("wrong problem: got %+v want %+v", body, expected)
+	}
+
+	// Pages win over problem details
+	rr = httptest.NewRecorder()
+	renderer.Write(rr, req, http.StatusNotFound, "Not Found")
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain") || rr.Body.String() != "missing" {
+		t.Errorf("Expected the 404 page, got %q", rr.Body.String())
+	}
+}
+
+func TestError(t *testing.T) {
+	renderer := New(nil, true)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(AddToContext(req.Context(), renderer))
+	rr := httptest.NewRecorder()
+
+	Error(rr, req, "Request timed out", http.StatusGatewayTimeout)
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Errorf("Expected the renderer from the context to be used, got content type %v", contentType)
+	}
+}
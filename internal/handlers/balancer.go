@@ -1,69 +1,334 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
-	"math/rand"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
 	"github.com/hvuhsg/gatego/internal/config"
 	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"github.com/hvuhsg/gatego/internal/drain"
+	"github.com/hvuhsg/gatego/internal/errorpages"
+	"github.com/hvuhsg/gatego/internal/health"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
 type ServerAndWeight struct {
-	server *httputil.ReverseProxy
-	weight int
-	url    string
+	server    *httputil.ReverseProxy
+	weight    int
+	url       string
+	health    *health.Server          // nil when the server is not health checked
+	outlier   *outlierDetector        // nil when outlier detection is disabled
+	breaker   *circuitbreaker.Breaker // nil when circuit breaking is disabled
+	drain     *drain.Server           // nil when the server is not registered for draining
+	slowStart *slowStart              // nil when slow start is disabled
+	failover  *failover               // nil when the backend has a single priority group and no local servers
+	priority  int
+	local     bool        // In the zone of the gatego instance
+	load      *serverLoad // nil for entries created without NewServerAndWeight
 }
 
-type BalancePolicy interface {
-	GetNext() *httputil.ReverseProxy
+// NewServerAndWeight create a balancer entry, server may be nil for non http upstreams (streams)
+func NewServerAndWeight(url string, weight uint, server *httputil.ReverseProxy) ServerAndWeight {
+	serverWeight := int(weight)
+	if serverWeight < 1 {
+		serverWeight = 1
+	}
+
+	return ServerAndWeight{server: server, weight: serverWeight, url: url, load: &serverLoad{}}
 }
 
-type Balancer struct {
-	policy BalancePolicy
+func (sw ServerAndWeight) URL() string {
+	return sw.url
 }
 
-func NewBalancer(service config.Service, path config.Path) (*Balancer, error) {
-	serversConfig := path.Backend.Servers
+// WithHealth return the entry with the health state that decides if the server is in the rotation
+func (sw ServerAndWeight) WithHealth(serverHealth *health.Server) ServerAndWeight {
+	sw.health = serverHealth
+	return sw
+}
+
+// WithRotation return the entry with the draining state (in the registry of the instance), slow start, priority
+// and locality (to the zone of the instance) of the server config
+func (sw ServerAndWeight) WithRotation(backendName string, backend config.Backend, server config.BackendServer, instance Instance) ServerAndWeight {
+	sw.drain = instance.Drain.Register(backendName, server.URL, server.Draining, sw.load.requests)
+	sw.slowStart = newSlowStart(backend.SlowStart)
+	sw.priority = int(server.Priority)
+	sw.local = instance.Zone != "" && server.Zone == instance.Zone
+
+	// Backup servers come after the last priority group
+	if server.Backup {
+		for _, other := range backend.Servers {
+			sw.priority = max(sw.priority, int(other.Priority)+1)
+		}
+	}
+
+	return sw
+}
+
+// Healthy report if the server is in the rotation (passing its health checks, not ejected as an outlier and its circuit is not open)
+func (sw *ServerAndWeight) Healthy() bool {
+	return sw.health.Healthy() && !sw.outlier.isEjected(sw.url) && sw.breaker.Available()
+}
+
+// BackendName identify the backend of an endpoint in the health state (target is the split target name or empty)
+func BackendName(service config.Service, path config.Path, target string) string {
+	name := service.Domain + path.Path
+	if target != "" {
+		name += "#" + target
+	}
+
+	return name
+}
+
+// ServerHealth return the health state of a backend server in the registry (nil when the backend has no health check)
+func ServerHealth(registry *health.Registry, backendName string, backend config.Backend, serverURL string) *health.Server {
+	if backend.HealthCheck == nil {
+		return nil
+	}
+
+	return registry.Register(backendName, serverURL, backend.HealthCheck.HealthyThreshold, backend.HealthCheck.UnhealthyThreshold)
+}
+
+// available return the filter of the servers a policy may pick: the healthy servers in use (by priority and locality)
+// that were not tried by the request yet. It falls back to the healthy servers and then to all the servers
+// (a broken health check should not take down the whole backend).
+// Draining servers are skipped unless every server is draining, servers in slow start sit out some of the requests
+func available(servers []ServerAndWeight, tried []string) func(*ServerAndWeight) bool {
+	anyActive := false
+	for i := range servers {
+		if !servers[i].drain.Draining() {
+			anyActive = true
+			break
+		}
+	}
+
+	inRotation := func(server *ServerAndWeight) bool {
+		return !anyActive || !server.drain.Draining()
+	}
+
+	// All the entries share the failover of the backend
+	inUse := servers[0].failover.inUse(servers, tried, func(server *ServerAndWeight) bool {
+		return server.Healthy() && !server.drain.Draining()
+	})
+
+	anyHealthy, anyUntried, anyAdmittedUntried := false, false, false
+	var held []string // Servers in slow start sitting this request out
 
-	serversAndWeights := make([]ServerAndWeight, 0, len(serversConfig))
-	for _, serverConfig := range serversConfig {
-		serverURL, err := url.Parse(serverConfig.URL)
-		if err != nil {
-			return &Balancer{}, err
+	for i := range servers {
+		server := &servers[i]
+		healthy := server.Healthy()
+
+		if !server.slowStart.admit(healthy && !server.drain.Draining()) {
+			held = append(held, server.url)
+		}
+
+		if !healthy || !inRotation(server) || !inUse(server) {
+			continue
+		}
+
+		anyHealthy = true
+		if !slices.Contains(tried, server.url) {
+			anyUntried = true
+			if !slices.Contains(held, server.url) {
+				anyAdmittedUntried = true
+			}
 		}
+	}
 
-		server := httputil.NewSingleHostReverseProxy(serverURL)
+	// Slow start only holds a server back when another server can take the request
+	if !anyAdmittedUntried {
+		held = nil
+	}
 
-		serverWeight := int(serverConfig.Weight)
-		if serverWeight < 1 {
-			serverWeight = 1
+	return func(server *ServerAndWeight) bool {
+		if !inRotation(server) {
+			return false
 		}
-		serversAndWeights = append(serversAndWeights, ServerAndWeight{server: server, weight: serverWeight, url: serverConfig.URL})
+
+		if !anyHealthy {
+			return true
+		}
+
+		return inUse(server) && server.Healthy() && (!anyUntried || !slices.Contains(tried, server.url)) && !slices.Contains(held, server.url)
+	}
+}
+
+// Outcome is the result of a request sent to a picked server
+type Outcome struct {
+	Latency time.Duration // Until the response headers (or the connection for streams)
+	Status  int           // 0 when no response was received
+	Err     error         // The upstream error (nil when a response was received)
+}
+
+// Pick is the server chosen by a policy for one request, Done must be called once when the request completes
+type Pick struct {
+	Server *ServerAndWeight
+	done   func(Outcome) // nil when the server load is not tracked
+}
+
+// newPick count the request in the load of the server until Done
+func newPick(server *ServerAndWeight) Pick {
+	return Pick{Server: server, done: server.load.start()}
+}
+
+func (p Pick) URL() string {
+	return p.Server.url
+}
+
+// Done report the outcome of the request to the policy
+func (p Pick) Done(outcome Outcome) {
+	if p.done != nil {
+		p.done(outcome)
+	}
+}
+
+// PickRequest is what the policies know about the request being balanced
+type PickRequest struct {
+	HashKey string   // The consistent hashing key (hash policy only)
+	Tried   []string // Servers already tried by the request (retries), they are skipped when possible
+}
+
+// BalancePolicy choose the servers of the requests, the policies are safe for concurrent use
+type BalancePolicy interface {
+	GetNext(request PickRequest) Pick
+}
+
+// NewBalancePolicy create the policy of the backend by its config name (see config.SupportedBalancePolicies)
+func NewBalancePolicy(backend config.Backend, servers []ServerAndWeight) (BalancePolicy, error) {
+	failover := newFailover(backend, servers)
+	for i := range servers {
+		servers[i].failover = failover
 	}
 
-	var policy BalancePolicy
-	switch path.Backend.BalancePolicy {
+	switch backend.BalancePolicy {
 	case "round-robin":
-		policy = NewRoundRobinPolicy(serversAndWeights)
+		return NewRoundRobinPolicy(servers), nil
 	case "random":
-		policy = NewRandomPolicy(serversAndWeights)
+		return NewRandomPolicy(servers), nil
 	case "least-latency":
-		policy = NewLeastLatencyPolicy(serversAndWeights)
+		return NewLeastLatencyPolicy(servers), nil
+	case "least-connections":
+		return NewLeastConnectionsPolicy(servers), nil
+	case "p2c":
+		return NewP2CPolicy(servers, backend.P2CMetric), nil
+	case "peak-ewma":
+		return NewPeakEWMAPolicy(servers), nil
+	case "hash":
+		return NewHashPolicy(servers), nil
+	default:
+		return nil, fmt.Errorf("balance policy '%s' is not supported", backend.BalancePolicy)
 	}
+}
+
+type Balancer struct {
+	pool         *Pool
+	hash         *config.Sticky       // The hashed request property (hash policy only)
+	stickyCookie *config.StickyCookie // nil when the servers are not sticky
+	retry        *retryPolicy         // nil when retries are disabled
+	breakers     *circuitBreakers     // nil when circuit breaking is disabled
+}
 
-	balancer := Balancer{policy: policy}
+func NewBalancer(ctx context.Context, service config.Service, path config.Path, instance Instance) (*Balancer, error) {
+	return newBalancer(ctx, BackendName(service, path, ""), *path.Backend, path, instance)
+}
+
+// newBalancer create the balancer of a backend with the retry and circuit breaker of the endpoint path
+func newBalancer(ctx context.Context, name string, backend config.Backend, path config.Path, instance Instance) (*Balancer, error) {
+	breakers, err := newCircuitBreakers(name, path.CircuitBreaker, instance.Breakers)
+	if err != nil {
+		return &Balancer{}, err
+	}
+
+	pool, err := newPool(ctx, name, backend, instance, breakers, true)
+	if err != nil {
+		return &Balancer{}, err
+	}
+
+	balancer := Balancer{pool: pool, stickyCookie: backend.StickyCookie, breakers: breakers}
+	if backend.BalancePolicy == "hash" {
+		balancer.hash = &config.Sticky{By: "ip"}
+		if backend.Hash != nil {
+			balancer.hash = backend.Hash
+		}
+	}
+	if path.Retry != nil {
+		balancer.retry = newRetryPolicy(*path.Retry)
+	}
 
 	return &balancer, nil
 }
 
+// Pool return the servers of the balancer (to update them at runtime)
+func (b *Balancer) Pool() *Pool {
+	return b.pool
+}
+
 func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	proxy := b.policy.GetNext()
+	request := PickRequest{Tried: make([]string, 0, 1)}
+	if b.hash != nil {
+		request.HashKey = requestKey(*b.hash, r)
+	}
+
+	b.retry.serve(w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The servers are discovered and none was found yet (or all are gone)
+		members := b.pool.snapshot()
+		if members == nil {
+			errorpages.Error(w, r, "No backend servers available", http.StatusServiceUnavailable)
+			return
+		}
+
+		pick := b.pick(w, r, members, request)
+		request.Tried = append(request.Tried, pick.URL())
+		b.send(w, r, pick)
+	}))
+}
+
+// pick return the server named by the affinity cookie when it is in the rotation,
+// otherwise the server chosen by the policy (and the affinity cookie is issued for it)
+func (b *Balancer) pick(w http.ResponseWriter, r *http.Request, members *poolMembers, request PickRequest) Pick {
+	if b.stickyCookie == nil {
+		return members.policy.GetNext(request)
+	}
+
+	if cookie, err := r.Cookie(b.stickyCookie.Name); err == nil {
+		isAvailable := available(members.servers, request.Tried)
+		for i := range members.servers {
+			server := &members.servers[i]
+			if serverID(server.url) == cookie.Value && isAvailable(server) {
+				return newPick(server)
+			}
+		}
+	}
+
+	pick := members.policy.GetNext(request)
+	http.SetCookie(w, &http.Cookie{
+		Name:     b.stickyCookie.Name,
+		Value:    serverID(pick.URL()),
+		Path:     "/",
+		MaxAge:   int(b.stickyCookie.MaxAge.Seconds()),
+		Secure:   b.stickyCookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return pick
+}
+
+// serverID name a server in the affinity cookie without exposing its url
+func serverID(url string) string {
+	return strconv.FormatUint(hashKey(url), 16)
+}
 
+func (b *Balancer) send(w http.ResponseWriter, r *http.Request, pick Pick) {
 	tracer := contextvalues.TracerFromContext(r.Context())
 	if tracer != nil {
 		ctx, span := tracer.Start(r.Context(), "request.upstream")
@@ -72,11 +337,23 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		defer span.End()
 	}
 
-	proxy.ServeHTTP(w, r)
+	server := pick.Server
+	r, result := withUpstreamResult(r)
+	start := time.Now()
+
+	b.breakers.serve(w, r, server.breaker, server.server)
+
+	outcome := result.outcome(start)
+	pick.Done(outcome)
+
+	// Rejected by the circuit breaker, the request never reached the server
+	if !errors.Is(outcome.Err, circuitbreaker.ErrOpen) {
+		b.pool.outlier.observe(server.url, outcome.Status, outcome.Err)
+	}
 }
 
 type RoundRobinPolicy struct {
-	current    int
+	current    atomic.Uint64
 	weightsSum int
 	servers    []ServerAndWeight
 }
@@ -87,24 +364,37 @@ func NewRoundRobinPolicy(servers []ServerAndWeight) *RoundRobinPolicy {
 		weightsSum += server.weight
 	}
 
-	policy := &RoundRobinPolicy{current: 0, weightsSum: weightsSum, servers: servers}
+	policy := &RoundRobinPolicy{weightsSum: weightsSum, servers: servers}
 	return policy
 }
 
 // The servers provided must be provided in the same order for accurate results
-func (rrp *RoundRobinPolicy) GetNext() *httputil.ReverseProxy {
-	serverIndex := rrp.current
-
-	for _, server := range rrp.servers {
-		serverIndex -= server.weight
-		if serverIndex < 0 {
-			rrp.current += 1
-			return server.server
+func (rrp *RoundRobinPolicy) GetNext(request PickRequest) Pick {
+	isAvailable := available(rrp.servers, request.Tried)
+
+	// A full cycle visits every server
+	for attempt := 0; attempt < rrp.weightsSum; attempt++ {
+		server := rrp.next()
+		if isAvailable(server) {
+			return newPick(server)
+		}
+	}
+
+	return newPick(rrp.next())
+}
+
+// next return the server of the next position in the weighted cycle (each server is repeated by its weight)
+func (rrp *RoundRobinPolicy) next() *ServerAndWeight {
+	position := int((rrp.current.Add(1) - 1) % uint64(rrp.weightsSum))
+
+	for i := range rrp.servers {
+		position -= rrp.servers[i].weight
+		if position < 0 {
+			return &rrp.servers[i]
 		}
 	}
 
-	rrp.current = (rrp.current % rrp.weightsSum) + 1
-	return rrp.servers[0].server
+	return &rrp.servers[0]
 }
 
 type RandomPolicy struct {
@@ -121,64 +411,37 @@ func NewRandomPolicy(servers []ServerAndWeight) *RandomPolicy {
 	return &RandomPolicy{weightsSum: weightsSum, servers: servers}
 }
 
-func (rp *RandomPolicy) GetNext() *httputil.ReverseProxy {
-	randomServerIndex := rand.Intn(rp.weightsSum)
-
-	for _, server := range rp.servers {
-		randomServerIndex -= server.weight
-		if randomServerIndex <= 0 {
-			return server.server
-		}
-	}
-
-	return rp.servers[0].server
+func (rp *RandomPolicy) GetNext(request PickRequest) Pick {
+	return newPick(&rp.servers[weightedRandom(rp.servers, available(rp.servers, request.Tried), -1)])
 }
 
 type LeastLatencyPolicy struct {
-	serversLatency map[string]int64
-	servers        []ServerAndWeight
+	servers []ServerAndWeight
 }
 
 func NewLeastLatencyPolicy(serversAndURLs []ServerAndWeight) *LeastLatencyPolicy {
-	serversLatency := make(map[string]int64, len(serversAndURLs))
-
-	for _, serverAndWeight := range serversAndURLs {
-		serversLatency[serverAndWeight.url] = 0
-	}
-
-	return &LeastLatencyPolicy{servers: serversAndURLs, serversLatency: serversLatency}
+	return &LeastLatencyPolicy{servers: serversAndURLs}
 }
 
-func (llp *LeastLatencyPolicy) GetNext() *httputil.ReverseProxy {
-
-	bestServerURL := llp.servers[0].url
+func (llp *LeastLatencyPolicy) GetNext(request PickRequest) Pick {
+	chosen := 0
 	var bestLatency int64 = math.MaxInt64
+	isAvailable := available(llp.servers, request.Tried)
 
-	for url, latency := range llp.serversLatency {
-		if latency < bestLatency {
-			bestServerURL = url
-			bestLatency = latency
+	// Iterate in servers order so ties are broken deterministically
+	for i := range llp.servers {
+		if !isAvailable(&llp.servers[i]) {
+			continue
 		}
-	}
 
-	var chosenServer ServerAndWeight
-	for _, server := range llp.servers {
-		if server.url == bestServerURL {
-			chosenServer = server
-			break
+		latency := llp.servers[i].load.lastLatency()
+		if latency < bestLatency {
+			chosen = i
+			bestLatency = latency
 		}
 	}
 
-	// TODO: use decaing latency for extream latency conditions
-
-	startTime := time.Now().UnixMicro()
-	chosenServer.server.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		llp.serversLatency[chosenServer.url] = time.Now().UnixMicro() - startTime
-	}
-	chosenServer.server.ModifyResponse = func(r *http.Response) error {
-		llp.serversLatency[chosenServer.url] = time.Now().UnixMicro() - startTime
-		return nil
-	}
+	// Only the last sample counts, peak-ewma decays the latency instead
 
-	return chosenServer.server
+	return newPick(&llp.servers[chosen])
 }
@@ -1,15 +1,22 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
-	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
 	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/drain"
+	"github.com/hvuhsg/gatego/internal/health"
 )
 
 func TestNewBalancer(t *testing.T) {
@@ -17,17 +24,14 @@ func TestNewBalancer(t *testing.T) {
 	path := config.Path{
 		Backend: &config.Backend{
 			BalancePolicy: "round-robin",
-			Servers: []struct {
-				URL    string "yaml:\"url\""
-				Weight uint   "yaml:\"weight\""
-			}{
+			Servers: []config.BackendServer{
 				{URL: "http://localhost:8001", Weight: 1},
 				{URL: "http://localhost:8002", Weight: 2},
 			},
 		},
 	}
 
-	balancer, err := NewBalancer(service, path)
+	balancer, err := NewBalancer(context.Background(), service, path, Instance{})
 	if err != nil {
 		t.Fatalf("Failed to create balancer: %v", err)
 	}
@@ -48,7 +52,7 @@ func TestRoundRobinPolicy(t *testing.T) {
 	// Test the round-robin behavior
 	expectedOrder := []string{"http://localhost:8001/", "http://localhost:8002/", "http://localhost:8001/", "http://localhost:8002/"}
 	for i, expected := range expectedOrder {
-		server := policy.GetNext()
+		server := policy.GetNext(PickRequest{}).Server.server
 		if server.Director == nil {
 			t.Fatalf("Server %d is nil", i)
 		}
@@ -69,7 +73,7 @@ func TestRandomPolicy(t *testing.T) {
 
 	// Test that we get a valid server (we can't test randomness easily)
 	for i := 0; i < 10; i++ {
-		server := policy.GetNext()
+		server := policy.GetNext(PickRequest{}).Server
 		if server == nil {
 			t.Fatal("Got nil server from RandomPolicy")
 		}
@@ -92,28 +96,145 @@ func TestLeastLatencyPolicy(t *testing.T) {
 	defer server2.Close()
 
 	servers := []ServerAndWeight{
-		{server: httputil.NewSingleHostReverseProxy(mustParseURL(server1.URL)), weight: 1, url: server1.URL},
-		{server: httputil.NewSingleHostReverseProxy(mustParseURL(server2.URL)), weight: 1, url: server2.URL},
+		NewServerAndWeight(server1.URL, 1, httputil.NewSingleHostReverseProxy(mustParseURL(server1.URL))),
+		NewServerAndWeight(server2.URL, 1, httputil.NewSingleHostReverseProxy(mustParseURL(server2.URL))),
 	}
 
 	policy := NewLeastLatencyPolicy(servers)
+	balancer := newPolicyBalancer(policy, servers)
 
-	// Initially, all servers should have 0 latency
-	server := policy.GetNext()
-	if server == nil {
-		t.Fatal("Got nil server from LeastLatencyPolicy")
-	}
-
-	// Simulate a request and update latency
+	// Initially, all servers have 0 latency and the first one is chosen
 	w := httptest.NewRecorder()
-	r, _ := http.NewRequest("GET", server1.URL, nil)
-	server.ServeHTTP(w, r)
+	r, _ := http.NewRequest("GET", "http://example.com", nil)
+	balancer.ServeHTTP(w, r)
+
+	if w.Body.String() != "Slow response from server 1" {
+		t.Fatalf("Expected the first request to reach server 1, got %q", w.Body.String())
+	}
 
 	// The policy should now prefer the fast second server
-	server = policy.GetNext()
-	serverURL := strings.TrimSuffix(getProxyURL(server), "/")
-	if serverURL != strings.TrimSuffix(server2.URL, "/") {
-		t.Errorf("LeastLatencyPolicy did not choose the server with least latency Got %s Want %s", serverURL, server2.URL)
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest("GET", "http://example.com", nil)
+		balancer.ServeHTTP(w, r)
+
+		if w.Body.String() != "Fast response from server 2" {
+			t.Errorf("LeastLatencyPolicy did not choose the server with least latency Got %q", w.Body.String())
+		}
+	}
+}
+
+func TestPickDone(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 1, nil),
+	}
+
+	policy := NewLeastLatencyPolicy(servers)
+
+	pick := policy.GetNext(PickRequest{})
+	pick.Done(Outcome{Latency: time.Second, Status: http.StatusOK})
+
+	if url := policy.GetNext(PickRequest{}).URL(); url != "http://localhost:8002" {
+		t.Errorf("Expected the reported latency to move the traffic, got %s", url)
+	}
+
+	// Rejected requests say nothing about the latency
+	pick = policy.GetNext(PickRequest{})
+	pick.Done(Outcome{Latency: 0, Err: circuitbreaker.ErrOpen})
+	policy.GetNext(PickRequest{}).Done(Outcome{Latency: time.Millisecond})
+
+	if url := policy.GetNext(PickRequest{}).URL(); url != "http://localhost:8002" {
+		t.Errorf("Expected the rejected request to be ignored, got %s", url)
+	}
+}
+
+func TestPoliciesSkipTriedServers(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 3, nil),
+	}
+
+	for _, name := range config.SupportedBalancePolicies {
+		policy, err := NewBalancePolicy(config.Backend{BalancePolicy: name}, servers)
+		if err != nil {
+			t.Fatalf("Failed to create %s policy: %v", name, err)
+		}
+
+		for i := 0; i < 20; i++ {
+			if url := policy.GetNext(PickRequest{Tried: []string{"http://localhost:8002"}}).URL(); url != "http://localhost:8001" {
+				t.Fatalf("%s policy returned the tried server", name)
+			}
+		}
+
+		// Every server was tried
+		policy.GetNext(PickRequest{Tried: []string{"http://localhost:8001", "http://localhost:8002"}}).Done(Outcome{})
+	}
+}
+
+func TestPoliciesConcurrentUse(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 2, nil),
+		NewServerAndWeight("http://localhost:8003", 3, nil),
+	}
+
+	for _, name := range config.SupportedBalancePolicies {
+		policy, err := NewBalancePolicy(config.Backend{BalancePolicy: name}, servers)
+		if err != nil {
+			t.Fatalf("Failed to create %s policy: %v", name, err)
+		}
+
+		var wg sync.WaitGroup
+		for worker := 0; worker < 32; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for i := 0; i < 500; i++ {
+					pick := policy.GetNext(PickRequest{})
+					if pick.Server == nil {
+						t.Errorf("%s policy returned no server", name)
+						return
+					}
+					pick.Done(Outcome{Latency: time.Duration(i) * time.Microsecond, Status: http.StatusOK})
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestRoundRobinPolicyConcurrentDistribution(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 3, nil),
+	}
+
+	policy := NewRoundRobinPolicy(servers)
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				url := policy.GetNext(PickRequest{}).URL()
+				mu.Lock()
+				counts[url]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// No position of the cycle is lost or repeated
+	if counts["http://localhost:8001"] != 400 || counts["http://localhost:8002"] != 1200 {
+		t.Errorf("Expected the weighted distribution, got %v", counts)
 	}
 }
 
@@ -138,7 +259,7 @@ func TestBalancerServeHTTP(t *testing.T) {
 	}
 
 	policy := NewRoundRobinPolicy(servers)
-	balancer := &Balancer{policy: policy}
+	balancer := newPolicyBalancer(policy, servers)
 
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest("GET", "http://example.com", nil)
@@ -172,6 +293,14 @@ func getProxyURL(proxy *httputil.ReverseProxy) string {
 	return req.URL.String()
 }
 
+// Helper function to create a balancer over a fixed policy
+func newPolicyBalancer(policy BalancePolicy, servers []ServerAndWeight) *Balancer {
+	pool := &Pool{name: "test"}
+	pool.members.Store(&poolMembers{policy: policy, servers: servers})
+
+	return &Balancer{pool: pool}
+}
+
 // Helper function to parse URL and panic on error
 func mustParseURL(rawURL string) *url.URL {
 	u, err := url.Parse(rawURL)
@@ -180,3 +309,138 @@ func mustParseURL(rawURL string) *url.URL {
 	}
 	return u
 }
+
+func TestPoliciesSkipUnhealthyServers(t *testing.T) {
+	registry := health.NewRegistry()
+	unhealthy := registry.Register("test", "http://localhost:8001", 1, 1)
+	unhealthy.Report(errors.New("connection refused"))
+
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, createDummyProxy("http://localhost:8001")).WithHealth(unhealthy),
+		NewServerAndWeight("http://localhost:8002", 1, createDummyProxy("http://localhost:8002")),
+		NewServerAndWeight("http://localhost:8003", 2, createDummyProxy("http://localhost:8003")),
+	}
+
+	for _, name := range config.SupportedBalancePolicies {
+		policy, err := NewBalancePolicy(config.Backend{BalancePolicy: name}, servers)
+		if err != nil {
+			t.Fatalf("Failed to create %s policy: %v", name, err)
+		}
+
+		for i := 0; i < 20; i++ {
+			if url := policy.GetNext(PickRequest{}).URL(); url == "http://localhost:8001" {
+				t.Fatalf("%s policy returned the unhealthy server", name)
+			}
+		}
+	}
+}
+
+func TestPoliciesUseAllServersWhenNoneIsHealthy(t *testing.T) {
+	registry := health.NewRegistry()
+
+	servers := make([]ServerAndWeight, 0, 2)
+	for _, url := range []string{"http://localhost:8001", "http://localhost:8002"} {
+		serverHealth := registry.Register("test", url, 1, 1)
+		serverHealth.Report(errors.New("connection refused"))
+		servers = append(servers, NewServerAndWeight(url, 1, createDummyProxy(url)).WithHealth(serverHealth))
+	}
+
+	policy := NewRoundRobinPolicy(servers)
+
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[policy.GetNext(PickRequest{}).URL()] = true
+	}
+
+	if len(seen) != 2 {
+		t.Errorf("Expected both servers to stay in the rotation, got %v", seen)
+	}
+}
+
+func TestPoliciesSkipDrainingServers(t *testing.T) {
+	registry := drain.NewRegistry()
+
+	servers := newServers("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	servers[0].drain = registry.Register("test", "http://localhost:8001", true, nil)
+
+	for _, name := range config.SupportedBalancePolicies {
+		policy, err := NewBalancePolicy(config.Backend{BalancePolicy: name}, servers)
+		if err != nil {
+			t.Fatalf("Failed to create %s policy: %v", name, err)
+		}
+
+		for i := 0; i < 20; i++ {
+			request := PickRequest{HashKey: fmt.Sprintf("user-%d", i)}
+			if url := policy.GetNext(request).URL(); url == "http://localhost:8001" {
+				t.Fatalf("%s policy returned the draining server", name)
+			}
+		}
+	}
+
+	// Draining every server keeps the backend serving
+	for i := range servers {
+		servers[i].drain = registry.Register("test", servers[i].url, true, nil)
+	}
+
+	policy := NewRoundRobinPolicy(servers)
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		seen[policy.GetNext(PickRequest{}).URL()] = true
+	}
+
+	if len(seen) != 3 {
+		t.Errorf("Expected all the servers to be used when all are draining, got %v", seen)
+	}
+}
+
+func TestBalancerDrainCompletesInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "slow")
+	}))
+	t.Cleanup(slow.Close)
+	other := newNamedServer(t, "other")
+
+	registry := drain.NewRegistry()
+	backend := config.Backend{BalancePolicy: "round-robin", Servers: []config.BackendServer{{URL: slow.URL, Weight: 1}, {URL: other, Weight: 1}}}
+	balancer, err := newBalancer(context.Background(), "test", backend, config.Path{}, Instance{Drain: registry})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rr := httptest.NewRecorder()
+		balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		inFlight <- rr
+	}()
+	<-started
+
+	server := registry.Lookup("test", slow.URL)
+	server.SetDraining(true, "test")
+
+	if status := server.Status(); status.InFlight != 1 || status.Drained {
+		t.Errorf("Expected one request in flight, got %+v", status)
+	}
+
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Body.String() != "other" {
+			t.Fatalf("Expected new requests to skip the draining server, got %q", rr.Body.String())
+		}
+	}
+
+	close(release)
+	if rr := <-inFlight; rr.Body.String() != "slow" {
+		t.Errorf("Expected the in-flight request to complete, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	if status := server.Status(); !status.Drained {
+		t.Errorf("Expected the server to be drained, got %+v", status)
+	}
+}
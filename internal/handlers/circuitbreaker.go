@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/errorpages"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// circuitBreakers create the circuit breakers of the servers of an endpoint and fail fast when they are open
+type circuitBreakers struct {
+	backend  string
+	config   config.CircuitBreaker
+	registry *circuitbreaker.Registry // Keep the state of the breakers (across reloads)
+	open     http.Handler             // The fail fast response
+}
+
+// newCircuitBreakers return nil when the endpoint has no circuit breaker
+func newCircuitBreakers(backend string, circuitBreaker *config.CircuitBreaker, registry *circuitbreaker.Registry) (*circuitBreakers, error) {
+	if circuitBreaker == nil {
+		return nil, nil
+	}
+
+	var open http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errorpages.Error(w, r, "Upstream server unavailable", config.DefaultCircuitBreakerStatus)
+	})
+
+	if circuitBreaker.Response != nil {
+		respond, err := NewRespond(*circuitBreaker.Response)
+		if err != nil {
+			return nil, err
+		}
+		open = respond
+	}
+
+	return &circuitBreakers{backend: backend, config: *circuitBreaker, registry: registry, open: open}, nil
+}
+
+// breaker return the circuit breaker of the server (nil when circuit breaking is disabled)
+func (cbs *circuitBreakers) breaker(url string) *circuitbreaker.Breaker {
+	if cbs == nil {
+		return nil
+	}
+
+	return cbs.registry.Register(cbs.backend, url, cbs.config)
+}
+
+// unchanged report if the circuit breakers have the same backend and config
+func (cbs *circuitBreakers) unchanged(other *circuitBreakers) bool {
+	if cbs == nil || other == nil {
+		return cbs == other
+	}
+
+	return cbs.backend == other.backend && reflect.DeepEqual(cbs.config, other.config)
+}
+
+// serve send the request to next when the breaker allows it and report the result to the breaker
+func (cbs *circuitBreakers) serve(w http.ResponseWriter, r *http.Request, breaker *circuitbreaker.Breaker, next http.Handler) {
+	if breaker == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if !breaker.Allow(r.Context()) {
+		trace.SpanFromContext(r.Context()).AddEvent("Circuit breaker open")
+		recordUpstreamError(r, circuitbreaker.ErrOpen)
+		cbs.open.ServeHTTP(w, r)
+		return
+	}
+
+	r, result := withUpstreamResult(r)
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+
+	next.ServeHTTP(sw, r)
+
+	// The client went away, it says nothing about the server
+	if errors.Is(result.err, context.Canceled) {
+		breaker.Cancel()
+		return
+	}
+
+	breaker.Report(r.Context(), result.err != nil || sw.status >= 500, time.Since(start))
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestCircuitBreakerFailFast(t *testing.T) {
+	var hits atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	circuitBreaker := newCircuitBreaker()
+	circuitBreaker.Response = &config.Respond{Status: http.StatusServiceUnavailable, Body: "circuit open"}
+
+	proxy, err := newProxy("breaker.example.com/fail-fast", config.Path{Destination: &failing.URL, CircuitBreaker: circuitBreaker}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	// The circuit opens after the min requests
+	if hits.Load() != 2 {
+		t.Errorf("Expected 2 requests to reach the server, got %d", hits.Load())
+	}
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusServiceUnavailable || rr.Body.String() != "circuit open" {
+		t.Errorf("got %d %q want the fail fast response", rr.Code, rr.Body.String())
+	}
+
+	if proxy.breaker.Status().State != circuitbreaker.Open {
+		t.Errorf("Expected the circuit to be open, got %s", proxy.breaker.Status().State)
+	}
+}
+
+func TestCircuitBreakerBalancer(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthy := newNamedServer(t, "healthy")
+
+	backend := config.Backend{BalancePolicy: "round-robin"}
+	for _, url := range []string{failing.URL, healthy} {
+		backend.Servers = append(backend.Servers, config.BackendServer{URL: url, Weight: 1})
+	}
+
+	balancer, err := newBalancer(context.Background(), "breaker.example.com/balancer", backend, config.Path{CircuitBreaker: newCircuitBreaker()}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	// Open the circuit of the failing server
+	for i := 0; i < 4; i++ {
+		balancer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != "healthy" {
+			t.Errorf("request %d got %d %q want the server with a closed circuit", i, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestCircuitBreakerDefaultResponse(t *testing.T) {
+	breakers, err := newCircuitBreakers("breaker.example.com/default", newCircuitBreaker(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create circuit breakers: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	breakers.open.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != config.DefaultCircuitBreakerStatus {
+		t.Errorf("got status %d want %d", rr.Code, config.DefaultCircuitBreakerStatus)
+	}
+}
+
+// Helper function to create a circuit breaker config that opens after 2 failed requests
+func newCircuitBreaker() *config.CircuitBreaker {
+	failureRate := 0.5
+	return &config.CircuitBreaker{FailureRate: &failureRate, Window: time.Minute, MinRequests: 2, OpenDuration: time.Minute, HalfOpenProbes: 1}
+}
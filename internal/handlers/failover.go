@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"slices"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/discovery"
+	"github.com/hvuhsg/gatego/internal/drain"
+	"github.com/hvuhsg/gatego/internal/health"
+)
+
+// Instance is the config of the gatego instance used by the backends, it is passed to the handlers on creation (and reload).
+// The registries are owned by the server and kept across reloads, nil registries keep no state
+type Instance struct {
+	Zone     string                   // The backends prefer servers in the zone
+	Agents   discovery.Agents         // The discovery services of the backends servers
+	Health   *health.Registry         // The health state of the checked servers
+	Breakers *circuitbreaker.Registry // The circuit breakers of the upstream servers
+	Drain    *drain.Registry          // The draining state of the servers
+	Pools    *Pools                   // The pools of the backends in use
+	Rollouts *Rollouts                // The progressive rollouts of the endpoints in use
+	Sources  *discovery.Shared        // The discovery providers shared by the backends of the same source
+}
+
+// failover choose the servers of a backend in use by priority and locality. The first priority group takes the requests
+// while the healthy (weighted) ratio of its servers is at least the threshold, below it the next group joins the rotation
+// and so on until a group reaches the threshold. Among the servers in use the local zone is preferred by the same rule
+// (servers tried by the request count as down, so retries leave the zone)
+type failover struct {
+	threshold  float64
+	priorities []int // Sorted
+	anyLocal   bool
+}
+
+// newFailover return nil when the backend has a single priority group and no servers in the local zone
+func newFailover(backend config.Backend, servers []ServerAndWeight) *failover {
+	priorities := make([]int, 0, 1)
+	anyLocal := false
+	for i := range servers {
+		if !slices.Contains(priorities, servers[i].priority) {
+			priorities = append(priorities, servers[i].priority)
+		}
+		anyLocal = anyLocal || servers[i].local
+	}
+
+	if len(priorities) == 1 && !anyLocal {
+		return nil
+	}
+
+	slices.Sort(priorities)
+
+	threshold := config.DefaultFailoverThreshold
+	if backend.FailoverThreshold != nil {
+		threshold = *backend.FailoverThreshold
+	}
+
+	return &failover{threshold: threshold, priorities: priorities, anyLocal: anyLocal}
+}
+
+// inUse return the filter of the servers in use, up report if a server is in the rotation (healthy and not draining).
+// A nil failover use all the servers
+func (f *failover) inUse(servers []ServerAndWeight, tried []string, up func(*ServerAndWeight) bool) func(*ServerAndWeight) bool {
+	if f == nil {
+		return func(*ServerAndWeight) bool { return true }
+	}
+
+	lastPriority := f.priorities[len(f.priorities)-1]
+	for _, priority := range f.priorities {
+		if f.healthy(servers, up, func(server *ServerAndWeight) bool { return server.priority == priority }) {
+			lastPriority = priority
+			break
+		}
+	}
+
+	untriedUp := func(server *ServerAndWeight) bool {
+		return up(server) && !slices.Contains(tried, server.url)
+	}
+
+	local := f.anyLocal && f.healthy(servers, untriedUp, func(server *ServerAndWeight) bool {
+		return server.local && server.priority <= lastPriority
+	})
+
+	return func(server *ServerAndWeight) bool {
+		return server.priority <= lastPriority && (!local || server.local)
+	}
+}
+
+// healthy report if the healthy ratio (by weight) of the servers matching the group reaches the threshold
+func (f *failover) healthy(servers []ServerAndWeight, up func(*ServerAndWeight) bool, group func(*ServerAndWeight) bool) bool {
+	total, healthy := 0, 0
+	for i := range servers {
+		if !group(&servers[i]) {
+			continue
+		}
+
+		total += servers[i].weight
+		if up(&servers[i]) {
+			healthy += servers[i].weight
+		}
+	}
+
+	return total > 0 && float64(healthy)/float64(total) >= f.threshold
+}
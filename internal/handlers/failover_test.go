@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/health"
+)
+
+func TestFailoverPriorityGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		unhealthy []string
+		want      []string // Servers taking requests
+	}{
+		{"Primary group healthy", nil, []string{"primary-1", "primary-2", "primary-3"}},
+		{"Primary group above the threshold", []string{"primary-3"}, []string{"primary-1", "primary-2"}},
+		{"Primary group below the threshold", []string{"primary-2", "primary-3"}, []string{"primary-1", "secondary-1", "secondary-2"}},
+		{"Primary group down", []string{"primary-1", "primary-2", "primary-3"}, []string{"secondary-1", "secondary-2"}},
+		{"Backups when the priority groups are down", []string{"primary-1", "primary-2", "primary-3", "secondary-1", "secondary-2"}, []string{"backup-1"}},
+	}
+
+	backend := config.Backend{BalancePolicy: "round-robin", FailoverThreshold: floatPtr(0.6), Servers: []config.BackendServer{
+		{URL: "primary-1", Weight: 1},
+		{URL: "primary-2", Weight: 1},
+		{URL: "primary-3", Weight: 1},
+		{URL: "secondary-1", Weight: 1, Priority: 1},
+		{URL: "secondary-2", Weight: 1, Priority: 1},
+		{URL: "backup-1", Weight: 1, Backup: true},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := health.NewRegistry()
+
+			servers := make([]ServerAndWeight, 0, len(backend.Servers))
+			for _, server := range backend.Servers {
+				serverHealth := registry.Register("test", server.URL, 1, 1)
+				for _, url := range tt.unhealthy {
+					if url == server.URL {
+						serverHealth.Report(errors.New("connection refused"))
+					}
+				}
+
+				servers = append(servers, NewServerAndWeight(server.URL, server.Weight, nil).WithHealth(serverHealth).WithRotation("test", backend, server, Instance{}))
+			}
+
+			policy, err := NewBalancePolicy(backend, servers)
+			if err != nil {
+				t.Fatalf("Failed to create policy: %v", err)
+			}
+
+			seen := map[string]bool{}
+			for i := 0; i < 30; i++ {
+				seen[policy.GetNext(PickRequest{}).URL()] = true
+			}
+
+			if len(seen) != len(tt.want) {
+				t.Errorf("got servers %v want %v", seen, tt.want)
+			}
+
+			for _, url := range tt.want {
+				if !seen[url] {
+					t.Errorf("got servers %v want %v", seen, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFailoverLocalZone(t *testing.T) {
+	backend := config.Backend{BalancePolicy: "random", Servers: []config.BackendServer{
+		{URL: "local-1", Weight: 1, Zone: "eu-west-1a"},
+		{URL: "remote-1", Weight: 1, Zone: "eu-west-1b"},
+		{URL: "remote-2", Weight: 1, Zone: "eu-west-1b"},
+	}}
+
+	registry := health.NewRegistry()
+	servers := make([]ServerAndWeight, 0, len(backend.Servers))
+	for _, server := range backend.Servers {
+		servers = append(servers, NewServerAndWeight(server.URL, server.Weight, nil).WithHealth(registry.Register("test", server.URL, 1, 1)).WithRotation("test", backend, server, Instance{Zone: "eu-west-1a"}))
+	}
+
+	policy, err := NewBalancePolicy(backend, servers)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if url := policy.GetNext(PickRequest{}).URL(); url != "local-1" {
+			t.Fatalf("Expected the local server to be preferred, got %s", url)
+		}
+	}
+
+	// A retry leaves the zone
+	if url := policy.GetNext(PickRequest{Tried: []string{"local-1"}}).URL(); url == "local-1" {
+		t.Errorf("Expected the retry to go to another zone, got %s", url)
+	}
+
+	registry.Register("test", "local-1", 1, 1).Report(errors.New("connection refused"))
+
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		seen[policy.GetNext(PickRequest{}).URL()] = true
+	}
+
+	if seen["local-1"] || !seen["remote-1"] || !seen["remote-2"] {
+		t.Errorf("Expected the other zones to take over, got %v", seen)
+	}
+}
+
+func TestNewFailover(t *testing.T) {
+	if newFailover(config.Backend{}, newServers("a", "b")) != nil {
+		t.Error("Expected no failover for a single priority group without local servers")
+	}
+
+	backend := config.Backend{Servers: []config.BackendServer{{URL: "a", Priority: 2}, {URL: "b", Backup: true}}}
+	backup := NewServerAndWeight("b", 1, nil).WithRotation("test", backend, backend.Servers[1], Instance{})
+	if backup.priority != 3 {
+		t.Errorf("Backup priority got %d want 3", backup.priority)
+	}
+}
+
+// Helper function to create float pointers
+func floatPtr(f float64) *float64 {
+	return &f
+}
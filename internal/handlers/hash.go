@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"hash/fnv"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// Points of a server on the hash ring per weight unit, more points spread the keys more evenly
+const hashRingReplicas = 100
+
+type ringPoint struct {
+	hash   uint64
+	server int // Index of the server
+}
+
+// HashPolicy map the hash key of the request to a server on a consistent hash ring,
+// adding or removing a server only moves the keys of its own points. Requests without a key are assigned randomly (by weight)
+type HashPolicy struct {
+	ring    []ringPoint // Sorted by hash
+	servers []ServerAndWeight
+}
+
+func NewHashPolicy(servers []ServerAndWeight) *HashPolicy {
+	ring := make([]ringPoint, 0)
+	for i, server := range servers {
+		// The points are placed by the server url so they don't depend on the order of the servers
+		for replica := 0; replica < server.weight*hashRingReplicas; replica++ {
+			ring = append(ring, ringPoint{hash: hashKey(server.url + "#" + strconv.Itoa(replica)), server: i})
+		}
+	}
+
+	slices.SortFunc(ring, func(a, b ringPoint) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return &HashPolicy{ring: ring, servers: servers}
+}
+
+func (hp *HashPolicy) GetNext(request PickRequest) Pick {
+	isAvailable := available(hp.servers, request.Tried)
+
+	if request.HashKey == "" {
+		return newPick(&hp.servers[weightedRandom(hp.servers, isAvailable, -1)])
+	}
+
+	// The first point after the key hash, servers out of the rotation pass their keys to the next points
+	hash := hashKey(request.HashKey)
+	start, _ := slices.BinarySearchFunc(hp.ring, hash, func(point ringPoint, hash uint64) int {
+		switch {
+		case point.hash < hash:
+			return -1
+		case point.hash > hash:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	for n := range hp.ring {
+		point := hp.ring[(start+n)%len(hp.ring)]
+		if isAvailable(&hp.servers[point.server]) {
+			return newPick(&hp.servers[point.server])
+		}
+	}
+
+	return newPick(&hp.servers[hp.ring[start%len(hp.ring)].server])
+}
+
+func hashKey(key string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+
+	// Mix the bits (murmur3 finalizer), fnv spreads similar keys (url#1, url#2) poorly
+	h := hash.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+// requestKey return the request property selected by sticky, requests without it are keyed by the client ip
+func requestKey(sticky config.Sticky, r *http.Request) string {
+	switch sticky.By {
+	case "cookie":
+		if cookie, err := r.Cookie(sticky.Name); err == nil && cookie.Value != "" {
+			return "cookie:" + cookie.Value
+		}
+	case "header":
+		if value := r.Header.Get(sticky.Name); value != "" {
+			return "header:" + value
+		}
+	case "path":
+		return "path:" + r.URL.Path
+	case "query":
+		if value := r.URL.Query().Get(sticky.Name); value != "" {
+			return "query:" + value
+		}
+	}
+
+	return "ip:" + clientIP(r.RemoteAddr)
+}
+
+// clientIP return the host of the remote address
+func clientIP(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return ip
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/health"
+)
+
+func TestHashPolicy(t *testing.T) {
+	policy := NewHashPolicy(newServers("http://localhost:8001", "http://localhost:8002", "http://localhost:8003"))
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		url := policy.GetNext(PickRequest{HashKey: key}).URL()
+		counts[url]++
+
+		if again := policy.GetNext(PickRequest{HashKey: key}).URL(); again != url {
+			t.Fatalf("Expected key %s to stay on %s, got %s", key, url, again)
+		}
+	}
+
+	for url, count := range counts {
+		if count < 700 || count > 1300 {
+			t.Errorf("Expected the keys to spread evenly, %s got %d of 3000", url, count)
+		}
+	}
+}
+
+func TestHashPolicyMinimalReshuffling(t *testing.T) {
+	before := NewHashPolicy(newServers("http://localhost:8001", "http://localhost:8002", "http://localhost:8003"))
+	after := NewHashPolicy(newServers("http://localhost:8001", "http://localhost:8002", "http://localhost:8003", "http://localhost:8004"))
+
+	moved := 0
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		from := before.GetNext(PickRequest{HashKey: key}).URL()
+		to := after.GetNext(PickRequest{HashKey: key}).URL()
+
+		if from != to {
+			moved++
+			if to != "http://localhost:8004" {
+				t.Fatalf("Expected keys to move only to the new server, %s moved from %s to %s", key, from, to)
+			}
+		}
+	}
+
+	// About a quarter of the keys belong to the new server
+	if moved < 450 || moved > 1050 {
+		t.Errorf("Expected about 750 keys to move, got %d", moved)
+	}
+}
+
+func TestHashPolicySkipsUnavailableServers(t *testing.T) {
+	registry := health.NewRegistry()
+	unhealthy := registry.Register("test", "http://localhost:8002", 1, 1)
+
+	servers := newServers("http://localhost:8001", "http://localhost:8002", "http://localhost:8003")
+	servers[1] = servers[1].WithHealth(unhealthy)
+	policy := NewHashPolicy(servers)
+
+	assigned := map[string]string{}
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		assigned[key] = policy.GetNext(PickRequest{HashKey: key}).URL()
+	}
+
+	unhealthy.Report(errors.New("connection refused"))
+
+	for key, url := range assigned {
+		got := policy.GetNext(PickRequest{HashKey: key}).URL()
+		if got == "http://localhost:8002" {
+			t.Fatalf("Expected the unhealthy server to be skipped for %s", key)
+		}
+
+		if url != "http://localhost:8002" && got != url {
+			t.Errorf("Expected %s to stay on %s, got %s", key, url, got)
+		}
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/users/42?tenant=acme", nil)
+		req.RemoteAddr = "10.0.0.7:4321"
+		req.Header.Set("X-User", "alice")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		return req
+	}
+
+	tests := []struct {
+		sticky config.Sticky
+		want   string
+	}{
+		{config.Sticky{By: "ip"}, "ip:10.0.0.7"},
+		{config.Sticky{By: "header", Name: "X-User"}, "header:alice"},
+		{config.Sticky{By: "cookie", Name: "session"}, "cookie:abc"},
+		{config.Sticky{By: "path"}, "path:/users/42"},
+		{config.Sticky{By: "query", Name: "tenant"}, "query:acme"},
+		{config.Sticky{By: "header", Name: "X-Missing"}, "ip:10.0.0.7"},
+		{config.Sticky{By: "query", Name: "missing"}, "ip:10.0.0.7"},
+	}
+
+	for _, tt := range tests {
+		if got := requestKey(tt.sticky, newRequest()); got != tt.want {
+			t.Errorf("requestKey(%+v) got %s want %s", tt.sticky, got, tt.want)
+		}
+	}
+}
+
+func TestBalancerHashByHeader(t *testing.T) {
+	backend := config.Backend{BalancePolicy: "hash", Hash: &config.Sticky{By: "header", Name: "X-User"}}
+	for i := 1; i <= 3; i++ {
+		backend.Servers = append(backend.Servers, config.BackendServer{URL: newNamedServer(t, fmt.Sprintf("server-%d", i)), Weight: 1})
+	}
+
+	balancer, err := newBalancer(context.Background(), "test", backend, config.Path{}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	for _, user := range []string{"alice", "bob", "carol"} {
+		served := ""
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-User", user)
+			req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+
+			rr := httptest.NewRecorder()
+			balancer.ServeHTTP(rr, req)
+
+			if served != "" && rr.Body.String() != served {
+				t.Errorf("Expected user %s to stay on %s, got %s", user, served, rr.Body.String())
+			}
+			served = rr.Body.String()
+		}
+	}
+}
+
+func TestBalancerStickyCookie(t *testing.T) {
+	registry := health.NewRegistry()
+
+	backend := config.Backend{BalancePolicy: "round-robin", StickyCookie: &config.StickyCookie{Name: config.DefaultStickyCookieName}}
+	for i := 1; i <= 3; i++ {
+		backend.Servers = append(backend.Servers, config.BackendServer{URL: newNamedServer(t, fmt.Sprintf("server-%d", i)), Weight: 1})
+	}
+
+	balancer, err := newBalancer(context.Background(), "test", backend, config.Path{}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != config.DefaultStickyCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an affinity cookie, got %v", cookies)
+	}
+	served := rr.Body.String()
+
+	// The cookie keeps the user on the server (round robin would move it)
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+
+		rr = httptest.NewRecorder()
+		balancer.ServeHTTP(rr, req)
+
+		if rr.Body.String() != served {
+			t.Fatalf("Expected the affinity cookie to keep the user on %s, got %s", served, rr.Body.String())
+		}
+
+		if len(rr.Result().Cookies()) != 0 {
+			t.Errorf("Expected the cookie to be issued once, got %v", rr.Result().Cookies())
+		}
+	}
+
+	// The server leaves the rotation, the user gets a new server and cookie
+	servers := balancer.pool.members.Load().servers
+	for i := range servers {
+		if serverID(servers[i].url) == cookies[0].Value {
+			serverHealth := registry.Register("test", servers[i].url, 1, 1)
+			serverHealth.Report(errors.New("connection refused"))
+			servers[i].health = serverHealth
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+
+	rr = httptest.NewRecorder()
+	balancer.ServeHTTP(rr, req)
+
+	if rr.Body.String() == served {
+		t.Errorf("Expected the user to move from the unhealthy server %s", served)
+	}
+
+	if newCookies := rr.Result().Cookies(); len(newCookies) != 1 || newCookies[0].Value == cookies[0].Value {
+		t.Errorf("Expected a new affinity cookie, got %v", newCookies)
+	}
+}
+
+// Helper function to create weight 1 servers of the urls
+func newServers(urls ...string) []ServerAndWeight {
+	servers := make([]ServerAndWeight, 0, len(urls))
+	for _, url := range urls {
+		servers = append(servers, NewServerAndWeight(url, 1, nil))
+	}
+
+	return servers
+}
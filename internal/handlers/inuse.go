@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// inUse track the values of the routes by name until the routes are replaced (their ctx is done),
+// so a reload can carry over the state of the previous routes. The last value of a name is the newest
+type inUse[T comparable] struct {
+	mu     sync.Mutex
+	values map[string][]T // In use order
+}
+
+// newest return the newest value of the name in use
+func (u *inUse[T]) newest(name string) (T, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var value T
+	values := u.values[name]
+	if len(values) == 0 {
+		return value, false
+	}
+
+	return values[len(values)-1], true
+}
+
+// reuse return the newest value of the name in use when accept is true for it,
+// the value is used again until ctx is done (released is called after the last use)
+func (u *inUse[T]) reuse(ctx context.Context, name string, accept func(T) bool, released func(T)) (T, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var value T
+	values := u.values[name]
+	if len(values) == 0 || !accept(values[len(values)-1]) {
+		return value, false
+	}
+
+	value = values[len(values)-1]
+	u.track(ctx, name, value, released)
+
+	return value, true
+}
+
+// use track the value until ctx is done, released is called after the last use of the value (may be nil)
+func (u *inUse[T]) use(ctx context.Context, name string, value T, released func(T)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.track(ctx, name, value, released)
+}
+
+func (u *inUse[T]) track(ctx context.Context, name string, value T, released func(T)) {
+	if u.values == nil {
+		u.values = make(map[string][]T)
+	}
+	u.values[name] = append(u.values[name], value)
+
+	context.AfterFunc(ctx, func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		values := u.values[name]
+		i := slices.Index(values, value)
+		values = slices.Delete(values, i, i+1)
+		if len(values) == 0 {
+			delete(u.values, name)
+		} else {
+			u.values[name] = values
+		}
+
+		if released != nil && !slices.Contains(values, value) {
+			released(value)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// Define a custom type for context keys to avoid collisions
+type upstreamResultKeyType string
+
+var upstreamResultKey = upstreamResultKeyType("upstream-result")
+
+// upstreamResult is filled by the reverse proxy with the upstream response or the error when the upstream request failed
+type upstreamResult struct {
+	err        error
+	status     int       // 0 when no response was received
+	receivedAt time.Time // When the response headers were received
+}
+
+// recordUpstreamError keep the proxy error for the balancer of the request (if any)
+func recordUpstreamError(r *http.Request, err error) {
+	if result, ok := r.Context().Value(upstreamResultKey).(*upstreamResult); ok {
+		result.err = err
+	}
+}
+
+// recordUpstreamResponse keep the upstream response status for the balancer of the request (used as ModifyResponse)
+func recordUpstreamResponse(resp *http.Response) error {
+	if result, ok := resp.Request.Context().Value(upstreamResultKey).(*upstreamResult); ok {
+		result.status = resp.StatusCode
+		result.receivedAt = time.Now()
+	}
+
+	return nil
+}
+
+// outcome return the outcome of the upstream request that started at start
+func (result *upstreamResult) outcome(start time.Time) Outcome {
+	if result.receivedAt.IsZero() {
+		return Outcome{Latency: time.Since(start), Err: result.err}
+	}
+
+	return Outcome{Latency: result.receivedAt.Sub(start), Status: result.status, Err: result.err}
+}
+
+// withUpstreamResult return the request with an upstream result in its context (the existing one is reused)
+func withUpstreamResult(r *http.Request) (*http.Request, *upstreamResult) {
+	if result, ok := r.Context().Value(upstreamResultKey).(*upstreamResult); ok {
+		return r, result
+	}
+
+	result := &upstreamResult{}
+	return r.WithContext(context.WithValue(r.Context(), upstreamResultKey, result)), result
+}
+
+type outlierStats struct {
+	consecutive5xx             int
+	consecutiveConnectFailures int
+	windowStart                time.Time
+	requests                   int // In the window
+	errors                     int // In the window
+	ejections                  int // Consecutive ejections (for the back-off)
+	ejectedUntil               time.Time
+}
+
+// outlierDetector eject servers of a backend by their live responses (passive health checking).
+// A server is ejected on consecutive 5xx responses, consecutive connection failures or a high error rate in the window,
+// each repeated ejection is twice as long (up to the max) and no more than the max percentage of the servers is ejected at once.
+type outlierDetector struct {
+	backend string
+	config  config.OutlierDetection
+
+	mu      sync.Mutex
+	servers map[string]*outlierStats // By url
+}
+
+func newOutlierDetector(backend string, outlierDetection config.OutlierDetection, urls []string) *outlierDetector {
+	servers := make(map[string]*outlierStats, len(urls))
+	for _, url := range urls {
+		servers[url] = &outlierStats{windowStart: time.Now()}
+	}
+
+	return &outlierDetector{backend: backend, config: outlierDetection, servers: servers}
+}
+
+// setServers keep the stats of the servers that stay and start the new servers clean
+func (od *outlierDetector) setServers(urls []string) {
+	if od == nil {
+		return
+	}
+
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	servers := make(map[string]*outlierStats, len(urls))
+	for _, url := range urls {
+		stats, exists := od.servers[url]
+		if !exists {
+			stats = &outlierStats{windowStart: time.Now()}
+		}
+		servers[url] = stats
+	}
+
+	od.servers = servers
+}
+
+// isEjected report if the server is out of the rotation, a nil detector ejects nothing
+func (od *outlierDetector) isEjected(url string) bool {
+	if od == nil {
+		return false
+	}
+
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	stats, exists := od.servers[url]
+	return exists && time.Now().Before(stats.ejectedUntil)
+}
+
+// observe record the result of a request to the server, err is the proxy error (nil when a response was received).
+// A nil detector ignores the results
+func (od *outlierDetector) observe(url string, status int, err error) {
+	// The client went away, it says nothing about the server
+	if od == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	stats, exists := od.servers[url]
+	if !exists {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(stats.windowStart) >= od.config.Window {
+		stats.windowStart = now
+		stats.requests = 0
+		stats.errors = 0
+	}
+
+	failed := err != nil || status >= 500
+	stats.requests++
+
+	if !failed {
+		stats.consecutive5xx = 0
+		stats.consecutiveConnectFailures = 0
+		return
+	}
+
+	stats.errors++
+
+	if isConnectFailure(err) {
+		stats.consecutiveConnectFailures++
+	} else {
+		stats.consecutiveConnectFailures = 0
+	}
+
+	// Failed requests are answered with 502
+	stats.consecutive5xx++
+
+	// Already ejected (requests that started before the ejection)
+	if now.Before(stats.ejectedUntil) {
+		return
+	}
+
+	if reason := od.ejectionReason(stats); reason != "" {
+		od.eject(url, stats, now, reason)
+	}
+}
+
+func (od *outlierDetector) ejectionReason(stats *outlierStats) string {
+	if stats.consecutiveConnectFailures >= od.config.ConsecutiveConnectFailures {
+		return fmt.Sprintf("%d consecutive connection failures", stats.consecutiveConnectFailures)
+	}
+
+	if stats.consecutive5xx >= od.config.Consecutive5xx {
+		return fmt.Sprintf("%d consecutive 5xx responses", stats.consecutive5xx)
+	}
+
+	if stats.requests >= od.config.MinRequests {
+		if errorRate := float64(stats.errors) / float64(stats.requests); errorRate >= *od.config.ErrorRate {
+			return fmt.Sprintf("error rate %.2f of %d requests", errorRate, stats.requests)
+		}
+	}
+
+	return ""
+}
+
+func (od *outlierDetector) eject(url string, stats *outlierStats, now time.Time, reason string) {
+	ejected := 0
+	for _, serverStats := range od.servers {
+		if now.Before(serverStats.ejectedUntil) {
+			ejected++
+		}
+	}
+
+	if ejected+1 > len(od.servers)*od.config.MaxEjectedPercent/100 {
+		log.Default().Printf("Backend <%s> server %s not ejected (%s), max ejected percent reached\n", od.backend, url, reason)
+		return
+	}
+
+	// The back-off is reset when the server was fine for the max ejection time since the last ejection
+	if !stats.ejectedUntil.IsZero() && now.Sub(stats.ejectedUntil) > od.config.MaxEjectionTime {
+		stats.ejections = 0
+	}
+
+	ejectionTime := od.config.BaseEjectionTime << min(stats.ejections, 16)
+	if ejectionTime > od.config.MaxEjectionTime || ejectionTime <= 0 {
+		ejectionTime = od.config.MaxEjectionTime
+	}
+
+	stats.ejections++
+	stats.ejectedUntil = now.Add(ejectionTime)
+	stats.consecutive5xx = 0
+	stats.consecutiveConnectFailures = 0
+	stats.windowStart = now
+	stats.requests = 0
+	stats.errors = 0
+
+	log.Default().Printf("Backend <%s> server %s ejected for %s: %s\n", od.backend, url, ejectionTime, reason)
+}
+
+// isConnectFailure report if the proxy error happened before the request reached the server
+func isConnectFailure(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	newDetector := func(maxEjectedPercent int, urls ...string) *outlierDetector {
+		return newOutlierDetector("test", newOutlierDetection(3, maxEjectedPercent), urls)
+	}
+
+	t.Run("consecutive 5xx", func(t *testing.T) {
+		od := newDetector(50, "a", "b")
+
+		od.observe("a", http.StatusBadGateway, nil)
+		od.observe("a", http.StatusBadGateway, nil)
+		od.observe("a", http.StatusOK, nil)
+		od.observe("a", http.StatusBadGateway, nil)
+		if od.isEjected("a") {
+			t.Fatal("Expected a success to reset the consecutive 5xx")
+		}
+
+		od.observe("a", http.StatusServiceUnavailable, nil)
+		od.observe("a", http.StatusInternalServerError, nil)
+		if !od.isEjected("a") {
+			t.Error("Expected the server to be ejected after 3 consecutive 5xx")
+		}
+	})
+
+	t.Run("connect failures", func(t *testing.T) {
+		od := newDetector(50, "a", "b")
+		dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+		for i := 0; i < config.DefaultOutlierConsecutiveConnectFailures; i++ {
+			od.observe("a", http.StatusBadGateway, dialErr)
+		}
+
+		if !od.isEjected("a") {
+			t.Error("Expected the server to be ejected after consecutive connection failures")
+		}
+	})
+
+	t.Run("error rate", func(t *testing.T) {
+		od := newDetector(50, "a", "b")
+
+		// Alternate so the consecutive thresholds are never reached
+		for i := 0; i < config.DefaultOutlierMinRequests; i++ {
+			status := http.StatusOK
+			if i%2 == 1 {
+				status = http.StatusInternalServerError
+			}
+			od.observe("a", status, nil)
+		}
+
+		if !od.isEjected("a") {
+			t.Error("Expected the server to be ejected by the error rate")
+		}
+	})
+
+	t.Run("canceled requests are ignored", func(t *testing.T) {
+		od := newDetector(50, "a", "b")
+
+		for i := 0; i < 5; i++ {
+			od.observe("a", http.StatusBadGateway, context.Canceled)
+		}
+
+		if od.isEjected("a") {
+			t.Error("Expected canceled requests to be ignored")
+		}
+	})
+
+	t.Run("max ejected percent", func(t *testing.T) {
+		od := newDetector(50, "a", "b")
+
+		for _, url := range []string{"a", "b"} {
+			for i := 0; i < 3; i++ {
+				od.observe(url, http.StatusBadGateway, nil)
+			}
+		}
+
+		if !od.isEjected("a") || od.isEjected("b") {
+			t.Errorf("Expected only half of the servers to be ejected, a=%v b=%v", od.isEjected("a"), od.isEjected("b"))
+		}
+
+		single := newDetector(100, "a")
+		for i := 0; i < 3; i++ {
+			single.observe("a", http.StatusBadGateway, nil)
+		}
+		if !single.isEjected("a") {
+			t.Error("Expected max_ejected_percent 100 to allow ejecting the only server")
+		}
+	})
+
+	t.Run("exponential back-off", func(t *testing.T) {
+		od := newDetector(50, "a", "b")
+		stats := od.servers["a"]
+
+		expected := []time.Duration{
+			config.DefaultOutlierBaseEjectionTime,
+			config.DefaultOutlierBaseEjectionTime * 2,
+			config.DefaultOutlierBaseEjectionTime * 4,
+		}
+		for i, ejectionTime := range expected {
+			// Let the previous ejection end
+			stats.ejectedUntil = time.Now().Add(-time.Second)
+
+			now := time.Now()
+			od.eject("a", stats, now, "test")
+			if got := stats.ejectedUntil.Sub(now); got != ejectionTime {
+				t.Errorf("ejection %d got %s want %s", i+1, got, ejectionTime)
+			}
+		}
+
+		stats.ejectedUntil = time.Now().Add(-config.DefaultOutlierMaxEjectionTime - time.Second)
+		now := time.Now()
+		od.eject("a", stats, now, "test")
+		if got := stats.ejectedUntil.Sub(now); got != config.DefaultOutlierBaseEjectionTime {
+			t.Errorf("Expected the back-off to reset after a healthy period, got %s", got)
+		}
+	})
+}
+
+func TestBalancerEjectsFailingServer(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	backend := config.Backend{
+		BalancePolicy: "round-robin",
+		Servers: []config.BackendServer{
+			{URL: failing.URL, Weight: 1},
+			{URL: healthy.URL, Weight: 1},
+		},
+	}
+	outlierDetection := newOutlierDetection(2, 50)
+	backend.OutlierDetection = &outlierDetection
+
+	balancer, err := newBalancer(context.Background(), "test", backend, config.Path{}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	// Round robin sends every other request to the failing server
+	for i := 0; i < 4; i++ {
+		balancer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	for i := 0; i < 10; i++ {
+		rr := httptest.NewRecorder()
+		balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected the failing server to be ejected, request %d got status %d", i, rr.Code)
+		}
+	}
+}
+
+// Helper function to create an outlier detection config with the default values
+func newOutlierDetection(consecutive5xx int, maxEjectedPercent int) config.OutlierDetection {
+	errorRate := config.DefaultOutlierErrorRate
+
+	return config.OutlierDetection{
+		Consecutive5xx:             consecutive5xx,
+		ConsecutiveConnectFailures: config.DefaultOutlierConsecutiveConnectFailures,
+		ErrorRate:                  &errorRate,
+		Window:                     config.DefaultOutlierWindow,
+		MinRequests:                config.DefaultOutlierMinRequests,
+		BaseEjectionTime:           config.DefaultOutlierBaseEjectionTime,
+		MaxEjectionTime:            config.DefaultOutlierMaxEjectionTime,
+		MaxEjectedPercent:          maxEjectedPercent,
+	}
+}
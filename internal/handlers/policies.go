@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+)
+
+// The peak ewma latency decays to the new samples with this time constant
+const ewmaDecay = time.Second * 10
+
+// Latency of the failed requests and of the servers without samples that have requests in flight
+const latencyPenalty = time.Second
+
+// serverLoad track the in-flight requests and the latency of a server (shared by all the policies), a nil load tracks nothing
+type serverLoad struct {
+	inFlight atomic.Int64
+	last     atomic.Int64 // Last latency in microseconds
+
+	mu         sync.Mutex
+	ewma       float64 // Peak ewma latency in microseconds
+	lastSample time.Time
+}
+
+// start count a request as in-flight, the returned done reports its outcome
+func (sl *serverLoad) start() func(Outcome) {
+	if sl == nil {
+		return nil
+	}
+
+	sl.inFlight.Add(1)
+
+	return func(outcome Outcome) {
+		sl.inFlight.Add(-1)
+
+		// Rejected by the circuit breaker, the server latency is unknown
+		if errors.Is(outcome.Err, circuitbreaker.ErrOpen) {
+			return
+		}
+
+		// A failed request is fast (connection refused) but the server must not look fast
+		if outcome.Err != nil {
+			sl.observe(max(outcome.Latency, latencyPenalty))
+			return
+		}
+
+		sl.observe(outcome.Latency)
+	}
+}
+
+// observe update the peak ewma: slower samples are taken as is and faster samples decay in by the time since the last sample
+func (sl *serverLoad) observe(latency time.Duration) {
+	sl.last.Store(latency.Microseconds())
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := time.Now()
+	sample := float64(latency.Microseconds())
+
+	if sample > sl.ewma {
+		sl.ewma = sample
+	} else {
+		weight := math.Exp(-float64(now.Sub(sl.lastSample)) / float64(ewmaDecay))
+		sl.ewma = sl.ewma*weight + sample*(1-weight)
+	}
+	sl.lastSample = now
+}
+
+func (sl *serverLoad) requests() int64 {
+	if sl == nil {
+		return 0
+	}
+
+	return sl.inFlight.Load()
+}
+
+// latency return the peak ewma latency in microseconds. A server without samples is free while idle and has the penalty
+// latency while it has requests in flight, so it takes one request at a time until its first response
+func (sl *serverLoad) latency() float64 {
+	if sl == nil {
+		return 0
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.lastSample.IsZero() {
+		if sl.inFlight.Load() > 0 {
+			return float64(latencyPenalty.Microseconds())
+		}
+		return 0
+	}
+
+	return sl.ewma
+}
+
+// lastLatency return the last latency in microseconds
+func (sl *serverLoad) lastLatency() int64 {
+	if sl == nil {
+		return 0
+	}
+
+	return sl.last.Load()
+}
+
+// LeastConnectionsPolicy choose the server with the least in-flight requests per weight
+type LeastConnectionsPolicy struct {
+	servers []ServerAndWeight
+}
+
+func NewLeastConnectionsPolicy(servers []ServerAndWeight) *LeastConnectionsPolicy {
+	return &LeastConnectionsPolicy{servers: servers}
+}
+
+func (lcp *LeastConnectionsPolicy) GetNext(request PickRequest) Pick {
+	isAvailable := available(lcp.servers, request.Tried)
+
+	chosen := -1
+	bestLoad := math.Inf(1)
+
+	// Start at a random server so ties don't always go to the first one
+	offset := rand.Intn(len(lcp.servers))
+	for n := range lcp.servers {
+		i := (n + offset) % len(lcp.servers)
+		if !isAvailable(&lcp.servers[i]) {
+			continue
+		}
+
+		load := float64(lcp.servers[i].load.requests()) / float64(lcp.servers[i].weight)
+		if load < bestLoad {
+			chosen = i
+			bestLoad = load
+		}
+	}
+
+	if chosen == -1 {
+		chosen = offset
+	}
+
+	return newPick(&lcp.servers[chosen])
+}
+
+// P2CPolicy choose two random servers (by weight) and send the request to the less loaded one,
+// the load is the in-flight requests or the peak ewma latency per weight
+type P2CPolicy struct {
+	byLatency bool
+	servers   []ServerAndWeight
+}
+
+func NewP2CPolicy(servers []ServerAndWeight, metric string) *P2CPolicy {
+	return &P2CPolicy{byLatency: metric == "latency", servers: servers}
+}
+
+func (pp *P2CPolicy) GetNext(request PickRequest) Pick {
+	isAvailable := available(pp.servers, request.Tried)
+
+	first := weightedRandom(pp.servers, isAvailable, -1)
+	second := weightedRandom(pp.servers, isAvailable, first)
+
+	chosen := first
+	if second != -1 && pp.load(second) < pp.load(first) {
+		chosen = second
+	}
+
+	return newPick(&pp.servers[chosen])
+}
+
+func (pp *P2CPolicy) load(i int) float64 {
+	weight := float64(pp.servers[i].weight)
+
+	if pp.byLatency {
+		return pp.servers[i].load.latency() / weight
+	}
+
+	return float64(pp.servers[i].load.requests()) / weight
+}
+
+// PeakEWMAPolicy choose the server with the lowest peak ewma latency, scaled by its in-flight requests and weight.
+// Unlike least-latency a single slow request doesn't decide everything, the latency decays back as faster responses arrive
+type PeakEWMAPolicy struct {
+	servers []ServerAndWeight
+}
+
+func NewPeakEWMAPolicy(servers []ServerAndWeight) *PeakEWMAPolicy {
+	return &PeakEWMAPolicy{servers: servers}
+}
+
+func (pep *PeakEWMAPolicy) GetNext(request PickRequest) Pick {
+	isAvailable := available(pep.servers, request.Tried)
+
+	chosen := -1
+	bestCost := math.Inf(1)
+
+	// Start at a random server so ties (no samples yet) don't always go to the first one
+	offset := rand.Intn(len(pep.servers))
+	for n := range pep.servers {
+		i := (n + offset) % len(pep.servers)
+		if !isAvailable(&pep.servers[i]) {
+			continue
+		}
+
+		load := pep.servers[i].load
+		cost := load.latency() * float64(load.requests()+1) / float64(pep.servers[i].weight)
+		if cost < bestCost {
+			chosen = i
+			bestCost = cost
+		}
+	}
+
+	if chosen == -1 {
+		chosen = offset
+	}
+
+	return newPick(&pep.servers[chosen])
+}
+
+// weightedRandom return the index of a random available server by weight (other than skip), -1 when there is none
+func weightedRandom(servers []ServerAndWeight, isAvailable func(*ServerAndWeight) bool, skip int) int {
+	weightsSum := 0
+	for i := range servers {
+		if i != skip && isAvailable(&servers[i]) {
+			weightsSum += servers[i].weight
+		}
+	}
+
+	if weightsSum == 0 {
+		if skip == -1 {
+			return rand.Intn(len(servers))
+		}
+		return -1
+	}
+
+	randomServerIndex := rand.Intn(weightsSum)
+	for i := range servers {
+		if i == skip || !isAvailable(&servers[i]) {
+			continue
+		}
+
+		randomServerIndex -= servers[i].weight
+		if randomServerIndex < 0 {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+)
+
+func TestLeastConnectionsPolicy(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 3, nil),
+	}
+
+	policy := NewLeastConnectionsPolicy(servers)
+
+	// Requests are held open, the in-flight requests follow the weights
+	counts := map[string]int{}
+	picks := make([]Pick, 0, 8)
+	for i := 0; i < 8; i++ {
+		pick := policy.GetNext(PickRequest{})
+		counts[pick.URL()]++
+		picks = append(picks, pick)
+	}
+
+	if counts["http://localhost:8001"] != 2 || counts["http://localhost:8002"] != 6 {
+		t.Errorf("Expected the in-flight requests to follow the weights, got %v", counts)
+	}
+
+	// Finished requests free their server
+	for _, pick := range picks {
+		if pick.URL() == "http://localhost:8001" {
+			pick.Done(Outcome{Latency: time.Millisecond})
+		}
+	}
+
+	if url := policy.GetNext(PickRequest{}).URL(); url != "http://localhost:8001" {
+		t.Errorf("Expected the server with the least connections, got %s", url)
+	}
+}
+
+func TestP2CPolicy(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 1, nil),
+	}
+
+	t.Run("in-flight", func(t *testing.T) {
+		policy := NewP2CPolicy(servers, "in-flight")
+
+		busy := policy.GetNext(PickRequest{})
+		for i := 0; i < 10; i++ {
+			pick := policy.GetNext(PickRequest{})
+			if pick.URL() == busy.URL() {
+				t.Fatalf("Expected the server without in-flight requests, got %s", pick.URL())
+			}
+			pick.Done(Outcome{Latency: time.Millisecond})
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		policy := NewP2CPolicy(servers, "latency")
+
+		policy.servers[0].load.observe(time.Millisecond * 50)
+		policy.servers[1].load.observe(time.Millisecond)
+
+		for i := 0; i < 10; i++ {
+			pick := policy.GetNext(PickRequest{})
+			if pick.URL() != "http://localhost:8002" {
+				t.Fatalf("Expected the faster server, got %s", pick.URL())
+			}
+			pick.Done(Outcome{Latency: time.Millisecond})
+		}
+	})
+}
+
+func TestPeakEWMAPolicy(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 1, nil),
+	}
+
+	policy := NewPeakEWMAPolicy(servers)
+
+	policy.servers[0].load.observe(time.Millisecond * 2)
+	policy.servers[1].load.observe(time.Millisecond * 5)
+
+	if url := policy.GetNext(PickRequest{}).URL(); url != "http://localhost:8001" {
+		t.Fatalf("Expected the faster server, got %s", url)
+	}
+
+	// A slow request is taken as is (peak)
+	policy.servers[0].load.observe(time.Millisecond * 50)
+	pick := policy.GetNext(PickRequest{})
+	if pick.URL() != "http://localhost:8002" {
+		t.Errorf("Expected the peak to move the traffic, got %s", pick.URL())
+	}
+
+	// Rejected requests don't count
+	pick.Done(Outcome{Err: circuitbreaker.ErrOpen})
+	if latency := policy.servers[1].load.latency(); latency != 5000 {
+		t.Errorf("Expected the rejected request to be ignored, got latency %v", latency)
+	}
+}
+
+func TestPeakEWMAPolicyNewServer(t *testing.T) {
+	servers := []ServerAndWeight{
+		NewServerAndWeight("http://localhost:8001", 1, nil),
+		NewServerAndWeight("http://localhost:8002", 1, nil),
+	}
+
+	policy := NewPeakEWMAPolicy(servers)
+	policy.servers[0].load.observe(time.Millisecond * 5)
+
+	// The new server takes one request until its first response
+	first := policy.GetNext(PickRequest{})
+	if first.URL() != "http://localhost:8002" {
+		t.Fatalf("Expected the idle new server, got %s", first.URL())
+	}
+
+	for i := 0; i < 5; i++ {
+		pick := policy.GetNext(PickRequest{})
+		if pick.URL() != "http://localhost:8001" {
+			t.Fatalf("Expected the sampled server while the new server is busy, got %s", pick.URL())
+		}
+		pick.Done(Outcome{Latency: time.Millisecond * 5})
+	}
+
+	// A failed request (connection refused) doesn't make the server look fast
+	first.Done(Outcome{Latency: time.Microsecond, Err: errors.New("connection refused")})
+	if latency := policy.servers[1].load.latency(); latency < float64(latencyPenalty.Microseconds()) {
+		t.Errorf("Expected the penalty latency for the failed request, got %v", latency)
+	}
+
+	if url := policy.GetNext(PickRequest{}).URL(); url != "http://localhost:8001" {
+		t.Errorf("Expected the failing server to be avoided, got %s", url)
+	}
+}
+
+func TestServerLoadDecay(t *testing.T) {
+	load := &serverLoad{}
+	load.observe(time.Millisecond * 100)
+
+	// Fast samples right after the peak barely move it
+	load.observe(time.Millisecond)
+	if latency := load.latency(); latency < 90000 {
+		t.Errorf("Expected the peak to decay slowly, got %v", latency)
+	}
+
+	// After a few decay periods the fast samples take over
+	load.lastSample = time.Now().Add(-ewmaDecay * 5)
+	load.observe(time.Millisecond)
+	if latency := load.latency(); latency > 2000 {
+		t.Errorf("Expected the latency to decay to the new samples, got %v", latency)
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http/httputil"
+	"net/url"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/discovery"
+)
+
+// Pool hold the servers of a backend and their balance policy. The servers can change at runtime (service discovery),
+// the servers that stay keep their reverse proxy and state
+type Pool struct {
+	name     string
+	backend  config.Backend
+	instance Instance
+	proxies  bool               // Create a reverse proxy per server (http backends)
+	outlier  *outlierDetector   // nil when outlier detection is disabled
+	breakers *circuitBreakers   // nil when circuit breaking is disabled
+	stop     context.CancelFunc // Stop the provider of the discovered servers when the pool is no longer in use (nil when not tracked)
+
+	mu      sync.Mutex // Serialize the updates
+	members atomic.Pointer[poolMembers]
+}
+
+// poolMembers is a snapshot of the servers of a pool, it is replaced as a whole on updates
+type poolMembers struct {
+	policy  BalancePolicy
+	servers []ServerAndWeight
+	configs []config.BackendServer // The config of the servers
+}
+
+// Pools track the pools in use by backend name, a reloaded backend with the same config keeps its pool
+// (servers, discovery and state) and a changed backend starts from the servers and state (load, slow start)
+// of its previous pool. A nil pools doesn't track them
+type Pools struct {
+	pools inUse[*Pool]
+}
+
+func NewPools() *Pools {
+	return &Pools{}
+}
+
+// last return the newest pool of the backend in use (nil when the backend has no pool)
+func (ps *Pools) last(name string) *Pool {
+	if ps == nil {
+		return nil
+	}
+
+	pool, _ := ps.pools.newest(name)
+	return pool
+}
+
+// reuse return the newest pool of the backend in use when it is unchanged, it is used until ctx is done (nil when there is no such pool)
+func (ps *Pools) reuse(ctx context.Context, name string, unchanged func(*Pool) bool) *Pool {
+	if ps == nil {
+		return nil
+	}
+
+	pool, _ := ps.pools.reuse(ctx, name, unchanged, stopPool)
+	return pool
+}
+
+// use track the pool until ctx is done
+func (ps *Pools) use(ctx context.Context, pool *Pool) {
+	if ps == nil {
+		return
+	}
+
+	ps.pools.use(ctx, pool.name, pool, stopPool)
+}
+
+// stopPool stop the provider of the pool after its last use
+func stopPool(pool *Pool) {
+	if pool.stop != nil {
+		pool.stop()
+	}
+}
+
+// NewPool create the pool of a backend without reverse proxies (streams), the discovered servers are loaded before it returns
+func NewPool(ctx context.Context, name string, backend config.Backend, instance Instance) (*Pool, error) {
+	return newPool(ctx, name, backend, instance, nil, false)
+}
+
+// newPool create the pool of a backend used until ctx is done, the provider of the discovered servers (shared by the pools of
+// the same source) stops after the last use.
+// The pool in use of the backend is reused when its config is unchanged (config reload), otherwise the pool starts from its
+// servers and state and the discovered servers of the previous pool are kept until the provider finds the servers
+func newPool(ctx context.Context, name string, backend config.Backend, instance Instance, breakers *circuitBreakers, proxies bool) (*Pool, error) {
+	unchanged := func(previous *Pool) bool {
+		return previous.unchanged(backend, instance, breakers, proxies)
+	}
+	if pool := instance.Pools.reuse(ctx, name, unchanged); pool != nil {
+		return pool, nil
+	}
+
+	pool := &Pool{name: name, backend: backend, instance: instance, proxies: proxies, breakers: breakers}
+
+	if backend.OutlierDetection != nil {
+		pool.outlier = newOutlierDetector(name, *backend.OutlierDetection, nil)
+	}
+
+	provider := discovery.New(name, backend, instance.Agents)
+
+	servers := backend.Servers
+	if previous := instance.Pools.last(name); previous != nil {
+		members := previous.members.Load()
+		pool.members.Store(members)
+		if provider != nil {
+			servers = members.configs
+		}
+	}
+
+	if err := pool.Update(servers); err != nil {
+		return nil, err
+	}
+
+	if provider != nil {
+		// A tracked pool can be reused by the next routes, its provider stops after the last use
+		providerCtx := ctx
+		if instance.Pools != nil {
+			providerCtx, pool.stop = context.WithCancel(context.WithoutCancel(ctx))
+		}
+
+		instance.Sources.Start(providerCtx, discovery.Source(backend, instance.Agents), provider, func(servers []config.BackendServer) {
+			if err := pool.Update(servers); err != nil {
+				log.Default().Printf("Backend <%s> failed to update the servers: %s\n", name, err.Error())
+			}
+		})
+	}
+
+	instance.Pools.use(ctx, pool)
+	return pool, nil
+}
+
+// unchanged report if the pool was created by the same config
+func (p *Pool) unchanged(backend config.Backend, instance Instance, breakers *circuitBreakers, proxies bool) bool {
+	return p.proxies == proxies &&
+		p.instance.Zone == instance.Zone &&
+		reflect.DeepEqual(p.instance.Agents, instance.Agents) &&
+		reflect.DeepEqual(p.backend, backend) &&
+		p.breakers.unchanged(breakers)
+}
+
+// Update replace the servers of the pool, servers added to a pool with servers ramp up by the slow start of the backend
+func (p *Pool) Update(serversConfig []config.BackendServer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := p.members.Load()
+
+	current := make(map[string]*ServerAndWeight)
+	if previous != nil {
+		for i := range previous.servers {
+			current[previous.servers[i].url] = &previous.servers[i]
+		}
+	}
+
+	// The backup servers and failover are computed from the current servers
+	backend := p.backend
+	backend.Servers = serversConfig
+
+	// The first servers of the pool are not ramped up
+	joining := previous != nil && len(previous.servers) > 0
+
+	urls := make([]string, 0, len(serversConfig))
+	servers := make([]ServerAndWeight, 0, len(serversConfig))
+	for _, serverConfig := range serversConfig {
+		server, err := p.newServer(backend, serverConfig, current[serverConfig.URL], joining)
+		if err != nil {
+			return err
+		}
+
+		servers = append(servers, server)
+		urls = append(urls, serverConfig.URL)
+	}
+
+	policy, err := NewBalancePolicy(backend, servers)
+	if err != nil {
+		return err
+	}
+
+	p.outlier.setServers(urls)
+	p.members.Store(&poolMembers{policy: policy, servers: servers, configs: serversConfig})
+
+	// The state of the removed servers is dropped, requests in flight keep their own references
+	for url := range current {
+		if !slices.Contains(urls, url) {
+			p.instance.Health.Unregister(p.name, url)
+			p.instance.Drain.Unregister(p.name, url)
+			p.instance.Breakers.Unregister(p.name, url)
+		}
+	}
+
+	return nil
+}
+
+// newServer create the entry of a server, the reverse proxy and state of the previous entry of the server are kept
+func (p *Pool) newServer(backend config.Backend, serverConfig config.BackendServer, previous *ServerAndWeight, joining bool) (ServerAndWeight, error) {
+	var proxy *httputil.ReverseProxy
+	switch {
+	case previous != nil:
+		proxy = previous.server
+	case p.proxies:
+		serverURL, err := url.Parse(serverConfig.URL)
+		if err != nil {
+			return ServerAndWeight{}, err
+		}
+
+		proxy = httputil.NewSingleHostReverseProxy(serverURL)
+		proxy.ErrorHandler = proxyErrorHandler
+		proxy.ModifyResponse = recordUpstreamResponse
+	}
+
+	server := NewServerAndWeight(serverConfig.URL, serverConfig.Weight, proxy)
+	if previous != nil {
+		server.load = previous.load
+	}
+
+	server = server.WithHealth(ServerHealth(p.instance.Health, p.name, backend, serverConfig.URL)).WithRotation(p.name, backend, serverConfig, p.instance)
+	server.outlier = p.outlier
+	server.breaker = p.breakers.breaker(serverConfig.URL)
+
+	if previous != nil {
+		server.slowStart = server.slowStart.inherit(previous.slowStart)
+	} else if joining {
+		server.slowStart.join()
+	}
+
+	return server, nil
+}
+
+// snapshot return the current servers and policy, nil when the pool has no servers
+func (p *Pool) snapshot() *poolMembers {
+	members := p.members.Load()
+	if len(members.servers) == 0 {
+		return nil
+	}
+
+	return members
+}
+
+// Pick choose the server of the request, false when the pool has no servers
+func (p *Pool) Pick(request PickRequest) (Pick, bool) {
+	members := p.snapshot()
+	if members == nil {
+		return Pick{}, false
+	}
+
+	return members.policy.GetNext(request), true
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/drain"
+)
+
+func TestPoolUpdateKeepsUnchangedServers(t *testing.T) {
+	backend := config.Backend{BalancePolicy: "round-robin", SlowStart: time.Minute, Servers: []config.BackendServer{
+		{URL: "http://10.0.0.1:8080", Weight: 1},
+		{URL: "http://10.0.0.2:8080", Weight: 1},
+	}}
+
+	registry := drain.NewRegistry()
+	pool, err := newPool(context.Background(), "pool-update-test", backend, Instance{Drain: registry}, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	before := pool.members.Load().servers[0]
+
+	err = pool.Update([]config.BackendServer{
+		{URL: "http://10.0.0.1:8080", Weight: 1},
+		{URL: "http://10.0.0.3:8080", Weight: 1},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update pool: %v", err)
+	}
+
+	servers := pool.members.Load().servers
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %d", len(servers))
+	}
+
+	if servers[0].server != before.server || servers[0].load != before.load || servers[0].slowStart != before.slowStart {
+		t.Error("Expected the unchanged server to keep its reverse proxy and state")
+	}
+
+	if servers[1].server == nil || getProxyURL(servers[1].server) != "http://10.0.0.3:8080/" {
+		t.Error("Expected a reverse proxy for the new server")
+	}
+
+	// The new server joined a running pool and ramps up
+	if servers[1].slowStart.since.IsZero() {
+		t.Error("Expected the new server to slow start")
+	}
+
+	if registry.Lookup("pool-update-test", "http://10.0.0.2:8080") != nil {
+		t.Error("Expected the removed server to be unregistered")
+	}
+}
+
+func TestBalancerWithEmptyPool(t *testing.T) {
+	pool, err := newPool(context.Background(), "pool-empty-test", config.Backend{BalancePolicy: "round-robin"}, Instance{}, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	balancer := &Balancer{pool: pool}
+
+	rr := httptest.NewRecorder()
+	balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rr.Code)
+	}
+
+	if _, ok := pool.Pick(PickRequest{}); ok {
+		t.Error("Expected no pick from an empty pool")
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("discovered"))
+	}))
+	defer upstream.Close()
+
+	if err := pool.Update([]config.BackendServer{{URL: upstream.URL, Weight: 1}}); err != nil {
+		t.Fatalf("Failed to update pool: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Body.String() != "discovered" {
+		t.Errorf("Expected the discovered server to serve the request, got %q", rr.Body.String())
+	}
+}
+
+func TestPoolFileDiscovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	if err := os.WriteFile(path, []byte(`[{"url": "http://10.0.0.1:8080"}]`), 0o644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	backend := config.Backend{BalancePolicy: "round-robin", File: &config.FileDiscovery{Path: path, Interval: 10 * time.Millisecond}}
+	pool, err := newPool(context.Background(), "pool-file-test", backend, Instance{}, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	before := pool.snapshot()
+	if before == nil || len(before.servers) != 1 {
+		t.Fatal("Expected the servers of the file before the pool is returned")
+	}
+
+	// Replaced by rename like a deploy system would
+	next := path + ".tmp"
+	if err := os.WriteFile(next, []byte(`[{"url": "http://10.0.0.1:8080"}, {"url": "http://10.0.0.2:8080"}]`), 0o644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+	if err := os.Rename(next, path); err != nil {
+		t.Fatalf("Failed to replace servers file: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pool.snapshot().servers) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the pool to be updated from the file")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if pool.snapshot().servers[0].server != before.servers[0].server {
+		t.Error("Expected the unchanged server to keep its reverse proxy")
+	}
+}
+
+func TestNewPoolStartsFromPreviousPool(t *testing.T) {
+	registry := drain.NewRegistry()
+	instance := Instance{Drain: registry, Pools: NewPools()}
+
+	backend := config.Backend{BalancePolicy: "round-robin", SlowStart: time.Minute, Servers: []config.BackendServer{
+		{URL: "http://10.0.0.1:8080", Weight: 1},
+		{URL: "http://10.0.0.2:8080", Weight: 1},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	previous, err := newPool(ctx, "pool-reload-test", backend, instance, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	before := previous.members.Load().servers[0]
+
+	// Reloaded with a server replaced
+	backend.Servers = []config.BackendServer{
+		{URL: "http://10.0.0.1:8080", Weight: 1},
+		{URL: "http://10.0.0.3:8080", Weight: 1},
+	}
+	pool, err := newPool(context.Background(), "pool-reload-test", backend, instance, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	cancel()
+
+	servers := pool.members.Load().servers
+	if servers[0].load != before.load || servers[0].slowStart != before.slowStart {
+		t.Error("Expected the kept server to keep its load and slow start")
+	}
+
+	if servers[1].slowStart.since.IsZero() {
+		t.Error("Expected the server added by the reload to slow start")
+	}
+
+	if registry.Lookup("pool-reload-test", "http://10.0.0.2:8080") != nil {
+		t.Error("Expected the server removed by the reload to be unregistered")
+	}
+}
+
+func TestNewPoolKeepsPreviousDiscoveredServers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	if err := os.WriteFile(path, []byte(`[{"url": "http://10.0.0.1:8080"}]`), 0o644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	instance := Instance{Pools: NewPools()}
+	backend := config.Backend{BalancePolicy: "round-robin", File: &config.FileDiscovery{Path: path, Interval: time.Minute}}
+	if _, err := newPool(context.Background(), "pool-discovery-reload-test", backend, instance, nil, true); err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	// Reloaded while the file can't be read
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove servers file: %v", err)
+	}
+	backend.BalancePolicy = "random"
+
+	pool, err := newPool(context.Background(), "pool-discovery-reload-test", backend, instance, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	members := pool.snapshot()
+	if members == nil || len(members.servers) != 1 || members.servers[0].url != "http://10.0.0.1:8080" {
+		t.Fatal("Expected the servers of the previous pool until the provider finds the servers")
+	}
+
+	if _, ok := members.policy.(*RandomPolicy); !ok {
+		t.Errorf("Expected the balance policy of the reloaded config, got %T", members.policy)
+	}
+}
+
+func TestPoolsReleasedWhenUnused(t *testing.T) {
+	pools := NewPools()
+	backend := config.Backend{BalancePolicy: "round-robin", Servers: []config.BackendServer{{URL: "http://10.0.0.1:8080", Weight: 1}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool, err := newPool(ctx, "pool-release-test", backend, Instance{Pools: pools}, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	if pools.last("pool-release-test") != pool {
+		t.Fatal("Expected the pool to be tracked while in use")
+	}
+
+	cancel()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pools.last("pool-release-test") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the pool to be released when its routes are replaced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewPoolReusesUnchangedPool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers.json")
+	if err := os.WriteFile(path, []byte(`[{"url": "http://10.0.0.1:8080"}]`), 0o644); err != nil {
+		t.Fatalf("Failed to write servers file: %v", err)
+	}
+
+	instance := Instance{Pools: NewPools()}
+	backend := config.Backend{BalancePolicy: "round-robin", File: &config.FileDiscovery{Path: path, Interval: 10 * time.Millisecond}}
+
+	previousCtx, cancelPrevious := context.WithCancel(context.Background())
+	previous, err := newPool(previousCtx, "pool-reuse-test", backend, instance, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool, err := newPool(ctx, "pool-reuse-test", backend, instance, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+
+	if pool != previous {
+		t.Fatal("Expected the pool of the unchanged backend to be reused")
+	}
+
+	// The previous routes are replaced, the discovery of the reused pool keeps running
+	cancelPrevious()
+
+	// Helper function to replace the servers file like a deploy system would
+	writeServers := func(servers string) {
+		next := path + ".tmp"
+		if err := os.WriteFile(next, []byte(servers), 0o644); err != nil {
+			t.Fatalf("Failed to write servers file: %v", err)
+		}
+		if err := os.Rename(next, path); err != nil {
+			t.Fatalf("Failed to replace servers file: %v", err)
+		}
+	}
+
+	writeServers(`[{"url": "http://10.0.0.1:8080"}, {"url": "http://10.0.0.2:8080"}]`)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pool.snapshot().servers) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the reused pool to keep discovering the servers")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The last use is done, the discovery stops
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	writeServers(`[{"url": "http://10.0.0.3:8080"}]`)
+	time.Sleep(100 * time.Millisecond)
+
+	if len(pool.snapshot().servers) != 2 {
+		t.Error("Expected the discovery to stop after the last use of the pool")
+	}
+}
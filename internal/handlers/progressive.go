@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/pkg/monitor"
+)
+
+// Latencies kept for the p95 of a step (the oldest are dropped)
+const maxProgressiveLatencies = 10000
+
+// progressiveRollout shift the split weight from the stable target to the canary step by step.
+// Each step the canary responses are observed, the canary is promoted to the next step after the interval
+// and rolled back (weight 0) as soon as its error rate or p95 latency exceed the thresholds.
+type progressiveRollout struct {
+	split    *Split
+	endpoint string
+	config   config.Progressive
+	canary   string
+	stable   string
+	tick     time.Duration // How often the canary is judged
+
+	mu         sync.Mutex
+	step       int
+	stepStart  time.Time
+	requests   int
+	errors     int
+	latencies  []time.Duration
+	done       bool // Completed or rolled back
+	rolledBack bool
+	stopped    bool // The handler was replaced
+}
+
+// Rollouts track the progressive rollouts in use by endpoint, a reloaded endpoint with the same progressive config
+// resumes the rollout of the previous config. A nil rollouts doesn't track them
+type Rollouts struct {
+	rollouts inUse[*progressiveRollout]
+}
+
+func NewRollouts() *Rollouts {
+	return &Rollouts{}
+}
+
+// last return the newest rollout of the endpoint in use (nil when the endpoint has no rollout)
+func (rs *Rollouts) last(endpoint string) *progressiveRollout {
+	if rs == nil {
+		return nil
+	}
+
+	rollout, _ := rs.rollouts.newest(endpoint)
+	return rollout
+}
+
+// use track the rollout until ctx is done
+func (rs *Rollouts) use(ctx context.Context, rollout *progressiveRollout) {
+	if rs == nil {
+		return
+	}
+
+	rs.rollouts.use(ctx, rollout.endpoint, rollout, nil)
+}
+
+// newProgressiveRollout create the rollout of the split, the step, rollback and step start of the previous rollout
+// of the endpoint (config reload) are kept when the progressive config is unchanged
+func newProgressiveRollout(split *Split, endpoint string, progressive config.Progressive, previous *progressiveRollout) *progressiveRollout {
+	rollout := &progressiveRollout{
+		split:    split,
+		endpoint: endpoint,
+		config:   progressive,
+		canary:   progressive.Canary,
+		tick:     min(progressive.Interval, time.Second),
+	}
+
+	for _, target := range split.targets {
+		if target.name != progressive.Canary {
+			rollout.stable = target.name
+		}
+	}
+
+	if previous != nil && previous.stable == rollout.stable && reflect.DeepEqual(previous.config, progressive) {
+		rollout.resume(previous)
+		return rollout
+	}
+
+	rollout.setStep(0)
+
+	return rollout
+}
+
+// resume continue the previous rollout from its state
+func (pr *progressiveRollout) resume(previous *progressiveRollout) {
+	previous.mu.Lock()
+	pr.step = previous.step
+	pr.stepStart = previous.stepStart
+	pr.requests = previous.requests
+	pr.errors = previous.errors
+	pr.latencies = slices.Clone(previous.latencies)
+	pr.done = previous.done
+	pr.rolledBack = previous.rolledBack
+	previous.mu.Unlock()
+
+	weight := pr.config.Steps[pr.step]
+	if pr.rolledBack {
+		weight = 0
+	}
+	pr.split.SetWeights(map[string]uint{pr.canary: weight, pr.stable: 100 - weight})
+}
+
+// run judge the canary until the rollout is over or ctx is done (the handler is replaced on reload)
+func (pr *progressiveRollout) run(ctx context.Context) {
+	ticker := time.NewTicker(pr.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if pr.evaluate(now) {
+				return
+			}
+		case <-ctx.Done():
+			pr.stop()
+			return
+		}
+	}
+}
+
+// stop end the rollout without changing the weights
+func (pr *progressiveRollout) stop() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	pr.stopped = true
+}
+
+// observe record a canary response
+func (pr *progressiveRollout) observe(status int, latency time.Duration) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if pr.done || pr.stopped {
+		return
+	}
+
+	pr.requests++
+	if status >= 500 {
+		pr.errors++
+	}
+
+	if len(pr.latencies) >= maxProgressiveLatencies {
+		pr.latencies = pr.latencies[1:]
+	}
+	pr.latencies = append(pr.latencies, latency)
+}
+
+// evaluate judge the current step, it returns true when the rollout is over (completed or rolled back)
+func (pr *progressiveRollout) evaluate(now time.Time) bool {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if pr.done || pr.stopped {
+		return true
+	}
+
+	// Not enough canary traffic to judge
+	if pr.requests < pr.config.MinRequests {
+		return false
+	}
+
+	if reason := pr.unhealthyReason(); reason != "" {
+		pr.rollback(reason)
+		return true
+	}
+
+	if now.Sub(pr.stepStart) < pr.config.Interval {
+		return false
+	}
+
+	if pr.step == len(pr.config.Steps)-1 {
+		pr.done = true
+		log.Default().Printf("Progressive <%s> canary %s completed at %d%%\n", pr.endpoint, pr.canary, pr.config.Steps[pr.step])
+		return true
+	}
+
+	pr.setStep(pr.step + 1)
+	log.Default().Printf("Progressive <%s> canary %s promoted to %d%%\n", pr.endpoint, pr.canary, pr.config.Steps[pr.step])
+
+	return false
+}
+
+// unhealthyReason return why the canary exceeds the thresholds (empty if healthy)
+func (pr *progressiveRollout) unhealthyReason() string {
+	errorRate := float64(pr.errors) / float64(pr.requests)
+	if errorRate > *pr.config.MaxErrorRate {
+		return fmt.Sprintf("error rate %.3f exceeds %.3f", errorRate, *pr.config.MaxErrorRate)
+	}
+
+	if pr.config.MaxP95Latency > 0 {
+		if p95 := percentile(pr.latencies, 0.95); p95 > pr.config.MaxP95Latency {
+			return fmt.Sprintf("p95 latency %s exceeds %s", p95, pr.config.MaxP95Latency)
+		}
+	}
+
+	return ""
+}
+
+// setStep move the weights to step and start a new observation window
+func (pr *progressiveRollout) setStep(step int) {
+	pr.step = step
+	pr.stepStart = time.Now()
+	pr.requests = 0
+	pr.errors = 0
+	pr.latencies = nil
+
+	weight := pr.config.Steps[step]
+	pr.split.SetWeights(map[string]uint{pr.canary: weight, pr.stable: 100 - weight})
+}
+
+func (pr *progressiveRollout) rollback(reason string) {
+	pr.done = true
+	pr.rolledBack = true
+	weight := pr.config.Steps[pr.step]
+	pr.split.SetWeights(map[string]uint{pr.canary: 0, pr.stable: 100})
+
+	log.Default().Printf("Progressive <%s> canary %s rolled back at %d%%: %s\n", pr.endpoint, pr.canary, weight, reason)
+
+	if pr.config.OnFailure == "" {
+		return
+	}
+
+	variables := map[string]string{
+		"endpoint": pr.endpoint,
+		"canary":   pr.canary,
+		"weight":   strconv.Itoa(int(weight)),
+		"error":    reason,
+	}
+	if err := monitor.RunHook(pr.config.OnFailure, variables); err != nil {
+		log.Default().Printf("Failed to spawn on_failure command: %s\n", err)
+	}
+}
+
+// percentile return the p percentile (0 - 1) of the latencies
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	index := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[max(0, min(index, len(sorted)-1))]
+}
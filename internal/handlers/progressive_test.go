@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestProgressiveRollout(t *testing.T) {
+	v1 := newNamedServer(t, "v1")
+	v2 := newNamedServer(t, "v2")
+
+	newRollout := func(progressive config.Progressive) *progressiveRollout {
+		maxErrorRate := 0.1
+		progressive.Canary = "v2"
+		progressive.Interval = time.Hour // Steps are driven by the test
+		progressive.MinRequests = 10
+		progressive.MaxErrorRate = &maxErrorRate
+
+		split, err := NewSplit(context.Background(), config.Service{Domain: "example.com"}, config.Path{Path: "/", Split: &config.Split{
+			Targets: []config.SplitTarget{
+				{Name: "v1", Destination: &v1},
+				{Name: "v2", Destination: &v2},
+			},
+			OverrideHeader: "X-Split-Target",
+			Progressive:    &progressive,
+		}}, Instance{})
+		if err != nil {
+			t.Fatalf("Failed to create split: %v", err)
+		}
+		return split.rollout
+	}
+
+	weights := func(pr *progressiveRollout) (uint, uint) {
+		pr.split.mu.RLock()
+		defer pr.split.mu.RUnlock()
+		return pr.split.targets[0].weight, pr.split.targets[1].weight
+	}
+
+	observe := func(pr *progressiveRollout, requests int, errors int, latency time.Duration) {
+		for i := 0; i < requests; i++ {
+			status := http.StatusOK
+			if i < errors {
+				status = http.StatusBadGateway
+			}
+			pr.observe(status, latency)
+		}
+	}
+
+	t.Run("promotes healthy canary", func(t *testing.T) {
+		pr := newRollout(config.Progressive{Steps: []uint{5, 50, 100}})
+
+		if stable, canary := weights(pr); stable != 95 || canary != 5 {
+			t.Fatalf("Expected weights 95/5, got %d/%d", stable, canary)
+		}
+
+		// Not enough requests to judge the step
+		observe(pr, 5, 0, time.Millisecond)
+		if pr.evaluate(time.Now().Add(2 * time.Hour)) {
+			t.Fatal("Expected the rollout to continue")
+		}
+		if _, canary := weights(pr); canary != 5 {
+			t.Errorf("Expected canary weight to stay 5 without enough requests, got %d", canary)
+		}
+
+		// Interval not passed yet
+		observe(pr, 5, 0, time.Millisecond)
+		pr.evaluate(time.Now())
+		if _, canary := weights(pr); canary != 5 {
+			t.Errorf("Expected canary weight to stay 5 before the interval, got %d", canary)
+		}
+
+		pr.evaluate(time.Now().Add(2 * time.Hour))
+		if stable, canary := weights(pr); stable != 50 || canary != 50 {
+			t.Errorf("Expected weights 50/50 after promotion, got %d/%d", stable, canary)
+		}
+
+		observe(pr, 10, 0, time.Millisecond)
+		pr.evaluate(time.Now().Add(2 * time.Hour))
+		observe(pr, 10, 0, time.Millisecond)
+		if !pr.evaluate(time.Now().Add(2 * time.Hour)) {
+			t.Error("Expected the rollout to complete after the last step")
+		}
+		if stable, canary := weights(pr); stable != 0 || canary != 100 {
+			t.Errorf("Expected weights 0/100 after completion, got %d/%d", stable, canary)
+		}
+	})
+
+	t.Run("rolls back on error rate", func(t *testing.T) {
+		pr := newRollout(config.Progressive{Steps: []uint{25, 100}})
+
+		observe(pr, 10, 2, time.Millisecond)
+		if !pr.evaluate(time.Now()) {
+			t.Error("Expected the rollout to stop on rollback")
+		}
+		if stable, canary := weights(pr); stable != 100 || canary != 0 {
+			t.Errorf("Expected weights 100/0 after rollback, got %d/%d", stable, canary)
+		}
+	})
+
+	t.Run("rolls back on p95 latency", func(t *testing.T) {
+		pr := newRollout(config.Progressive{Steps: []uint{25, 100}, MaxP95Latency: 100 * time.Millisecond})
+
+		observe(pr, 18, 0, time.Millisecond)
+		observe(pr, 2, 0, time.Second)
+		if !pr.evaluate(time.Now()) {
+			t.Error("Expected the rollout to stop on rollback")
+		}
+		if _, canary := weights(pr); canary != 0 {
+			t.Errorf("Expected canary weight 0 after rollback, got %d", canary)
+		}
+	})
+
+	t.Run("runs on_failure hook", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "rollback-$canary-$weight")
+		pr := newRollout(config.Progressive{Steps: []uint{25, 100}, OnFailure: "touch " + marker})
+
+		observe(pr, 10, 10, time.Millisecond)
+		pr.evaluate(time.Now())
+
+		expected := filepath.Join(filepath.Dir(marker), "rollback-v2-25")
+		for i := 0; i < 50; i++ {
+			if _, err := os.Stat(expected); err == nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Errorf("Expected the on_failure hook to create %s", expected)
+	})
+
+	t.Run("observes canary responses", func(t *testing.T) {
+		pr := newRollout(config.Progressive{Steps: []uint{100}})
+
+		serveSplit(t, pr.split, "", "", "10.0.0.1:1")
+		serveSplit(t, pr.split, "", "v1", "10.0.0.1:1")
+
+		pr.mu.Lock()
+		defer pr.mu.Unlock()
+		if pr.requests != 1 {
+			t.Errorf("Expected 1 observed canary request, got %d", pr.requests)
+		}
+	})
+}
+
+func TestProgressiveRolloutStopsWithContext(t *testing.T) {
+	v1 := newNamedServer(t, "v1")
+	v2 := newNamedServer(t, "v2")
+
+	maxErrorRate := 0.1
+	marker := filepath.Join(t.TempDir(), "rollback")
+	progressive := config.Progressive{
+		Canary:       "v2",
+		Steps:        []uint{25, 100},
+		Interval:     10 * time.Millisecond,
+		MinRequests:  1,
+		MaxErrorRate: &maxErrorRate,
+		OnFailure:    "touch " + marker,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	split, err := NewSplit(ctx, config.Service{Domain: "example.com"}, config.Path{Path: "/", Split: &config.Split{
+		Targets:     []config.SplitTarget{{Name: "v1", Destination: &v1}, {Name: "v2", Destination: &v2}},
+		Progressive: &progressive,
+	}}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create split: %v", err)
+	}
+
+	// The split is replaced by a reload
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	// A failing canary of the stopped rollout is not judged anymore
+	for i := 0; i < 10; i++ {
+		split.rollout.observe(http.StatusBadGateway, time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	split.mu.RLock()
+	stable, canary := split.targets[0].weight, split.targets[1].weight
+	split.mu.RUnlock()
+	if stable != 75 || canary != 25 {
+		t.Errorf("Expected the weights to stay 75/25 after the rollout stopped, got %d/%d", stable, canary)
+	}
+
+	split.rollout.mu.Lock()
+	requests := split.rollout.requests
+	split.rollout.mu.Unlock()
+	if requests != 0 {
+		t.Errorf("Expected no observed requests after the rollout stopped, got %d", requests)
+	}
+
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the on_failure hook not to run after the rollout stopped")
+	}
+}
+
+func TestProgressiveRolloutResumesAfterReload(t *testing.T) {
+	v1 := newNamedServer(t, "v1")
+	v2 := newNamedServer(t, "v2")
+
+	maxErrorRate := 0.1
+	progressive := config.Progressive{Canary: "v2", Steps: []uint{5, 50, 100}, Interval: time.Hour, MinRequests: 1, MaxErrorRate: &maxErrorRate}
+	instance := Instance{Rollouts: NewRollouts()}
+
+	// Helper function to create the split of the endpoint like a reload would
+	newRollout := func(ctx context.Context, progressive config.Progressive) *progressiveRollout {
+		split, err := NewSplit(ctx, config.Service{Domain: "example.com"}, config.Path{Path: "/", Split: &config.Split{
+			Targets:     []config.SplitTarget{{Name: "v1", Destination: &v1}, {Name: "v2", Destination: &v2}},
+			Progressive: &progressive,
+		}}, instance)
+		if err != nil {
+			t.Fatalf("Failed to create split: %v", err)
+		}
+		return split.rollout
+	}
+
+	canaryWeight := func(pr *progressiveRollout) uint {
+		pr.split.mu.RLock()
+		defer pr.split.mu.RUnlock()
+		return pr.split.targets[1].weight
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := newRollout(ctx, progressive)
+	first.observe(http.StatusOK, time.Millisecond)
+	first.evaluate(time.Now().Add(2 * time.Hour))
+
+	reloadedCtx, cancelReloaded := context.WithCancel(context.Background())
+	defer cancelReloaded()
+	reloaded := newRollout(reloadedCtx, progressive)
+	cancel()
+
+	if reloaded.step != 1 || !reloaded.stepStart.Equal(first.stepStart) || canaryWeight(reloaded) != 50 {
+		t.Fatalf("Expected the reloaded rollout to resume at step 1, got step %d weight %d", reloaded.step, canaryWeight(reloaded))
+	}
+
+	// Rolled back, a reload keeps the canary out
+	reloaded.observe(http.StatusBadGateway, time.Millisecond)
+	reloaded.evaluate(time.Now())
+
+	rolledBack := newRollout(context.Background(), progressive)
+	if !rolledBack.done || canaryWeight(rolledBack) != 0 {
+		t.Errorf("Expected the reloaded rollout to stay rolled back, got weight %d", canaryWeight(rolledBack))
+	}
+
+	// A changed progressive config starts over
+	progressive.Steps = []uint{10, 100}
+	if restarted := newRollout(context.Background(), progressive); restarted.done || canaryWeight(restarted) != 10 {
+		t.Errorf("Expected the changed rollout to start over, got weight %d", canaryWeight(restarted))
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	if got := percentile(latencies, 0.95); got != 95*time.Millisecond {
+		t.Errorf("percentile(0.95) got %v want %v", got, 95*time.Millisecond)
+	}
+
+	if got := percentile(nil, 0.95); got != 0 {
+		t.Errorf("percentile of no latencies got %v want 0", got)
+	}
+}
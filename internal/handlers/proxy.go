@@ -1,28 +1,51 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
 	"github.com/hvuhsg/gatego/internal/config"
 	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"github.com/hvuhsg/gatego/internal/errorpages"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
 type Proxy struct {
-	proxy *httputil.ReverseProxy
+	proxy    *httputil.ReverseProxy
+	retry    *retryPolicy            // nil when retries are disabled
+	breakers *circuitBreakers        // nil when circuit breaking is disabled
+	breaker  *circuitbreaker.Breaker // The circuit breaker of the destination
 }
 
-func NewProxy(service config.Service, path config.Path) (Proxy, error) {
+func NewProxy(service config.Service, path config.Path, instance Instance) (Proxy, error) {
+	return newProxy(BackendName(service, path, ""), path, instance)
+}
+
+// newProxy create the proxy to the destination of the path, name identify it in the circuit breakers state of the instance
+func newProxy(name string, path config.Path, instance Instance) (Proxy, error) {
 	serviceURL, err := url.Parse(*path.Destination)
 	if err != nil {
 		return Proxy{}, err
 	}
 
+	breakers, err := newCircuitBreakers(name, path.CircuitBreaker, instance.Breakers)
+	if err != nil {
+		return Proxy{}, err
+	}
+
 	proxy := httputil.NewSingleHostReverseProxy(serviceURL)
+	proxy.ErrorHandler = proxyErrorHandler
+
+	server := Proxy{proxy: proxy, breakers: breakers, breaker: breakers.breaker(*path.Destination)}
+	if path.Retry != nil {
+		server.retry = newRetryPolicy(*path.Retry)
+	}
 
-	server := Proxy{proxy: proxy}
 	return server, nil
 }
 
@@ -34,5 +57,20 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r = r.WithContext(ctx)
 		defer span.End()
 	}
-	p.proxy.ServeHTTP(w, r)
+	p.retry.serve(w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.breakers.serve(w, r, p.breaker, p.proxy)
+	}))
+}
+
+// proxyErrorHandler report upstream failures (like httputil default) using the error renderer of the request
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	log.Default().Printf("http: proxy error: %v", err)
+	recordUpstreamError(r, err)
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		errorpages.Error(w, r, "Upstream server timed out", http.StatusGatewayTimeout)
+		return
+	}
+
+	errorpages.Error(w, r, "Upstream server unavailable", http.StatusBadGateway)
 }
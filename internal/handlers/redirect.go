@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+var targetVariableRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var wildcardVariableRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\.\.\.\}`)
+
+type Redirect struct {
+	status        int
+	target        string
+	preserveQuery bool
+	wildcards     []string // Variables of the endpoint path matching the rest of the path ({rest...})
+}
+
+func NewRedirect(redirect config.Redirect, pathPattern string) Redirect {
+	status := redirect.Status
+	if status == 0 {
+		status = config.DefaultRedirectStatus
+	}
+
+	wildcards := []string{}
+	for _, match := range wildcardVariableRegex.FindAllStringSubmatch(pathPattern, -1) {
+		wildcards = append(wildcards, match[1])
+	}
+
+	return Redirect{status: status, target: redirect.Target, preserveQuery: redirect.PreserveQuery, wildcards: wildcards}
+}
+
+func (rd Redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	location := rd.expandTarget(r)
+
+	// A path starting with // is a protocol relative url (another host)
+	if strings.HasPrefix(location, "//") && !strings.HasPrefix(rd.target, "//") {
+		location = "/" + strings.TrimLeft(location, "/")
+	}
+
+	if rd.preserveQuery && r.URL.RawQuery != "" {
+		separator := "?"
+		if strings.Contains(location, "?") {
+			separator = "&"
+		}
+		location += separator + r.URL.RawQuery
+	}
+
+	http.Redirect(w, r, location, rd.status)
+}
+
+// expandTarget replace {name} with the (escaped) path variable captured for the request,
+// or with the request {path}, {query}, {host} and {scheme} (path variables win on name collision)
+func (rd Redirect) expandTarget(r *http.Request) string {
+	return targetVariableRegex.ReplaceAllStringFunc(rd.target, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+
+		if value := r.PathValue(name); value != "" {
+			return rd.escapePathValue(name, value)
+		}
+
+		switch name {
+		case "path":
+			return r.URL.EscapedPath()
+		case "query":
+			return r.URL.RawQuery
+		case "host":
+			return r.Host
+		case "scheme":
+			if r.TLS != nil {
+				return "https"
+			}
+			return "http"
+		}
+
+		return ""
+	})
+}
+
+// escapePathValue escape the decoded path value, the slashes of a wildcard value separate its segments
+func (rd Redirect) escapePathValue(name string, value string) string {
+	if !slices.Contains(rd.wildcards, name) {
+		return url.PathEscape(value)
+	}
+
+	segments := strings.Split(value, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	return strings.Join(segments, "/")
+}
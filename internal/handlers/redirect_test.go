@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name             string
+		pattern          string
+		redirect         config.Redirect
+		requestURL       string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:             "fixed target with default status",
+			pattern:          "/old-docs/",
+			redirect:         config.Redirect{Target: "https://docs.example.com"},
+			requestURL:       "http://example.com/old-docs/intro",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://docs.example.com",
+		},
+		{
+			name:             "request path and host",
+			pattern:          "/",
+			redirect:         config.Redirect{Status: http.StatusMovedPermanently, Target: "https://{host}{path}"},
+			requestURL:       "http://example.com/a/b",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "https://example.com/a/b",
+		},
+		{
+			name:             "captured path variables",
+			pattern:          "/users/{id}/posts/{rest...}",
+			redirect:         config.Redirect{Status: http.StatusPermanentRedirect, Target: "/v2/members/{id}/{rest}"},
+			requestURL:       "http://example.com/users/42/posts/7/comments",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "/v2/members/42/7/comments",
+		},
+		{
+			name:             "path variable wins over request variable",
+			pattern:          "/files/{path...}",
+			redirect:         config.Redirect{Target: "https://cdn.example.com/{path}"},
+			requestURL:       "http://example.com/files/img/logo.png",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://cdn.example.com/img/logo.png",
+		},
+		{
+			name:             "escaped path variable",
+			pattern:          "/users/{id}",
+			redirect:         config.Redirect{Target: "/v2/members/{id}"},
+			requestURL:       "http://example.com/users/a%3Fb%23c%2Fd",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/v2/members/a%3Fb%23c%2Fd",
+		},
+		{
+			name:             "escaped wildcard path variable",
+			pattern:          "/files/{rest...}",
+			redirect:         config.Redirect{Target: "https://cdn.example.com/{rest}"},
+			requestURL:       "http://example.com/files/img/a%3Fb.png",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://cdn.example.com/img/a%3Fb.png",
+		},
+		{
+			name:             "query variable",
+			pattern:          "/search",
+			redirect:         config.Redirect{Target: "https://search.example.com/?{query}"},
+			requestURL:       "http://example.com/search?q=go&page=2",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://search.example.com/?q=go&page=2",
+		},
+		{
+			name:             "preserve query",
+			pattern:          "/old",
+			redirect:         config.Redirect{Target: "/new", PreserveQuery: true},
+			requestURL:       "http://example.com/old?a=1",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/new?a=1",
+		},
+		{
+			name:             "preserve query with target query",
+			pattern:          "/old",
+			redirect:         config.Redirect{Target: "/new?source=old", PreserveQuery: true},
+			requestURL:       "http://example.com/old?a=1",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/new?source=old&a=1",
+		},
+		{
+			name:             "preserve query without request query",
+			pattern:          "/old",
+			redirect:         config.Redirect{Target: "/new", PreserveQuery: true},
+			requestURL:       "http://example.com/old",
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "/new",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle(tt.pattern, NewRedirect(tt.redirect, tt.pattern))
+
+			req := httptest.NewRequest(http.MethodGet, tt.requestURL, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("handler returned wrong location: got %v want %v", location, tt.expectedLocation)
+			}
+		})
+	}
+}
+
+func TestRedirectProtocolRelativePath(t *testing.T) {
+	tests := []struct {
+		name             string
+		target           string
+		expectedLocation string
+	}{
+		{name: "request path", target: "{path}", expectedLocation: "/evil.example/x"},
+		{name: "path after a slash", target: "/{path}", expectedLocation: "/evil.example/x"},
+		{name: "protocol relative target", target: "//cdn.example.com{path}", expectedLocation: "//cdn.example.com//evil.example/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			NewRedirect(config.Redirect{Target: tt.target}, "/").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com//evil.example/x", nil))
+
+			if location := rr.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("got location %q want %q", location, tt.expectedLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// Respond serve a static response without contacting any server
+type Respond struct {
+	status  int
+	headers map[string]string
+	body    []byte
+}
+
+func NewRespond(respond config.Respond) (Respond, error) {
+	status := respond.Status
+	if status == 0 {
+		status = config.DefaultRespondStatus
+	}
+
+	headers := make(map[string]string, len(respond.Headers)+1)
+	for header, value := range respond.Headers {
+		headers[http.CanonicalHeaderKey(header)] = value
+	}
+
+	body := []byte(respond.Body)
+	if respond.BodyFile != "" {
+		var err error
+		body, err = os.ReadFile(respond.BodyFile)
+		if err != nil {
+			return Respond{}, err
+		}
+
+		// Prefer the file extension over content sniffing
+		if _, exists := headers["Content-Type"]; !exists {
+			if contentType := mime.TypeByExtension(filepath.Ext(respond.BodyFile)); contentType != "" {
+				headers["Content-Type"] = contentType
+			}
+		}
+	}
+
+	return Respond{status: status, headers: headers, body: body}, nil
+}
+
+func (rs Respond) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for header, value := range rs.headers {
+		w.Header().Set(header, value)
+	}
+
+	if len(rs.body) > 0 {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(rs.body))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(rs.body)))
+	}
+
+	w.WriteHeader(rs.status)
+
+	if r.Method != http.MethodHead {
+		w.Write(rs.body)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestRespond(t *testing.T) {
+	tempDir := t.TempDir()
+	bodyFile := filepath.Join(tempDir, "stub.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"status":"ok"}`), 0644); err != nil {
+		t.Fatalf("Failed to create body file: %v", err)
+	}
+
+	tests := []struct {
+		name                string
+		respond             config.Respond
+		method              string
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+		expectedHeaders     map[string]string
+	}{
+		{
+			name:                "inline body",
+			respond:             config.Respond{Body: "hello"},
+			method:              http.MethodGet,
+			expectedStatus:      http.StatusOK,
+			expectedBody:        "hello",
+			expectedContentType: "text/plain; charset=utf-8",
+		},
+		{
+			name: "status and headers",
+			respond: config.Respond{
+				Status:  http.StatusServiceUnavailable,
+				Headers: map[string]string{"content-type": "application/json", "Retry-After": "120"},
+				Body:    `{"error":"maintenance"}`,
+			},
+			method:              http.MethodGet,
+			expectedStatus:      http.StatusServiceUnavailable,
+			expectedBody:        `{"error":"maintenance"}`,
+			expectedContentType: "application/json",
+			expectedHeaders:     map[string]string{"Retry-After": "120"},
+		},
+		{
+			name:                "body from file",
+			respond:             config.Respond{BodyFile: bodyFile},
+			method:              http.MethodGet,
+			expectedStatus:      http.StatusOK,
+			expectedBody:        `{"status":"ok"}`,
+			expectedContentType: "application/json",
+		},
+		{
+			name:           "empty body",
+			respond:        config.Respond{Status: http.StatusNoContent},
+			method:         http.MethodGet,
+			expectedStatus: http.StatusNoContent,
+			expectedBody:   "",
+		},
+		{
+			name:                "head request",
+			respond:             config.Respond{Body: "hello"},
+			method:              http.MethodHead,
+			expectedStatus:      http.StatusOK,
+			expectedBody:        "",
+			expectedContentType: "text/plain; charset=utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := NewRespond(tt.respond)
+			if err != nil {
+				t.Fatalf("Failed to create respond handler: %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, "/stub", nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned wrong body: got %q want %q", rr.Body.String(), tt.expectedBody)
+			}
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("handler returned wrong content type: got %v want %v", contentType, tt.expectedContentType)
+			}
+
+			for header, want := range tt.expectedHeaders {
+				if got := rr.Header().Get(header); got != want {
+					t.Errorf("handler returned wrong %s header: got %v want %v", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRespondMissingBodyFile(t *testing.T) {
+	if _, err := NewRespond(config.Respond{BodyFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("Expected error for missing body file")
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The retry budget is counted over this window
+const retryBudgetWindow = time.Second * 10
+
+// Methods that can be sent twice without changing the result
+var idempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete}
+
+// retryPolicy retry failed upstream requests. A failed try is only retried when its response wasn't written yet,
+// so the retryable responses of every try but the last are held back from the client.
+type retryPolicy struct {
+	config   config.Retry
+	statuses map[int]bool
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int // In the budget window
+	retries     int // In the budget window
+}
+
+func newRetryPolicy(retry config.Retry) *retryPolicy {
+	statuses := make(map[int]bool)
+	for _, condition := range retry.RetryOn {
+		if status, err := strconv.Atoi(condition); err == nil {
+			statuses[status] = true
+		}
+	}
+
+	return &retryPolicy{config: retry, statuses: statuses, windowStart: time.Now()}
+}
+
+// serve send the request to next with up to the configured attempts, a nil policy sends it once
+func (rp *retryPolicy) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if rp == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	rp.addRequest()
+
+	// Bodies are replayable when buffered (by the request size limit)
+	replayable := r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+
+	for try := 1; ; try++ {
+		tryRequest := r
+		if try > 1 && r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tryRequest = r.Clone(r.Context())
+			tryRequest.Body = body
+		}
+
+		var cancel context.CancelFunc = func() {}
+		if rp.config.PerTryTimeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(tryRequest.Context(), rp.config.PerTryTimeout)
+			tryRequest = tryRequest.WithContext(ctx)
+		}
+
+		result := &upstreamResult{}
+		tryRequest = tryRequest.WithContext(context.WithValue(tryRequest.Context(), upstreamResultKey, result))
+
+		lastTry := try >= rp.config.Attempts || !replayable
+		rw := newRetryWriter(w, func(status int) bool {
+			return !lastTry && rp.shouldRetry(r, status, result.err)
+		})
+
+		next.ServeHTTP(rw, tryRequest)
+		cancel()
+
+		if !rw.heldBack {
+			rw.commit()
+			if try > 1 {
+				contextvalues.LogFieldsFromContext(r.Context()).Set("retries", strconv.Itoa(try-1))
+			}
+			return
+		}
+
+		trace.SpanFromContext(r.Context()).AddEvent("Retrying request", trace.WithAttributes(
+			attribute.Int("gatego.retry.try", try),
+			attribute.Int("gatego.retry.status", rw.status),
+		))
+
+		if !rp.sleep(r.Context(), try) {
+			// The endpoint timed out (or the client went away) during the back-off
+			return
+		}
+	}
+}
+
+// shouldRetry decide if a failed try is retried (and takes the retry from the budget)
+func (rp *retryPolicy) shouldRetry(r *http.Request, status int, err error) bool {
+	// The endpoint timed out or the client went away
+	if r.Context().Err() != nil {
+		return false
+	}
+
+	condition := ""
+	switch {
+	case isConnectFailure(err), errors.Is(err, circuitbreaker.ErrOpen):
+		// Both never reached the server
+		condition = "connect-error"
+	case errors.Is(err, context.DeadlineExceeded):
+		condition = "per-try-timeout"
+	case err != nil:
+		condition = "reset"
+	}
+
+	if condition != "" {
+		if !slices.Contains(rp.config.RetryOn, condition) {
+			return false
+		}
+	} else if !rp.statuses[status] {
+		return false
+	}
+
+	// Requests that never reached the server are safe to retry
+	if condition != "connect-error" && !rp.config.NonIdempotent && !slices.Contains(idempotentMethods, r.Method) {
+		return false
+	}
+
+	return rp.takeRetry()
+}
+
+func (rp *retryPolicy) addRequest() {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.resetWindow()
+	rp.requests++
+}
+
+// takeRetry report if the budget allows another retry
+func (rp *retryPolicy) takeRetry() bool {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.resetWindow()
+
+	allowed := max(rp.config.BudgetMinRetries, int(float64(rp.requests)*(*rp.config.BudgetPercent)/100))
+	if rp.retries >= allowed {
+		return false
+	}
+
+	rp.retries++
+	return true
+}
+
+func (rp *retryPolicy) resetWindow() {
+	if time.Since(rp.windowStart) >= retryBudgetWindow {
+		rp.windowStart = time.Now()
+		rp.requests = 0
+		rp.retries = 0
+	}
+}
+
+// sleep the jittered back-off of the try, it returns false when the context is done first
+func (rp *retryPolicy) sleep(ctx context.Context, try int) bool {
+	backoff := rp.config.BackoffBase << min(try-1, 16)
+	if backoff > rp.config.BackoffMax || backoff <= 0 {
+		backoff = rp.config.BackoffMax
+	}
+
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff) + 1)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// retryWriter hold back the response of a try when it is going to be retried,
+// other responses are written to the client (the headers are copied on WriteHeader)
+type retryWriter struct {
+	w        http.ResponseWriter
+	header   http.Header
+	retry    func(status int) bool
+	status   int
+	heldBack bool
+	written  bool
+}
+
+func newRetryWriter(w http.ResponseWriter, retry func(status int) bool) *retryWriter {
+	return &retryWriter{w: w, header: w.Header().Clone(), retry: retry}
+}
+
+func (rw *retryWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *retryWriter) WriteHeader(statusCode int) {
+	if rw.status != 0 {
+		return
+	}
+
+	// Informational responses (103 Early Hints) are forwarded as is, protocol switches (101) hijack the connection through Unwrap
+	if statusCode >= 100 && statusCode < 200 {
+		rw.copyHeader()
+		rw.w.WriteHeader(statusCode)
+		return
+	}
+
+	rw.status = statusCode
+	if rw.retry(statusCode) {
+		rw.heldBack = true
+		return
+	}
+
+	rw.commit()
+}
+
+func (rw *retryWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	if rw.heldBack {
+		return io.Discard.Write(b)
+	}
+
+	return rw.w.Write(b)
+}
+
+// commit write the headers to the client
+func (rw *retryWriter) commit() {
+	if rw.written || rw.heldBack {
+		return
+	}
+	rw.written = true
+
+	rw.copyHeader()
+	if rw.status != 0 {
+		rw.w.WriteHeader(rw.status)
+	}
+}
+
+// copyHeader make the client headers the headers of the try
+func (rw *retryWriter) copyHeader() {
+	header := rw.w.Header()
+	for key := range header {
+		if _, exists := rw.header[key]; !exists {
+			header.Del(key)
+		}
+	}
+
+	for key, values := range rw.header {
+		header[key] = values
+	}
+}
+
+func (rw *retryWriter) Flush() {
+	if rw.heldBack {
+		return
+	}
+
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rw.w).Flush()
+}
+
+// Unwrap let http.ResponseController reach the original writer (hijacking the connection of upgrade requests)
+func (rw *retryWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
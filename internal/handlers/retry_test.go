@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+func TestRetry(t *testing.T) {
+	t.Run("retries on another server", func(t *testing.T) {
+		var failingHits atomic.Int32
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			failingHits.Add(1)
+			w.Header().Set("X-Server", "failing")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "unavailable")
+		}))
+		defer failing.Close()
+
+		healthy := newNamedServer(t, "healthy")
+
+		balancer := newTestBalancer(t, newRetry(config.Retry{}), failing.URL, healthy)
+
+		for i := 0; i < 4; i++ {
+			rr := httptest.NewRecorder()
+			balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != http.StatusOK || rr.Body.String() != "healthy" {
+				t.Fatalf("request %d got %d %q want 200 \"healthy\"", i, rr.Code, rr.Body.String())
+			}
+
+			if rr.Header().Get("X-Server") != "" {
+				t.Errorf("Expected the headers of the failed try to be dropped")
+			}
+		}
+
+		if failingHits.Load() == 0 {
+			t.Error("Expected the failing server to be tried")
+		}
+	})
+
+	t.Run("retries connect errors with a replayed body", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, r.Body)
+		}))
+		defer echo.Close()
+
+		balancer := newTestBalancer(t, newRetry(config.Retry{}), closed.URL, echo.URL)
+
+		for i := 0; i < 2; i++ {
+			req := newReplayableRequest(http.MethodPost, "payload")
+			rr := httptest.NewRecorder()
+			balancer.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK || rr.Body.String() != "payload" {
+				t.Fatalf("request %d got %d %q want 200 \"payload\"", i, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("non idempotent methods are not retried", func(t *testing.T) {
+		var hits atomic.Int32
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer failing.Close()
+
+		balancer := newTestBalancer(t, newRetry(config.Retry{}), failing.URL)
+
+		rr := httptest.NewRecorder()
+		balancer.ServeHTTP(rr, newReplayableRequest(http.MethodPost, "payload"))
+
+		if rr.Code != http.StatusBadGateway || hits.Load() != 1 {
+			t.Errorf("got status %d after %d tries want 502 after 1 try", rr.Code, hits.Load())
+		}
+
+		hits.Store(0)
+		balancer = newTestBalancer(t, newRetry(config.Retry{NonIdempotent: true}), failing.URL)
+		balancer.ServeHTTP(httptest.NewRecorder(), newReplayableRequest(http.MethodPost, "payload"))
+
+		if hits.Load() != config.DefaultRetryAttempts {
+			t.Errorf("Expected non_idempotent to retry POST, got %d tries", hits.Load())
+		}
+	})
+
+	t.Run("per try timeout", func(t *testing.T) {
+		var hits atomic.Int32
+		slowOnce := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hits.Add(1) == 1 {
+				time.Sleep(200 * time.Millisecond)
+			}
+			io.WriteString(w, "done")
+		}))
+		defer slowOnce.Close()
+
+		balancer := newTestBalancer(t, newRetry(config.Retry{PerTryTimeout: 50 * time.Millisecond}), slowOnce.URL)
+
+		rr := httptest.NewRecorder()
+		balancer.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rr.Code != http.StatusOK || hits.Load() != 2 {
+			t.Errorf("got status %d after %d tries want 200 after 2 tries", rr.Code, hits.Load())
+		}
+	})
+
+	t.Run("budget", func(t *testing.T) {
+		var hits atomic.Int32
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+
+		budgetPercent := 0.0
+		balancer := newTestBalancer(t, newRetry(config.Retry{Attempts: 2, BudgetPercent: &budgetPercent, BudgetMinRetries: 2}), failing.URL)
+
+		for i := 0; i < 5; i++ {
+			balancer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+
+		// 5 requests and only 2 retries
+		if hits.Load() != 7 {
+			t.Errorf("Expected the budget to allow 2 retries, got %d tries for 5 requests", hits.Load())
+		}
+	})
+}
+
+func TestRetryWriterStreamsFinalResponse(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rw := newRetryWriter(rr, func(status int) bool { return status == http.StatusServiceUnavailable })
+
+	rw.Header().Set("Content-Type", "text/plain")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("hello"))
+	rw.Flush()
+
+	if rw.heldBack || rr.Code != http.StatusOK || rr.Body.String() != "hello" || !rr.Flushed {
+		t.Errorf("Expected the response to be written through, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	if rr.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected the headers to be copied, got %v", rr.Header())
+	}
+}
+
+func TestRetryUpgrade(t *testing.T) {
+	// Switch to an echo protocol
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack the upstream connection: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		brw.Flush()
+
+		line, _ := brw.ReadString('\n')
+		brw.WriteString(line)
+		brw.Flush()
+	}))
+	defer upstream.Close()
+
+	gateway := httptest.NewServer(newTestBalancer(t, newRetry(config.Retry{}), upstream.URL))
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read the response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected the protocol switch, got %d", resp.StatusCode)
+	}
+
+	io.WriteString(conn, "ping\n")
+	if line, _ := reader.ReadString('\n'); line != "ping\n" {
+		t.Errorf("Expected the upgraded connection to echo, got %q", line)
+	}
+}
+
+// Helper function to create a retry config with the default values
+func newRetry(retry config.Retry) *config.Retry {
+	if retry.Attempts == 0 {
+		retry.Attempts = config.DefaultRetryAttempts
+	}
+	retry.RetryOn = config.DefaultRetryOn
+	retry.BackoffBase = time.Millisecond
+	retry.BackoffMax = time.Millisecond * 5
+	if retry.BudgetPercent == nil {
+		budgetPercent := config.DefaultRetryBudgetPercent
+		retry.BudgetPercent = &budgetPercent
+	}
+	if retry.BudgetMinRetries == 0 {
+		retry.BudgetMinRetries = config.DefaultRetryBudgetMinRetries
+	}
+
+	return &retry
+}
+
+// Helper function to create a round robin balancer of the urls
+func newTestBalancer(t *testing.T, retry *config.Retry, urls ...string) *Balancer {
+	t.Helper()
+
+	backend := config.Backend{BalancePolicy: "round-robin"}
+	for _, url := range urls {
+		backend.Servers = append(backend.Servers, config.BackendServer{URL: url, Weight: 1})
+	}
+
+	balancer, err := newBalancer(context.Background(), "test", backend, config.Path{Retry: retry}, Instance{})
+	if err != nil {
+		t.Fatalf("Failed to create balancer: %v", err)
+	}
+
+	return balancer
+}
+
+// Helper function to create a request with a buffered body (like the request size limit does)
+func newReplayableRequest(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+
+	return req
+}
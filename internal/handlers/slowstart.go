@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// slowStart ramp up the share of requests of a server joining the rotation (coming back healthy, from an ejection,
+// an open circuit or draining), the chance of the server to take a request grows linearly over the window.
+// A nil slow start admits every request
+type slowStart struct {
+	window time.Duration
+
+	mu         sync.Mutex
+	inRotation bool
+	since      time.Time // Joined the rotation
+}
+
+func newSlowStart(window time.Duration) *slowStart {
+	if window <= 0 {
+		return nil
+	}
+
+	// The servers are in the rotation from the start, a restart of gatego doesn't ramp them up
+	return &slowStart{window: window, inRotation: true}
+}
+
+// admit track when the server joins the rotation and report if the server may take the request
+func (ss *slowStart) admit(inRotation bool) bool {
+	if ss == nil {
+		return true
+	}
+
+	ss.mu.Lock()
+	if inRotation && !ss.inRotation {
+		ss.since = time.Now()
+	}
+	ss.inRotation = inRotation
+	elapsed := time.Since(ss.since)
+	ss.mu.Unlock()
+
+	if !inRotation || elapsed >= ss.window {
+		return true
+	}
+
+	return rand.Float64() < float64(elapsed)/float64(ss.window)
+}
+
+// join restart the ramp up, for servers added to a running backend
+func (ss *slowStart) join() {
+	if ss == nil {
+		return
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.inRotation = true
+	ss.since = time.Now()
+}
+
+// inherit return the slow start with the ramp up of the previous slow start of the server (the window may be changed by a reload)
+func (ss *slowStart) inherit(previous *slowStart) *slowStart {
+	if ss == nil || previous == nil {
+		return ss
+	}
+
+	if ss.window == previous.window {
+		return previous
+	}
+
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	ss.inRotation = previous.inRotation
+	ss.since = previous.since
+
+	return ss
+}
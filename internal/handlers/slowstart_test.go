@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/health"
+)
+
+func TestSlowStartAdmit(t *testing.T) {
+	var disabled *slowStart
+	if !disabled.admit(true) {
+		t.Error("Expected a nil slow start to admit every request")
+	}
+
+	ss := newSlowStart(time.Minute)
+	if !ss.admit(true) {
+		t.Error("Expected the servers of the config to start at their full share")
+	}
+
+	// The server leaves the rotation and joins back
+	ss.admit(false)
+	ss.admit(true)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    float64 // Share of the admitted requests
+	}{
+		{"Quarter of the window", time.Minute / 4, 0.25},
+		{"Three quarters of the window", time.Minute * 3 / 4, 0.75},
+		{"After the window", time.Minute * 2, 1},
+	}
+
+	for _, tt := range tests {
+		ss.since = time.Now().Add(-tt.elapsed)
+
+		const requests = 10000
+		admitted := 0
+		for i := 0; i < requests; i++ {
+			if ss.admit(true) {
+				admitted++
+			}
+		}
+
+		if got := float64(admitted) / requests; math.Abs(got-tt.want) > 0.05 {
+			t.Errorf("%s: got share %.2f want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPoliciesRampUpRecoveredServer(t *testing.T) {
+	registry := health.NewRegistry()
+	serverHealth := registry.Register("test", "http://localhost:8001", 1, 1)
+
+	servers := newServers("http://localhost:8001", "http://localhost:8002")
+	servers[0] = servers[0].WithHealth(serverHealth)
+	for i := range servers {
+		servers[i].slowStart = newSlowStart(time.Minute)
+	}
+
+	policy := NewRoundRobinPolicy(servers)
+
+	// The restarted server fails its health checks and comes back
+	serverHealth.Report(errors.New("connection refused"))
+	policy.GetNext(PickRequest{})
+	serverHealth.Report(nil)
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[policy.GetNext(PickRequest{}).URL()]++
+	}
+
+	if counts["http://localhost:8001"] > 50 {
+		t.Errorf("Expected the recovered server to start with a small share, got %v", counts)
+	}
+
+	// A retry that already tried the other server is not held back
+	for i := 0; i < 20; i++ {
+		if url := policy.GetNext(PickRequest{Tried: []string{"http://localhost:8002"}}).URL(); url != "http://localhost:8001" {
+			t.Fatalf("Expected the server in slow start to take the retry, got %s", url)
+		}
+	}
+}
+
+func TestSlowStartInherit(t *testing.T) {
+	previous := newSlowStart(time.Minute)
+	previous.join()
+
+	if newSlowStart(time.Minute).inherit(previous) != previous {
+		t.Error("Expected the previous slow start of the same window to be kept")
+	}
+
+	longer := newSlowStart(time.Hour).inherit(previous)
+	if longer.window != time.Hour || !longer.since.Equal(previous.since) {
+		t.Errorf("Expected the new window with the previous ramp up, got window %s since %s", longer.window, longer.since)
+	}
+
+	var disabled *slowStart
+	if disabled.inherit(previous) != nil {
+		t.Error("Expected a disabled slow start to stay disabled")
+	}
+}
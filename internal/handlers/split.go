@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Number of buckets the sticky keys are hashed into
+const splitBuckets = 10000
+
+type splitTarget struct {
+	name    string
+	weight  uint
+	handler http.Handler
+}
+
+// Split send each request to one of the targets by weight, the target is chosen by a hash of the sticky key
+// so the same user keeps getting the same target (as long as the weights don't change)
+type Split struct {
+	mu             sync.RWMutex // Guards the weights
+	targets        []splitTarget
+	totalWeight    uint
+	sticky         config.Sticky
+	overrideHeader string
+	rollout        *progressiveRollout // nil when the weights are static
+}
+
+func NewSplit(ctx context.Context, service config.Service, path config.Path, instance Instance) (*Split, error) {
+	split := &Split{sticky: path.Split.Sticky, overrideHeader: path.Split.OverrideHeader}
+
+	for _, targetConfig := range path.Split.Targets {
+		// Each target is a destination or a backend of the same endpoint
+		targetPath := path
+		targetPath.Split = nil
+		targetPath.Destination = targetConfig.Destination
+		targetPath.Backend = targetConfig.Backend
+
+		var handler http.Handler
+		var err error
+		if targetConfig.Destination != nil {
+			handler, err = newProxy(BackendName(service, path, targetConfig.Name), targetPath, instance)
+		} else {
+			handler, err = newBalancer(ctx, BackendName(service, path, targetConfig.Name), *targetConfig.Backend, path, instance)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		split.targets = append(split.targets, splitTarget{name: targetConfig.Name, weight: targetConfig.Weight, handler: handler})
+		split.totalWeight += targetConfig.Weight
+	}
+
+	if path.Split.Progressive != nil {
+		endpoint := service.Domain + path.Path
+		split.rollout = newProgressiveRollout(split, endpoint, *path.Split.Progressive, instance.Rollouts.last(endpoint))
+		instance.Rollouts.use(ctx, split.rollout)
+		go split.rollout.run(ctx)
+	}
+
+	return split, nil
+}
+
+// SetWeights change the weights of the named targets
+func (s *Split) SetWeights(weights map[string]uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.totalWeight = 0
+	for i := range s.targets {
+		if weight, exists := weights[s.targets[i].name]; exists {
+			s.targets[i].weight = weight
+		}
+		s.totalWeight += s.targets[i].weight
+	}
+}
+
+func (s *Split) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := s.choose(r)
+
+	contextvalues.LogFieldsFromContext(r.Context()).Set("split_target", target.name)
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("gatego.split.target", target.name))
+
+	if s.rollout == nil || target.name != s.rollout.canary {
+		target.handler.ServeHTTP(w, r)
+		return
+	}
+
+	// Observe the canary responses to judge the rollout
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	target.handler.ServeHTTP(sw, r)
+	s.rollout.observe(sw.status, time.Since(start))
+}
+
+func (s *Split) choose(r *http.Request) *splitTarget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.overrideHeader != "" {
+		if name := r.Header.Get(s.overrideHeader); name != "" {
+			for i := range s.targets {
+				if s.targets[i].name == name {
+					return &s.targets[i]
+				}
+			}
+		}
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(s.stickyKey(r)))
+
+	// The bucket is scaled to the total weight, so raising the weight of a later target
+	// only moves users to it (users already assigned to it stay)
+	point := float64(hash.Sum64()%splitBuckets) / splitBuckets * float64(s.totalWeight)
+
+	var cumulativeWeight uint
+	for i := range s.targets {
+		cumulativeWeight += s.targets[i].weight
+		if point < float64(cumulativeWeight) {
+			return &s.targets[i]
+		}
+	}
+
+	// Reached only when all the weights are zero
+	return &s.targets[0]
+}
+
+// statusWriter capture the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	sw.status = statusCode
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap let http.ResponseController reach the original writer (flushing streamed responses)
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// stickyKey return the request property the target is assigned by (the client ip if missing)
+func (s *Split) stickyKey(r *http.Request) string {
+	return requestKey(s.sticky, r)
+}
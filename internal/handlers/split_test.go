@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/contextvalues"
+)
+
+func TestSplit(t *testing.T) {
+	v1 := newNamedServer(t, "v1")
+	v2 := newNamedServer(t, "v2")
+
+	newSplit := func(sticky config.Sticky, v1Weight uint, v2Weight uint) *Split {
+		split, err := NewSplit(context.Background(), config.Service{}, config.Path{Path: "/", Split: &config.Split{
+			Targets: []config.SplitTarget{
+				{Name: "v1", Weight: v1Weight, Destination: &v1},
+				{Name: "v2", Weight: v2Weight, Destination: &v2},
+			},
+			Sticky:         sticky,
+			OverrideHeader: "X-Split-Target",
+		}}, Instance{})
+		if err != nil {
+			t.Fatalf("Failed to create split: %v", err)
+		}
+		return split
+	}
+
+	t.Run("weights", func(t *testing.T) {
+		split := newSplit(config.Sticky{By: "ip"}, 90, 10)
+
+		counts := map[string]int{}
+		for i := 0; i < 2000; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+			counts[split.choose(req).name]++
+		}
+
+		if counts["v2"] < 100 || counts["v2"] > 300 {
+			t.Errorf("Expected about 10%% of the requests to go to v2, got %d of 2000", counts["v2"])
+		}
+	})
+
+	t.Run("sticky cookie", func(t *testing.T) {
+		split := newSplit(config.Sticky{By: "cookie", Name: "session"}, 50, 50)
+
+		for i := 0; i < 50; i++ {
+			first := serveSplit(t, split, fmt.Sprintf("user-%d", i), "", "10.0.0.1:1")
+			second := serveSplit(t, split, fmt.Sprintf("user-%d", i), "", "10.0.0.2:1")
+			if first != second {
+				t.Fatalf("user-%d was assigned to %s and then to %s", i, first, second)
+			}
+		}
+	})
+
+	t.Run("users stay on the canary when its weight grows", func(t *testing.T) {
+		before := newSplit(config.Sticky{By: "cookie", Name: "session"}, 90, 10)
+		after := newSplit(config.Sticky{By: "cookie", Name: "session"}, 50, 50)
+
+		for i := 0; i < 200; i++ {
+			session := fmt.Sprintf("user-%d", i)
+			if serveSplit(t, before, session, "", "10.0.0.1:1") == "v2" && serveSplit(t, after, session, "", "10.0.0.1:1") != "v2" {
+				t.Fatalf("%s moved from v2 to v1 when the v2 weight grew", session)
+			}
+		}
+	})
+
+	t.Run("override header", func(t *testing.T) {
+		split := newSplit(config.Sticky{By: "ip"}, 100, 0)
+
+		if got := serveSplit(t, split, "", "v2", "10.0.0.1:1"); got != "v2" {
+			t.Errorf("Expected the override header to select v2, got %s", got)
+		}
+
+		if got := serveSplit(t, split, "", "unknown", "10.0.0.1:1"); got != "v1" {
+			t.Errorf("Expected unknown override target to be ignored, got %s", got)
+		}
+	})
+
+	t.Run("target is added to the log fields", func(t *testing.T) {
+		split := newSplit(config.Sticky{By: "ip"}, 0, 100)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx, logFields := contextvalues.AddLogFieldsToContext(req.Context())
+		split.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+
+		if logFields.String() != "split_target=v2" {
+			t.Errorf("Expected split_target=v2 log field, got %q", logFields.String())
+		}
+	})
+}
+
+// Helper function to send a request through the split and return the responding target
+func serveSplit(t *testing.T, split *Split, session string, override string, remoteAddr string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "session", Value: session})
+	}
+	if override != "" {
+		req.Header.Set("X-Split-Target", override)
+	}
+
+	rr := httptest.NewRecorder()
+	split.ServeHTTP(rr, req)
+
+	body, _ := io.ReadAll(rr.Body)
+	return string(body)
+}
+
+// Helper function to start a server that responds with its name
+func newNamedServer(t *testing.T, name string) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
@@ -0,0 +1,194 @@
+// This package track the health of the backend servers from the results of their health checks,
+// the balancers skip the unhealthy servers and the admin api exposes the state
+
+package health
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Server is the health state of a backend server, a nil server is always healthy (not checked)
+type Server struct {
+	backend            string
+	url                string
+	healthyThreshold   int
+	unhealthyThreshold int
+
+	mu        sync.RWMutex
+	healthy   bool
+	successes int // Consecutive
+	failures  int // Consecutive
+	lastError string
+	lastCheck time.Time
+}
+
+// Report the result of a health check (err is nil on success)
+func (s *Server) Report(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastCheck = time.Now()
+
+	if err == nil {
+		s.successes++
+		s.failures = 0
+		s.lastError = ""
+
+		if !s.healthy && s.successes >= s.healthyThreshold {
+			s.healthy = true
+			log.Default().Printf("Backend <%s> server %s is healthy\n", s.backend, s.url)
+		}
+		return
+	}
+
+	s.failures++
+	s.successes = 0
+	s.lastError = err.Error()
+
+	if s.healthy && s.failures >= s.unhealthyThreshold {
+		s.healthy = false
+		log.Default().Printf("Backend <%s> server %s is unhealthy Error=%s\n", s.backend, s.url, s.lastError)
+	}
+}
+
+func (s *Server) Healthy() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.healthy
+}
+
+// Status is the health state of a server as exposed by the admin api
+type Status struct {
+	Backend              string    `json:"backend"`
+	URL                  string    `json:"url"`
+	Healthy              bool      `json:"healthy"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	LastError            string    `json:"last_error,omitempty"`
+	LastCheck            time.Time `json:"last_check"`
+}
+
+func (s *Server) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Status{
+		Backend:              s.backend,
+		URL:                  s.url,
+		Healthy:              s.healthy,
+		ConsecutiveSuccesses: s.successes,
+		ConsecutiveFailures:  s.failures,
+		LastError:            s.lastError,
+		LastCheck:            s.lastCheck,
+	}
+}
+
+func newServer(backend string, url string, healthyThreshold int, unhealthyThreshold int) *Server {
+	return &Server{
+		backend:            backend,
+		url:                url,
+		healthyThreshold:   max(healthyThreshold, 1),
+		unhealthyThreshold: max(unhealthyThreshold, 1),
+		healthy:            true,
+	}
+}
+
+type serverKey struct {
+	backend string
+	url     string
+}
+
+// Registry hold the health state of the checked servers by backend name and server url.
+// A nil registry keeps no state, every call creates a new server state
+type Registry struct {
+	mu      sync.RWMutex
+	servers []*Server // In registration order
+	index   map[serverKey]*Server
+}
+
+func NewRegistry() *Registry {
+	return &Registry{index: make(map[serverKey]*Server)}
+}
+
+// Register return the server health state, it is created (healthy) on the first call.
+// A registered server keeps its state and takes the thresholds of the call (changed by a reload)
+func (r *Registry) Register(backend string, url string, healthyThreshold int, unhealthyThreshold int) *Server {
+	if r == nil {
+		return newServer(backend, url, healthyThreshold, unhealthyThreshold)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := serverKey{backend: backend, url: url}
+	if server, exists := r.index[key]; exists {
+		server.mu.Lock()
+		server.healthyThreshold = max(healthyThreshold, 1)
+		server.unhealthyThreshold = max(unhealthyThreshold, 1)
+		server.mu.Unlock()
+
+		return server
+	}
+
+	server := newServer(backend, url, healthyThreshold, unhealthyThreshold)
+	r.servers = append(r.servers, server)
+	r.index[key] = server
+
+	return server
+}
+
+// Unregister drop the state of a server removed from its backend
+func (r *Registry) Unregister(backend string, url string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := serverKey{backend: backend, url: url}
+	if existing, exists := r.index[key]; exists {
+		delete(r.index, key)
+		r.servers = slices.DeleteFunc(r.servers, func(registered *Server) bool { return registered == existing })
+	}
+}
+
+// Prune drop the state of the servers of the backends that are not in backends (removed by a reload)
+func (r *Registry) Prune(backends []string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.servers = slices.DeleteFunc(r.servers, func(server *Server) bool {
+		if slices.Contains(backends, server.backend) {
+			return false
+		}
+
+		delete(r.index, serverKey{backend: server.backend, url: server.url})
+		return true
+	})
+}
+
+// Statuses return the state of all the registered servers
+func (r *Registry) Statuses() []Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(r.servers))
+	for _, server := range r.servers {
+		statuses = append(statuses, server.Status())
+	}
+
+	return statuses
+}
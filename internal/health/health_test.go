@@ -0,0 +1,92 @@
+package health
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestServerReport(t *testing.T) {
+	registry := NewRegistry()
+	server := registry.Register("example.com/api", "http://backend-1", 2, 2)
+
+	steps := []struct {
+		name    string
+		err     error
+		healthy bool
+	}{
+		{"Healthy before the first check", nil, true},
+		{"One failure is below the threshold", errors.New("refused"), true},
+		{"Second failure takes it out", errors.New("refused"), false},
+		{"One success is below the threshold", nil, false},
+		{"Second success puts it back", nil, true},
+	}
+
+	for i, step := range steps {
+		if i > 0 {
+			server.Report(step.err)
+		}
+
+		if server.Healthy() != step.healthy {
+			t.Errorf("%s: got healthy %v want %v", step.name, server.Healthy(), step.healthy)
+		}
+	}
+}
+
+func TestServerStatus(t *testing.T) {
+	registry := NewRegistry()
+	server := registry.Register("example.com/api", "http://backend-1", 1, 1)
+	server.Report(errors.New("connection refused"))
+
+	status := server.Status()
+	if status.Healthy || status.ConsecutiveFailures != 1 || status.LastError != "connection refused" || status.LastCheck.IsZero() {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	first := registry.Register("a", "http://backend-1", 1, 1)
+	if registry.Register("a", "http://backend-1", 2, 2) != first {
+		t.Error("Expected the same server to be returned for the same backend and url")
+	}
+
+	// The thresholds of the last registration apply (reloaded config)
+	first.Report(errors.New("refused"))
+	if !first.Healthy() {
+		t.Error("Expected the reloaded unhealthy threshold to apply")
+	}
+
+	if registry.Register("b", "http://backend-1", 1, 1) == first {
+		t.Error("Expected different backends to have different states")
+	}
+
+	if got := len(registry.Statuses()); got != 2 {
+		t.Errorf("Statuses got %d servers want 2", got)
+	}
+
+	var notChecked *Server
+	if !notChecked.Healthy() {
+		t.Error("Expected a server without health checks to be healthy")
+	}
+}
+
+func TestRegistryPrune(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("a", "http://backend-1", 1, 1)
+	registry.Register("b", "http://backend-1", 1, 1)
+	removed := registry.Register("b", "http://backend-2", 1, 1)
+	removed.Report(errors.New("refused"))
+
+	registry.Prune([]string{"a"})
+
+	statuses := registry.Statuses()
+	if len(statuses) != 1 || statuses[0].Backend != "a" {
+		t.Errorf("Expected only the servers of the kept backend, got %+v", statuses)
+	}
+
+	// A backend added back starts over
+	if !registry.Register("b", "http://backend-2", 1, 1).Healthy() {
+		t.Error("Expected the pruned server to be registered again as healthy")
+	}
+}
@@ -0,0 +1,339 @@
+// This package talk to the kubernetes api server (list and watch of resources), and translate the Ingresses and the
+// Gateway API HTTPRoutes of the cluster to gatego services
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/wait"
+)
+
+// Credentials of the pod service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// The api server ends a watch after this time, the watch is then resumed from the last resource version
+const watchTimeout = time.Minute * 5
+
+// Wait after a failed list or watch
+const watchRetry = time.Second * 5
+
+// Max size of a response that is not a watch stream
+const maxBodySize = 50 << 20
+
+// errGone is the expired resource version of a watch, the resource is listed again
+var errGone = errors.New("resource version expired")
+
+var errNotFound = errors.New("not found")
+
+// Client list and watch resources of the kubernetes api
+type Client struct {
+	server    string
+	tokenFile string
+	client    *http.Client
+	retry     time.Duration
+}
+
+// NewClient create a client of the cluster, the in-cluster api server and service account are used when no api server is set
+func NewClient(cluster config.Kubernetes) (*Client, error) {
+	server, tokenFile, caFile := cluster.APIServer, cluster.TokenFile, cluster.CAFile
+
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes api_server is required outside of a cluster")
+		}
+
+		server = "https://" + net.JoinHostPort(host, port)
+		if tokenFile == "" {
+			tokenFile = serviceAccountDir + "/token"
+		}
+		if caFile == "" {
+			caFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes ca_file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("kubernetes ca_file has no certificates")
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &Client{
+		server:    strings.TrimSuffix(server, "/"),
+		tokenFile: tokenFile,
+		client:    &http.Client{Transport: transport},
+		retry:     watchRetry,
+	}, nil
+}
+
+type objectMeta struct {
+	Name            string
+	Namespace       string
+	ResourceVersion string
+	Annotations     map[string]string
+}
+
+type object struct {
+	Metadata objectMeta
+}
+
+type list struct {
+	Metadata struct {
+		ResourceVersion string
+	}
+	Items []json.RawMessage
+}
+
+type watchEvent struct {
+	Type   string // ADDED, MODIFIED, DELETED, BOOKMARK or ERROR
+	Object json.RawMessage
+}
+
+type status struct {
+	Code    int
+	Message string
+}
+
+func (c *Client) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes token_file: %w", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxBodySize))
+
+		switch response.StatusCode {
+		case http.StatusGone:
+			return nil, errGone
+		case http.StatusNotFound:
+			return nil, fmt.Errorf("kubernetes %s: %w", path, errNotFound)
+		}
+
+		return nil, fmt.Errorf("kubernetes %s: status %d %s", path, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return response, nil
+}
+
+// Get decode the resource of the path into v, false when the resource doesn't exist
+func (c *Client) Get(ctx context.Context, path string, v any) (bool, error) {
+	response, err := c.do(ctx, path, url.Values{})
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxBodySize)).Decode(v); err != nil {
+		return false, fmt.Errorf("invalid kubernetes response: %w", err)
+	}
+
+	return true, nil
+}
+
+// Watch pass the resources of the collection path (e.g. /apis/networking.k8s.io/v1/ingresses) to update before it returns,
+// then keep watching the collection (until ctx is done) and pass the resources again on every change. The resources are
+// sorted by namespace and name, a failed watch keeps the last resources. Only the first list error is returned
+func (c *Client) Watch(ctx context.Context, path string, query url.Values, update func([]json.RawMessage)) error {
+	return c.WatchListed(ctx, path, query, nil, update)
+}
+
+// WatchListed is Watch calling listed before the resources of every list are passed to update (the first list and the lists
+// after an expired watch), so state derived from other resources is loaded again. A failed listed keeps the last resources
+func (c *Client) WatchListed(ctx context.Context, path string, query url.Values, listed func(context.Context) error, update func([]json.RawMessage)) error {
+	objects, resourceVersion, err := c.list(ctx, path, query)
+	if err == nil && listed != nil {
+		err = listed(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	update(sortedObjects(objects))
+
+	go func() {
+		for ctx.Err() == nil {
+			if resourceVersion == "" {
+				objects, resourceVersion, err = c.list(ctx, path, query)
+				if err == nil && listed != nil {
+					err = listed(ctx)
+				}
+				if err != nil {
+					resourceVersion = ""
+					if ctx.Err() == nil {
+						log.Default().Printf("Kubernetes list %s failed, keeping the last resources: %s\n", path, err.Error())
+						wait.Sleep(ctx, c.retry)
+					}
+					continue
+				}
+				update(sortedObjects(objects))
+			}
+
+			resourceVersion, err = c.watch(ctx, path, query, resourceVersion, objects, update)
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+
+			// Listed again from the current state
+			if errors.Is(err, errGone) {
+				resourceVersion = ""
+				continue
+			}
+
+			log.Default().Printf("Kubernetes watch %s failed, keeping the last resources: %s\n", path, err.Error())
+			wait.Sleep(ctx, c.retry)
+		}
+	}()
+
+	return nil
+}
+
+// list return the resources of the collection by namespace/name and the resource version of the list
+func (c *Client) list(ctx context.Context, path string, query url.Values) (map[string]json.RawMessage, string, error) {
+	response, err := c.do(ctx, path, query)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	var l list
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxBodySize)).Decode(&l); err != nil {
+		return nil, "", fmt.Errorf("invalid kubernetes list: %w", err)
+	}
+
+	objects := make(map[string]json.RawMessage, len(l.Items))
+	for _, item := range l.Items {
+		key, _, err := objectKey(item)
+		if err != nil {
+			return nil, "", err
+		}
+		objects[key] = item
+	}
+
+	return objects, l.Metadata.ResourceVersion, nil
+}
+
+// watch apply the events of a single watch request to objects and pass the resources to update after every change,
+// it returns the resource version to resume from when the api server ends the watch
+func (c *Client) watch(ctx context.Context, path string, query url.Values, resourceVersion string, objects map[string]json.RawMessage, update func([]json.RawMessage)) (string, error) {
+	watchQuery := maps.Clone(query)
+	if watchQuery == nil {
+		watchQuery = url.Values{}
+	}
+	watchQuery.Set("watch", "true")
+	watchQuery.Set("resourceVersion", resourceVersion)
+	watchQuery.Set("allowWatchBookmarks", "true")
+	watchQuery.Set("timeoutSeconds", strconv.Itoa(int(watchTimeout.Seconds())))
+
+	response, err := c.do(ctx, path, watchQuery)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var event watchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+
+		if event.Type == "ERROR" {
+			var s status
+			json.Unmarshal(event.Object, &s)
+			if s.Code == http.StatusGone {
+				return "", errGone
+			}
+			return resourceVersion, fmt.Errorf("watch error %d %s", s.Code, s.Message)
+		}
+
+		key, version, err := objectKey(event.Object)
+		if err != nil {
+			return resourceVersion, err
+		}
+		resourceVersion = version
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			objects[key] = event.Object
+		case "DELETED":
+			delete(objects, key)
+		default:
+			continue
+		}
+
+		update(sortedObjects(objects))
+	}
+}
+
+// objectKey return the namespace/name and the resource version of a resource
+func objectKey(raw json.RawMessage) (string, string, error) {
+	var o object
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return "", "", fmt.Errorf("invalid kubernetes resource: %w", err)
+	}
+
+	return o.Metadata.Namespace + "/" + o.Metadata.Name, o.Metadata.ResourceVersion, nil
+}
+
+func sortedObjects(objects map[string]json.RawMessage) []json.RawMessage {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	sorted := make([]json.RawMessage, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, objects[key])
+	}
+
+	return sorted
+}
@@ -0,0 +1,157 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/kubernetes/kubernetestest"
+)
+
+const ingresses = "/apis/networking.k8s.io/v1/namespaces/default/ingresses"
+
+func TestClientWatch(t *testing.T) {
+	server := kubernetestest.NewServer(t, "secret")
+	server.Apply(ingresses, resource("default", "web", nil))
+	server.Apply(ingresses, resource("default", "api", nil))
+
+	client := newTestClient(t, server)
+
+	updates := make(chan []string, 10)
+	err := client.Watch(testContext(t), ingresses, nil, func(objects []json.RawMessage) {
+		updates <- names(t, objects)
+	})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	expectNames(t, updates, "api", "web")
+
+	server.Apply(ingresses, resource("default", "shop", nil))
+	expectNames(t, updates, "api", "shop", "web")
+
+	server.Delete(ingresses, "api")
+	expectNames(t, updates, "shop", "web")
+
+	// An expired watch lists the resources again
+	server.Expire()
+	expectNames(t, updates, "shop", "web")
+
+	server.Apply(ingresses, resource("default", "blog", nil))
+	expectNames(t, updates, "blog", "shop", "web")
+}
+
+func TestClientGet(t *testing.T) {
+	server := kubernetestest.NewServer(t, "")
+	server.Apply("/api/v1/namespaces/default/services", resource("default", "api", nil))
+
+	client := newTestClient(t, server)
+
+	var o object
+	found, err := client.Get(testContext(t), "/api/v1/namespaces/default/services/api", &o)
+	if err != nil || !found || o.Metadata.Name != "api" {
+		t.Errorf("Expected the service, got found %v err %v name %q", found, err, o.Metadata.Name)
+	}
+
+	found, err = client.Get(testContext(t), "/api/v1/namespaces/default/services/missing", &o)
+	if err != nil || found {
+		t.Errorf("Expected a missing service, got found %v err %v", found, err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+
+	if _, err := NewClient(config.Kubernetes{}); err == nil {
+		t.Error("Expected an error without an api server outside of a cluster")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatalf("Failed to write ca file: %v", err)
+	}
+
+	if _, err := NewClient(config.Kubernetes{APIServer: "https://10.0.0.1:6443", CAFile: caFile}); err == nil {
+		t.Error("Expected an error for a ca file without certificates")
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	// The service account is missing outside of a pod
+	if _, err := NewClient(config.Kubernetes{}); err == nil {
+		t.Error("Expected an error for the missing in-cluster ca")
+	}
+}
+
+// Helper function to create a client of the fake api server with the token in a token file
+func newTestClient(t *testing.T, server *kubernetestest.Server) *Client {
+	t.Helper()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(server.Token+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	client, err := NewClient(config.Kubernetes{APIServer: server.URL, TokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	client.retry = 10 * time.Millisecond
+
+	return client
+}
+
+// Helper function to create a resource with metadata
+func resource(namespace string, name string, annotations map[string]any) map[string]any {
+	metadata := map[string]any{"namespace": namespace, "name": name}
+	if annotations != nil {
+		metadata["annotations"] = annotations
+	}
+
+	return map[string]any{"metadata": metadata}
+}
+
+// Helper function to create a context canceled at the end of the test
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func names(t *testing.T, objects []json.RawMessage) []string {
+	names := []string{}
+	for _, raw := range objects {
+		var o object
+		if err := json.Unmarshal(raw, &o); err != nil {
+			t.Errorf("Invalid resource: %v", err)
+		}
+		names = append(names, o.Metadata.Name)
+	}
+
+	return names
+}
+
+// Helper function to wait for an update with the names
+func expectNames(t *testing.T, updates chan []string, expected ...string) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case got := <-updates:
+			if slices.Equal(got, expected) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Expected an update with %v", expected)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// This package is a fake kubernetes api server for the tests of the kubernetes integrations (list, watch and get of resources)
+
+package kubernetestest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server keep resources by collection path (e.g. /apis/networking.k8s.io/v1/namespaces/default/ingresses) and serve lists,
+// watches and gets of them. The requests must carry the token
+type Server struct {
+	URL   string
+	Token string
+
+	mu        sync.Mutex
+	version   int
+	changed   chan struct{}                        // Closed on every change
+	resources map[string]map[string]map[string]any // Collection to name to resource
+	events    map[string][]event                   // Collection to its changes
+	expired   int                                  // Watches from older versions are gone
+	watches   int
+}
+
+type event struct {
+	version int
+	Type    string         `json:"type"`
+	Object  map[string]any `json:"object"`
+}
+
+// NewServer start a fake api server, it is closed at the end of the test
+func NewServer(t *testing.T, token string) *Server {
+	t.Helper()
+
+	s := &Server{Token: token, changed: make(chan struct{}), resources: map[string]map[string]map[string]any{}, events: map[string][]event{}}
+	server := httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(server.Close)
+
+	s.URL = server.URL
+	return s
+}
+
+// Apply add or replace the resource in the collection, the metadata name is the key
+func (s *Server) Apply(collection string, resource map[string]any) {
+	s.change(collection, "MODIFIED", resource)
+}
+
+// Delete remove the resource of the name from the collection
+func (s *Server) Delete(collection string, name string) {
+	s.mu.Lock()
+	resource := s.resources[collection][name]
+	s.mu.Unlock()
+
+	if resource != nil {
+		s.change(collection, "DELETED", resource)
+	}
+}
+
+// Expire make the watches from the current versions fail as gone, the clients must list again
+func (s *Server) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version++
+	s.expired = s.version
+	s.signal()
+}
+
+// Watches return the number of watch requests served
+func (s *Server) Watches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.watches
+}
+
+func (s *Server) change(collection string, eventType string, resource map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copied, the served resources are encoded without the lock
+	s.version++
+	resource = maps.Clone(resource)
+	metadata, _ := resource["metadata"].(map[string]any)
+	metadata = maps.Clone(metadata)
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	metadata["resourceVersion"] = strconv.Itoa(s.version)
+	resource["metadata"] = metadata
+	name, _ := metadata["name"].(string)
+
+	if s.resources[collection] == nil {
+		s.resources[collection] = map[string]map[string]any{}
+	}
+
+	if eventType == "DELETED" {
+		delete(s.resources[collection], name)
+	} else {
+		if _, exists := s.resources[collection][name]; !exists {
+			eventType = "ADDED"
+		}
+		s.resources[collection][name] = resource
+	}
+
+	s.events[collection] = append(s.events[collection], event{version: s.version, Type: eventType, Object: resource})
+	s.signal()
+}
+
+func (s *Server) signal() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	query := r.URL.Query()
+
+	if query.Get("watch") == "true" {
+		s.watch(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if collection, exists := s.resources[r.URL.Path]; exists || !s.isResource(r.URL.Path) {
+		items := []map[string]any{}
+		for _, name := range sortedNames(collection) {
+			if matchLabels(collection[name], query.Get("labelSelector")) {
+				items = append(items, collection[name])
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"metadata": map[string]any{"resourceVersion": strconv.Itoa(s.version)},
+			"items":    items,
+		})
+		return
+	}
+
+	resource := s.resources[path.Dir(r.URL.Path)][path.Base(r.URL.Path)]
+	if resource == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"kind": "Status", "code": 404}`)
+		return
+	}
+
+	json.NewEncoder(w).Encode(resource)
+}
+
+// isResource report if the path is a resource of a collection (a get) rather than an empty collection (a list)
+func (s *Server) isResource(resourcePath string) bool {
+	_, exists := s.resources[path.Dir(resourcePath)]
+	return exists
+}
+
+// watch stream the events after the resource version until the timeout of the request, the client or the server ends
+func (s *Server) watch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	version, _ := strconv.Atoi(query.Get("resourceVersion"))
+	timeoutSeconds, _ := strconv.Atoi(query.Get("timeoutSeconds"))
+	timeout := time.After(time.Duration(timeoutSeconds) * time.Second)
+
+	s.mu.Lock()
+	s.watches++
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+
+	for {
+		s.mu.Lock()
+		if version < s.expired {
+			s.mu.Unlock()
+			encoder.Encode(map[string]any{"type": "ERROR", "object": map[string]any{"kind": "Status", "code": http.StatusGone, "message": "too old resource version"}})
+			return
+		}
+
+		pending := []event{}
+		for _, e := range s.events[r.URL.Path] {
+			if e.version > version && matchLabels(e.Object, query.Get("labelSelector")) {
+				pending = append(pending, e)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, e := range pending {
+			encoder.Encode(e)
+			version = e.version
+		}
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// matchLabels report if the resource has the labels of an equality selector (name=value,...)
+func matchLabels(resource map[string]any, selector string) bool {
+	metadata, _ := resource["metadata"].(map[string]any)
+	labels, _ := metadata["labels"].(map[string]any)
+
+	for _, requirement := range strings.Split(selector, ",") {
+		name, value, found := strings.Cut(requirement, "=")
+		if found && labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedNames(collection map[string]map[string]any) []string {
+	names := make([]string, 0, len(collection))
+	for name := range collection {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,521 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+)
+
+// Annotations of the Ingresses and HTTPRoutes setting the gatego features of their paths
+const (
+	annotationRateLimits    = "gatego.io/ratelimits"     // Comma separated rate limits (ip-10/m)
+	annotationOpenAPI       = "gatego.io/openapi"        // Path or url of the openapi spec of the requests
+	annotationCache         = "gatego.io/cache"          // true to cache the responses with cache headers
+	annotationMinify        = "gatego.io/minify"         // Comma separated content types (all, html, css, js, ...)
+	annotationGzip          = "gatego.io/gzip"           // true to compress the responses
+	annotationTimeout       = "gatego.io/timeout"        // Duration (30s)
+	annotationBalancePolicy = "gatego.io/balance-policy" // Defaults to round-robin
+)
+
+// Ingress class of the Ingresses without spec.ingressClassName
+const annotationIngressClass = "kubernetes.io/ingress.class"
+
+type ingress struct {
+	Metadata objectMeta
+	Spec     struct {
+		IngressClassName *string
+		Rules            []struct {
+			Host string
+			HTTP *struct {
+				Paths []struct {
+					Path     string
+					PathType string
+					Backend  ingressBackend
+				}
+			}
+		}
+	}
+}
+
+type ingressBackend struct {
+	Service *struct {
+		Name string
+		Port struct {
+			Name   string
+			Number int
+		}
+	}
+}
+
+type httpRoute struct {
+	Metadata objectMeta
+	Spec     struct {
+		ParentRefs []struct {
+			Kind      *string
+			Namespace *string
+			Name      string
+		}
+		Hostnames []string
+		Rules     []struct {
+			Matches     []httpRouteRuleMatch
+			BackendRefs []httpRouteBackendRef
+		}
+	}
+}
+
+type httpRouteRuleMatch struct {
+	Path *struct {
+		Type  *string // PathPrefix (default), Exact or RegularExpression
+		Value *string
+	}
+	Headers     []httpRouteMatch
+	QueryParams []httpRouteMatch
+	Method      *string
+}
+
+type httpRouteBackendRef struct {
+	Kind      *string
+	Namespace *string
+	Name      string
+	Port      *int
+	Weight    *int
+}
+
+type httpRouteMatch struct {
+	Type  *string // Exact (default) or RegularExpression
+	Name  string
+	Value string
+}
+
+// WatchRoutes pass the services of the Ingresses and HTTPRoutes of the cluster to update before it returns, then keep watching
+// them (until ctx is done) and pass the services again when they change. The backends of the paths take their servers from
+// the endpoints of the kubernetes services (kubernetes service discovery)
+func WatchRoutes(ctx context.Context, client *Client, cluster config.Kubernetes, update func([]config.Service)) error {
+	var mu sync.Mutex
+	var ingresses, httpRoutes []json.RawMessage
+	var last []config.Service
+	loaded := false
+
+	// Called by the watches after every change of the resources
+	changed := func(set func()) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		set()
+		if !loaded {
+			return
+		}
+
+		services := buildServices(cluster, ingresses, httpRoutes)
+		if reflect.DeepEqual(services, last) {
+			return
+		}
+
+		last = services
+		update(services)
+	}
+
+	namespace := ""
+	if cluster.Namespace != "" {
+		namespace = "/namespaces/" + url.PathEscape(cluster.Namespace)
+	}
+
+	if cluster.Ingress {
+		err := client.Watch(ctx, "/apis/networking.k8s.io/v1"+namespace+"/ingresses", nil, func(objects []json.RawMessage) {
+			changed(func() { ingresses = objects })
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cluster.HTTPRoutes {
+		err := client.Watch(ctx, "/apis/gateway.networking.k8s.io/v1"+namespace+"/httproutes", nil, func(objects []json.RawMessage) {
+			changed(func() { httpRoutes = objects })
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The first services, last is nil so they are always passed
+	changed(func() { loaded = true })
+
+	return nil
+}
+
+// servicesBuilder collect the paths of the routes by host
+type servicesBuilder struct {
+	services []*config.Service
+	hosts    map[string]*config.Service
+	routes   map[string]string // host, path pattern and match to the resource that added the path
+	openAPI  bool              // The openapi annotation is allowed
+}
+
+func buildServices(cluster config.Kubernetes, ingresses []json.RawMessage, httpRoutes []json.RawMessage) []config.Service {
+	b := &servicesBuilder{hosts: map[string]*config.Service{}, routes: map[string]string{}, openAPI: cluster.OpenAPIAnnotation}
+
+	for _, raw := range ingresses {
+		var i ingress
+		if err := json.Unmarshal(raw, &i); err != nil {
+			log.Default().Printf("Kubernetes invalid ingress skipped: %s\n", err.Error())
+			continue
+		}
+
+		b.addIngress(i, cluster.IngressClass)
+	}
+
+	for _, raw := range httpRoutes {
+		var r httpRoute
+		if err := json.Unmarshal(raw, &r); err != nil {
+			log.Default().Printf("Kubernetes invalid httproute skipped: %s\n", err.Error())
+			continue
+		}
+
+		b.addHTTPRoute(r, cluster.Gateway)
+	}
+
+	services := make([]config.Service, 0, len(b.services))
+	for _, service := range b.services {
+		services = append(services, *service)
+	}
+
+	return services
+}
+
+func (b *servicesBuilder) addIngress(i ingress, ingressClass string) {
+	class := i.Metadata.Annotations[annotationIngressClass]
+	if i.Spec.IngressClassName != nil {
+		class = *i.Spec.IngressClassName
+	}
+
+	if class != ingressClass {
+		return
+	}
+
+	source := "ingress " + i.Metadata.Namespace + "/" + i.Metadata.Name
+	features, err := annotatedPath(i.Metadata.Annotations, b.openAPI)
+	if err != nil {
+		log.Default().Printf("Kubernetes %s skipped: %s\n", source, err.Error())
+		return
+	}
+
+	for _, rule := range i.Spec.Rules {
+		// The rules without a host would need a default service
+		if rule.Host == "" || rule.HTTP == nil {
+			continue
+		}
+
+		for _, ingressPath := range rule.HTTP.Paths {
+			if ingressPath.Backend.Service == nil {
+				log.Default().Printf("Kubernetes %s path %s skipped: only service backends are supported\n", source, ingressPath.Path)
+				continue
+			}
+
+			port := ingressPath.Backend.Service.Port.Name
+			if port == "" && ingressPath.Backend.Service.Port.Number != 0 {
+				port = strconv.Itoa(ingressPath.Backend.Service.Port.Number)
+			}
+
+			// The patterns of a prefix path share the backend (and its discovery watch)
+			backend := newBackend(i.Metadata.Namespace, ingressPath.Backend.Service.Name, port, i.Metadata.Annotations)
+			for _, pattern := range pathPatterns(ingressPath.Path, ingressPath.PathType == "Exact") {
+				path := features
+				path.Path = pattern
+				path.Backend = backend
+				b.add(source, rule.Host, path)
+			}
+		}
+	}
+}
+
+func (b *servicesBuilder) addHTTPRoute(r httpRoute, gateway string) {
+	if !attached(r, gateway) {
+		return
+	}
+
+	source := "httproute " + r.Metadata.Namespace + "/" + r.Metadata.Name
+
+	// The routes without hostnames would need a default service (like the ingress rules without a host)
+	if len(r.Spec.Hostnames) == 0 {
+		log.Default().Printf("Kubernetes %s skipped: routes without hostnames are not supported\n", source)
+		return
+	}
+
+	features, err := annotatedPath(r.Metadata.Annotations, b.openAPI)
+	if err != nil {
+		log.Default().Printf("Kubernetes %s skipped: %s\n", source, err.Error())
+		return
+	}
+
+	for _, rule := range r.Spec.Rules {
+		path := features
+
+		targets := []config.SplitTarget{}
+		for _, ref := range rule.BackendRefs {
+			if (ref.Kind != nil && *ref.Kind != "Service") || (ref.Namespace != nil && *ref.Namespace != r.Metadata.Namespace) {
+				log.Default().Printf("Kubernetes %s backend %s skipped: only services of the route namespace are supported\n", source, ref.Name)
+				continue
+			}
+
+			weight := 1
+			if ref.Weight != nil {
+				weight = *ref.Weight
+			}
+
+			if weight <= 0 {
+				continue
+			}
+
+			port := ""
+			if ref.Port != nil {
+				port = strconv.Itoa(*ref.Port)
+			}
+
+			name := ref.Name
+			for i := 2; containsTarget(targets, name); i++ {
+				name = fmt.Sprintf("%s-%d", ref.Name, i)
+			}
+
+			targets = append(targets, config.SplitTarget{Name: name, Weight: uint(weight), Backend: newBackend(r.Metadata.Namespace, ref.Name, port, r.Metadata.Annotations)})
+		}
+
+		switch len(targets) {
+		case 0:
+			continue
+		case 1:
+			path.Backend = targets[0].Backend
+		default:
+			path.Split = &config.Split{Targets: targets}
+		}
+
+		// A rule without matches matches all the requests
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []httpRouteRuleMatch{{}}
+		}
+
+		for _, match := range matches {
+			value, exact := "/", false
+			if match.Path != nil {
+				if match.Path.Value != nil {
+					value = *match.Path.Value
+				}
+
+				if match.Path.Type != nil {
+					switch *match.Path.Type {
+					case "Exact":
+						exact = true
+					case "RegularExpression":
+						log.Default().Printf("Kubernetes %s path %s skipped: regular expression paths are not supported\n", source, value)
+						continue
+					}
+				}
+			}
+
+			matchPath := path
+			matchPath.Match = newMatch(match.Headers, match.QueryParams, match.Method)
+
+			for _, hostname := range r.Spec.Hostnames {
+				for _, pattern := range pathPatterns(value, exact) {
+					matchPath.Path = pattern
+					b.add(source, hostname, matchPath)
+				}
+			}
+		}
+	}
+}
+
+// add the path to the service of the host, the first resource adding a route keeps it
+func (b *servicesBuilder) add(source string, host string, path config.Path) {
+	host = strings.ToLower(host)
+
+	match, _ := json.Marshal(path.Match)
+	route := host + " " + path.Path + " " + string(match)
+	if previous, exists := b.routes[route]; exists {
+		if previous != source {
+			log.Default().Printf("Kubernetes %s path %s of %s skipped: already routed by %s\n", source, path.Path, host, previous)
+		}
+		return
+	}
+
+	// Checked alone so an invalid path doesn't take down the other paths of the host
+	if err := (config.Service{Domain: host, Paths: []config.Path{path}}).Validate(); err != nil {
+		log.Default().Printf("Kubernetes %s path %s of %s skipped: %s\n", source, path.Path, host, err.Error())
+		return
+	}
+
+	b.routes[route] = source
+
+	service, exists := b.hosts[host]
+	if !exists {
+		service = &config.Service{Domain: host}
+		b.hosts[host] = service
+		b.services = append(b.services, service)
+	}
+
+	service.Paths = append(service.Paths, path)
+}
+
+// pathPatterns return the gatego patterns of a kubernetes path. A prefix matches the path and the paths under it (/api and /api/...)
+// but not /apis, the patterns of gatego match exactly unless they end with a slash
+func pathPatterns(path string, exact bool) []string {
+	if path == "" {
+		path = "/"
+	}
+
+	if exact {
+		if strings.HasSuffix(path, "/") {
+			return []string{path + "{$}"}
+		}
+		return []string{path}
+	}
+
+	if path == "/" {
+		return []string{path}
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	return []string{path, path + "/"}
+}
+
+// attached report if the route is attached to the gateway (name or namespace/name), to any gateway when empty
+func attached(r httpRoute, gateway string) bool {
+	for _, parent := range r.Spec.ParentRefs {
+		if parent.Kind != nil && *parent.Kind != "Gateway" {
+			continue
+		}
+
+		if gateway == "" {
+			return true
+		}
+
+		namespace := r.Metadata.Namespace
+		if parent.Namespace != nil {
+			namespace = *parent.Namespace
+		}
+
+		if parent.Name == gateway || namespace+"/"+parent.Name == gateway {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newBackend(namespace string, service string, port string, annotations map[string]string) *config.Backend {
+	policy := annotations[annotationBalancePolicy]
+	if policy == "" {
+		policy = "round-robin"
+	}
+
+	return &config.Backend{
+		BalancePolicy: policy,
+		Kubernetes:    &config.KubernetesDiscovery{Namespace: namespace, Service: service, Port: port},
+	}
+}
+
+func newMatch(headers []httpRouteMatch, queryParams []httpRouteMatch, method *string) *config.Match {
+	if len(headers) == 0 && len(queryParams) == 0 && method == nil {
+		return nil
+	}
+
+	match := &config.Match{Headers: matchRules(headers), Query: matchRules(queryParams)}
+	if method != nil {
+		match.Methods = []string{*method}
+	}
+
+	return match
+}
+
+func matchRules(matches []httpRouteMatch) []config.MatchRule {
+	rules := make([]config.MatchRule, 0, len(matches))
+	for _, m := range matches {
+		value := m.Value
+		rule := config.MatchRule{Name: m.Name, Exact: &value}
+		if m.Type != nil && *m.Type == "RegularExpression" {
+			rule = config.MatchRule{Name: m.Name, Regex: &value}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+func containsTarget(targets []config.SplitTarget, name string) bool {
+	for _, target := range targets {
+		if target.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// annotatedPath return a path with the gatego features of the annotations of a resource, the base of the paths of the resource.
+// The openapi annotation is rejected unless allowOpenAPI
+func annotatedPath(annotations map[string]string, allowOpenAPI bool) (config.Path, error) {
+	path := config.Path{}
+
+	if value, ok := annotations[annotationRateLimits]; ok {
+		path.RateLimits = splitList(value)
+	}
+
+	if value, ok := annotations[annotationOpenAPI]; ok {
+		if !allowOpenAPI {
+			return config.Path{}, fmt.Errorf("the %s annotation is disabled (kubernetes openapi_annotation)", annotationOpenAPI)
+		}
+		path.OpenAPI = &value
+	}
+
+	if value, ok := annotations[annotationCache]; ok {
+		cache, err := strconv.ParseBool(value)
+		if err != nil {
+			return config.Path{}, fmt.Errorf("invalid %s annotation '%s'", annotationCache, value)
+		}
+		path.Cache = cache
+	}
+
+	if value, ok := annotations[annotationMinify]; ok {
+		path.Minify = splitList(value)
+	}
+
+	if value, ok := annotations[annotationGzip]; ok {
+		gzip, err := strconv.ParseBool(value)
+		if err != nil {
+			return config.Path{}, fmt.Errorf("invalid %s annotation '%s'", annotationGzip, value)
+		}
+		path.Gzip = &gzip
+	}
+
+	if value, ok := annotations[annotationTimeout]; ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config.Path{}, fmt.Errorf("invalid %s annotation '%s'", annotationTimeout, value)
+		}
+		path.Timeout = timeout
+	}
+
+	return path, nil
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
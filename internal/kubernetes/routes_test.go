@@ -0,0 +1,247 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/kubernetes/kubernetestest"
+)
+
+func TestBuildServicesFromIngresses(t *testing.T) {
+	cluster := config.Kubernetes{Ingress: true, IngressClass: "gatego", OpenAPIAnnotation: true}
+
+	openapi := filepath.Join(t.TempDir(), "api.yaml")
+	if err := os.WriteFile(openapi, []byte("openapi: 3.0.0"), 0o644); err != nil {
+		t.Fatalf("Failed to write openapi spec: %v", err)
+	}
+
+	api := ingressResource("shop", "api", "gatego", map[string]any{
+		"gatego.io/ratelimits": "ip-10/s, ip-100/m",
+		"gatego.io/cache":      "true",
+		"gatego.io/minify":     "html,css",
+		"gatego.io/openapi":    openapi,
+		"gatego.io/timeout":    "30s",
+	}, ingressRule("Shop.Example.com", ingressPath("/api/", "Prefix", "api", 8080, "")))
+
+	// Routes of the same host are merged, the first ingress keeps a route
+	web := ingressResource("shop", "web", "gatego", nil,
+		ingressRule("shop.example.com", ingressPath("/", "Prefix", "web", 0, "http"), ingressPath("/api", "Prefix", "other", 80, "")),
+		ingressRule("", ingressPath("/", "Prefix", "web", 0, "http")),
+	)
+
+	exact := ingressResource("shop", "health", "gatego", nil, ingressRule("status.example.com", ingressPath("/health/", "Exact", "status", 80, "")))
+	otherClass := ingressResource("shop", "nginx", "nginx", nil, ingressRule("nginx.example.com", ingressPath("/", "Prefix", "web", 80, "")))
+	invalidAnnotation := ingressResource("shop", "invalid", "gatego", map[string]any{"gatego.io/timeout": "soon"}, ingressRule("invalid.example.com", ingressPath("/", "Prefix", "web", 80, "")))
+
+	services := buildServices(cluster, rawResources(t, api, web, exact, otherClass, invalidAnnotation), nil)
+
+	if domains := serviceDomains(services); !slices.Equal(domains, []string{"shop.example.com", "status.example.com"}) {
+		t.Fatalf("Expected the services of the gatego ingresses, got %v", domains)
+	}
+
+	shop := services[0]
+	if paths := servicePaths(shop); !slices.Equal(paths, []string{"/api", "/api/", "/"}) {
+		t.Fatalf("Expected the prefix paths, got %v", paths)
+	}
+
+	apiPath := shop.Paths[0]
+	if apiPath.Backend == nil || *apiPath.Backend.Kubernetes != (config.KubernetesDiscovery{Namespace: "shop", Service: "api", Port: "8080"}) {
+		t.Errorf("Expected a backend of the api service, got %+v", apiPath.Backend)
+	}
+
+	if !slices.Equal(apiPath.RateLimits, []string{"ip-10/s", "ip-100/m"}) || !apiPath.Cache || !slices.Equal(apiPath.Minify, []string{"html", "css"}) {
+		t.Errorf("Expected the features of the annotations, got %+v", apiPath)
+	}
+
+	if apiPath.OpenAPI == nil || *apiPath.OpenAPI != openapi || apiPath.Timeout != 30*time.Second {
+		t.Errorf("Expected the openapi and timeout of the annotations, got %+v", apiPath)
+	}
+
+	if webPath := shop.Paths[2]; webPath.Backend.Kubernetes.Port != "http" || webPath.Cache {
+		t.Errorf("Expected the named port without the annotations of the api ingress, got %+v", webPath)
+	}
+
+	if paths := servicePaths(services[1]); !slices.Equal(paths, []string{"/health/{$}"}) {
+		t.Errorf("Expected the exact path, got %v", paths)
+	}
+
+	// The openapi annotation is allowed by the cluster config only
+	cluster.OpenAPIAnnotation = false
+	if services := buildServices(cluster, rawResources(t, api), nil); len(services) != 0 {
+		t.Errorf("Expected the ingress with the openapi annotation skipped, got %v", serviceDomains(services))
+	}
+}
+
+func TestBuildServicesFromHTTPRoutes(t *testing.T) {
+	cluster := config.Kubernetes{HTTPRoutes: true, Gateway: "infra/public"}
+
+	checkout := httpRouteResource("shop", "checkout", "infra", "public", []string{"shop.example.com"}, []any{
+		map[string]any{
+			"matches": []any{
+				map[string]any{
+					"path":    map[string]any{"type": "PathPrefix", "value": "/checkout"},
+					"headers": []any{map[string]any{"name": "X-Canary", "value": "true"}},
+					"method":  "POST",
+				},
+			},
+			"backendRefs": []any{
+				map[string]any{"name": "checkout-v1", "port": 8080, "weight": 90},
+				map[string]any{"name": "checkout-v2", "port": 8080, "weight": 10},
+				map[string]any{"name": "checkout-v3", "port": 8080, "weight": 0},
+			},
+		},
+		map[string]any{
+			"backendRefs": []any{map[string]any{"name": "web", "port": 80}},
+		},
+	})
+
+	otherGateway := httpRouteResource("shop", "internal", "infra", "private", []string{"internal.example.com"}, []any{
+		map[string]any{"backendRefs": []any{map[string]any{"name": "web", "port": 80}}},
+	})
+
+	// Skipped, a route without hostnames would need a default service
+	noHostnames := httpRouteResource("shop", "catch-all", "infra", "public", nil, []any{
+		map[string]any{"backendRefs": []any{map[string]any{"name": "web", "port": 80}}},
+	})
+
+	services := buildServices(cluster, nil, rawResources(t, checkout, otherGateway, noHostnames))
+
+	if domains := serviceDomains(services); !slices.Equal(domains, []string{"shop.example.com"}) {
+		t.Fatalf("Expected the services of the routes of the gateway, got %v", domains)
+	}
+
+	if paths := servicePaths(services[0]); !slices.Equal(paths, []string{"/checkout", "/checkout/", "/"}) {
+		t.Fatalf("Expected the paths of the matches, got %v", paths)
+	}
+
+	checkoutPath := services[0].Paths[0]
+	if checkoutPath.Split == nil || len(checkoutPath.Split.Targets) != 2 || checkoutPath.Split.Targets[0].Weight != 90 {
+		t.Fatalf("Expected a split between the weighted backends, got %+v", checkoutPath.Split)
+	}
+
+	match := checkoutPath.Match
+	if match == nil || !slices.Equal(match.Methods, []string{"POST"}) || len(match.Headers) != 1 || *match.Headers[0].Exact != "true" {
+		t.Errorf("Expected the method and header match, got %+v", match)
+	}
+
+	if services[0].Paths[2].Backend == nil || services[0].Paths[2].Match != nil {
+		t.Errorf("Expected a single backend matching all the requests, got %+v", services[0].Paths[2])
+	}
+}
+
+func TestWatchRoutes(t *testing.T) {
+	server := kubernetestest.NewServer(t, "")
+	client := newTestClient(t, server)
+
+	updates := make(chan []config.Service, 10)
+	err := WatchRoutes(testContext(t), client, config.Kubernetes{Namespace: "default", Ingress: true, IngressClass: "gatego"}, func(services []config.Service) {
+		updates <- services
+	})
+	if err != nil {
+		t.Fatalf("WatchRoutes failed: %v", err)
+	}
+
+	select {
+	case services := <-updates:
+		if len(services) != 0 {
+			t.Fatalf("Expected no services, got %v", serviceDomains(services))
+		}
+	default:
+		t.Fatal("Expected the services before WatchRoutes returns")
+	}
+
+	server.Apply(ingresses, ingressResource("default", "web", "gatego", nil, ingressRule("www.example.com", ingressPath("/", "Prefix", "web", 80, ""))))
+
+	select {
+	case services := <-updates:
+		if domains := serviceDomains(services); !slices.Equal(domains, []string{"www.example.com"}) {
+			t.Errorf("Expected the service of the new ingress, got %v", domains)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update after the ingress was added")
+	}
+
+	// An ingress of another class changes nothing
+	server.Apply(ingresses, ingressResource("default", "nginx", "nginx", nil, ingressRule("nginx.example.com", ingressPath("/", "Prefix", "web", 80, ""))))
+
+	select {
+	case services := <-updates:
+		t.Errorf("Expected no update, got %v", serviceDomains(services))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Helper function to create an ingress
+func ingressResource(namespace string, name string, class string, annotations map[string]any, rules ...any) map[string]any {
+	ingress := resource(namespace, name, annotations)
+	ingress["spec"] = map[string]any{"ingressClassName": class, "rules": rules}
+
+	return ingress
+}
+
+// Helper function to create an ingress rule of a host
+func ingressRule(host string, paths ...any) map[string]any {
+	return map[string]any{"host": host, "http": map[string]any{"paths": paths}}
+}
+
+// Helper function to create an ingress path to a service port (number or name)
+func ingressPath(path string, pathType string, service string, portNumber int, portName string) map[string]any {
+	port := map[string]any{"number": portNumber}
+	if portName != "" {
+		port = map[string]any{"name": portName}
+	}
+
+	return map[string]any{
+		"path":     path,
+		"pathType": pathType,
+		"backend":  map[string]any{"service": map[string]any{"name": service, "port": port}},
+	}
+}
+
+// Helper function to create an httproute attached to a gateway
+func httpRouteResource(namespace string, name string, gatewayNamespace string, gateway string, hostnames []string, rules []any) map[string]any {
+	route := resource(namespace, name, nil)
+	route["spec"] = map[string]any{
+		"parentRefs": []any{map[string]any{"namespace": gatewayNamespace, "name": gateway}},
+		"hostnames":  hostnames,
+		"rules":      rules,
+	}
+
+	return route
+}
+
+func rawResources(t *testing.T, resources ...map[string]any) []json.RawMessage {
+	raws := []json.RawMessage{}
+	for _, resource := range resources {
+		raw, err := json.Marshal(resource)
+		if err != nil {
+			t.Fatalf("Failed to encode resource: %v", err)
+		}
+		raws = append(raws, raw)
+	}
+
+	return raws
+}
+
+func serviceDomains(services []config.Service) []string {
+	domains := []string{}
+	for _, service := range services {
+		domains = append(domains, service.Domain)
+	}
+
+	return domains
+}
+
+func servicePaths(service config.Service) []string {
+	paths := []string{}
+	for _, path := range service.Paths {
+		paths = append(paths, path.Path)
+	}
+
+	return paths
+}
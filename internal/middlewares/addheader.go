@@ -3,20 +3,57 @@ package middlewares
 import (
 	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
 
 	"go.opentelemetry.io/otel/trace"
 )
 
-func NewAddHeadersMiddleware(headers map[string]string) Middleware {
+var pathValueRegex = regexp.MustCompile(`\$?\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var pathVariableRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(?:\.\.\.)?\}`)
+
+// NewAddHeadersMiddleware add headers to the request, values can use path variables captured by the endpoint path ({id})
+func NewAddHeadersMiddleware(headers map[string]string, pathPattern string) Middleware {
+	variables := PathVariables(pathPattern)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			span := trace.SpanFromContext(r.Context())
 
 			for header, value := range headers {
-				r.Header.Set(header, value)
+				r.Header.Set(header, ExpandPathValues(value, variables, r))
 				span.AddEvent(fmt.Sprintf("Added header %s to request", header))
 			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// PathVariables return the names of the variables declared by the endpoint path pattern ({id} and {rest...})
+func PathVariables(pathPattern string) []string {
+	variables := []string{}
+	for _, match := range pathVariableRegex.FindAllStringSubmatch(pathPattern, -1) {
+		variables = append(variables, match[1])
+	}
+
+	return variables
+}
+
+// ExpandPathValues replace {name} with the value of the path variable captured for the request, only the variables
+// of the endpoint path are replaced, other braces are left as is (like ${name} of regex replacements)
+func ExpandPathValues(value string, variables []string, r *http.Request) string {
+	return expandPathValues(value, variables, r, func(pathValue string) string { return pathValue })
+}
+
+// expandPathValues replace the path variables with their values passed through escape
+func expandPathValues(value string, variables []string, r *http.Request, escape func(string) string) string {
+	return pathValueRegex.ReplaceAllStringFunc(value, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if placeholder[0] == '$' || !slices.Contains(variables, name) {
+			return placeholder
+		}
+
+		return escape(r.PathValue(name))
+	})
+}
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAddHeadersMiddleware(t *testing.T) {
+	var receivedHeaders http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header.Clone()
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/users/{id}", NewAddHeadersMiddleware(map[string]string{
+		"X-Static":  "value",
+		"X-User-ID": "user-{id}",
+		"X-Missing": "{unknown}",
+	}, "/users/{id}")(handler))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+
+	// Placeholders that aren't variables of the path are literal text
+	expected := map[string]string{"X-Static": "value", "X-User-ID": "user-42", "X-Missing": "{unknown}"}
+	for header, value := range expected {
+		if receivedHeaders.Get(header) != value {
+			t.Errorf("Expected header %s = %q, got %q", header, value, receivedHeaders.Get(header))
+		}
+	}
+}
+
+func TestAddHeadersMiddlewareLiteralBraces(t *testing.T) {
+	var receivedHeaders http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header.Clone()
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", NewAddHeadersMiddleware(map[string]string{"X-Template": "{word} and {id}"}, "/api/")(handler))
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/users", nil))
+
+	if value := receivedHeaders.Get("X-Template"); value != "{word} and {id}" {
+		t.Errorf("Expected the header value to be kept on a path without variables, got %q", value)
+	}
+}
+
+func TestPathVariables(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"/api/", []string{}},
+		{"/users/{id}", []string{"id"}},
+		{"/files/{bucket}/{path...}", []string{"bucket", "path"}},
+		{"/exact/{$}", []string{}},
+	}
+
+	for _, tt := range tests {
+		if variables := PathVariables(tt.pattern); !slices.Equal(variables, tt.expected) {
+			t.Errorf("PathVariables(%q) = %v, want %v", tt.pattern, variables, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/hvuhsg/gatego/internal/errorpages"
+)
+
+// NewErrorPagesMiddleware make the error responses generated by the next middlewares and handler use the renderer.
+// Requests without a request id get a new one (sent upstream in the X-Request-Id header).
+func NewErrorPagesMiddleware(renderer *errorpages.Renderer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(errorpages.RequestIDHeader) == "" {
+				r.Header.Set(errorpages.RequestIDHeader, errorpages.NewRequestID())
+			}
+
+			r = r.WithContext(errorpages.AddToContext(r.Context(), renderer))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
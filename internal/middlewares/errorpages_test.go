@@ -0,0 +1,49 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hvuhsg/gatego/internal/errorpages"
+	"github.com/hvuhsg/gatego/internal/middlewares"
+)
+
+func TestErrorPagesMiddleware(t *testing.T) {
+	renderer := errorpages.New(map[string]errorpages.Page{
+		"413": {ContentType: "application/json", Body: `{"status":{status},"request_id":"{request_id}"}`},
+	}, false)
+
+	var upstreamRequestID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequestID = r.Header.Get(errorpages.RequestIDHeader)
+	})
+
+	wrapped := middlewares.NewErrorPagesMiddleware(renderer)(middlewares.NewRequestSizeLimitMiddleware(4)(handler))
+
+	t.Run("request id is sent upstream", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("ok"))
+		wrapped.ServeHTTP(httptest.NewRecorder(), req)
+
+		if upstreamRequestID == "" {
+			t.Error("Expected a generated request id header")
+		}
+	})
+
+	t.Run("errors use the renderer", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("too large"))
+		req.Header.Set(errorpages.RequestIDHeader, "abc")
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+		}
+
+		expectedBody := `{"status":413,"request_id":"abc"}`
+		if rr.Body.String() != expectedBody {
+			t.Errorf("handler returned wrong body: got %v want %v", rr.Body.String(), expectedBody)
+		}
+	})
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"github.com/hvuhsg/gatego/pkg/multimux"
 )
 
 func formatDuration(ms int64) string {
@@ -20,6 +24,9 @@ func NewLoggingMiddleware(out io.Writer) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now().UnixMilli()
 
+			ctx, logFields := contextvalues.AddLogFieldsToContext(r.Context())
+			r = r.WithContext(ctx)
+
 			rh := &responseHook{ResponseWriter: w, respSize: 0}
 			next.ServeHTTP(rh, r)
 
@@ -40,7 +47,18 @@ func NewLoggingMiddleware(out io.Writer) func(http.Handler) http.Handler {
 			statusCode := rh.statusCode
 			duration := formatDuration(end - start)
 
-			fmt.Fprintf(out, "%s - - [%s] \"%s %s %s\" %d %d %s \"%s\" \"%s\"\n", remoteAddr, date, method, path, r.Proto, statusCode, responseSize, duration, fullURL, userAgent)
+			// Hosts served by a wildcard or the default service log the pattern that matched them
+			if hostPattern := multimux.MatchedPattern(r.Context()); strings.HasPrefix(hostPattern, "*") {
+				logFields.Set("host_pattern", hostPattern)
+			}
+
+			// Fields added by the handlers and middlewares (like the split target)
+			extraFields := ""
+			if fields := logFields.String(); fields != "" {
+				extraFields = " " + fields
+			}
+
+			fmt.Fprintf(out, "%s - - [%s] \"%s %s %s\" %d %d %s \"%s\" \"%s\"%s\n", remoteAddr, date, method, path, r.Proto, statusCode, responseSize, duration, fullURL, userAgent, extraFields)
 		})
 	}
 }
@@ -7,6 +7,9 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+
+	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"github.com/hvuhsg/gatego/pkg/multimux"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -104,6 +107,49 @@ func TestLoggingMiddleware(t *testing.T) {
 	}
 }
 
+func TestLoggingMiddlewareHostPattern(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mm := multimux.NewMultiMux()
+	mm.RegisterHandler("*.example.com", "/", NewLoggingMiddleware(buf)(testHandler))
+
+	req := httptest.NewRequest("GET", "http://tenant.example.com/", nil)
+	mm.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.HasSuffix(buf.String(), `" host_pattern=*.example.com`+"\n") {
+		t.Errorf("Expected log to end with the matched host pattern. Log: %s", buf.String())
+	}
+
+	// Exact hosts keep the log line unchanged
+	buf.Reset()
+	mm.RegisterHandler("www.example.com", "/", NewLoggingMiddleware(buf)(testHandler))
+	mm.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://www.example.com/", nil))
+
+	if strings.Contains(buf.String(), "host_pattern") {
+		t.Errorf("Expected no host pattern for an exact host. Log: %s", buf.String())
+	}
+}
+
+func TestLoggingMiddlewareLogFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextvalues.LogFieldsFromContext(r.Context()).Set("split_target", "v2")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	NewLoggingMiddleware(buf)(testHandler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.HasSuffix(buf.String(), `" split_target=v2`+"\n") {
+		t.Errorf("Expected log to end with the log fields. Log: %s", buf.String())
+	}
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,337 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const mirrorMeterName = "mirror"
+
+type MirrorConfig struct {
+	URL            string
+	Percentage     float64 // 0 - 100
+	MaxConcurrency int
+	QueueSize      int
+	DropOldest     bool // Drop the oldest queued request instead of the new one when the queue is full
+	Timeout        time.Duration
+	MaxBodySize    uint64            // Requests with larger bodies are not mirrored (0 for no limit)
+	Diff           *MirrorDiffConfig // Compare the mirror responses with the primary responses
+}
+
+type mirrorJob struct {
+	ctx     context.Context // Detached from the client request, keeps the trace
+	request *http.Request
+	primary *capturedResponse // Set when diffing
+}
+
+type mirror struct {
+	config  MirrorConfig
+	target  *url.URL
+	client  *http.Client
+	jobs    chan mirrorJob
+	metrics *mirrorMetrics
+	differ  *mirrorDiffer // nil when diffing is disabled
+}
+
+// NewMirrorMiddleware asynchronously replay a percentage of the requests to the mirror url and discard the responses.
+// At most MaxConcurrency mirror requests run at once, when they are all busy and the queue is full requests are dropped
+// so a slow mirror never delays the primary request.
+// When diffing the request is mirrored after the primary response is written and the responses are compared.
+func NewMirrorMiddleware(ctx context.Context, config MirrorConfig) (Middleware, error) {
+	target, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := newMirrorMetrics(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mirror{
+		config:  config,
+		target:  target,
+		client:  &http.Client{Timeout: config.Timeout},
+		jobs:    make(chan mirrorJob, config.QueueSize),
+		metrics: metrics,
+	}
+
+	if config.Diff != nil {
+		m.differ, err = newMirrorDiffer(ctx, *config.Diff, metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < max(config.MaxConcurrency, 1); i++ {
+		go m.worker(ctx)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rand.Float64()*100 >= config.Percentage {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			job, ok := m.newJob(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if m.differ == nil {
+				m.mirror(r, job)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tee := newTeeResponseWriter(w)
+			next.ServeHTTP(tee, r)
+			job.primary = tee.captured()
+			m.mirror(r, job)
+		})
+	}, nil
+}
+
+func (m *mirror) newJob(r *http.Request) (mirrorJob, bool) {
+	span := trace.SpanFromContext(r.Context())
+
+	body, ok := m.bufferBody(r)
+	if !ok {
+		span.AddEvent("Request body too large to mirror")
+		m.metrics.recordResult("skipped")
+		return mirrorJob{}, false
+	}
+
+	return mirrorJob{
+		ctx:     contextvalues.AddTracerToContext(trace.ContextWithSpanContext(context.Background(), span.SpanContext()), contextvalues.TracerFromContext(r.Context())),
+		request: m.newMirrorRequest(r, body),
+	}, true
+}
+
+func (m *mirror) mirror(r *http.Request, job mirrorJob) {
+	span := trace.SpanFromContext(r.Context())
+
+	if !m.enqueue(job) {
+		span.AddEvent("Mirror request dropped")
+		m.metrics.recordResult("dropped")
+		return
+	}
+
+	span.AddEvent("Mirrored request")
+}
+
+// bufferBody read the request body so it can be sent twice
+func (m *mirror) bufferBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+
+	var reader io.Reader = r.Body
+	if m.config.MaxBodySize > 0 {
+		reader = io.LimitReader(r.Body, int64(m.config.MaxBodySize)+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil || (m.config.MaxBodySize > 0 && uint64(len(body)) > m.config.MaxBodySize) {
+		// Give the primary request the body as it was
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		return nil, false
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+func (m *mirror) newMirrorRequest(r *http.Request, body []byte) *http.Request {
+	mirrorURL := *m.target
+	mirrorURL.Path = strings.TrimSuffix(m.target.Path, "/") + r.URL.Path
+	mirrorURL.RawPath = ""
+	mirrorURL.RawQuery = r.URL.RawQuery
+
+	var bodyReader io.Reader = http.NoBody
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+
+	// The context is set by the worker
+	request, _ := http.NewRequest(r.Method, mirrorURL.String(), bodyReader)
+	request.Header = r.Header.Clone()
+	request.Header.Del("Connection")
+	request.Header.Set("X-Forwarded-Host", r.Host)
+
+	return request
+}
+
+// enqueue never blocks, it returns false when the request was dropped
+func (m *mirror) enqueue(job mirrorJob) bool {
+	select {
+	case m.jobs <- job:
+		return true
+	default:
+	}
+
+	if !m.config.DropOldest {
+		return false
+	}
+
+	select {
+	case oldJob := <-m.jobs:
+		trace.SpanFromContext(oldJob.ctx).AddEvent("Mirror request dropped")
+		m.metrics.recordResult("dropped")
+	default:
+	}
+
+	select {
+	case m.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *mirror) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-m.jobs:
+			m.send(job)
+		}
+	}
+}
+
+func (m *mirror) send(job mirrorJob) {
+	ctx := job.ctx
+	tracer := contextvalues.TracerFromContext(ctx)
+	if tracer == nil {
+		tracer = otel.GetTracerProvider().Tracer(tracerName)
+	}
+
+	ctx, span := tracer.Start(ctx, "request.mirror", trace.WithAttributes(attribute.String("gatego.mirror.url", job.request.URL.String())))
+	defer span.End()
+
+	start := time.Now()
+	response, err := m.client.Do(job.request.WithContext(ctx))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		m.metrics.recordResponse(0, time.Since(start))
+		return
+	}
+
+	candidate := &capturedResponse{status: response.StatusCode, headers: response.Header}
+	if job.primary != nil {
+		candidate.body, _ = io.ReadAll(io.LimitReader(response.Body, maxDiffBodySize))
+	}
+
+	// Discard the response
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	latency := time.Since(start)
+
+	if job.primary != nil {
+		mismatches := m.differ.compare(job.primary, candidate)
+		m.differ.record(job.request, job.primary, candidate, mismatches)
+		span.SetAttributes(attribute.StringSlice("gatego.mirror.mismatches", mismatches))
+	}
+
+	span.SetAttributes(
+		attribute.Int("gatego.mirror.status", response.StatusCode),
+		attribute.Int64("gatego.mirror.latency_ms", latency.Milliseconds()),
+	)
+	if response.StatusCode >= 500 {
+		span.SetStatus(codes.Error, fmt.Sprintf("mirror responded with %d", response.StatusCode))
+	}
+
+	m.metrics.recordResponse(response.StatusCode, latency)
+}
+
+// mirrorMetrics report mirror metrics through the global OpenTelemetry meter provider
+// (no-op when OpenTelemetry is not configured)
+type mirrorMetrics struct {
+	attributes []attribute.KeyValue
+	requests   metric.Int64Counter
+	duration   metric.Float64Histogram
+	diffs      metric.Int64Counter
+	mismatches metric.Int64Counter
+}
+
+func newMirrorMetrics(mirrorURL string) (*mirrorMetrics, error) {
+	meter := otel.GetMeterProvider().Meter(mirrorMeterName)
+
+	requests, err := meter.Int64Counter("gatego.mirror.requests", metric.WithDescription("Number of mirrored requests by result (sent, error, dropped, skipped)"))
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := meter.Float64Histogram("gatego.mirror.duration", metric.WithDescription("Mirror request latency"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	diffs, err := meter.Int64Counter("gatego.mirror.diffs", metric.WithDescription("Number of compared primary and mirror responses by result (match, mismatch)"))
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches, err := meter.Int64Counter("gatego.mirror.mismatches", metric.WithDescription("Number of mismatches by response part (status, header, body)"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mirrorMetrics{
+		attributes: []attribute.KeyValue{attribute.String("mirror.url", mirrorURL)},
+		requests:   requests,
+		duration:   duration,
+		diffs:      diffs,
+		mismatches: mismatches,
+	}, nil
+}
+
+func (mm *mirrorMetrics) recordResult(result string) {
+	attrs := append([]attribute.KeyValue{attribute.String("mirror.result", result)}, mm.attributes...)
+	mm.requests.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+}
+
+// recordDiff count the compared responses and their mismatching parts by kind (the fields are on the mirror span)
+func (mm *mirrorMetrics) recordDiff(mismatches []string) {
+	result := "match"
+	if len(mismatches) > 0 {
+		result = "mismatch"
+	}
+
+	mm.diffs.Add(context.Background(), 1, metric.WithAttributes(append([]attribute.KeyValue{attribute.String("mirror.diff.result", result)}, mm.attributes...)...))
+
+	for _, mismatch := range mismatches {
+		kind, _, _ := strings.Cut(mismatch, ":")
+		attrs := append([]attribute.KeyValue{attribute.String("mirror.diff.kind", kind)}, mm.attributes...)
+		mm.mismatches.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+	}
+}
+
+// recordResponse record a sent mirror request, status is 0 when no response was received
+func (mm *mirrorMetrics) recordResponse(status int, latency time.Duration) {
+	result := "sent"
+	if status == 0 {
+		result = "error"
+	}
+
+	attrs := append([]attribute.KeyValue{attribute.String("mirror.result", result), attribute.Int("mirror.status", status)}, mm.attributes...)
+	mm.requests.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+	mm.duration.Record(context.Background(), latency.Seconds(), metric.WithAttributes(attrs...))
+}
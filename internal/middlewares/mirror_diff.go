@@ -0,0 +1,260 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bodies larger than this are compared up to this size
+const maxDiffBodySize = 1024 * 1024
+
+// Sampled bodies are truncated to this size
+const maxSampleBodySize = 4 * 1024
+
+type MirrorDiffConfig struct {
+	Headers      []string // Response headers to compare
+	IgnoreFields []string // JSON body fields to ignore (dot separated paths, arrays are traversed)
+	SamplesFile  string   // JSONL file to write mismatch samples to (empty for none)
+	MaxSamples   int      // Max samples to write (0 for no limit)
+}
+
+// capturedResponse is a response (or its first maxDiffBodySize bytes) kept for diffing
+type capturedResponse struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+// teeResponseWriter write the response to the client and capture it
+type teeResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	headers http.Header
+	body    bytes.Buffer
+}
+
+func newTeeResponseWriter(w http.ResponseWriter) *teeResponseWriter {
+	return &teeResponseWriter{ResponseWriter: w}
+}
+
+func (t *teeResponseWriter) WriteHeader(statusCode int) {
+	if t.status == 0 {
+		t.status = statusCode
+		t.headers = t.ResponseWriter.Header().Clone()
+	}
+
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *teeResponseWriter) Write(b []byte) (int, error) {
+	if t.status == 0 {
+		t.WriteHeader(http.StatusOK)
+	}
+
+	if remaining := maxDiffBodySize - t.body.Len(); remaining > 0 {
+		t.body.Write(b[:min(len(b), remaining)])
+	}
+
+	return t.ResponseWriter.Write(b)
+}
+
+// Unwrap let http.ResponseController reach the original writer (flushing streamed responses, hijacking upgrades)
+func (t *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (t *teeResponseWriter) captured() *capturedResponse {
+	if t.status == 0 {
+		return &capturedResponse{status: http.StatusOK, headers: t.ResponseWriter.Header().Clone()}
+	}
+
+	return &capturedResponse{status: t.status, headers: t.headers, body: t.body.Bytes()}
+}
+
+// mirrorDiffer compare the primary and mirror responses and record the mismatches
+type mirrorDiffer struct {
+	config  MirrorDiffConfig
+	metrics *mirrorMetrics
+
+	mu          sync.Mutex
+	samples     *os.File // nil when samples are disabled or the differ is stopped
+	samplesSent int
+}
+
+// newMirrorDiffer create a differ, its samples file is closed when ctx is done (the handler is replaced on reload)
+func newMirrorDiffer(ctx context.Context, config MirrorDiffConfig, metrics *mirrorMetrics) (*mirrorDiffer, error) {
+	differ := &mirrorDiffer{config: config, metrics: metrics}
+
+	if config.SamplesFile != "" {
+		samples, err := os.OpenFile(config.SamplesFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		differ.samples = samples
+
+		go func() {
+			<-ctx.Done()
+			differ.close()
+		}()
+	}
+
+	return differ, nil
+}
+
+// close the samples file, later mismatches are counted in the metrics only
+func (md *mirrorDiffer) close() {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	if md.samples != nil {
+		md.samples.Close()
+		md.samples = nil
+	}
+}
+
+type diffSample struct {
+	Time       time.Time      `json:"time"`
+	Method     string         `json:"method"`
+	URL        string         `json:"url"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Mismatches []string       `json:"mismatches"`
+	Primary    sampleResponse `json:"primary"`
+	Candidate  sampleResponse `json:"candidate"`
+}
+
+type sampleResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// compare return the mismatching parts of the responses (status, header:<name>, body)
+func (md *mirrorDiffer) compare(primary *capturedResponse, candidate *capturedResponse) []string {
+	mismatches := []string{}
+
+	if primary.status != candidate.status {
+		mismatches = append(mismatches, "status")
+	}
+
+	for _, header := range md.config.Headers {
+		if primary.headers.Get(header) != candidate.headers.Get(header) {
+			mismatches = append(mismatches, "header:"+http.CanonicalHeaderKey(header))
+		}
+	}
+
+	if !md.equalBodies(decodeBody(primary), decodeBody(candidate)) {
+		mismatches = append(mismatches, "body")
+	}
+
+	return mismatches
+}
+
+// equalBodies compare JSON bodies without the ignored fields and other bodies byte by byte
+func (md *mirrorDiffer) equalBodies(primaryBody []byte, candidateBody []byte) bool {
+	var primaryJSON, candidateJSON any
+	if json.Unmarshal(primaryBody, &primaryJSON) != nil || json.Unmarshal(candidateBody, &candidateJSON) != nil {
+		return bytes.Equal(primaryBody, candidateBody)
+	}
+
+	for _, field := range md.config.IgnoreFields {
+		path := strings.Split(field, ".")
+		removeJSONField(primaryJSON, path)
+		removeJSONField(candidateJSON, path)
+	}
+
+	return reflect.DeepEqual(primaryJSON, candidateJSON)
+}
+
+// record the diff result in the metrics and a sample of the mismatch in the samples file
+func (md *mirrorDiffer) record(r *http.Request, primary *capturedResponse, candidate *capturedResponse, mismatches []string) {
+	md.metrics.recordDiff(mismatches)
+
+	if len(mismatches) == 0 {
+		return
+	}
+
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	if md.samples == nil {
+		return
+	}
+
+	if md.config.MaxSamples > 0 && md.samplesSent >= md.config.MaxSamples {
+		return
+	}
+	md.samplesSent++
+
+	sample := diffSample{
+		Time:       time.Now(),
+		Method:     r.Method,
+		URL:        r.URL.RequestURI(),
+		RequestID:  r.Header.Get("X-Request-Id"),
+		Mismatches: mismatches,
+		Primary:    md.newSampleResponse(primary),
+		Candidate:  md.newSampleResponse(candidate),
+	}
+
+	json.NewEncoder(md.samples).Encode(sample)
+}
+
+func (md *mirrorDiffer) newSampleResponse(response *capturedResponse) sampleResponse {
+	headers := make(map[string]string, len(md.config.Headers))
+	for _, header := range md.config.Headers {
+		headers[http.CanonicalHeaderKey(header)] = response.headers.Get(header)
+	}
+
+	body := decodeBody(response)
+	if len(body) > maxSampleBodySize {
+		body = body[:maxSampleBodySize]
+	}
+
+	return sampleResponse{Status: response.status, Headers: headers, Body: string(body)}
+}
+
+// decodeBody return the gzip decompressed body (the primary and mirror may compress differently)
+func decodeBody(response *capturedResponse) []byte {
+	if response.headers.Get("Content-Encoding") != "gzip" {
+		return response.body
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(response.body))
+	if err != nil {
+		return response.body
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxDiffBodySize))
+	if err != nil && len(body) == 0 {
+		return response.body
+	}
+
+	return body
+}
+
+// removeJSONField delete the field at path from a decoded JSON value (in place)
+func removeJSONField(value any, path []string) {
+	switch typed := value.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			delete(typed, path[0])
+			return
+		}
+
+		if child, exists := typed[path[0]]; exists {
+			removeJSONField(child, path[1:])
+		}
+	case []any:
+		for _, item := range typed {
+			removeJSONField(item, path)
+		}
+	}
+}
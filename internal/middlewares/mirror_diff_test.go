@@ -0,0 +1,226 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMirrorDifferCompare(t *testing.T) {
+	differ := &mirrorDiffer{config: MirrorDiffConfig{
+		Headers:      []string{"content-type"},
+		IgnoreFields: []string{"timestamp", "items.updated_at"},
+	}}
+
+	jsonHeaders := http.Header{"Content-Type": []string{"application/json"}}
+
+	tests := []struct {
+		name      string
+		primary   *capturedResponse
+		candidate *capturedResponse
+		expected  []string
+	}{
+		{
+			name:      "identical",
+			primary:   &capturedResponse{status: 200, headers: jsonHeaders, body: []byte(`{"id":1}`)},
+			candidate: &capturedResponse{status: 200, headers: jsonHeaders, body: []byte(`{"id":1}`)},
+			expected:  []string{},
+		},
+		{
+			name:      "ignored fields and key order",
+			primary:   &capturedResponse{status: 200, headers: jsonHeaders, body: []byte(`{"id":1,"timestamp":1,"items":[{"a":1,"updated_at":"x"}]}`)},
+			candidate: &capturedResponse{status: 200, headers: jsonHeaders, body: []byte(`{"items":[{"updated_at":"y","a":1}],"timestamp":2,"id":1}`)},
+			expected:  []string{},
+		},
+		{
+			name:      "different status, header and body",
+			primary:   &capturedResponse{status: 200, headers: jsonHeaders, body: []byte(`{"id":1}`)},
+			candidate: &capturedResponse{status: 201, headers: http.Header{"Content-Type": []string{"text/plain"}}, body: []byte(`{"id":2}`)},
+			expected:  []string{"status", "header:Content-Type", "body"},
+		},
+		{
+			name:      "non json bodies",
+			primary:   &capturedResponse{status: 200, headers: http.Header{}, body: []byte("hello")},
+			candidate: &capturedResponse{status: 200, headers: http.Header{}, body: []byte("hello!")},
+			expected:  []string{"body"},
+		},
+		{
+			name:      "gzip body",
+			primary:   &capturedResponse{status: 200, headers: http.Header{"Content-Encoding": []string{"gzip"}}, body: gzipBytes(t, "hello")},
+			candidate: &capturedResponse{status: 200, headers: http.Header{}, body: []byte("hello")},
+			expected:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := differ.compare(tt.primary, tt.candidate)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("compare() = %v want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMirrorDiffSamples(t *testing.T) {
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"v2","generated_at":"later"}`))
+	}))
+	defer mirrorServer.Close()
+
+	samplesFile := filepath.Join(t.TempDir(), "diff.jsonl")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mirror, err := NewMirrorMiddleware(ctx, MirrorConfig{
+		URL:            mirrorServer.URL,
+		Percentage:     100,
+		MaxConcurrency: 1,
+		QueueSize:      10,
+		Timeout:        time.Second,
+		Diff: &MirrorDiffConfig{
+			Headers:      []string{"Content-Type"},
+			IgnoreFields: []string{"generated_at"},
+			SamplesFile:  samplesFile,
+			MaxSamples:   1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"v1","generated_at":"now"}`))
+	}))
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+		if rr.Body.String() != `{"name":"v1","generated_at":"now"}` {
+			t.Fatalf("primary response changed: %q", rr.Body.String())
+		}
+	}
+
+	// Wait for the samples to be written
+	var lines []string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		lines = readLines(t, samplesFile)
+		if len(lines) > 0 {
+			break
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	lines = readLines(t, samplesFile)
+	if len(lines) != 1 {
+		t.Fatalf("Expected exactly 1 sample (max_samples), got %d", len(lines))
+	}
+
+	var sample diffSample
+	if err := json.Unmarshal([]byte(lines[0]), &sample); err != nil {
+		t.Fatalf("Invalid sample: %v", err)
+	}
+
+	if sample.URL != "/users" || !reflect.DeepEqual(sample.Mismatches, []string{"body"}) {
+		t.Errorf("Unexpected sample %+v", sample)
+	}
+
+	if sample.Primary.Body != `{"name":"v1","generated_at":"now"}` || sample.Candidate.Body != `{"name":"v2","generated_at":"later"}` {
+		t.Errorf("Unexpected sample bodies %+v", sample)
+	}
+}
+
+func TestMirrorDifferClosedWithContext(t *testing.T) {
+	metrics, err := newMirrorMetrics("http://mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samplesFile := filepath.Join(t.TempDir(), "diff.jsonl")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	differ, err := newMirrorDiffer(ctx, MirrorDiffConfig{SamplesFile: samplesFile}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler is replaced by a reload
+	cancel()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		differ.mu.Lock()
+		closed := differ.samples == nil
+		differ.mu.Unlock()
+
+		if closed {
+			break
+		}
+	}
+
+	response := &capturedResponse{status: http.StatusOK, headers: http.Header{}}
+	differ.record(httptest.NewRequest(http.MethodGet, "/users", nil), response, response, []string{"status"})
+
+	if lines := readLines(t, samplesFile); len(lines) != 0 {
+		t.Errorf("Expected no samples after the differ is stopped, got %d", len(lines))
+	}
+}
+
+func TestTeeResponseWriterFlush(t *testing.T) {
+	rr := httptest.NewRecorder()
+	tee := newTeeResponseWriter(rr)
+
+	tee.Write([]byte("event: ping\n\n"))
+	if err := http.NewResponseController(tee).Flush(); err != nil || !rr.Flushed {
+		t.Errorf("Expected the flush to reach the client writer, got %v", err)
+	}
+
+	if captured := tee.captured(); string(captured.body) != "event: ping\n\n" {
+		t.Errorf("Expected the flushed body to be captured, got %q", captured.body)
+	}
+}
+
+// Helper function to gzip a string
+func gzipBytes(t *testing.T, value string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(value))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Helper function to read the lines of a file (empty if missing)
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines
+}
@@ -0,0 +1,134 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/middlewares"
+)
+
+func TestMirrorMiddleware(t *testing.T) {
+	mirrored := make(chan string, 10)
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.RequestURI() + " " + string(body)
+		w.WriteHeader(http.StatusInternalServerError) // Must not affect the client
+	}))
+	defer mirrorServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mirror, err := middlewares.NewMirrorMiddleware(ctx, middlewares.MirrorConfig{
+		URL:            mirrorServer.URL + "/shadow/",
+		Percentage:     100,
+		MaxConcurrency: 2,
+		QueueSize:      1,
+		Timeout:        time.Second,
+		MaxBodySize:    1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", bytes.NewBufferString("payload"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "payload" {
+		t.Errorf("primary response changed: got %d %q", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case got := <-mirrored:
+		expected := "POST /shadow/orders?id=1 payload"
+		if got != expected {
+			t.Errorf("mirror got %q want %q", got, expected)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request was not mirrored")
+	}
+}
+
+func TestMirrorMiddlewarePercentage(t *testing.T) {
+	var mirroredCount atomic.Int64
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirroredCount.Add(1)
+	}))
+	defer mirrorServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mirror, err := middlewares.NewMirrorMiddleware(ctx, middlewares.MirrorConfig{
+		URL:            mirrorServer.URL,
+		Percentage:     0,
+		MaxConcurrency: 1,
+		Timeout:        time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 20; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if count := mirroredCount.Load(); count != 0 {
+		t.Errorf("Expected no mirrored requests with 0%%, got %d", count)
+	}
+}
+
+func TestMirrorMiddlewareSlowMirror(t *testing.T) {
+	release := make(chan struct{})
+	var mirroredCount atomic.Int64
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirroredCount.Add(1)
+		<-release
+	}))
+	defer mirrorServer.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mirror, err := middlewares.NewMirrorMiddleware(ctx, middlewares.MirrorConfig{
+		URL:            mirrorServer.URL,
+		Percentage:     100,
+		MaxConcurrency: 1,
+		QueueSize:      1,
+		Timeout:        5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := mirror(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Slow mirror delayed the primary requests by %s", elapsed)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if count := mirroredCount.Load(); count != 1 {
+		t.Errorf("Expected only one in-flight mirror request, got %d", count)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/hvuhsg/gatego/internal/errorpages"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -33,7 +34,7 @@ func NewOpenAPIValidationMiddleware(specPath string) (Middleware, error) {
 			route, pathParams, err := router.FindRoute(r)
 			if err != nil {
 				span.AddEvent("Request path not found in openapi spec")
-				http.Error(w, fmt.Sprintf("Error finding route: %v", err), http.StatusBadRequest)
+				errorpages.Error(w, r, fmt.Sprintf("Error finding route: %v", err), http.StatusBadRequest)
 				return
 			}
 
@@ -45,7 +46,7 @@ func NewOpenAPIValidationMiddleware(specPath string) (Middleware, error) {
 
 			if err := openapi3filter.ValidateRequest(r.Context(), requestValidationInput); err != nil {
 				span.AddEvent(fmt.Sprintf("Error while validating request with openapi spec. err = %v", err))
-				http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+				errorpages.Error(w, r, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
 				return
 			}
 
@@ -66,7 +67,7 @@ func NewOpenAPIValidationMiddleware(specPath string) (Middleware, error) {
 
 			if err := openapi3filter.ValidateResponse(r.Context(), responseValidationInput); err != nil {
 				span.AddEvent(fmt.Sprintf("Error while validating response with openapi spec. err = %v", err))
-				http.Error(w, fmt.Sprintf("Invalid response: %v", err), http.StatusInternalServerError)
+				errorpages.Error(w, r, fmt.Sprintf("Invalid response: %v", err), http.StatusInternalServerError)
 				return
 			}
 
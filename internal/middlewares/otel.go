@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/hvuhsg/gatego/internal/contextvalues"
+	"github.com/hvuhsg/gatego/pkg/multimux"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -44,6 +45,7 @@ func NewOpenTelemetryMiddleware(ctx context.Context, config OTELConfig) (Middlew
 			attrs := make([]attribute.KeyValue, 0)
 			attrs = append(attrs, semconv.HTTPUserAgentKey.String(r.UserAgent()))
 			attrs = append(attrs, semconv.HTTPServerAttributesFromHTTPRequest(config.ServiceDomain, config.BasePath, r)...)
+			attrs = append(attrs, attribute.String("gatego.host_pattern", multimux.MatchedPattern(r.Context())))
 			span.SetAttributes(
 				attrs...,
 			)
@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/hvuhsg/gatego/internal/errorpages"
 	"golang.org/x/time/rate"
 )
 
@@ -116,7 +117,7 @@ func NewRateLimitMiddleware(limits []string) (func(http.Handler) http.Handler, e
 				key, err := config.GetKey(r)
 				if err != nil {
 					// Should never reach here (validation should prevent it)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					errorpages.Error(w, r, err.Error(), http.StatusInternalServerError)
 				}
 
 				limiter := rateLimiter.getLimiter(key)
@@ -127,7 +128,7 @@ func NewRateLimitMiddleware(limits []string) (func(http.Handler) http.Handler, e
 
 				if !limiter.Allow() {
 					setRateLimitHeaders(w, limiter, config)
-					http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+					errorpages.Error(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
 					return
 				}
 			}
@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type RewriteRule struct {
+	Regex       *regexp.Regexp
+	Replacement string // Supports regex groups ($1, ${name}) and path variables ({id})
+}
+
+type RewriteConfig struct {
+	StripPrefix   string
+	AddPrefix     string
+	Rules         []RewriteRule // The first matching rule is applied
+	PathVariables []string      // Variables of the endpoint path, usable in the replacements
+}
+
+// NewRewriteMiddleware rewrite the request path before it is sent upstream (strip prefix, rewrite rules, add prefix).
+// The original request uri is sent in the X-Original-URI header and the stripped prefix in X-Forwarded-Prefix.
+func NewRewriteMiddleware(config RewriteConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+
+			// The headers are changed on a copy, the middlewares before (mirror, logging) keep the original request
+			originalRequest := r
+			r = r.Clone(r.Context())
+
+			originalURI := r.URL.RequestURI()
+			path := r.URL.Path
+
+			stripPrefix := strings.TrimSuffix(config.StripPrefix, "/")
+			if stripPrefix != "" && (path == stripPrefix || strings.HasPrefix(path, stripPrefix+"/")) {
+				path = "/" + strings.TrimPrefix(strings.TrimPrefix(path, stripPrefix), "/")
+				r.Header.Set("X-Forwarded-Prefix", stripPrefix)
+			}
+
+			for _, rule := range config.Rules {
+				if rule.Regex.MatchString(path) {
+					// The path values are sent by the client, their $ must not be taken as regex groups
+					replacement := expandPathValues(rule.Replacement, config.PathVariables, r, func(pathValue string) string {
+						return strings.ReplaceAll(pathValue, "$", "$$")
+					})
+					path = rule.Regex.ReplaceAllString(path, replacement)
+					break
+				}
+			}
+
+			if config.AddPrefix != "" {
+				path = strings.TrimSuffix(config.AddPrefix, "/") + "/" + strings.TrimPrefix(path, "/")
+			}
+
+			if path != originalRequest.URL.Path {
+				span.AddEvent(fmt.Sprintf("Rewrote path %s to %s", originalRequest.URL.Path, path))
+
+				r.URL.Path = path
+				r.URL.RawPath = ""
+			}
+
+			r.Header.Set("X-Original-URI", originalURI)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
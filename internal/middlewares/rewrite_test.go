@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestRewriteMiddleware(t *testing.T) {
+	tests := []struct {
+		name                    string
+		pattern                 string
+		config                  RewriteConfig
+		requestURI              string
+		expectedPath            string
+		expectedForwardedPrefix string
+	}{
+		{
+			name:                    "strip prefix",
+			pattern:                 "/billing/",
+			config:                  RewriteConfig{StripPrefix: "/billing"},
+			requestURI:              "/billing/invoices/1?page=2",
+			expectedPath:            "/invoices/1",
+			expectedForwardedPrefix: "/billing",
+		},
+		{
+			name:                    "strip prefix exact path",
+			pattern:                 "/billing",
+			config:                  RewriteConfig{StripPrefix: "/billing/"},
+			requestURI:              "/billing",
+			expectedPath:            "/",
+			expectedForwardedPrefix: "/billing",
+		},
+		{
+			name:         "strip prefix only on segment boundary",
+			pattern:      "/",
+			config:       RewriteConfig{StripPrefix: "/billing"},
+			requestURI:   "/billingreport",
+			expectedPath: "/billingreport",
+		},
+		{
+			name:                    "strip and add prefix",
+			pattern:                 "/billing/",
+			config:                  RewriteConfig{StripPrefix: "/billing", AddPrefix: "/api/v1/"},
+			requestURI:              "/billing/invoices",
+			expectedPath:            "/api/v1/invoices",
+			expectedForwardedPrefix: "/billing",
+		},
+		{
+			name:    "regex with capture groups",
+			pattern: "/",
+			config: RewriteConfig{Rules: []RewriteRule{
+				{Regex: regexp.MustCompile(`^/old/(.*)$`), Replacement: "/new/$1"},
+				{Regex: regexp.MustCompile(`^/new/(.*)$`), Replacement: "/never/$1"},
+			}},
+			requestURI:   "/old/docs/page",
+			expectedPath: "/new/docs/page",
+		},
+		{
+			name:    "regex with path variables",
+			pattern: "/users/{id}/",
+			config: RewriteConfig{Rules: []RewriteRule{
+				{Regex: regexp.MustCompile(`^/users/[^/]+/(?P<rest>.*)$`), Replacement: "/accounts/{id}/${rest}"},
+			}, PathVariables: []string{"id"}},
+			requestURI:   "/users/42/orders",
+			expectedPath: "/accounts/42/orders",
+		},
+		{
+			name:    "path variable with regex group syntax",
+			pattern: "/users/{id}/",
+			config: RewriteConfig{Rules: []RewriteRule{
+				{Regex: regexp.MustCompile(`^/users/(?P<user>[^/]+)/(?P<rest>.*)$`), Replacement: "/accounts/{id}/${rest}"},
+			}, PathVariables: []string{"id"}},
+			requestURI:   "/users/$1$%7Brest%7D/orders",
+			expectedPath: "/accounts/$1${rest}/orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamRequest *http.Request
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamRequest = r
+			})
+
+			var originalPath string
+			var originalHeader http.Header
+			mux := http.NewServeMux()
+			mux.Handle(tt.pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				NewRewriteMiddleware(tt.config)(handler).ServeHTTP(w, r)
+				originalPath = r.URL.Path
+				originalHeader = r.Header
+			}))
+
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.requestURI, nil))
+
+			if upstreamRequest.URL.Path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, upstreamRequest.URL.Path)
+			}
+
+			if upstreamRequest.Header.Get("X-Original-URI") != tt.requestURI {
+				t.Errorf("Expected X-Original-URI %q, got %q", tt.requestURI, upstreamRequest.Header.Get("X-Original-URI"))
+			}
+
+			if upstreamRequest.Header.Get("X-Forwarded-Prefix") != tt.expectedForwardedPrefix {
+				t.Errorf("Expected X-Forwarded-Prefix %q, got %q", tt.expectedForwardedPrefix, upstreamRequest.Header.Get("X-Forwarded-Prefix"))
+			}
+
+			if r := httptest.NewRequest("GET", tt.requestURI, nil); originalPath != r.URL.Path {
+				t.Errorf("Expected outer request to keep path %q, got %q", r.URL.Path, originalPath)
+			}
+
+			if len(originalHeader) != 0 {
+				t.Errorf("Expected outer request to keep its headers, got %v", originalHeader)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/hvuhsg/gatego/internal/errorpages"
 )
 
 // NewRequestSizeLimitMiddleware limits the size of the request body to the specified limit in bytes.
@@ -20,18 +22,22 @@ func NewRequestSizeLimitMiddleware(maxSize uint64) func(http.Handler) http.Handl
 
 			// Check for errors
 			if err != nil {
-				http.Error(w, "Error reading request body", http.StatusInternalServerError)
+				errorpages.Error(w, r, "Error reading request body", http.StatusInternalServerError)
 				return
 			}
 
 			// Check if we exceeded the maximum size
 			if buf.Len() > int(maxSize) {
-				http.Error(w, fmt.Sprintf("Request body too large. Maximum allowed size is %d bytes.", maxSize), http.StatusRequestEntityTooLarge)
+				errorpages.Error(w, r, fmt.Sprintf("Request body too large. Maximum allowed size is %d bytes.", maxSize), http.StatusRequestEntityTooLarge)
 				return
 			}
 
-			// Restore the request body for further processing
-			r.Body = io.NopCloser(bytes.NewReader(buf.Bytes()))
+			// Restore the request body for further processing (replayable for retries)
+			body := buf.Bytes()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
 
 			// Proceed to the next handler
 			next.ServeHTTP(w, r)
@@ -2,6 +2,7 @@ package middlewares_test
 
 import (
 	"bytes"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -70,3 +71,23 @@ func TestRequestSizeLimitMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestSizeLimitMiddlewareReplayableBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://example.com", bytes.NewReader([]byte("payload")))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+
+		if r.GetBody == nil {
+			t.Fatal("Expected the request body to be replayable")
+		}
+
+		body, _ := r.GetBody()
+		replayed, _ := io.ReadAll(body)
+		if string(replayed) != "payload" {
+			t.Errorf("replayed body got %q want %q", replayed, "payload")
+		}
+	})
+
+	middlewares.NewRequestSizeLimitMiddleware(30)(handler).ServeHTTP(httptest.NewRecorder(), req)
+}
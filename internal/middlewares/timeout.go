@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/hvuhsg/gatego/internal/errorpages"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -37,7 +38,7 @@ func NewTimeoutMiddleware(timeout time.Duration) func(next http.Handler) http.Ha
 				// If the context is canceled (due to timeout), return an error response
 				if ctx.Err() == context.DeadlineExceeded {
 					span.AddEvent("Request timed out")
-					http.Error(w, "Request timed out", http.StatusGatewayTimeout)
+					errorpages.Error(w, r, "Request timed out", http.StatusGatewayTimeout)
 				}
 			case <-done:
 				// If the request finished within the timeout, return the result
@@ -0,0 +1,76 @@
+package streams
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "stream"
+
+// metrics report connection metrics through the global OpenTelemetry meter provider
+// (no-op when OpenTelemetry is not configured)
+type metrics struct {
+	attributes        []attribute.KeyValue
+	connections       metric.Int64Counter
+	activeConnections metric.Int64UpDownCounter
+	bytes             metric.Int64Counter
+	duration          metric.Float64Histogram
+}
+
+func newMetrics(streamName string, protocol string) (*metrics, error) {
+	meter := otel.GetMeterProvider().Meter(meterName)
+
+	connections, err := meter.Int64Counter("gatego.stream.connections", metric.WithDescription("Number of proxied connections (sessions for udp)"))
+	if err != nil {
+		return nil, err
+	}
+
+	activeConnections, err := meter.Int64UpDownCounter("gatego.stream.active_connections", metric.WithDescription("Number of open connections (sessions for udp)"))
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := meter.Int64Counter("gatego.stream.bytes", metric.WithDescription("Number of proxied bytes"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := meter.Float64Histogram("gatego.stream.duration", metric.WithDescription("Connection duration"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &metrics{
+		attributes: []attribute.KeyValue{
+			attribute.String("stream.name", streamName),
+			attribute.String("stream.protocol", protocol),
+		},
+		connections:       connections,
+		activeConnections: activeConnections,
+		bytes:             bytes,
+		duration:          duration,
+	}, nil
+}
+
+func (m *metrics) connectionOpened() {
+	m.activeConnections.Add(context.Background(), 1, metric.WithAttributes(m.attributes...))
+}
+
+func (m *metrics) connectionClosed(upstream string, status int, bytesSent int64, bytesReceived int64, duration time.Duration) {
+	ctx := context.Background()
+	attrs := append([]attribute.KeyValue{
+		attribute.String("stream.upstream", upstream),
+		attribute.Int("stream.status", status),
+	}, m.attributes...)
+
+	m.activeConnections.Add(ctx, -1, metric.WithAttributes(m.attributes...))
+	m.connections.Add(ctx, 1, metric.WithAttributes(attrs...))
+	m.bytes.Add(ctx, bytesSent, metric.WithAttributes(slices.Concat(attrs, []attribute.KeyValue{attribute.String("direction", "sent")})...))
+	m.bytes.Add(ctx, bytesReceived, metric.WithAttributes(slices.Concat(attrs, []attribute.KeyValue{attribute.String("direction", "received")})...))
+	m.duration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+}
@@ -0,0 +1,263 @@
+// Package streams implement layer 4 (tcp / udp) proxying of connections
+// to backend pools using the same balance policies as the http backends.
+package streams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/handlers"
+)
+
+const dialTimeout = time.Second * 5
+const sniPeekTimeout = time.Second * 5
+
+var ErrNoRoute = errors.New("no backend matches the connection")
+var ErrNoServers = errors.New("no backend servers available")
+
+type Proxy struct {
+	name        string
+	protocol    string
+	listen      string
+	idleTimeout time.Duration
+
+	defaultPool *pool
+	sniRoutes   map[string]*pool // server name (or *.domain) to pool
+
+	metrics *metrics
+	out     io.Writer
+
+	mu         sync.Mutex
+	closed     bool
+	listener   net.Listener
+	packetConn net.PacketConn
+	conns      map[net.Conn]struct{} // Open client and upstream connections
+}
+
+func New(ctx context.Context, stream config.Stream, instance handlers.Instance, out io.Writer) (*Proxy, error) {
+	protocol := stream.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	idleTimeout := stream.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = config.DefaultStreamIdleTimeout
+	}
+
+	metrics, err := newMetrics(stream.Name, protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := &Proxy{
+		name:        stream.Name,
+		protocol:    protocol,
+		listen:      stream.Listen,
+		idleTimeout: idleTimeout,
+		sniRoutes:   make(map[string]*pool),
+		metrics:     metrics,
+		out:         out,
+		conns:       make(map[net.Conn]struct{}),
+	}
+
+	if stream.Backend != nil {
+		proxy.defaultPool, err = newPool(ctx, stream.Name, *stream.Backend, instance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, route := range stream.SNI {
+		routePool, err := newPool(ctx, SNIBackendName(stream, route), route.Backend, instance)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, serverName := range route.ServerNames {
+			proxy.sniRoutes[strings.ToLower(serverName)] = routePool
+		}
+	}
+
+	return proxy, nil
+}
+
+func (p *Proxy) Name() string {
+	return p.name
+}
+
+// Listen bind the listen address, call Serve to start accepting connections
+func (p *Proxy) Listen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	if p.protocol == "udp" {
+		p.packetConn, err = net.ListenPacket("udp", p.listen)
+	} else {
+		p.listener, err = net.Listen("tcp", p.listen)
+	}
+
+	return err
+}
+
+// Addr return the bound address (nil before Listen)
+func (p *Proxy) Addr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.packetConn != nil {
+		return p.packetConn.LocalAddr()
+	}
+
+	if p.listener != nil {
+		return p.listener.Addr()
+	}
+
+	return nil
+}
+
+// Serve block until the proxy is closed or the listener fails
+func (p *Proxy) Serve() error {
+	p.mu.Lock()
+	listener, packetConn := p.listener, p.packetConn
+	p.mu.Unlock()
+
+	if packetConn != nil {
+		return p.serveUDP(packetConn)
+	}
+
+	if listener != nil {
+		return p.serveTCP(listener)
+	}
+
+	return fmt.Errorf("stream '%s' is not listening", p.name)
+}
+
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	var err error
+	if p.listener != nil {
+		err = errors.Join(err, p.listener.Close())
+	}
+
+	if p.packetConn != nil {
+		err = errors.Join(err, p.packetConn.Close())
+	}
+
+	for conn := range p.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (p *Proxy) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+func (p *Proxy) trackConn(conn net.Conn, add bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if add {
+		p.conns[conn] = struct{}{}
+	} else {
+		delete(p.conns, conn)
+	}
+}
+
+// route return the pool for the tls server name, the most specific match wins
+func (p *Proxy) route(serverName string) *pool {
+	serverName = strings.ToLower(serverName)
+
+	if routePool, exists := p.sniRoutes[serverName]; exists {
+		return routePool
+	}
+
+	labels := strings.Split(serverName, ".")
+	for i := 1; i < len(labels); i++ {
+		wildcard := "*." + strings.Join(labels[i:], ".")
+		if routePool, exists := p.sniRoutes[wildcard]; exists {
+			return routePool
+		}
+	}
+
+	return p.defaultPool
+}
+
+func (p *Proxy) logConnection(remoteAddr string, status int, bytesSent int64, bytesReceived int64, duration time.Duration, upstream string) {
+	date := time.Now().Format("2006-01-02 15:04:05")
+	protocol := strings.ToUpper(p.protocol)
+
+	// Same fields as the nginx stream module log
+	fmt.Fprintf(p.out, "%s [%s] %s %s %d %d %d %.3f \"%s\"\n", remoteAddr, date, p.name, protocol, status, bytesSent, bytesReceived, duration.Seconds(), upstream)
+}
+
+type pool struct {
+	servers *handlers.Pool
+	hash    bool // Hash the client ip (hash policy)
+}
+
+// SNIBackendName identify the backend of a sni route in the health state (the default backend is the stream name)
+func SNIBackendName(stream config.Stream, route config.SNIRoute) string {
+	return stream.Name + "#" + route.ServerNames[0]
+}
+
+func newPool(ctx context.Context, name string, backend config.Backend, instance handlers.Instance) (*pool, error) {
+	servers, err := handlers.NewPool(ctx, name, backend, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pool{servers: servers, hash: backend.BalancePolicy == "hash"}, nil
+}
+
+// dial open a connection to the next server of the pool for the client, done must be called when the connection is closed
+func (p *pool) dial(network string, clientAddr net.Addr) (net.Conn, string, func(), error) {
+	request := handlers.PickRequest{}
+	if p.hash {
+		ip, _, err := net.SplitHostPort(clientAddr.String())
+		if err != nil {
+			ip = clientAddr.String()
+		}
+		request.HashKey = "ip:" + ip
+	}
+
+	pick, ok := p.servers.Pick(request)
+	if !ok {
+		return nil, "", func() {}, ErrNoServers
+	}
+
+	serverURL, err := url.Parse(pick.URL())
+	if err != nil {
+		pick.Done(handlers.Outcome{Err: err})
+		return nil, pick.URL(), func() {}, err
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout(network, serverURL.Host, dialTimeout)
+	outcome := handlers.Outcome{Latency: time.Since(start), Err: err}
+
+	if err != nil {
+		pick.Done(outcome)
+		return nil, pick.URL(), func() {}, err
+	}
+
+	return conn, pick.URL(), func() { pick.Done(outcome) }, nil
+}
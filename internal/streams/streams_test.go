@@ -0,0 +1,368 @@
+package streams
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/handlers"
+)
+
+func TestTCPProxyRoundRobin(t *testing.T) {
+	backend1 := startTCPBackend(t, nil, "backend1")
+	backend2 := startTCPBackend(t, nil, "backend2")
+
+	proxy := startProxy(t, config.Stream{
+		Name:   "test",
+		Listen: "127.0.0.1:0",
+		Backend: &config.Backend{
+			BalancePolicy: "round-robin",
+			Servers:       backendServers("tcp", backend1, backend2),
+		},
+	})
+
+	expected := []string{"backend1", "backend2", "backend1"}
+	for i, want := range expected {
+		conn, err := net.Dial("tcp", proxy.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect to proxy: %v", err)
+		}
+
+		got := exchangeLine(t, conn, "hello")
+		conn.Close()
+
+		if got != want+": hello" {
+			t.Errorf("index = %d Expected response from %s, got %q", i, want, got)
+		}
+	}
+}
+
+func TestTCPProxyConcurrentConnections(t *testing.T) {
+	backend1 := startTCPBackend(t, nil, "backend")
+	backend2 := startTCPBackend(t, nil, "backend")
+
+	proxy := startProxy(t, config.Stream{
+		Name:   "test",
+		Listen: "127.0.0.1:0",
+		Backend: &config.Backend{
+			BalancePolicy: "least-latency",
+			Servers:       backendServers("tcp", backend1, backend2),
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := net.Dial("tcp", proxy.Addr().String())
+			if err != nil {
+				t.Errorf("Failed to connect to proxy: %v", err)
+				return
+			}
+			defer conn.Close()
+
+			// exchangeLine can't fail the test outside of the test goroutine
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+			io.WriteString(conn, "hello\n")
+			if got, err := bufio.NewReader(conn).ReadString('\n'); err != nil || got != "backend: hello\n" {
+				t.Errorf("Expected a response from a backend, got %q (error %v)", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTCPProxySNIRouting(t *testing.T) {
+	tlsConfig := selfSignedTLSConfig(t)
+	apiBackend := startTCPBackend(t, tlsConfig, "api")
+	wildcardBackend := startTCPBackend(t, tlsConfig, "wildcard")
+	defaultBackend := startTCPBackend(t, tlsConfig, "default")
+
+	proxy := startProxy(t, config.Stream{
+		Name:   "test",
+		Listen: "127.0.0.1:0",
+		Backend: &config.Backend{
+			BalancePolicy: "round-robin",
+			Servers:       backendServers("tcp", defaultBackend),
+		},
+		SNI: []config.SNIRoute{
+			{ServerNames: []string{"api.example.com"}, Backend: config.Backend{BalancePolicy: "random", Servers: backendServers("tcp", apiBackend)}},
+			{ServerNames: []string{"*.example.com"}, Backend: config.Backend{BalancePolicy: "random", Servers: backendServers("tcp", wildcardBackend)}},
+		},
+	})
+
+	tests := []struct {
+		serverName string
+		expected   string
+	}{
+		{"api.example.com", "api"},
+		{"API.EXAMPLE.COM", "api"},
+		{"db.example.com", "wildcard"},
+		{"deep.db.example.com", "wildcard"},
+		{"other.org", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			conn, err := tls.Dial("tcp", proxy.Addr().String(), &tls.Config{ServerName: tt.serverName, InsecureSkipVerify: true})
+			if err != nil {
+				t.Fatalf("TLS handshake through proxy failed: %v", err)
+			}
+			defer conn.Close()
+
+			got := exchangeLine(t, conn, "hello")
+			if got != tt.expected+": hello" {
+				t.Errorf("Expected response from %s, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTCPProxyIdleTimeout(t *testing.T) {
+	backend := startTCPBackend(t, nil, "backend")
+
+	proxy := startProxy(t, config.Stream{
+		Name:        "test",
+		Listen:      "127.0.0.1:0",
+		IdleTimeout: 100 * time.Millisecond,
+		Backend: &config.Backend{
+			BalancePolicy: "round-robin",
+			Servers:       backendServers("tcp", backend),
+		},
+	})
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("Expected connection to be closed by the proxy, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("Idle connection was closed after %s", time.Since(start))
+	}
+}
+
+func TestTCPProxyUpstreamDown(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadAddr := listener.Addr().String()
+	listener.Close()
+
+	proxy := startProxy(t, config.Stream{
+		Name:   "test",
+		Listen: "127.0.0.1:0",
+		Backend: &config.Backend{
+			BalancePolicy: "round-robin",
+			Servers:       backendServers("tcp", deadAddr),
+		},
+	})
+
+	conn, err := net.Dial("tcp", proxy.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected connection to be closed when upstream is down, got %v", err)
+	}
+}
+
+func TestUDPProxy(t *testing.T) {
+	backend, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := backend.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			backend.WriteTo(append([]byte("echo: "), buf[:n]...), addr)
+		}
+	}()
+
+	proxy := startProxy(t, config.Stream{
+		Name:     "test",
+		Protocol: "udp",
+		Listen:   "127.0.0.1:0",
+		Backend: &config.Backend{
+			BalancePolicy: "round-robin",
+			Servers:       backendServers("udp", backend.LocalAddr().String()),
+		},
+	})
+
+	conn, err := net.Dial("udp", proxy.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, message := range []string{"ping", "pong"} {
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+
+		if string(buf[:n]) != "echo: "+message {
+			t.Errorf("Expected %q, got %q", "echo: "+message, string(buf[:n]))
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	exact, wildcard, fallback := &pool{}, &pool{}, &pool{}
+	proxy := &Proxy{
+		defaultPool: fallback,
+		sniRoutes:   map[string]*pool{"api.example.com": exact, "*.example.com": wildcard},
+	}
+
+	tests := []struct {
+		serverName string
+		expected   *pool
+	}{
+		{"api.example.com", exact},
+		{"web.example.com", wildcard},
+		{"a.b.example.com", wildcard},
+		{"example.com", fallback},
+		{"", fallback},
+	}
+
+	for _, tt := range tests {
+		if got := proxy.route(tt.serverName); got != tt.expected {
+			t.Errorf("route(%q) returned the wrong pool", tt.serverName)
+		}
+	}
+}
+
+// Helper function to create, listen and serve a stream proxy
+func startProxy(t *testing.T, stream config.Stream) *Proxy {
+	t.Helper()
+
+	proxy, err := New(context.Background(), stream, handlers.Instance{}, io.Discard)
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+
+	if err := proxy.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	go proxy.Serve()
+	t.Cleanup(func() { proxy.Close() })
+
+	return proxy
+}
+
+// Helper function to start a line based backend that prefix every line with its name
+func startTCPBackend(t *testing.T, tlsConfig *tls.Config, name string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					io.WriteString(conn, name+": "+scanner.Text()+"\n")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func exchangeLine(t *testing.T, conn net.Conn, line string) string {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	return strings.TrimSuffix(response, "\n")
+}
+
+func backendServers(scheme string, addrs ...string) []config.BackendServer {
+	servers := make([]config.BackendServer, 0, len(addrs))
+
+	for _, addr := range addrs {
+		servers = append(servers, config.BackendServer{URL: scheme + "://" + addr, Weight: 1})
+	}
+
+	return servers
+}
+
+func selfSignedTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"*.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{certDER}, PrivateKey: key}}}
+}
@@ -0,0 +1,156 @@
+package streams
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func (p *Proxy) serveTCP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if p.isClosed() {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			return err
+		}
+
+		go p.handleTCP(conn)
+	}
+}
+
+func (p *Proxy) handleTCP(clientConn net.Conn) {
+	start := time.Now()
+	p.metrics.connectionOpened()
+	p.trackConn(clientConn, true)
+	defer p.trackConn(clientConn, false)
+	defer clientConn.Close()
+
+	var clientReader io.Reader = clientConn
+	connPool := p.defaultPool
+
+	// Route tls passthrough connections by the server name of the client hello
+	if len(p.sniRoutes) > 0 {
+		clientConn.SetReadDeadline(time.Now().Add(sniPeekTimeout))
+		hello, reader, err := peekClientHello(clientConn)
+		clientConn.SetReadDeadline(time.Time{})
+
+		clientReader = reader
+		if err == nil {
+			connPool = p.route(hello.ServerName)
+		}
+	}
+
+	if connPool == nil {
+		log.Default().Printf("Stream <%s> %s from %s\n", p.name, ErrNoRoute, clientConn.RemoteAddr())
+		p.finishTCP(clientConn, http.StatusForbidden, 0, 0, start, "")
+		return
+	}
+
+	upstreamConn, upstream, done, err := connPool.dial("tcp", clientConn.RemoteAddr())
+	if err != nil {
+		log.Default().Printf("Stream <%s> error connecting to upstream %s Error=%s\n", p.name, upstream, err.Error())
+		p.finishTCP(clientConn, http.StatusBadGateway, 0, 0, start, upstream)
+		return
+	}
+	defer done()
+	p.trackConn(upstreamConn, true)
+	defer p.trackConn(upstreamConn, false)
+	defer upstreamConn.Close()
+
+	session := &tcpSession{idleTimeout: p.idleTimeout}
+	session.touch()
+
+	var bytesSent, bytesReceived atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		session.pipe(upstreamConn, clientReader, clientConn, &bytesReceived)
+	}()
+
+	go func() {
+		defer wg.Done()
+		session.pipe(clientConn, upstreamConn, upstreamConn, &bytesSent)
+	}()
+
+	wg.Wait()
+
+	p.finishTCP(clientConn, http.StatusOK, bytesSent.Load(), bytesReceived.Load(), start, upstream)
+}
+
+func (p *Proxy) finishTCP(clientConn net.Conn, status int, bytesSent int64, bytesReceived int64, start time.Time, upstream string) {
+	duration := time.Since(start)
+	p.metrics.connectionClosed(upstream, status, bytesSent, bytesReceived, duration)
+	p.logConnection(clientConn.RemoteAddr().String(), status, bytesSent, bytesReceived, duration, upstream)
+}
+
+// tcpSession close both directions after idleTimeout without traffic in any direction
+type tcpSession struct {
+	idleTimeout  time.Duration
+	lastActivity atomic.Int64 // unix nano
+}
+
+func (s *tcpSession) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *tcpSession) deadline() time.Time {
+	return time.Unix(0, s.lastActivity.Load()).Add(s.idleTimeout)
+}
+
+// pipe copy src into dst, src is read from srcConn (may replay peeked bytes first)
+func (s *tcpSession) pipe(dst net.Conn, src io.Reader, srcConn net.Conn, counter *atomic.Int64) {
+	buf := make([]byte, 32*1024)
+
+	for {
+		srcConn.SetReadDeadline(s.deadline())
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			s.touch()
+			if _, err := dst.Write(buf[:n]); err != nil {
+				dst.Close()
+				srcConn.Close()
+				return
+			}
+			counter.Add(int64(n))
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// The deadline may have passed while the other direction was active
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && time.Now().Before(s.deadline()) {
+			continue
+		}
+
+		if errors.Is(err, io.EOF) {
+			// Half close, let the other direction finish
+			if tcpConn, ok := dst.(interface{ CloseWrite() error }); ok {
+				tcpConn.CloseWrite()
+				return
+			}
+		}
+
+		// Idle timeout or broken connection, stop both directions
+		dst.Close()
+		srcConn.Close()
+		return
+	}
+}
@@ -0,0 +1,138 @@
+package streams
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const maxDatagramSize = 64 * 1024
+
+// udpSession is the upstream "connection" of a single client address
+type udpSession struct {
+	clientAddr    net.Addr
+	upstreamConn  net.Conn
+	upstream      string
+	start         time.Time
+	lastActivity  atomic.Int64 // unix nano
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+}
+
+func (s *udpSession) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (p *Proxy) serveUDP(packetConn net.PacketConn) error {
+	var sessions sync.Map // client address to *udpSession
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, clientAddr, err := packetConn.ReadFrom(buf)
+		if err != nil {
+			if p.isClosed() {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			return err
+		}
+
+		sessionAny, exists := sessions.Load(clientAddr.String())
+		if !exists {
+			session, err := p.newUDPSession(packetConn, clientAddr, func() { sessions.Delete(clientAddr.String()) })
+			if err != nil {
+				continue
+			}
+			sessions.Store(clientAddr.String(), session)
+			sessionAny = session
+		}
+
+		session := sessionAny.(*udpSession)
+		session.touch()
+		if _, err := session.upstreamConn.Write(buf[:n]); err == nil {
+			session.bytesReceived.Add(int64(n))
+		}
+	}
+}
+
+func (p *Proxy) newUDPSession(packetConn net.PacketConn, clientAddr net.Addr, onClose func()) (*udpSession, error) {
+	start := time.Now()
+	p.metrics.connectionOpened()
+
+	if p.defaultPool == nil {
+		p.finishUDP(clientAddr.String(), http.StatusForbidden, 0, 0, start, "")
+		return nil, ErrNoRoute
+	}
+
+	upstreamConn, upstream, done, err := p.defaultPool.dial("udp", clientAddr)
+	if err != nil {
+		log.Default().Printf("Stream <%s> error connecting to upstream %s Error=%s\n", p.name, upstream, err.Error())
+		p.finishUDP(clientAddr.String(), http.StatusBadGateway, 0, 0, start, upstream)
+		return nil, err
+	}
+	p.trackConn(upstreamConn, true)
+
+	session := &udpSession{clientAddr: clientAddr, upstreamConn: upstreamConn, upstream: upstream, start: start}
+	session.touch()
+
+	go func() {
+		defer done()
+		defer p.trackConn(upstreamConn, false)
+		defer upstreamConn.Close()
+		defer onClose()
+
+		p.relayReplies(packetConn, session)
+		p.finishUDP(clientAddr.String(), http.StatusOK, session.bytesSent.Load(), session.bytesReceived.Load(), session.start, session.upstream)
+	}()
+
+	return session, nil
+}
+
+// relayReplies send upstream datagrams back to the client until the session is idle
+func (p *Proxy) relayReplies(packetConn net.PacketConn, session *udpSession) {
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		deadline := time.Unix(0, session.lastActivity.Load()).Add(p.idleTimeout)
+		session.upstreamConn.SetReadDeadline(deadline)
+
+		n, err := session.upstreamConn.Read(buf)
+		if n > 0 {
+			session.touch()
+			if _, err := packetConn.WriteTo(buf[:n], session.clientAddr); err == nil {
+				session.bytesSent.Add(int64(n))
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// The client may have sent datagrams since the deadline was set
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && time.Now().Before(time.Unix(0, session.lastActivity.Load()).Add(p.idleTimeout)) {
+			continue
+		}
+
+		// udp "connection refused" errors are reported on read, keep the session until it is idle
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return
+		}
+	}
+}
+
+func (p *Proxy) finishUDP(clientAddr string, status int, bytesSent int64, bytesReceived int64, start time.Time, upstream string) {
+	duration := time.Since(start)
+	p.metrics.connectionClosed(upstream, status, bytesSent, bytesReceived, duration)
+	p.logConnection(clientAddr, status, bytesSent, bytesReceived, duration, upstream)
+}
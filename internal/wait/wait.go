@@ -0,0 +1,21 @@
+// This package hold the waits of the background watchers (the retry after a failed watch or poll)
+
+package wait
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep wait for the duration, false when ctx is done first
+func Sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -3,9 +3,12 @@ package monitor
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,9 +23,16 @@ type Check struct {
 	Timeout   time.Duration
 	Headers   map[string]string
 	OnFailure string
+	Interval  time.Duration   // Run every interval instead of by the cron expression
+	OnResult  func(err error) // Called after every run, err is nil when the check passed
 }
 
-func (c Check) run(onFailure func(error)) func() {
+// run return the check job, report is called with the result of each run (nil on success)
+func (c Check) run(report func(error)) func() {
+	if strings.HasPrefix(c.URL, "tcp://") {
+		return c.runTCP(report)
+	}
+
 	return func() {
 		// Create a client with timeout
 		client := &http.Client{
@@ -33,7 +43,7 @@ func (c Check) run(onFailure func(error)) func() {
 		req, err := http.NewRequest(c.Method, c.URL, nil)
 		if err != nil {
 			log.Default().Printf("Check <%s> error creating check request URL=%s Method=%s\n", c.Name, c.URL, c.Method)
-			onFailure(err)
+			report(err)
 			return
 		}
 
@@ -46,7 +56,7 @@ func (c Check) run(onFailure func(error)) func() {
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Default().Printf("Check <%s> error sending request Error=%s\n", c.Name, err.Error())
-			onFailure(err)
+			report(err)
 			return
 		}
 		defer resp.Body.Close()
@@ -54,19 +64,48 @@ func (c Check) run(onFailure func(error)) func() {
 		// Check status code
 		if resp.StatusCode != http.StatusOK {
 			log.Default().Printf("Check <%s> failed. Expected status code 200 got %d\n", c.Name, resp.StatusCode)
-			onFailure(fmt.Errorf("expected status code 200 got %d", resp.StatusCode))
+			report(fmt.Errorf("expected status code 200 got %d", resp.StatusCode))
 			return
 		}
+
+		report(nil)
+	}
+}
+
+// runTCP only checks that a connection can be opened (used for layer 4 streams)
+func (c Check) runTCP(report func(error)) func() {
+	return func() {
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(c.URL, "tcp://"), c.Timeout)
+		if err != nil {
+			log.Default().Printf("Check <%s> error opening connection Error=%s\n", c.Name, err.Error())
+			report(err)
+			return
+		}
+		conn.Close()
+
+		report(nil)
 	}
 }
 
 func handleFailure(check Check, err error) error {
+	return RunHook(check.OnFailure, map[string]string{"error": err.Error(), "check_name": check.Name})
+}
+
+// RunHook start the command (without waiting for it) after expanding $date and the $name variables
+func RunHook(command string, variables map[string]string) error {
 	// Expand command
-	command := check.OnFailure
 	date := time.Now().UTC().Format("2006-01-02 15:04:05")
 	command = strings.ReplaceAll(command, "$date", date)
-	command = strings.ReplaceAll(command, "$error", err.Error())
-	command = strings.ReplaceAll(command, "$check_name", check.Name)
+
+	// Longer names first so $name doesn't replace the prefix of $name_suffix
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int { return len(b) - len(a) })
+	for _, name := range names {
+		command = strings.ReplaceAll(command, "$"+name, variables[name])
+	}
 
 	// Run it
 	args := strings.Split(command, " ")
@@ -81,33 +120,99 @@ type Monitor struct {
 	Delay     time.Duration
 	Checks    []Check
 	scheduler *cron.Cron
+	stop      chan struct{} // Closed by Stop, nil for monitors not created by New (they run until the process exits)
+	stopOnce  *sync.Once
 }
 
 func New(delay time.Duration, checks ...Check) *Monitor {
-	return &Monitor{Delay: delay, Checks: checks, scheduler: cron.New()}
+	return &Monitor{Delay: delay, Checks: checks, scheduler: cron.New(), stop: make(chan struct{}), stopOnce: &sync.Once{}}
 }
 
 func (m Monitor) Start() error {
 	m.scheduler = cron.New()
 
+	intervalChecks := make([]Check, 0)
 	for _, check := range m.Checks {
-		err := m.scheduler.Add(uuid.NewString(), check.Cron, check.run(func(err error) {
-			if check.OnFailure != "" {
-				if err := handleFailure(check, err); err != nil {
-					log.Default().Printf("Failed to spawn on_failure command: %s\n", err)
-				}
-			}
-		}))
-		if err != nil {
+		if check.Interval > 0 {
+			intervalChecks = append(intervalChecks, check)
+			continue
+		}
+
+		if err := m.scheduler.Add(uuid.NewString(), check.Cron, check.run(reporter(check))); err != nil {
 			return err
 		}
 	}
 
+	scheduler, stop := m.scheduler, m.stop
 	go func() {
-		time.Sleep(m.Delay)
-		m.scheduler.Start()
+		delay := time.NewTimer(m.Delay)
+		defer delay.Stop()
+
+		select {
+		case <-delay.C:
+		case <-stop:
+			return
+		}
+
+		// Both are ready when the monitor was stopped before the delay ended
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		scheduler.Start()
+
+		for _, check := range intervalChecks {
+			go runEvery(check.Interval, check.run(reporter(check)), stop)
+		}
+
 		log.Default().Println("Started running automated checks.")
+
+		<-stop
+		scheduler.Stop()
 	}()
 
 	return nil
 }
+
+// Stop end the checks of the monitor, the running checks complete. A monitor stopped before it starts never runs its checks,
+// stopping again (or a monitor not created by New) does nothing
+func (m *Monitor) Stop() {
+	if m.stop == nil {
+		return
+	}
+
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// reporter pass the check results to OnResult and run the on_failure command on failures
+func reporter(check Check) func(error) {
+	return func(err error) {
+		if check.OnResult != nil {
+			check.OnResult(err)
+		}
+
+		if err != nil && check.OnFailure != "" {
+			if err := handleFailure(check, err); err != nil {
+				log.Default().Printf("Failed to spawn on_failure command: %s\n", err)
+			}
+		}
+	}
+}
+
+// runEvery run the job now and then every interval until stop is closed
+func runEvery(interval time.Duration, job func(), stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -2,8 +2,10 @@ package monitor
 
 import (
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -231,3 +233,160 @@ func TestCheckWithMockServer(t *testing.T) {
 
 	check.run(func(error) {})
 }
+
+func TestTCPCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := Check{
+		Name:    "tcp-check",
+		URL:     "tcp://" + listener.Addr().String(),
+		Timeout: time.Second,
+	}
+
+	var checkErr error
+	check.run(func(err error) { checkErr = err })()
+	if checkErr != nil {
+		t.Errorf("Expected tcp check to succeed, got %v", checkErr)
+	}
+
+	listener.Close()
+
+	check.run(func(err error) { checkErr = err })()
+	if checkErr == nil {
+		t.Error("Expected tcp check to fail after listener is closed")
+	}
+}
+
+func TestCheckResult(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	check := Check{Name: "result-check", Method: "GET", URL: server.URL, Timeout: time.Second}
+
+	results := make(chan error, 1)
+	check.OnResult = func(err error) { results <- err }
+	job := check.run(reporter(check))
+
+	job()
+	if err := <-results; err != nil {
+		t.Errorf("Expected a nil result for a passing check, got %v", err)
+	}
+
+	status.Store(http.StatusServiceUnavailable)
+	job()
+	if err := <-results; err == nil {
+		t.Error("Expected an error result for a failing check")
+	}
+}
+
+func TestIntervalCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	results := make(chan error, 10)
+	checker := New(0, Check{
+		Name:     "interval-check",
+		Method:   "GET",
+		URL:      server.URL,
+		Timeout:  time.Second,
+		Interval: 10 * time.Millisecond,
+		OnResult: func(err error) {
+			select {
+			case results <- err:
+			default:
+			}
+		},
+	})
+
+	if err := checker.Start(); err != nil {
+		t.Fatalf("Checker.Start() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Errorf("Expected the check to pass, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the interval check to run twice")
+		}
+	}
+}
+
+func TestStop(t *testing.T) {
+	var runs atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	results := make(chan error, 10)
+	checker := New(0, Check{
+		Name:     "interval-check",
+		Method:   "GET",
+		URL:      server.URL,
+		Timeout:  time.Second,
+		Interval: 10 * time.Millisecond,
+		OnResult: func(err error) {
+			select {
+			case results <- err:
+			default:
+			}
+		},
+	})
+
+	if err := checker.Start(); err != nil {
+		t.Fatalf("Checker.Start() error = %v", err)
+	}
+
+	select {
+	case <-results:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the interval check to run")
+	}
+
+	checker.Stop()
+	time.Sleep(50 * time.Millisecond)
+	stopped := runs.Load()
+
+	time.Sleep(100 * time.Millisecond)
+	if after := runs.Load(); after != stopped {
+		t.Errorf("Expected no runs after Stop, got %d more", after-stopped)
+	}
+}
+
+func TestStopIdempotent(t *testing.T) {
+	var runs atomic.Int32
+	checker := New(0, Check{
+		Name:     "interval-check",
+		Interval: 10 * time.Millisecond,
+		OnResult: func(err error) { runs.Add(1) },
+	})
+
+	// Stopped before it starts and stopped again
+	checker.Stop()
+	checker.Stop()
+
+	if err := checker.Start(); err != nil {
+		t.Fatalf("Checker.Start() error = %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := runs.Load(); got != 0 {
+		t.Errorf("Expected a stopped monitor to not run its checks, got %d runs", got)
+	}
+
+	var notCreatedByNew Monitor
+	notCreatedByNew.Stop()
+}
@@ -0,0 +1,168 @@
+package multimux
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RequestMatcher select a route by request properties other than host and path.
+// A nil or empty matcher matches every request.
+type RequestMatcher struct {
+	Methods []string
+	Headers []ValueMatcher
+	Query   []ValueMatcher
+	Cookies []ValueMatcher
+}
+
+// ValueMatcher match a single named value (header, query parameter or cookie).
+// Exactly one of Exact, Regex and Present should be set.
+type ValueMatcher struct {
+	Name    string
+	Exact   *string
+	Regex   *regexp.Regexp
+	Present *bool // false means the value must be absent
+}
+
+func (m *RequestMatcher) Match(r *http.Request) bool {
+	return m.MatchMethod(r) && m.matchValues(r)
+}
+
+func (m *RequestMatcher) MatchMethod(r *http.Request) bool {
+	if m == nil || len(m.Methods) == 0 {
+		return true
+	}
+
+	return slices.Contains(m.Methods, r.Method) || (r.Method == http.MethodHead && slices.Contains(m.Methods, http.MethodGet))
+}
+
+func (m *RequestMatcher) matchValues(r *http.Request) bool {
+	if m == nil {
+		return true
+	}
+
+	for _, header := range m.Headers {
+		values, exists := r.Header[http.CanonicalHeaderKey(header.Name)]
+		if !header.match(values, exists) {
+			return false
+		}
+	}
+
+	query := r.URL.Query()
+	for _, param := range m.Query {
+		values, exists := query[param.Name]
+		if !param.match(values, exists) {
+			return false
+		}
+	}
+
+	for _, cookieMatcher := range m.Cookies {
+		values := []string{}
+		for _, cookie := range r.Cookies() {
+			if cookie.Name == cookieMatcher.Name {
+				values = append(values, cookie.Value)
+			}
+		}
+
+		if !cookieMatcher.match(values, len(values) > 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Specificity is the number of predicates, routes with more predicates are tried first
+func (m *RequestMatcher) Specificity() int {
+	if m == nil {
+		return 0
+	}
+
+	specificity := len(m.Headers) + len(m.Query) + len(m.Cookies)
+	if len(m.Methods) > 0 {
+		specificity++
+	}
+
+	return specificity
+}
+
+func (vm ValueMatcher) match(values []string, exists bool) bool {
+	if vm.Present != nil {
+		return *vm.Present == exists
+	}
+
+	for _, value := range values {
+		if vm.Exact != nil && value == *vm.Exact {
+			return true
+		}
+
+		if vm.Regex != nil && vm.Regex.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// route group holds every route registered with the same host and path pattern
+type routeGroup struct {
+	routes  []route
+	onError func(w http.ResponseWriter, r *http.Request, status int)
+}
+
+type route struct {
+	matcher *RequestMatcher
+	handler http.Handler
+}
+
+// add keep the routes sorted by specificity, routes with the same specificity keep registration order
+func (g *routeGroup) add(matcher *RequestMatcher, handler http.Handler) {
+	index := len(g.routes)
+	for i, existing := range g.routes {
+		if existing.matcher.Specificity() < matcher.Specificity() {
+			index = i
+			break
+		}
+	}
+
+	g.routes = slices.Insert(g.routes, index, route{matcher: matcher, handler: handler})
+}
+
+func (g *routeGroup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	methodMismatch := false
+	allowedMethods := []string{}
+
+	for _, route := range g.routes {
+		if !route.matcher.matchValues(r) {
+			continue
+		}
+
+		if !route.matcher.MatchMethod(r) {
+			methodMismatch = true
+			allowedMethods = append(allowedMethods, route.matcher.Methods...)
+			continue
+		}
+
+		route.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if methodMismatch {
+		slices.Sort(allowedMethods)
+		w.Header().Set("Allow", strings.Join(slices.Compact(allowedMethods), ", "))
+		g.writeError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.writeError(w, r, http.StatusNotFound)
+}
+
+func (g *routeGroup) writeError(w http.ResponseWriter, r *http.Request, status int) {
+	if g.onError != nil {
+		g.onError(w, r, status)
+		return
+	}
+
+	w.WriteHeader(status)
+}
@@ -0,0 +1,124 @@
+package multimux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestRouteMatching(t *testing.T) {
+	mm := NewMultiMux()
+
+	respondWith := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		})
+	}
+
+	present, absent := true, false
+	v2 := "2"
+
+	mm.RegisterRoute("example.com", "/orders", &RequestMatcher{Methods: []string{http.MethodPost}}, respondWith("create-order"))
+	mm.RegisterRoute("example.com", "/orders", &RequestMatcher{Methods: []string{http.MethodGet}}, respondWith("list-orders"))
+	mm.RegisterRoute("example.com", "/orders", &RequestMatcher{Methods: []string{http.MethodGet}, Headers: []ValueMatcher{{Name: "X-Api-Version", Exact: &v2}}}, respondWith("list-orders-v2"))
+	mm.RegisterRoute("example.com", "/search", &RequestMatcher{Query: []ValueMatcher{{Name: "q", Regex: regexp.MustCompile(`^[a-z]+$`)}}}, respondWith("search"))
+	mm.RegisterRoute("example.com", "/search", nil, respondWith("search-fallback"))
+	mm.RegisterRoute("example.com", "/beta", &RequestMatcher{Cookies: []ValueMatcher{{Name: "beta", Present: &present}}}, respondWith("beta"))
+	mm.RegisterRoute("example.com", "/beta", &RequestMatcher{Cookies: []ValueMatcher{{Name: "beta", Present: &absent}}}, respondWith("stable"))
+	mm.RegisterRoute("example.com", "/users/{userID}", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "user "+r.PathValue("userID"))
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		header         map[string]string
+		cookie         *http.Cookie
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"method POST", http.MethodPost, "/orders", nil, nil, http.StatusOK, "create-order"},
+		{"method GET", http.MethodGet, "/orders", nil, nil, http.StatusOK, "list-orders"},
+		{"HEAD uses GET route", http.MethodHead, "/orders", nil, nil, http.StatusOK, ""},
+		{"more predicates win", http.MethodGet, "/orders", map[string]string{"X-Api-Version": "2"}, nil, http.StatusOK, "list-orders-v2"},
+		{"method not allowed", http.MethodDelete, "/orders", nil, nil, http.StatusMethodNotAllowed, ""},
+		{"query regex", http.MethodGet, "/search?q=shoes", nil, nil, http.StatusOK, "search"},
+		{"query regex mismatch falls back", http.MethodGet, "/search?q=123", nil, nil, http.StatusOK, "search-fallback"},
+		{"cookie present", http.MethodGet, "/beta", nil, &http.Cookie{Name: "beta", Value: "1"}, http.StatusOK, "beta"},
+		{"cookie absent", http.MethodGet, "/beta", nil, nil, http.StatusOK, "stable"},
+		{"path template", http.MethodGet, "/users/42", nil, nil, http.StatusOK, "user 42"},
+		{"path template extra segment", http.MethodGet, "/users/42/extra", nil, nil, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+
+			mm.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowedHeader(t *testing.T) {
+	mm := NewMultiMux()
+	mm.RegisterRoute("example.com", "/orders", &RequestMatcher{Methods: []string{http.MethodPost}}, http.NotFoundHandler())
+	mm.RegisterRoute("example.com", "/orders", &RequestMatcher{Methods: []string{http.MethodGet, http.MethodPost}}, http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	mm.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "http://example.com/orders", nil))
+
+	if w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("expected Allow header %q, got %q", "GET, POST", w.Header().Get("Allow"))
+	}
+}
+
+func TestRegisterRouteInvalidPattern(t *testing.T) {
+	mm := NewMultiMux()
+
+	if err := mm.RegisterRoute("example.com", "/users/{id", nil, http.NotFoundHandler()); err == nil {
+		t.Error("expected error for invalid path pattern")
+	}
+
+	if err := mm.RegisterRoute("example.com", "/users/{id}", nil, http.NotFoundHandler()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := mm.RegisterRoute("example.com", "/users/{name}", nil, http.NotFoundHandler()); err == nil {
+		t.Error("expected error for conflicting path pattern")
+	}
+}
+
+func TestCleanPattern(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/PATH", "/path"},
+		{"/Users/{userID}", "/users/{userID}"},
+		{"/Files/{Rest...}", "/files/{Rest...}"},
+	}
+
+	for _, tt := range tests {
+		if result := CleanPattern(tt.input); result != tt.expected {
+			t.Errorf("CleanPattern(%q) = %q; want %q", tt.input, result, tt.expected)
+		}
+	}
+}
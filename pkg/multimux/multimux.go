@@ -4,41 +4,205 @@
 package multimux
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"unicode"
 )
 
+// DefaultPattern is the matched pattern of requests served by the default (catch-all) handlers
+const DefaultPattern = "*"
+
+// Define a custom type for context keys to avoid collisions
+type patternKeyType string
+
+var patternKey = patternKeyType("host-pattern")
+
 type MultiMux struct {
-	Hosts sync.Map
+	Hosts     sync.Map // Exact hosts
+	Wildcards sync.Map // Wildcard hosts (*.example.com)
+
+	// ErrorHandler write the errors generated by the multimux (404 and 405),
+	// the request context has the matched host pattern (empty if no host matched).
+	// When nil a response without body is written (http.ServeMux default page for unknown paths).
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, status int)
+
+	defaultRouter *hostRouter
+	hasDefault    atomic.Bool
 }
 
 func NewMultiMux() *MultiMux {
-	return &MultiMux{Hosts: sync.Map{}}
+	mm := &MultiMux{Hosts: sync.Map{}, Wildcards: sync.Map{}}
+	mm.defaultRouter = newHostRouter(mm.writeError)
+	return mm
 }
 
+// RegisterHandler register handler for the host and path pattern.
+// A host of the form *.example.com matches every subdomain of example.com (in any depth).
+// It panics if the pattern is invalid or conflicts with a registered pattern (like http.ServeMux).
 func (mm *MultiMux) RegisterHandler(host string, pattern string, handler http.Handler) {
+	if err := mm.RegisterRoute(host, pattern, nil, handler); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterRoute register handler for the host, path pattern and request matcher.
+// Path patterns use the http.ServeMux syntax (/users/{id}, /files/{path...}), when a request
+// matches more than one route with the same path pattern the route with the most specific matcher wins.
+func (mm *MultiMux) RegisterRoute(host string, pattern string, matcher *RequestMatcher, handler http.Handler) error {
 	cleanedHost := cleanHost(host)
-	muxAny, _ := mm.Hosts.LoadOrStore(cleanedHost, http.NewServeMux())
-	mux := muxAny.(*http.ServeMux)
 
-	cleanedPattern := strings.ToLower(pattern)
+	hosts := &mm.Hosts
+	if isWildcard(cleanedHost) {
+		hosts = &mm.Wildcards
+	}
+
+	routerAny, _ := hosts.LoadOrStore(cleanedHost, newHostRouter(mm.writeError))
+	router := routerAny.(*hostRouter)
+
+	return router.add(pattern, matcher, handler)
+}
+
+// RegisterDefaultHandler register handler for requests that don't match any registered host
+func (mm *MultiMux) RegisterDefaultHandler(pattern string, handler http.Handler) {
+	if err := mm.RegisterDefaultRoute(pattern, nil, handler); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterDefaultRoute is RegisterRoute for requests that don't match any registered host
+func (mm *MultiMux) RegisterDefaultRoute(pattern string, matcher *RequestMatcher, handler http.Handler) error {
+	if err := mm.defaultRouter.add(pattern, matcher, handler); err != nil {
+		return err
+	}
 
-	mux.Handle(cleanedPattern, handler)
+	mm.hasDefault.Store(true)
+	return nil
 }
 
 func (mm *MultiMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	host := r.Host
 	cleanedHost := cleanHost(host)
-	muxAny, exists := mm.Hosts.Load(cleanedHost)
+	router, pattern := mm.match(cleanedHost)
 
-	if !exists {
-		w.WriteHeader(http.StatusNotFound)
+	if router == nil {
+		mm.writeError(w, r, http.StatusNotFound)
+		return
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), patternKey, pattern))
+
+	// http.ServeMux writes its own not found page
+	if mm.ErrorHandler != nil {
+		if _, matchedPattern := router.mux.Handler(r); matchedPattern == "" {
+			mm.writeError(w, r, http.StatusNotFound)
+			return
+		}
+	}
+
+	router.mux.ServeHTTP(w, r)
+}
+
+func (mm *MultiMux) writeError(w http.ResponseWriter, r *http.Request, status int) {
+	if mm.ErrorHandler != nil {
+		mm.ErrorHandler(w, r, status)
 		return
 	}
 
-	mux := muxAny.(*http.ServeMux)
-	mux.ServeHTTP(w, r)
+	w.WriteHeader(status)
+}
+
+// match return the router for the host and its pattern.
+// Exact hosts win over wildcards, and longer wildcards win over shorter ones.
+func (mm *MultiMux) match(host string) (*hostRouter, string) {
+	if routerAny, exists := mm.Hosts.Load(host); exists {
+		return routerAny.(*hostRouter), host
+	}
+
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels); i++ {
+		wildcard := "*." + strings.Join(labels[i:], ".")
+		if routerAny, exists := mm.Wildcards.Load(wildcard); exists {
+			return routerAny.(*hostRouter), wildcard
+		}
+	}
+
+	if mm.hasDefault.Load() {
+		return mm.defaultRouter, DefaultPattern
+	}
+
+	return nil, ""
+}
+
+// hostRouter route requests of a single host by path pattern (http.ServeMux) and then by request matchers
+type hostRouter struct {
+	mu      sync.Mutex
+	mux     *http.ServeMux
+	groups  map[string]*routeGroup
+	onError func(w http.ResponseWriter, r *http.Request, status int)
+}
+
+func newHostRouter(onError func(w http.ResponseWriter, r *http.Request, status int)) *hostRouter {
+	return &hostRouter{mux: http.NewServeMux(), groups: make(map[string]*routeGroup), onError: onError}
+}
+
+func (hr *hostRouter) add(pattern string, matcher *RequestMatcher, handler http.Handler) (err error) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	cleanedPattern := CleanPattern(pattern)
+
+	group, exists := hr.groups[cleanedPattern]
+	if !exists {
+		group = &routeGroup{onError: hr.onError}
+
+		// http.ServeMux panics on invalid and conflicting patterns
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("invalid path pattern '%s': %v", pattern, recovered)
+			}
+		}()
+		hr.mux.Handle(cleanedPattern, group)
+
+		hr.groups[cleanedPattern] = group
+	}
+
+	group.add(matcher, handler)
+	return nil
+}
+
+// CleanPattern lower case the literal parts of a path pattern (wildcard names keep their case)
+func CleanPattern(pattern string) string {
+	var cleaned strings.Builder
+	inWildcard := false
+
+	for _, char := range pattern {
+		switch {
+		case char == '{':
+			inWildcard = true
+		case char == '}':
+			inWildcard = false
+		case !inWildcard:
+			char = unicode.ToLower(char)
+		}
+		cleaned.WriteRune(char)
+	}
+
+	return cleaned.String()
+}
+
+// MatchedPattern return the host pattern that matched the request
+// (the host itself, a wildcard or DefaultPattern) or empty string if not served by a MultiMux
+func MatchedPattern(ctx context.Context) string {
+	pattern, _ := ctx.Value(patternKey).(string)
+	return pattern
+}
+
+func isWildcard(host string) bool {
+	return strings.HasPrefix(host, "*.")
 }
 
 func cleanHost(domain string) string {
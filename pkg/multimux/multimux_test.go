@@ -100,6 +100,106 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+func TestWildcardAndDefaultHosts(t *testing.T) {
+	mm := NewMultiMux()
+
+	respondWith := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s|%s", name, MatchedPattern(r.Context()))
+		})
+	}
+
+	mm.RegisterHandler("api.example.com", "/", respondWith("exact"))
+	mm.RegisterHandler("*.example.com", "/", respondWith("wildcard"))
+	mm.RegisterHandler("*.eu.example.com", "/", respondWith("eu-wildcard"))
+
+	tests := []struct {
+		name           string
+		host           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"exact wins over wildcard", "api.example.com", http.StatusOK, "exact|api.example.com"},
+		{"wildcard subdomain", "tenant1.example.com:8080", http.StatusOK, "wildcard|*.example.com"},
+		{"wildcard deep subdomain", "a.b.example.com", http.StatusOK, "wildcard|*.example.com"},
+		{"most specific wildcard wins", "tenant1.eu.example.com", http.StatusOK, "eu-wildcard|*.eu.example.com"},
+		{"wildcard does not match apex", "example.com", http.StatusNotFound, ""},
+		{"unknown host without default", "unknown.org", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://"+tt.host+"/", nil)
+			w := httptest.NewRecorder()
+
+			mm.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	// Unmatched hosts are served by the default handlers once registered
+	mm.RegisterDefaultHandler("/", respondWith("default"))
+
+	req := httptest.NewRequest("GET", "http://unknown.org/", nil)
+	w := httptest.NewRecorder()
+	mm.ServeHTTP(w, req)
+
+	if w.Body.String() != "default|"+DefaultPattern {
+		t.Errorf("expected default handler, got %q", w.Body.String())
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	mm := NewMultiMux()
+	mm.ErrorHandler = func(w http.ResponseWriter, r *http.Request, status int) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "error %d|%s", status, MatchedPattern(r.Context()))
+	}
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mm.RegisterHandler("example.com", "/api/", okHandler)
+	if err := mm.RegisterRoute("example.com", "/users", &RequestMatcher{Methods: []string{"POST"}}, okHandler); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"registered route", "GET", "http://example.com/api/items", http.StatusOK, ""},
+		{"unknown host", "GET", "http://unknown.org/", http.StatusNotFound, "error 404|"},
+		{"unknown path", "GET", "http://example.com/other", http.StatusNotFound, "error 404|example.com"},
+		{"method not allowed", "GET", "http://example.com/users", http.StatusMethodNotAllowed, "error 405|example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			w := httptest.NewRecorder()
+
+			mm.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
 func TestCleanHost(t *testing.T) {
 	tests := []struct {
 		input    string
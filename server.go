@@ -2,24 +2,103 @@ package gatego
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"reflect"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hvuhsg/gatego/internal/circuitbreaker"
 	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/hvuhsg/gatego/internal/discovery"
+	"github.com/hvuhsg/gatego/internal/drain"
+	"github.com/hvuhsg/gatego/internal/handlers"
+	"github.com/hvuhsg/gatego/internal/health"
+	"github.com/hvuhsg/gatego/internal/streams"
 	"github.com/hvuhsg/gatego/pkg/multimux"
+	"github.com/quic-go/quic-go/http3"
 )
 
 type gategoServer struct {
 	*http.Server
+	http3Server *http3.Server // nil when HTTP/3 is disabled
+	adminServer *http.Server  // nil when the admin api is disabled
+	streams     []*streams.Proxy
+	routes      *routes
+	checks      *checksRunner
+
+	ctx         context.Context
+	useOtel     bool
+	config      config.Config     // The config of the listeners, tls, streams, admin api and otel (change on restart only)
+	checksDelay time.Duration     // Before the checks of the routes start
+	registries  handlers.Instance // The registries of the backends state, kept across reloads
+}
+
+// Before the checks start running
+const defaultChecksDelay = time.Second * 5
+
+// routes serve the requests by the routes of the services, the routes are replaced on config reloads
+type routes struct {
+	mu      sync.Mutex // Serialize the replacements
+	current atomic.Pointer[multimux.MultiMux]
+	cancel  context.CancelFunc // Stop the background work of the current handlers (service discovery, mirrors)
+}
+
+func (r *routes) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.current.Load().ServeHTTP(w, req)
+}
+
+// replace serve the new routes and stop the background work of the previous handlers, their in-flight requests complete
+func (r *routes) replace(multimuxer *multimux.MultiMux, cancel context.CancelFunc) {
+	r.mu.Lock()
+	previousCancel := r.cancel
+	r.current.Store(multimuxer)
+	r.cancel = cancel
+	r.mu.Unlock()
+
+	if previousCancel != nil {
+		previousCancel()
+	}
 }
 
 func newServer(ctx context.Context, config config.Config, useOtel bool) (*gategoServer, error) {
-	multimuxer, err := createMultiMuxer(ctx, config.Services, useOtel)
+	registries := handlers.Instance{
+		Health:   health.NewRegistry(),
+		Breakers: circuitbreaker.NewRegistry(),
+		Drain:    drain.NewRegistry(),
+		Pools:    handlers.NewPools(),
+		Rollouts: handlers.NewRollouts(),
+		Sources:  discovery.NewShared(),
+	}
+	instance := newInstance(config, registries)
+
+	routesCtx, cancel := context.WithCancel(ctx)
+	multimuxer, err := createMultiMuxer(routesCtx, config.Services, config.ErrorPages, instance, useOtel)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	checks := &checksRunner{}
+	if err := checks.run(defaultChecksDelay, createMonitorChecks(config.Services, config.Streams, instance.Health)); err != nil {
+		cancel()
+		return nil, err
+	}
+	context.AfterFunc(ctx, checks.stop)
+
+	serverRoutes := &routes{}
+	serverRoutes.replace(multimuxer, cancel)
+
+	streamProxies, err := createStreams(ctx, config.Streams, instance)
 	if err != nil {
+		cancel()
+		checks.stop()
 		return nil, err
 	}
 
@@ -31,36 +110,233 @@ func newServer(ctx context.Context, config config.Config, useOtel bool) (*gatego
 		BaseContext:  func(_ net.Listener) context.Context { return ctx },
 		ReadTimeout:  time.Second,
 		WriteTimeout: 10 * time.Second,
-		Handler:      multimuxer,
+		Handler:      serverRoutes,
+	}
+
+	var adminServer *http.Server
+	if config.Admin != nil {
+		adminServer = &http.Server{
+			Addr:         config.Admin.Listen,
+			ReadTimeout:  time.Second,
+			WriteTimeout: 10 * time.Second,
+			Handler:      newAdminHandler(registries.Health, registries.Breakers, registries.Drain),
+		}
+	}
+
+	gs := &gategoServer{Server: server, adminServer: adminServer, streams: streamProxies, routes: serverRoutes, checks: checks, ctx: ctx, useOtel: useOtel, config: config, checksDelay: defaultChecksDelay, registries: registries}
+	if !config.TLS.HTTP3 {
+		return gs, nil
+	}
+
+	// The QUIC listener shares the address (over UDP) and the routing with the TLS listener
+	gs.http3Server = &http3.Server{
+		Addr:    addr,
+		Handler: serverRoutes,
+	}
+	server.Handler = newAltSvcHandler(gs.http3Server, serverRoutes)
+
+	return gs, nil
+}
+
+// reload replace the routes and their checks by the services, error pages and zone of the config. The listeners, tls,
+// streams, admin api and otel change on restart only, their changes are logged and ignored
+func (gs *gategoServer) reload(config config.Config) error {
+	instance := newInstance(config, gs.registries)
+
+	ctx, cancel := context.WithCancel(gs.ctx)
+	multimuxer, err := createMultiMuxer(ctx, config.Services, config.ErrorPages, instance, gs.useOtel)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	// The checks of the streams are kept, the streams are not reloaded
+	if err := gs.checks.run(gs.checksDelay, createMonitorChecks(config.Services, gs.config.Streams, instance.Health)); err != nil {
+		cancel()
+		return err
+	}
+
+	for _, field := range restartOnlyChanges(gs.config, config) {
+		log.Default().Printf("Config reload ignores the %s change, it applies on restart\n", field)
+	}
+
+	gs.routes.replace(multimuxer, cancel)
+
+	// The state of the removed backends is dropped
+	backends := backendNames(config.Services, gs.config.Streams)
+	gs.registries.Health.Prune(backends)
+	gs.registries.Breakers.Prune(backends)
+	gs.registries.Drain.Prune(backends)
+
+	return nil
+}
+
+// restartOnlyChanges return the config fields that changed and can't be reloaded
+func restartOnlyChanges(current config.Config, next config.Config) []string {
+	changes := []struct {
+		field   string
+		changed bool
+	}{
+		{field: "host", changed: current.Host != next.Host},
+		{field: "port", changed: current.Port != next.Port},
+		{field: "ssl", changed: !reflect.DeepEqual(current.TLS, next.TLS)},
+		{field: "streams", changed: !reflect.DeepEqual(current.Streams, next.Streams)},
+		{field: "admin", changed: !reflect.DeepEqual(current.Admin, next.Admin)},
+		{field: "open_telemetry", changed: !reflect.DeepEqual(current.OTEL, next.OTEL)},
+	}
+
+	fields := []string{}
+	for _, change := range changes {
+		if change.changed {
+			fields = append(fields, change.field)
+		}
 	}
 
-	return &gategoServer{Server: server}, nil
+	return fields
 }
 
-func createMultiMuxer(ctx context.Context, services []config.Service, useOtel bool) (*multimux.MultiMux, error) {
+// newAltSvcHandler advertise the HTTP/3 listener on HTTP/1.1 and HTTP/2 responses
+func newAltSvcHandler(http3Server *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fails only before the QUIC listener is up, in that case there is nothing to advertise
+		_ = http3Server.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newInstance return the config of the instance used by the backends with the registries of the server
+func newInstance(c config.Config, registries handlers.Instance) handlers.Instance {
+	instance := registries
+	instance.Zone = c.Zone
+	instance.Agents = discovery.Agents{Consul: c.Consul, Kubernetes: c.Kubernetes, Docker: c.Docker}
+
+	return instance
+}
+
+func createMultiMuxer(ctx context.Context, services []config.Service, errorPages *config.ErrorPages, instance handlers.Instance, useOtel bool) (*multimux.MultiMux, error) {
 	mm := multimux.NewMultiMux()
 
+	errorHandler, err := newMultiMuxErrorHandler(services, errorPages)
+	if err != nil {
+		return nil, err
+	}
+	mm.ErrorHandler = errorHandler
+
 	for _, service := range services {
 		for _, path := range service.Paths {
-			handler, err := NewHandler(ctx, useOtel, service, path)
+			errorRenderer, err := newErrorRenderer(errorPages, service.ErrorPages, path.ErrorPages)
+			if err != nil {
+				return nil, err
+			}
+
+			handler, err := NewHandler(ctx, useOtel, service, path, instance, errorRenderer)
 			if err != nil {
 				return nil, err
 			}
 
-			mm.RegisterHandler(service.Domain, path.Path, handler)
+			matcher := newRequestMatcher(path.Match)
+
+			if err := mm.RegisterRoute(service.Domain, path.Path, matcher, handler); err != nil {
+				return nil, err
+			}
+
+			if service.Default {
+				if err := mm.RegisterDefaultRoute(path.Path, matcher, handler); err != nil {
+					return nil, err
+				}
+			}
 		}
 	}
 
 	return mm, nil
 }
 
+// newRequestMatcher convert the endpoint match block (validated already) to a multimux matcher
+func newRequestMatcher(match *config.Match) *multimux.RequestMatcher {
+	if match == nil {
+		return nil
+	}
+
+	return &multimux.RequestMatcher{
+		Methods: match.Methods,
+		Headers: newValueMatchers(match.Headers),
+		Query:   newValueMatchers(match.Query),
+		Cookies: newValueMatchers(match.Cookies),
+	}
+}
+
+func newValueMatchers(rules []config.MatchRule) []multimux.ValueMatcher {
+	matchers := make([]multimux.ValueMatcher, 0, len(rules))
+
+	for _, rule := range rules {
+		matcher := multimux.ValueMatcher{Name: rule.Name, Exact: rule.Exact, Present: rule.Present}
+		if rule.Regex != nil {
+			matcher.Regex = regexp.MustCompile(*rule.Regex)
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers
+}
+
+func createStreams(ctx context.Context, streamsConfig []config.Stream, instance handlers.Instance) ([]*streams.Proxy, error) {
+	streamProxies := make([]*streams.Proxy, 0, len(streamsConfig))
+
+	for _, stream := range streamsConfig {
+		streamProxy, err := streams.New(ctx, stream, instance, os.Stdout)
+		if err != nil {
+			return nil, err
+		}
+
+		streamProxies = append(streamProxies, streamProxy)
+	}
+
+	return streamProxies, nil
+}
+
 func (gs *gategoServer) serve(certfile *string, keyfile *string) (chan error, error) {
 	supportTLS, err := checkTLSConfig(certfile, keyfile)
 	if err != nil {
 		return nil, err
 	}
 
-	serveErr := make(chan error, 1)
+	if gs.http3Server != nil && !supportTLS {
+		return nil, errors.New("http3 requires tls certfile and keyfile")
+	}
+
+	serveErr := make(chan error, 3+len(gs.streams))
+
+	for i, stream := range gs.streams {
+		if err := stream.Listen(); err != nil {
+			// The streams are served only when all of them listen
+			for _, listening := range gs.streams[:i] {
+				listening.Close()
+			}
+			return nil, err
+		}
+	}
+
+	for _, stream := range gs.streams {
+		go func(stream *streams.Proxy) {
+			log.Default().Printf("Serving stream %s %s\n", stream.Name(), stream.Addr())
+			serveErr <- stream.Serve()
+		}(stream)
+	}
+
+	if gs.adminServer != nil {
+		go func() {
+			log.Default().Printf("Serving admin api %s\n", gs.adminServer.Addr)
+			serveErr <- gs.adminServer.ListenAndServe()
+		}()
+	}
+
+	if gs.http3Server != nil {
+		go func() {
+			log.Default().Printf("Serving proxy with HTTP/3 (QUIC) %s\n", gs.http3Server.Addr)
+			serveErr <- gs.http3Server.ListenAndServeTLS(*certfile, *keyfile)
+		}()
+	}
 
 	go func() {
 		if supportTLS {
@@ -75,6 +351,24 @@ func (gs *gategoServer) serve(certfile *string, keyfile *string) (chan error, er
 	return serveErr, nil
 }
 
+func (gs *gategoServer) Shutdown(ctx context.Context) error {
+	err := gs.Server.Shutdown(ctx)
+
+	if gs.http3Server != nil {
+		err = errors.Join(err, gs.http3Server.Shutdown(ctx))
+	}
+
+	if gs.adminServer != nil {
+		err = errors.Join(err, gs.adminServer.Shutdown(ctx))
+	}
+
+	for _, stream := range gs.streams {
+		err = errors.Join(err, stream.Close())
+	}
+
+	return err
+}
+
 func checkTLSConfig(certfile *string, keyfile *string) (bool, error) {
 	if keyfile == nil || certfile == nil || *keyfile == "" || *certfile == "" {
 		return false, nil
@@ -0,0 +1,224 @@
+package gatego
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hvuhsg/gatego/internal/config"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3Listener(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from upstream")
+	}))
+	defer upstream.Close()
+
+	certfile, keyfile := writeSelfSignedCert(t)
+	port := freeTCPAndUDPPort(t)
+
+	cfg := config.Config{
+		Host: "127.0.0.1",
+		Port: port,
+		TLS:  config.TLS{CertFile: &certfile, KeyFile: &keyfile, HTTP3: true},
+		Services: []config.Service{
+			{Domain: "localhost", Paths: []config.Path{{Path: "/", Destination: &upstream.URL}}},
+		},
+	}
+
+	server, err := newServer(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Shutdown(context.Background())
+
+	serveErr, err := server.serve(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		t.Fatalf("Failed to serve: %v", err)
+	}
+
+	url := fmt.Sprintf("https://localhost:%d/", port)
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	// HTTP/1.1 or HTTP/2 over TCP should advertise the QUIC listener
+	tcpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 5 * time.Second}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = tcpClient.Get(url)
+		if err == nil && resp.Header.Get("Alt-Svc") != "" {
+			break
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("TCP request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	expectedAltSvc := fmt.Sprintf(`h3=":%d"`, port)
+	if !strings.Contains(resp.Header.Get("Alt-Svc"), expectedAltSvc) {
+		t.Errorf("Expected Alt-Svc to contain %s, got %q", expectedAltSvc, resp.Header.Get("Alt-Svc"))
+	}
+
+	// HTTP/3 over loopback UDP should reach the same routing
+	transport := &http3.RoundTripper{TLSClientConfig: tlsConfig}
+	defer transport.Close()
+	quicClient := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	resp, err = quicClient.Get(url)
+	if err != nil {
+		t.Fatalf("HTTP/3 request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 3 {
+		t.Errorf("Expected HTTP/3 response, got %s", resp.Proto)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello from upstream" {
+		t.Errorf("Expected upstream body, got %q", string(body))
+	}
+
+	select {
+	case err := <-serveErr:
+		t.Fatalf("Server stopped unexpectedly: %v", err)
+	default:
+	}
+}
+
+func TestHTTP3RequiresTLS(t *testing.T) {
+	cfg := config.Config{Host: "127.0.0.1", Port: 8443, TLS: config.TLS{HTTP3: true}}
+
+	server, err := newServer(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	if _, err := server.serve(nil, nil); err == nil {
+		t.Error("Expected error when serving HTTP/3 without certificates")
+	}
+}
+
+func TestServeClosesListeningStreams(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer taken.Close()
+
+	backend := &config.Backend{BalancePolicy: "round-robin", Servers: []config.BackendServer{{URL: "tcp://127.0.0.1:1", Weight: 1}}}
+	cfg := config.Config{
+		Host: "127.0.0.1",
+		Port: 8080,
+		Streams: []config.Stream{
+			{Name: "first", Listen: "127.0.0.1:0", Backend: backend},
+			{Name: "taken", Listen: taken.Addr().String(), Backend: backend},
+		},
+	}
+
+	server, err := newServer(context.Background(), cfg, false)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	if _, err := server.serve(nil, nil); err == nil {
+		t.Fatal("Expected an error for a stream on a taken address")
+	}
+
+	// The address of the first stream is free again
+	listener, err := net.Listen("tcp", server.streams[0].Addr().String())
+	if err != nil {
+		t.Fatalf("Expected the listening stream to be closed: %v", err)
+	}
+	listener.Close()
+}
+
+// Helper function to find a port that is free on both TCP and UDP loopback
+func freeTCPAndUDPPort(t *testing.T) uint16 {
+	t.Helper()
+
+	for i := 0; i < 20; i++ {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := tcpListener.Addr().(*net.TCPAddr).Port
+
+		udpConn, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+		tcpListener.Close()
+		if err != nil {
+			continue
+		}
+		udpConn.Close()
+
+		return uint16(port)
+	}
+
+	t.Fatal("no free port found")
+	return 0
+}
+
+// Helper function to write a self signed certificate for localhost
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certfile := filepath.Join(dir, "cert.pem")
+	keyfile := filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certfile, keyfile
+}